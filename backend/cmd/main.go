@@ -1,19 +1,33 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 
 	"github.com/joho/godotenv"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
 	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oauth"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oidc"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
 	"github.com/mikeytheong/swearjar/backend/pkg/database/mongodb"
+	"github.com/mikeytheong/swearjar/backend/pkg/digest"
 	"github.com/mikeytheong/swearjar/backend/pkg/email"
-	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/amazonses"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers"
+	"github.com/mikeytheong/swearjar/backend/pkg/export"
 	"github.com/mikeytheong/swearjar/backend/pkg/http/rest"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/discord"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/slack"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/telegram"
+	"github.com/mikeytheong/swearjar/backend/pkg/notification"
+	"github.com/mikeytheong/swearjar/backend/pkg/pubsub"
 	"github.com/mikeytheong/swearjar/backend/pkg/search"
 	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+	"github.com/mikeytheong/swearjar/backend/pkg/webhook"
 )
 
 func main() {
@@ -32,15 +46,117 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
-	p := amazonses.NewClient() // Email Service Provider Client
-	e := email.NewService(p)
+	p, stopEmailProvider, err := providers.LoadProviderFromEnv() // Email Service Provider
+	if err != nil {
+		log.Fatalf("Error loading email provider: %v", err)
+	}
+	defer stopEmailProvider()
 	r := mongodb.NewMongoRepository()
+	templates, err := email.DefaultTemplates(email.PreviewConfig{DownloadLinkDuration: export.DownloadLinkDuration})
+	if err != nil {
+		log.Fatalf("Error loading email templates: %v", err)
+	}
+	e := email.NewService(p, templates, r)
+	stopEmailWorker := e.Start()
+	defer stopEmailWorker()
+
+	keyring, err := authentication.NewKeyring(context.Background(), r)
+	if err != nil {
+		log.Fatalf("Error loading JWT keyring: %v", err)
+	}
+	stopKeyRotation := keyring.StartRotation()
+	defer stopKeyRotation()
+
+	passwordPolicy, err := authentication.LoadPasswordPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading password policy: %v", err)
+	}
 
-	authService := authentication.NewService(r, e)
-	swearService := swearJar.NewService(r)
+	relyingParty, err := webauthn.LoadRelyingPartyFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading WebAuthn relying party: %v", err)
+	}
+
+	auditService := audit.NewService(r)
+
+	authService := authentication.NewService(r, e, keyring, passwordPolicy, auditService, relyingParty)
+	stopAccountCleanup := authService.StartUnverifiedAccountCleanup()
+	defer stopAccountCleanup()
+	webhookClient, err := webhook.LoadClientFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading webhook client: %v", err)
+	}
+	webhookService := webhook.NewService(r, webhookClient, auditService)
+	stopWebhookWorker := webhookService.Start()
+	defer stopWebhookWorker()
+
+	notificationService := notification.NewService(r, e, webhookClient, auditService)
+
+	swearService := swearJar.NewService(r, auditService, pubsub.NewInProcessBroker(pubsub.DefaultBufferSize), webhookService, notificationService)
 	searchService := search.NewService(r)
 
-	handler := rest.NewHandler(authService, swearService, searchService) // Initialize the handler with the services
+	oidcProviders, err := oidc.LoadProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading OIDC providers: %v", err)
+	}
+
+	oauthService := oauth.NewService(r, keyring, auditService)
+
+	exportService := export.NewService(r, e, auditService)
+	stopExportWorker := exportService.Start()
+	defer stopExportWorker()
+
+	digestConfig, err := digest.LoadConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading digest config: %v", err)
+	}
+	digestService := digest.NewService(r, swearService, e, digestConfig)
+	stopDigestScheduler := digestService.Start()
+	defer stopDigestScheduler()
+
+	integrationService := integration.NewService(r, auditService)
+
+	slackConfig, err := slack.LoadConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading Slack config: %v", err)
+	}
+	var slackService slack.Service
+	if slackConfig != nil {
+		slackClient := slack.NewAPIClient(slackConfig.APIURL, slackConfig.BotToken)
+		slackService = slack.NewService(*slackConfig, slackClient, integrationService, swearService, r)
+	}
+
+	discordConfig, err := discord.LoadConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading Discord config: %v", err)
+	}
+	var discordService discord.Service
+	if discordConfig != nil {
+		discordService = discord.NewService(*discordConfig, integrationService, swearService)
+		if discordConfig.BotToken != "" {
+			discordClient := discord.NewAPIClient(discordConfig.APIURL, discordConfig.BotToken)
+			if err := discordClient.RegisterCommands(context.Background(), discordConfig.ApplicationId, discord.Commands); err != nil {
+				log.Printf("Error registering Discord commands: %v", err)
+			}
+		}
+	}
+
+	telegramConfig, err := telegram.LoadConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading Telegram config: %v", err)
+	}
+	var telegramService telegram.Service
+	if telegramConfig != nil {
+		telegramClient := telegram.NewAPIClient(telegramConfig.APIURL, telegramConfig.BotToken)
+		telegramService = telegram.NewService(*telegramConfig, telegramClient, integrationService, swearService)
+		if telegramConfig.WebhookURL != "" {
+			if err := telegramClient.SetWebhook(context.Background(), telegramConfig.WebhookURL, telegramConfig.SecretToken); err != nil {
+				log.Printf("Error registering Telegram webhook: %v", err)
+			}
+		}
+	}
+
+	handler := rest.NewHandler(authService, e, swearService, searchService, oidcProviders, oauthService, exportService, auditService, webhookService, digestService, notificationService, integrationService, slackService, discordService, telegramService) // Initialize the handler with the services
 	mux := handler.RegisterRoutes()
 
 	// Paths to your certificate and key files
@@ -0,0 +1,119 @@
+package apperror
+
+import (
+	"errors"
+	"time"
+)
+
+// Kind is the category of a domain error, which the transport maps to a status code
+type Kind string
+
+const (
+	KindInternal     Kind = "internal"
+	KindValidation   Kind = "validation"
+	KindUnauthorized Kind = "unauthorized"
+	KindForbidden    Kind = "forbidden"
+	KindNotFound     Kind = "not_found"
+	KindConflict     Kind = "conflict"
+	KindGone         Kind = "gone"
+	KindRateLimited  Kind = "rate_limited"
+)
+
+// Error is an error returned by a service. Code and Message are stable and safe to show to the client,
+// the wrapped Err is only logged.
+type Error struct {
+	Kind    Kind
+	Code    string // machine readable, e.g. "swear_jar_not_found"
+	Message string
+	// Fields maps the invalid fields of the request to what is wrong with them, only set for validation errors
+	Fields map[string]string
+	// RetryAfter is how long the client should wait before retrying, only set for rate limited errors
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors of the same kind and code, so a sentinel matches a copy of it with details such as
+// RetryAfter or a cause added
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+// WithCause returns a copy of the error wrapping err, to keep the cause in the logs
+func (e *Error) WithCause(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithRetryAfter returns a copy of the error telling the client how long to wait before retrying
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	c := *e
+	c.RetryAfter = d
+	return &c
+}
+
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func Validation(code string, message string, fields map[string]string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message, Fields: fields}
+}
+
+// InvalidField is a validation error of a single field of the request
+func InvalidField(field string, message string) *Error {
+	return Validation("invalid_"+field, message, map[string]string{field: message})
+}
+
+func Unauthorized(code string, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+func Forbidden(code string, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+func NotFound(code string, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+func Conflict(code string, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Gone(code string, message string) *Error {
+	return New(KindGone, code, message)
+}
+
+func RateLimited(code string, message string, retryAfter time.Duration) *Error {
+	return &Error{Kind: KindRateLimited, Code: code, Message: message, RetryAfter: retryAfter}
+}
+
+// As returns the domain error in the chain of err, if there is one
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// KindOf returns the kind of the domain error in the chain of err, or KindInternal for any other error
+func KindOf(err error) Kind {
+	if e, ok := As(err); ok {
+		return e.Kind
+	}
+	return KindInternal
+}
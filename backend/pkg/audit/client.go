@@ -0,0 +1,21 @@
+package audit
+
+import "context"
+
+// Client describes where a request came from
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type clientContextKey struct{}
+
+// WithClient returns a copy of ctx carrying the client, which is recorded with the events logged for the request
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, c)
+}
+
+func ClientFromContext(ctx context.Context) Client {
+	c, _ := ctx.Value(clientContextKey{}).(Client)
+	return c
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"errors"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionSignUp                  Action = "user.signup"
+	ActionLogin                   Action = "user.login"
+	ActionLoginFailed             Action = "user.login_failed"
+	ActionMagicLoginRequested     Action = "user.magic_login_requested"
+	ActionPasswordResetRequested  Action = "user.password_reset_requested"
+	ActionPasswordReset           Action = "user.password_reset"
+	ActionPasswordChanged         Action = "user.password_changed"
+	ActionEmailVerified           Action = "user.email_verified"
+	ActionVerificationEmailResent Action = "user.verification_email_resent"
+	ActionEmailChangeRequested    Action = "user.email_change_requested"
+	ActionEmailChanged            Action = "user.email_changed"
+	ActionProfileUpdated          Action = "user.profile_updated"
+	ActionAccountDeleted          Action = "user.account_deleted"
+	ActionExternalIdentityLinked  Action = "user.external_identity_linked"
+	ActionPasskeyRegistered       Action = "user.passkey_registered"
+	ActionPasskeyDeleted          Action = "user.passkey_deleted"
+	ActionSecondFactorEnabled     Action = "user.second_factor_enabled"
+	ActionSecondFactorDisabled    Action = "user.second_factor_disabled"
+	ActionAPITokenCreated         Action = "api_token.created"
+	ActionAPITokenRevoked         Action = "api_token.revoked"
+	ActionOAuthClientRegistered   Action = "oauth_client.registered"
+	ActionOAuthClientDeleted      Action = "oauth_client.deleted"
+	ActionOAuthConsentGranted     Action = "oauth.consent_granted"
+	ActionOAuthConsentDenied      Action = "oauth.consent_denied"
+	ActionOAuthTokenIssued        Action = "oauth.token_issued"
+	ActionDataExportRequested     Action = "data_export.requested"
+	ActionDataExportDownloaded    Action = "data_export.downloaded"
+	ActionSwearJarCreated         Action = "swear_jar.created"
+	ActionSwearJarUpdated         Action = "swear_jar.updated"
+	ActionSwearJarOwnerAdded      Action = "swear_jar.owner_added"
+	ActionSwearJarOwnerRemoved    Action = "swear_jar.owner_removed"
+	ActionSwearJarCleared         Action = "swear_jar.cleared"
+	ActionSwearAdded              Action = "swear.added"
+	ActionWebhookCreated          Action = "webhook.created"
+	ActionWebhookDeleted          Action = "webhook.deleted"
+	ActionWebhookRedelivered      Action = "webhook.redelivered"
+	ActionIntegrationLinked       Action = "integration.linked"
+	ActionIntegrationUnlinked     Action = "integration.unlinked"
+	ActionChatAccountLinked       Action = "integration.account_linked"
+	ActionChatAccountUnlinked     Action = "integration.account_unlinked"
+	ActionNotifyWebhookSet        Action = "notification.webhook_set"
+	ActionNotifyWebhookDeleted    Action = "notification.webhook_deleted"
+)
+
+type TargetType string
+
+const (
+	TargetUser        TargetType = "user"
+	TargetAPIToken    TargetType = "api_token"
+	TargetOAuthClient TargetType = "oauth_client"
+	TargetDataExport  TargetType = "data_export"
+	TargetSwearJar    TargetType = "swear_jar"
+	TargetWebhook     TargetType = "webhook"
+	TargetChannelLink TargetType = "channel_link"
+	TargetAccountLink TargetType = "account_link"
+)
+
+// Event is an append-only record of a security relevant action
+type Event struct {
+	EventId    string            `bson:"_id,omitempty"`
+	Timestamp  time.Time         `bson:"Timestamp"`
+	ActorId    string            `bson:"ActorId"` // Empty if the actor is not authenticated, e.g. for failed logins
+	Action     Action            `bson:"Action"`
+	TargetType TargetType        `bson:"TargetType"`
+	TargetId   string            `bson:"TargetId"`
+	SwearJarId string            `bson:"SwearJarId,omitempty"` // Set for swear jar activity, which is visible to all its owners
+	IP         string            `bson:"IP"`
+	UserAgent  string            `bson:"UserAgent"`
+	Details    map[string]string `bson:"Details,omitempty"`
+}
+
+func (e *Event) Validate() error {
+	if e.Action == "" {
+		return errors.New("action is required")
+	}
+	if e.TargetType == "" {
+		return errors.New("target type is required")
+	}
+	if e.Timestamp.IsZero() {
+		return errors.New("timestamp is required")
+	}
+	return nil
+}
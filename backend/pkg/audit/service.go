@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+
+	storeTimeout = 10 * time.Second
+)
+
+// Logger records audit events. Services write to it for every security relevant action.
+type Logger interface {
+	Log(ctx context.Context, e Event)
+}
+
+type Service interface {
+	Logger
+	GetUserEvents(ctx context.Context, userId string, before time.Time, limit int) ([]Event, error)
+	GetSwearJarEvents(ctx context.Context, swearJarId string, before time.Time, limit int) ([]Event, error)
+}
+
+// Repository only allows events to be appended and read, never changed or deleted
+type Repository interface {
+	CreateAuditEvent(ctx context.Context, e Event) error
+	GetAuditEventsByUserId(ctx context.Context, userId string, before time.Time, limit int) ([]Event, error)
+	GetAuditEventsBySwearJarId(ctx context.Context, swearJarId string, before time.Time, limit int) ([]Event, error)
+}
+
+type service struct {
+	r Repository
+}
+
+func NewService(r Repository) Service {
+	return &service{r}
+}
+
+// Log stores the event with the client of the request in ctx. Failing to store an event must not fail the
+// action being audited, so errors are only logged. The event is stored even if the request was cancelled after
+// the action completed.
+func (s *service) Log(ctx context.Context, e Event) {
+	client := ClientFromContext(ctx)
+	e.EventId = ""
+	e.Timestamp = time.Now().UTC()
+	e.IP = client.IP
+	e.UserAgent = client.UserAgent
+
+	if err := e.Validate(); err != nil {
+		log.Printf("AuditService: Invalid audit event %s: %v", e.Action, err)
+		return
+	}
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+	if err := s.r.CreateAuditEvent(storeCtx, e); err != nil {
+		log.Printf("AuditService: Error storing audit event %s for actor {%s}: %v", e.Action, e.ActorId, err)
+	}
+}
+
+// GetUserEvents returns the events the user performed or which targeted their account, newest first.
+// Pass the timestamp of the last event of a page as before to fetch the next page.
+func (s *service) GetUserEvents(ctx context.Context, userId string, before time.Time, limit int) ([]Event, error) {
+	return s.r.GetAuditEventsByUserId(ctx, userId, before, pageSize(limit))
+}
+
+// GetSwearJarEvents returns the activity in the swear jar, newest first. Callers must check that the user is an owner.
+func (s *service) GetSwearJarEvents(ctx context.Context, swearJarId string, before time.Time, limit int) ([]Event, error) {
+	return s.r.GetAuditEventsBySwearJarId(ctx, swearJarId, before, pageSize(limit))
+}
+
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
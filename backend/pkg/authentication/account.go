@@ -0,0 +1,255 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RecentLoginDuration is how long after logging in a user without a password can make sensitive changes to their
+// account without confirming it's them again
+const RecentLoginDuration = 5 * time.Minute
+
+var ErrReauthenticationRequired = apperror.Forbidden("reauthentication_required", "confirm it's you with a passkey or log in again")
+
+// Reauthentication confirms it's the user before a sensitive change to their account. Accounts with a password
+// confirm the password. Accounts without one sign a challenge from BeginReauthentication with a passkey, unless
+// the session was logged in to within RecentLoginDuration, e.g. by magic link or OIDC.
+type Reauthentication struct {
+	Password string
+	Passkey  *webauthn.AuthenticationResponse
+}
+
+// reauthenticate checks the reauthentication of the stored user, see Reauthentication
+func (s *service) reauthenticate(ctx context.Context, storedUser User, reauth Reauthentication) error {
+	switch {
+	case storedUser.Password != "":
+		return checkPassword(storedUser.Password, reauth.Password)
+	case reauth.Passkey != nil:
+		return s.verifyPasskeyAssertion(ctx, storedUser, *reauth.Passkey, PurposeReauthentication, true)
+	}
+
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok || principal.AuthMethod != AuthMethodSession || principal.UserId != storedUser.UserId ||
+		principal.AuthTime.IsZero() || time.Since(principal.AuthTime) > RecentLoginDuration {
+		return ErrReauthenticationRequired
+	}
+	return nil
+}
+
+// getUserWithPassword returns the stored user, including the password hash, for the given user id
+func (s *service) getUserWithPassword(ctx context.Context, userId string) (User, error) {
+	ur, err := s.r.GetUserById(ctx, userId)
+	if err != nil {
+		return User{}, err
+	}
+	return s.r.GetUserByEmail(ctx, ur.Email)
+}
+
+// checkPassword compares the password against the stored hash, returning ErrIncorrectPassword on a mismatch
+func checkPassword(hashedPassword string, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrIncorrectPassword
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *service) ChangePassword(ctx context.Context, userId string, currentPassword string, newPassword string) error {
+	storedUser, err := s.getUserWithPassword(ctx, userId)
+	if err != nil {
+		log.Printf("AuthService: Error fetching user {%s}: %v", userId, err)
+		return err
+	}
+
+	// Users created through an external identity provider set their first password through forgot password
+	if storedUser.Password == "" {
+		return ErrPasswordNotSet
+	}
+	if err := checkPassword(storedUser.Password, currentPassword); err != nil {
+		return err
+	}
+
+	// Validate password against the policy
+	if err := s.p.Validate(newPassword, storedUser.Email, storedUser.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := s.r.UpdateUserPassword(ctx, storedUser.Email, string(hashedPassword)); err != nil {
+		log.Printf("AuthService: Error updating password for user {%s}: %v", userId, err)
+		return err
+	}
+
+	s.logUserEvent(ctx, userId, audit.ActionPasswordChanged, userId, nil)
+	log.Printf("AuthService: Password changed for user {%s}", userId)
+	return nil
+}
+
+// RequestEmailChange sends a confirmation link to the new email. The email is only changed once the link is used.
+func (s *service) RequestEmailChange(ctx context.Context, userId string, reauth Reauthentication, newEmail string) error {
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if err := validateEmail(newEmail); err != nil {
+		return err
+	}
+
+	storedUser, err := s.getUserWithPassword(ctx, userId)
+	if err != nil {
+		log.Printf("AuthService: Error fetching user {%s}: %v", userId, err)
+		return err
+	}
+	if err := s.reauthenticate(ctx, storedUser, reauth); err != nil {
+		return err
+	}
+	if newEmail == storedUser.Email {
+		return apperror.InvalidField("email", "new email must be different from the current email")
+	}
+
+	// * 1. Check if email is used
+	_, err = s.r.GetUserByEmail(ctx, newEmail)
+	if err == nil {
+		return ErrEmailTaken
+	}
+	if !errors.Is(err, ErrNoDocuments) {
+		log.Printf("AuthService: Error fetching user by email: %v", err)
+		return err
+	}
+
+	// * 2. Generate raw token
+	rawToken, err := generateToken()
+	if err != nil {
+		log.Printf("AuthService: Error generating token: %v", err)
+		return err
+	}
+	encodedToken := url.QueryEscape(rawToken)
+
+	// * 3. Create auth token, which is stored with the email
+	authToken, err := NewEmailChangeToken(storedUser.Email, newEmail, encodedToken, AuthTokenDuration)
+	if err != nil {
+		log.Printf("AuthService: Error creating auth token: %v", err)
+		return err
+	}
+
+	// * 4. Send email with confirmation link to the new email
+	data := struct {
+		Name        string
+		ConfirmLink string
+	}{
+		Name:        storedUser.Name,
+		ConfirmLink: os.Getenv("FRONTEND_URL") + "/auth/email/change?token=" + encodedToken,
+	}
+
+	if err := s.sendTokenEmail(ctx, *authToken, newEmail, storedUser.Locale, data); err != nil {
+		log.Printf("AuthService: Error sending email change confirmation")
+		return err
+	}
+	s.logUserEvent(ctx, userId, audit.ActionEmailChangeRequested, userId, map[string]string{"newEmail": newEmail})
+	log.Printf("AuthService: Email change confirmation sent for user {%s}", userId)
+	return nil
+}
+
+// ConfirmEmailChange changes the email of the account once the new email is confirmed, and notifies the old email
+func (s *service) ConfirmEmailChange(ctx context.Context, token string) error {
+	authToken, err := s.verifyAndGetAuthToken(ctx, token, string(PurposeEmailChange))
+	if err != nil {
+		log.Printf("AuthService: Error verifying auth token: %v", err)
+		return ErrInvalidToken
+	}
+
+	storedUser, err := s.r.GetUserByEmail(ctx, authToken.Email)
+	if err != nil {
+		log.Printf("AuthService: Error fetching user by email: %v", err)
+		return ErrInvalidToken
+	}
+
+	err = s.r.ChangeEmailAndMarkToken(ctx, authToken.Email, authToken.NewEmail, encryptToken(token))
+	if err != nil {
+		if errors.Is(err, ErrEmailTaken) {
+			return err
+		}
+		log.Printf("AuthService: Error changing email and marking token: %v", err)
+		return ErrInvalidToken
+	}
+
+	s.logUserEvent(ctx, storedUser.UserId, audit.ActionEmailChanged, storedUser.UserId, map[string]string{"oldEmail": authToken.Email, "newEmail": authToken.NewEmail})
+
+	// * Notify the old email, so the owner finds out if the account was taken over
+	data := struct {
+		Name     string
+		NewEmail string
+	}{
+		Name:     storedUser.Name,
+		NewEmail: authToken.NewEmail,
+	}
+
+	// The change has been made, so failing to send the notice is only logged
+	if err := s.e.SendEmail(ctx, authToken.Email, storedUser.Locale, email.TemplateEmailChanged, data); err != nil {
+		log.Printf("AuthService: Error sending email change notice: %v", err)
+	}
+
+	log.Printf("AuthService: Email changed for user {%s}", storedUser.UserId)
+	return nil
+}
+
+// UpdateProfile updates the display name and the locale emails are sent in, an empty locale keeps the current one.
+// It returns a refreshed jwt carrying the new name.
+func (s *service) UpdateProfile(ctx context.Context, userId string, name string, locale string) (ur UserResponse, jwt string, csrfToken string, err error) {
+	name = strings.TrimSpace(name)
+	if err := validateName(name); err != nil {
+		return UserResponse{}, "", "", err
+	}
+	if err := validateLocale(locale); err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	if err := s.r.UpdateUserProfile(ctx, userId, name, locale); err != nil {
+		log.Printf("AuthService: Error updating profile for user {%s}: %v", userId, err)
+		return UserResponse{}, "", "", err
+	}
+	s.logUserEvent(ctx, userId, audit.ActionProfileUpdated, userId, nil)
+
+	return s.GetUser(ctx, userId)
+}
+
+// DeleteAccount permanently deletes the user and their data:
+//   - swear jars the user is the only owner of are deleted together with all their swears
+//   - the user is removed from the owners of shared swear jars, and the swears they recorded there are deleted
+//   - auth tokens, API tokens and OAuth clients of the user are deleted
+//
+// The user must reauthenticate, see Reauthentication.
+func (s *service) DeleteAccount(ctx context.Context, userId string, reauth Reauthentication) error {
+	storedUser, err := s.getUserWithPassword(ctx, userId)
+	if err != nil {
+		log.Printf("AuthService: Error fetching user {%s}: %v", userId, err)
+		return err
+	}
+	if err := s.reauthenticate(ctx, storedUser, reauth); err != nil {
+		return err
+	}
+
+	if err := s.r.DeleteUser(ctx, userId); err != nil {
+		log.Printf("AuthService: Error deleting user {%s}: %v", userId, err)
+		return err
+	}
+
+	s.logUserEvent(ctx, userId, audit.ActionAccountDeleted, userId, nil)
+	log.Printf("AuthService: Account deleted for user {%s}", userId)
+	return nil
+}
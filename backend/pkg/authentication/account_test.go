@@ -0,0 +1,212 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+)
+
+// sessionContext returns a context carrying the session of the jwt, as the protected routes do
+func sessionContext(t *testing.T, s *service, jwt string) context.Context {
+	t.Helper()
+	claims, err := s.ParseToken(jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WithPrincipal(context.Background(), SessionPrincipal(claims))
+}
+
+// reauthenticatedOperations are the changes to an account which require reauthentication
+var reauthenticatedOperations = []struct {
+	name string
+	run  func(ctx context.Context, s *service, userId string, reauth Reauthentication) error
+}{
+	{"SetPasskeySecondFactor", func(ctx context.Context, s *service, userId string, reauth Reauthentication) error {
+		return s.SetPasskeySecondFactor(ctx, userId, reauth, true)
+	}},
+	{"RequestEmailChange", func(ctx context.Context, s *service, userId string, reauth Reauthentication) error {
+		return s.RequestEmailChange(ctx, userId, reauth, "new@example.com")
+	}},
+	{"DeleteAccount", func(ctx context.Context, s *service, userId string, reauth Reauthentication) error {
+		return s.DeleteAccount(ctx, userId, reauth)
+	}},
+}
+
+func TestReauthenticationWithPassword(t *testing.T) {
+	for _, op := range reauthenticatedOperations {
+		t.Run(op.name, func(t *testing.T) {
+			s, r, _ := newTestService(t)
+			password := "correct horse battery staple"
+			user := r.addUser(t, "alex@example.com", password)
+			registerPasskey(t, s, user.UserId)
+			_, jwt, _, err := s.Login(context.Background(), User{Email: user.Email, Password: password})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := sessionContext(t, s, jwt)
+
+			// A recent login does not stand in for the password of an account which has one
+			if err := op.run(ctx, s, user.UserId, Reauthentication{}); !errors.Is(err, ErrIncorrectPassword) {
+				t.Errorf("%s without the password error = %v, want %v", op.name, err, ErrIncorrectPassword)
+			}
+			if err := op.run(ctx, s, user.UserId, Reauthentication{Password: "wrong"}); !errors.Is(err, ErrIncorrectPassword) {
+				t.Errorf("%s with a wrong password error = %v, want %v", op.name, err, ErrIncorrectPassword)
+			}
+			if err := op.run(ctx, s, user.UserId, Reauthentication{Password: password}); err != nil {
+				t.Errorf("%s with the password: %v", op.name, err)
+			}
+		})
+	}
+}
+
+func TestReauthenticationWithoutPassword(t *testing.T) {
+	for _, op := range reauthenticatedOperations {
+		t.Run(op.name, func(t *testing.T) {
+			s, r, _ := newTestService(t)
+			user := r.addUser(t, "alex@example.com", "")
+			registerPasskey(t, s, user.UserId)
+
+			tests := []struct {
+				name string
+				ctx  context.Context
+			}{
+				{"no session", context.Background()},
+				{"session of an old login", WithPrincipal(context.Background(), Principal{UserId: user.UserId, AuthMethod: AuthMethodSession, AuthTime: time.Now().Add(-time.Hour)})},
+				{"session without login time", WithPrincipal(context.Background(), Principal{UserId: user.UserId, AuthMethod: AuthMethodSession})},
+				{"recent session of another user", WithPrincipal(context.Background(), Principal{UserId: "someone else", AuthMethod: AuthMethodSession, AuthTime: time.Now()})},
+				{"api token", WithPrincipal(context.Background(), Principal{UserId: user.UserId, AuthMethod: AuthMethodAPIToken, AuthTime: time.Now()})},
+			}
+			for _, tt := range tests {
+				if err := op.run(tt.ctx, s, user.UserId, Reauthentication{}); !errors.Is(err, ErrReauthenticationRequired) {
+					t.Errorf("%s with %s error = %v, want %v", op.name, tt.name, err, ErrReauthenticationRequired)
+				}
+			}
+			if r.byId(user.UserId) == nil {
+				t.Fatal("the account was deleted without reauthentication")
+			}
+		})
+	}
+}
+
+func TestReauthenticationByRecentLogin(t *testing.T) {
+	for _, op := range reauthenticatedOperations {
+		t.Run(op.name, func(t *testing.T) {
+			s, r, _ := newTestService(t)
+			user := r.addUser(t, "alex@example.com", "")
+			registerPasskey(t, s, user.UserId)
+
+			// Logging in with OIDC, like by magic link, leaves the session with the time of the login
+			_, jwt, _, err := s.LoginWithExternalIdentity(context.Background(), ExternalIdentity{Provider: "google", Subject: "1234", Email: user.Email, EmailVerified: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := op.run(sessionContext(t, s, jwt), s, user.UserId, Reauthentication{}); err != nil {
+				t.Errorf("%s right after logging in: %v", op.name, err)
+			}
+		})
+	}
+}
+
+func TestReauthenticationWithPasskey(t *testing.T) {
+	for _, op := range reauthenticatedOperations {
+		t.Run(op.name, func(t *testing.T) {
+			s, r, _ := newTestService(t)
+			ctx := context.Background()
+			user := r.addUser(t, "alex@example.com", "")
+			authenticator, _ := registerPasskey(t, s, user.UserId)
+
+			opts, err := s.BeginReauthentication(ctx, user.UserId)
+			if err != nil {
+				t.Fatalf("BeginReauthentication: %v", err)
+			}
+			if len(opts.AllowCredentials) != 1 || opts.UserVerification != webauthn.RequirementRequired {
+				t.Errorf("options = %+v, want the passkey of the user with user verification", opts)
+			}
+			resp, err := authenticator.Login(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := op.run(ctx, s, user.UserId, Reauthentication{Passkey: &resp}); err != nil {
+				t.Errorf("%s with a passkey: %v", op.name, err)
+			}
+		})
+	}
+}
+
+func TestReauthenticationRejectsOtherPasskeyAssertions(t *testing.T) {
+	s, r, _ := newTestService(t)
+	ctx := context.Background()
+	user := r.addUser(t, "alex@example.com", "")
+	authenticator, _ := registerPasskey(t, s, user.UserId)
+	attacker := r.addUser(t, "sam@example.com", "")
+	attackerAuthenticator, _ := registerPasskey(t, s, attacker.UserId)
+
+	// * 1. A challenge of the attacker, signed with their own passkey
+	opts, err := s.BeginReauthentication(ctx, attacker.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := attackerAuthenticator.Login(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAccount(ctx, user.UserId, Reauthentication{Passkey: &resp}); err == nil {
+		t.Error("DeleteAccount succeeded with the passkey of another user")
+	}
+
+	// * 2. A login challenge signed with the passkey of the user
+	opts, err = s.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = authenticator.Login(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAccount(ctx, user.UserId, Reauthentication{Passkey: &resp}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("DeleteAccount with a login challenge error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	// * 3. A reauthentication which was already used
+	opts, err = s.BeginReauthentication(ctx, user.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = authenticator.Login(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPasskeySecondFactor(ctx, user.UserId, Reauthentication{Passkey: &resp}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAccount(ctx, user.UserId, Reauthentication{Passkey: &resp}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("DeleteAccount with a used challenge error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	if r.byId(user.UserId) == nil {
+		t.Fatal("the account was deleted")
+	}
+}
+
+func TestGetUserKeepsLoginTime(t *testing.T) {
+	s, r, _ := newTestService(t)
+	user := r.addUser(t, "alex@example.com", "")
+	loggedInAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// A session refreshed long after the login must not count as a recent login
+	ctx := WithPrincipal(context.Background(), Principal{UserId: user.UserId, AuthMethod: AuthMethodSession, AuthTime: loggedInAt})
+	_, jwt, _, err := s.GetUser(ctx, user.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.ParseToken(jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.AuthTime == nil || !claims.AuthTime.Time.Equal(loggedInAt) {
+		t.Errorf("AuthTime = %v, want %v", claims.AuthTime, loggedInAt)
+	}
+}
@@ -0,0 +1,94 @@
+package authentication
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+const (
+	// APITokenPrefix makes personal access tokens easy to recognise, e.g. by secret scanners
+	APITokenPrefix     = "sj_"
+	MaxAPITokenNameLen = 50
+)
+
+// APIToken is a user-managed personal access token used by scripts and bots.
+// Only the hash of the raw token is stored.
+type APIToken struct {
+	TokenId     string `bson:"_id,omitempty"`
+	UserId      string
+	Name        string
+	Token       string `json:"-"`
+	Scopes      []Scope
+	SwearJarIds []string // empty means the token is not restricted to specific jars
+	CreatedAt   time.Time
+	ExpiresAt   time.Time // zero means the token never expires
+	LastUsedAt  time.Time
+	Revoked     bool
+}
+
+func (a *APIToken) Validate() error {
+	if a.UserId == "" {
+		return errors.New("user id is required")
+	}
+	if a.Name == "" {
+		return apperror.InvalidField("name", "name is required")
+	}
+	if len(a.Name) > MaxAPITokenNameLen {
+		return apperror.InvalidField("name", "name is too long")
+	}
+	if a.Token == "" {
+		return errors.New("token is required")
+	}
+	if len(a.Scopes) == 0 {
+		return apperror.InvalidField("scopes", "at least one scope is required")
+	}
+	for _, scope := range a.Scopes {
+		if !scope.IsValid() {
+			return apperror.InvalidField("scopes", "invalid scope: "+string(scope))
+		}
+	}
+	if a.IsExpired() {
+		return errors.New("token has already expired")
+	}
+	if a.Revoked {
+		return errors.New("token has been revoked")
+	}
+	return nil
+}
+
+func (a *APIToken) IsExpired() bool {
+	return !a.ExpiresAt.IsZero() && time.Now().After(a.ExpiresAt)
+}
+
+func (a *APIToken) HasScope(scope Scope) bool {
+	return slices.Contains(a.Scopes, scope)
+}
+
+func (a *APIToken) CanAccessSwearJar(swearJarId string) bool {
+	return len(a.SwearJarIds) == 0 || slices.Contains(a.SwearJarIds, swearJarId)
+}
+
+func NewAPIToken(userId string, name string, rawToken string, scopes []Scope, swearJarIds []string, duration time.Duration) (*APIToken, error) {
+	now := time.Now()
+	apiToken := &APIToken{
+		UserId:      userId,
+		Name:        name,
+		Token:       encryptToken(rawToken),
+		Scopes:      scopes,
+		SwearJarIds: swearJarIds,
+		CreatedAt:   now,
+		Revoked:     false,
+	}
+	if duration > 0 {
+		apiToken.ExpiresAt = now.Add(duration)
+	}
+
+	if err := apiToken.Validate(); err != nil {
+		return nil, err
+	}
+
+	return apiToken, nil
+}
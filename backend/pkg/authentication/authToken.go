@@ -17,10 +17,14 @@ type AuthToken struct {
 	ExpiresAt time.Time
 	Purpose   PurposeType
 	Used      bool
+
+	// NewEmail is the address being confirmed by an email change token
+	NewEmail string `bson:"NewEmail,omitempty"`
 }
 
 func (a *AuthToken) Validate() error {
-	if a.Email == "" {
+	// Passwordless passkey logins only find out who the user is from the signed challenge
+	if a.Email == "" && a.Purpose != PurposePasskeyLogin {
 		return errors.New("email is required")
 	}
 	if a.Token == "" {
@@ -35,21 +39,27 @@ func (a *AuthToken) Validate() error {
 	if a.Used {
 		return errors.New("token has already been used")
 	}
+	if a.Purpose == PurposeEmailChange && a.NewEmail == "" {
+		return errors.New("new email is required")
+	}
 	return nil
 }
 
 func NewAuthToken(email string, rawToken string, purpose PurposeType, duration time.Duration) (*AuthToken, error) {
-	encryptedToken := encryptToken(rawToken)
+	authToken := newAuthToken(email, rawToken, purpose, duration)
 
-	authToken := &AuthToken{
-		Email:     email,
-		Token:     encryptedToken,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(duration),
-		Purpose:   purpose,
-		Used:      false,
+	if err := authToken.Validate(); err != nil {
+		return nil, err
 	}
 
+	return authToken, nil
+}
+
+// NewEmailChangeToken returns the token confirming the change of the email to newEmail, which is stored with it
+func NewEmailChangeToken(email string, newEmail string, rawToken string, duration time.Duration) (*AuthToken, error) {
+	authToken := newAuthToken(email, rawToken, PurposeEmailChange, duration)
+	authToken.NewEmail = newEmail
+
 	if err := authToken.Validate(); err != nil {
 		return nil, err
 	}
@@ -57,6 +67,17 @@ func NewAuthToken(email string, rawToken string, purpose PurposeType, duration t
 	return authToken, nil
 }
 
+func newAuthToken(email string, rawToken string, purpose PurposeType, duration time.Duration) *AuthToken {
+	return &AuthToken{
+		Email:     email,
+		Token:     encryptToken(rawToken),
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(duration),
+		Purpose:   purpose,
+		Used:      false,
+	}
+}
+
 func encryptToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
 	return hex.EncodeToString(hash[:])
@@ -0,0 +1,65 @@
+package authentication
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachedPasswordList looks up passwords in a local copy of a breached password corpus, split into
+// k-anonymity range files the same way as the Pwned Passwords range API: the SHA-1 hash of each password
+// is stored in the file named after its first 5 hex characters, e.g. 21BD1.txt, as lines of
+// "<remaining 35 hex characters>:<number of times seen>".
+type BreachedPasswordList struct {
+	dir      string
+	minCount int
+}
+
+func NewBreachedPasswordList(dir string, minCount int) (*BreachedPasswordList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening breached password dir: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password dir %s is not a directory", dir)
+	}
+	return &BreachedPasswordList{dir: dir, minCount: minCount}, nil
+}
+
+// Contains reports whether the password has been seen in breaches at least minCount times
+func (b *BreachedPasswordList) Contains(password string) (bool, error) {
+	hash := sha1.Sum([]byte(password))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+	prefix, suffix := hexHash[:5], hexHash[5:]
+
+	f, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if err != nil {
+		// A missing range file means no breached password has this prefix
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, fmt.Errorf("invalid count in range file %s: %s", prefix, count)
+		}
+		return n >= b.minCount, nil
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,68 @@
+package authentication
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+// CSRF tokens are bound to the session jwt they are issued with. A token is a random nonce and an HMAC over the
+// session id (the jti of the jwt) and the nonce, so it cannot be reused with another session and is rotated
+// whenever the jwt is refreshed.
+
+var ErrInvalidCSRFToken = apperror.Forbidden("invalid_csrf_token", "invalid csrf token")
+
+// csrfKey derives the CSRF signing key from JWT_KEYRING_SECRET, so it is shared by all instances without
+// reusing the key which encrypts the signing keys
+func (k *Keyring) csrfKey() []byte {
+	mac := hmac.New(sha256.New, k.encryptionKey)
+	mac.Write([]byte("csrf"))
+	return mac.Sum(nil)
+}
+
+func (k *Keyring) csrfSignature(sessionId string, nonce string) string {
+	mac := hmac.New(sha256.New, k.csrfKey())
+	mac.Write([]byte(sessionId))
+	mac.Write([]byte{'.'})
+	mac.Write([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateCSRFToken returns a csrf token bound to the session
+func (k *Keyring) GenerateCSRFToken(sessionId string) (string, error) {
+	if sessionId == "" {
+		return "", errors.New("session id is required")
+	}
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(nonceBytes)
+	return nonce + "." + k.csrfSignature(sessionId, nonce), nil
+}
+
+// VerifyCSRFToken checks the csrf token was issued for the session
+func (k *Keyring) VerifyCSRFToken(token string, sessionId string) error {
+	nonce, signature, found := strings.Cut(token, ".")
+	if !found || nonce == "" || sessionId == "" {
+		return ErrInvalidCSRFToken
+	}
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(k.csrfSignature(sessionId, nonce))) != 1 {
+		return ErrInvalidCSRFToken
+	}
+	return nil
+}
+
+func generateSessionId() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
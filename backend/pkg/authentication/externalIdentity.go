@@ -0,0 +1,22 @@
+package authentication
+
+import "errors"
+
+// ExternalIdentity is a user identity asserted by an external identity provider, e.g. Google or GitHub
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+func (i *ExternalIdentity) Validate() error {
+	if i.Provider == "" {
+		return errors.New("provider is required")
+	}
+	if i.Subject == "" {
+		return errors.New("subject is required")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+)
+
+func TestLoginWithExternalIdentityRequiresSecondFactor(t *testing.T) {
+	identity := ExternalIdentity{Provider: "google", Subject: "1234", Email: "alex@example.com", EmailVerified: true, Name: "Alex"}
+
+	tests := []struct {
+		name   string
+		linked bool
+	}{
+		{"linked identity", true},
+		{"linked by verified email", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, r, a := newTestService(t)
+			ctx := context.Background()
+			password := "correct horse battery staple"
+			user := r.addUser(t, identity.Email, password)
+			authenticator, _ := registerPasskey(t, s, user.UserId)
+			if err := s.SetPasskeySecondFactor(ctx, user.UserId, Reauthentication{Password: password}, true); err != nil {
+				t.Fatal(err)
+			}
+			if tt.linked {
+				if err := r.LinkExternalIdentity(ctx, user.UserId, identity, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, jwt, csrfToken, err := s.LoginWithExternalIdentity(ctx, identity)
+			var secondFactorErr *SecondFactorRequiredError
+			if !errors.As(err, &secondFactorErr) {
+				t.Fatalf("LoginWithExternalIdentity error = %v, want SecondFactorRequiredError", err)
+			}
+			if jwt != "" || csrfToken != "" {
+				t.Fatal("LoginWithExternalIdentity issued a session before the second factor")
+			}
+			if a.has(audit.ActionLogin, map[string]string{"method": "oidc:google"}) {
+				t.Error("login was audited before the second factor")
+			}
+
+			resp, err := authenticator.Login(secondFactorErr.Options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ur, jwt, _, err := s.FinishSecondFactor(ctx, resp)
+			if err != nil {
+				t.Fatalf("FinishSecondFactor: %v", err)
+			}
+			if ur.UserId != user.UserId || jwt == "" {
+				t.Errorf("FinishSecondFactor = %+v, %q, want a session of the user", ur, jwt)
+			}
+		})
+	}
+}
+
+func TestLoginWithExternalIdentityLinksAccountByVerifiedEmail(t *testing.T) {
+	s, r, a := newTestService(t)
+	ctx := context.Background()
+	user := r.addUser(t, "alex@example.com", "correct horse battery staple")
+	identity := ExternalIdentity{Provider: "google", Subject: "1234", Email: "Alex@example.com", EmailVerified: true, Name: "Alex G"}
+
+	ur, jwt, csrfToken, err := s.LoginWithExternalIdentity(ctx, identity)
+	if err != nil {
+		t.Fatalf("LoginWithExternalIdentity: %v", err)
+	}
+	if ur.UserId != user.UserId || jwt == "" || csrfToken == "" {
+		t.Fatalf("LoginWithExternalIdentity = %+v, %q, %q, want a session of the existing user", ur, jwt, csrfToken)
+	}
+	if !a.has(audit.ActionExternalIdentityLinked, map[string]string{"provider": "google", "passwordCleared": "false"}) {
+		t.Error("linking was not audited")
+	}
+
+	// The identity is linked, so the next login finds the user by it, and the password of the verified account is kept
+	linked, err := r.GetUserByExternalIdentity(ctx, "google", "1234")
+	if err != nil || linked.UserId != user.UserId {
+		t.Fatalf("GetUserByExternalIdentity = %+v, %v, want the existing user", linked, err)
+	}
+	if linked.Password == "" {
+		t.Error("the password of the verified account was cleared")
+	}
+	if len(r.users) != 1 {
+		t.Errorf("%d users, want no new user", len(r.users))
+	}
+}
+
+func TestLoginWithExternalIdentityClearsPasswordOfUnverifiedAccount(t *testing.T) {
+	s, r, _ := newTestService(t)
+	ctx := context.Background()
+	user := r.addUser(t, "alex@example.com", "password of a squatter")
+	r.byId(user.UserId).Verified = false
+
+	identity := ExternalIdentity{Provider: "google", Subject: "1234", Email: "alex@example.com", EmailVerified: true}
+	if _, _, _, err := s.LoginWithExternalIdentity(ctx, identity); err != nil {
+		t.Fatalf("LoginWithExternalIdentity: %v", err)
+	}
+
+	stored, err := r.GetUserByEmail(ctx, "alex@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password != "" || !stored.Verified {
+		t.Errorf("stored user has password %q and verified %v, want the password cleared and the email verified", stored.Password, stored.Verified)
+	}
+}
+
+func TestLoginWithExternalIdentityRefusesUnverifiedEmail(t *testing.T) {
+	s, r, _ := newTestService(t)
+	ctx := context.Background()
+	r.addUser(t, "alex@example.com", "correct horse battery staple")
+
+	tests := []ExternalIdentity{
+		{Provider: "google", Subject: "1234", Email: "alex@example.com", EmailVerified: false},
+		{Provider: "google", Subject: "5678", Email: "sam@example.com", EmailVerified: false},
+		{Provider: "github", Subject: "9012", Email: "", EmailVerified: true},
+	}
+	for _, identity := range tests {
+		if _, jwt, _, err := s.LoginWithExternalIdentity(ctx, identity); !errors.Is(err, ErrUnverifiedIdentity) || jwt != "" {
+			t.Errorf("LoginWithExternalIdentity(%+v) = %q, %v, want %v", identity, jwt, err, ErrUnverifiedIdentity)
+		}
+	}
+	if _, err := r.GetUserByExternalIdentity(ctx, "google", "1234"); !errors.Is(err, ErrNoDocuments) {
+		t.Error("the identity with an unverified email was linked")
+	}
+	if len(r.users) != 1 {
+		t.Errorf("%d users, want no account created for an unverified email", len(r.users))
+	}
+}
+
+func TestLoginWithExternalIdentityCreatesUser(t *testing.T) {
+	s, _, a := newTestService(t)
+	ctx := context.Background()
+	identity := ExternalIdentity{Provider: "google", Subject: "1234", Email: "sam@example.com", EmailVerified: true}
+
+	ur, jwt, _, err := s.LoginWithExternalIdentity(ctx, identity)
+	if err != nil {
+		t.Fatalf("LoginWithExternalIdentity: %v", err)
+	}
+	if ur.Email != "sam@example.com" || ur.Name != "sam" || !ur.Verified || jwt == "" {
+		t.Errorf("LoginWithExternalIdentity = %+v, %q, want a session of a new verified user", ur, jwt)
+	}
+	if !a.has(audit.ActionSignUp, map[string]string{"method": "oidc:google"}) {
+		t.Error("signup was not audited")
+	}
+
+	again, _, _, err := s.LoginWithExternalIdentity(ctx, identity)
+	if err != nil || again.UserId != ur.UserId {
+		t.Errorf("second login = %+v, %v, want the same user", again, err)
+	}
+}
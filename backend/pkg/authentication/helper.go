@@ -1,21 +1,25 @@
 package authentication
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"errors"
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
 )
 
-func CreateToken(u User) (string, error) {
-	var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-
+// createToken signs a session jwt for the user. The session id is the jti the csrf token is bound to, the auth time
+// is left out if it is zero.
+func createToken(k *Keyring, u User, sessionId string, authTime time.Time) (string, error) {
 	jwtExpirationTime, _ := strconv.Atoi(os.Getenv("JWT_EXPIRATION_TIME"))
 	expirationTime := time.Now().Add(time.Duration(jwtExpirationTime) * time.Minute)
 	claims := &Claims{
@@ -24,61 +28,92 @@ func CreateToken(u User) (string, error) {
 		UserId:   u.UserId,
 		Verified: u.Verified,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionId,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
+
+	return k.Sign(claims, nil)
 }
 
-// DecodeJWT decodes a JWT token string and returns the token object or an error if the token is invalid.
-func DecodeJWT(tokenString string) (jwt.MapClaims, error) {
-	// Parse the token without validating the signature, as previously validated in the middleware
-	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
-	if err != nil {
-		return nil, err
+// durationFromEnv parses the environment variable as a duration, e.g. "90s" or "168h", falling back to the default
+// if it is not set or invalid
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
 	}
-
-	// Extract claims and print them in a human-readable format
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		// log.Printf("Decoded JWT Token: UserId: %s, Email: %s, Name: %s, Verified: %v, Issued At: %v, Expires At: %v", claims["UserId"], claims["Email"], claims["Name"], claims["Verified"], claims["iat"], claims["exp"])
-		return claims, nil
-	} else {
-		log.Printf("Unable to extract claims from token")
-		return nil, errors.New("Unable to extract claims from token")
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("Invalid %s: %s, using default %s", name, value, defaultValue)
+		return defaultValue
 	}
+	return d
 }
 
-func GenerateCSRFToken() (string, error) {
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return base64.URLEncoding.EncodeToString(bytes), nil
+// tokenEmailTemplates are the emails the links of auth tokens are sent in, by purpose
+var tokenEmailTemplates = map[PurposeType]string{
+	PurposeEmailVerification: email.TemplateVerifyEmail,
+	PurposePasswordReset:     email.TemplateResetPassword,
+	PurposeMagicLogin:        email.TemplateMagicLogin,
+	PurposeEmailChange:       email.TemplateConfirmEmailChange,
 }
 
-func validatePassword(password string) error {
-	if password == "" {
-		return errors.New("password is required")
+// sendTokenEmail stores the auth token and queues the email with its link in one transaction, so a link is never sent
+// for a token which was not stored, and a token is never stored without its link being sent
+func (s *service) sendTokenEmail(ctx context.Context, authToken AuthToken, to string, locale string, data interface{}) error {
+	template, ok := tokenEmailTemplates[authToken.Purpose]
+	if !ok {
+		return fmt.Errorf("no email for auth tokens of purpose %s", authToken.Purpose)
 	}
 
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters")
-	}
+	return s.r.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.r.CreateAuthToken(ctx, authToken); err != nil {
+			log.Printf("AuthService: Error storing auth token in db: %v", err)
+			return err
+		}
+		return s.e.SendEmail(ctx, to, locale, template, data)
+	})
+}
 
-	if len(password) >= 30 {
-		return errors.New("password must be less than 30 characters")
-	}
+// logUserEvent records an audit event targeting the account of the user
+func (s *service) logUserEvent(ctx context.Context, actorId string, action audit.Action, userId string, details map[string]string) {
+	s.a.Log(ctx, audit.Event{
+		ActorId:    actorId,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetId:   userId,
+		Details:    details,
+	})
+}
 
-	if !regexp.MustCompile(`[A-Z]`).MatchString(password) {
-		return errors.New("password must contain at least one uppercase letter")
+func validateEmail(email string) error {
+	emailRegex := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
+	if !regexp.MustCompile(emailRegex).MatchString(email) {
+		return apperror.InvalidField("email", "invalid email format")
 	}
+	return nil
+}
 
-	if !regexp.MustCompile(`[!@#$%^&*()_+\-=[\]{};':"\\|,.<>/?]`).MatchString(password) {
-		return errors.New("password must contain at least one special character")
+// validateLocale accepts the locales emails are translated to, and an empty locale for the default
+func validateLocale(locale string) error {
+	if locale != "" && !slices.Contains(email.Locales, locale) {
+		return apperror.InvalidField("locale", "locale must be one of "+strings.Join(email.Locales, ", "))
 	}
+	return nil
+}
 
+func validateName(name string) error {
+	if name == "" {
+		return apperror.InvalidField("name", "name is required")
+	}
+	if len([]rune(name)) > 50 {
+		return apperror.InvalidField("name", "name must be at most 50 characters")
+	}
 	return nil
 }
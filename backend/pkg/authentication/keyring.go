@@ -0,0 +1,463 @@
+package authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/jwk"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	DefaultKeyRotationInterval = 30 * 24 * time.Hour
+	// keyPrepublishDuration is how long a new key is published in the JWKS before it is used for signing,
+	// so other instances and external verifiers pick it up first. It must exceed keyringRefreshInterval.
+	keyPrepublishDuration  = 15 * time.Minute
+	keyringRefreshInterval = 5 * time.Minute
+	// retiredKeyTTL is how long a replaced key remains valid for verification. It must exceed the longest token lifetime.
+	retiredKeyTTL = 48 * time.Hour
+	// unknownKidReloadInterval limits how often a token with an unknown kid can trigger a reload from the db
+	unknownKidReloadInterval = 1 * time.Minute
+	// keyringTimeout bounds the db operations of a reload or rotation
+	keyringTimeout = 30 * time.Second
+)
+
+var ErrSigningKeyExists = errors.New("signing key already exists")
+
+// SigningKey is a keyring entry. The private key is stored encrypted with JWT_KEYRING_SECRET.
+type SigningKey struct {
+	Kid                 string `bson:"_id"`
+	Epoch               int    // number of rotations before the key, which its kid is derived from
+	Algorithm           string
+	EncryptedPrivateKey []byte
+	CreatedAt           time.Time
+	NotBefore           time.Time // the key is published from CreatedAt but only signs from NotBefore
+	ExpiresAt           time.Time // zero until the key is replaced
+
+	privateKey crypto.Signer
+}
+
+func (k *SigningKey) IsExpired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt)
+}
+
+type KeyRepository interface {
+	// CreateSigningKey returns ErrSigningKeyExists if a key with the kid was already created
+	CreateSigningKey(ctx context.Context, key SigningKey) error
+	GetSigningKeys(ctx context.Context) ([]SigningKey, error)
+	SetSigningKeyExpiry(ctx context.Context, kid string, expiresAt time.Time) error
+}
+
+// Keyring signs JWTs with the newest active asymmetric key and verifies them with any published key,
+// so keys can be rotated without invalidating tokens that are already issued
+type Keyring struct {
+	r                KeyRepository
+	algorithm        string
+	rotationInterval time.Duration
+	encryptionKey    []byte
+	legacySecret     []byte
+
+	mu         sync.RWMutex
+	keys       []SigningKey
+	lastLoaded time.Time
+}
+
+// NewKeyring loads the keyring configuration from env and the keys from the db, creating the first key if there is none.
+// JWT_SIGNING_ALG is RS256 (default) or EdDSA, JWT_KEY_ROTATION_INTERVAL is a duration such as 720h and
+// JWT_KEYRING_SECRET encrypts the private keys at rest. Tokens signed with the legacy JWT_SECRET are
+// still accepted while it is set, so they can expire naturally after migrating.
+func NewKeyring(ctx context.Context, r KeyRepository) (*Keyring, error) {
+	k := &Keyring{
+		r:                r,
+		algorithm:        os.Getenv("JWT_SIGNING_ALG"),
+		rotationInterval: DefaultKeyRotationInterval,
+		legacySecret:     []byte(os.Getenv("JWT_SECRET")),
+	}
+
+	if k.algorithm == "" {
+		k.algorithm = AlgorithmRS256
+	}
+	if k.algorithm != AlgorithmRS256 && k.algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG: %s", k.algorithm)
+	}
+
+	if interval := os.Getenv("JWT_KEY_ROTATION_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < time.Hour {
+			return nil, fmt.Errorf("invalid JWT_KEY_ROTATION_INTERVAL: %s", interval)
+		}
+		k.rotationInterval = d
+	}
+
+	secret := os.Getenv("JWT_KEYRING_SECRET")
+	if secret == "" {
+		return nil, errors.New("JWT_KEYRING_SECRET is required")
+	}
+	encryptionKey := sha256.Sum256([]byte(secret))
+	k.encryptionKey = encryptionKey[:]
+
+	if err := k.reload(ctx); err != nil {
+		return nil, err
+	}
+	if len(k.keys) == 0 {
+		log.Printf("Keyring: No signing keys found, creating the first key")
+		// Another instance starting at the same time creates the same key
+		if err := k.addKey(ctx, 0, time.Now()); err != nil && !errors.Is(err, ErrSigningKeyExists) {
+			return nil, err
+		}
+		if err := k.reload(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// Sign signs the claims with the current signing key and sets the kid header
+func (k *Keyring) Sign(claims jwt.Claims, headers map[string]interface{}) (string, error) {
+	key, err := k.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	for name, value := range headers {
+		token.Header[name] = value
+	}
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.privateKey)
+}
+
+// Parse verifies the token signature against the keyring and validates the claims
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims, options ...jwt.ParserOption) (*jwt.Token, error) {
+	validMethods := []string{AlgorithmRS256, AlgorithmEdDSA}
+	if len(k.legacySecret) > 0 {
+		validMethods = append(validMethods, jwt.SigningMethodHS256.Alg())
+	}
+	options = append(options, jwt.WithValidMethods(validMethods), jwt.WithExpirationRequired())
+
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && len(k.legacySecret) > 0 {
+				return k.legacySecret, nil
+			}
+			return nil, errors.New("token has no kid")
+		}
+
+		key, err := k.verificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.privateKey.Public(), nil
+	}, options...)
+}
+
+// JWKS returns the public keys of all keys that are valid for verification
+func (k *Keyring) JWKS() (jwk.Set, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	set := jwk.Set{Keys: []jwk.Key{}}
+	for _, key := range k.keys {
+		if key.IsExpired(now) {
+			continue
+		}
+		publicKey, err := jwk.NewKey(key.Kid, key.Algorithm, key.privateKey.Public())
+		if err != nil {
+			return jwk.Set{}, err
+		}
+		set.Keys = append(set.Keys, publicKey)
+	}
+	return set, nil
+}
+
+// Algorithms returns the algorithms the keyring can sign with
+func (k *Keyring) Algorithms() []string {
+	return []string{k.algorithm}
+}
+
+// Rotate publishes a new key, which takes over signing once the prepublish window has passed.
+// The keys it replaces remain valid for verification until retiredKeyTTL after that.
+// The new key is derived from the number of rotations, so when instances rotate at the same time only the
+// first creates a key and the others pick it up.
+func (k *Keyring) Rotate(ctx context.Context) error {
+	now := time.Now()
+	notBefore := now.Add(keyPrepublishDuration)
+
+	k.mu.RLock()
+	replaced := []string{}
+	epoch := 0
+	for _, key := range k.keys {
+		if key.ExpiresAt.IsZero() {
+			replaced = append(replaced, key.Kid)
+		}
+		epoch = max(epoch, key.Epoch+1)
+	}
+	k.mu.RUnlock()
+
+	if err := k.addKey(ctx, epoch, notBefore); err != nil {
+		if errors.Is(err, ErrSigningKeyExists) {
+			log.Printf("Keyring: Signing key of rotation %d was already created by another instance", epoch)
+			return k.reload(ctx)
+		}
+		return err
+	}
+	for _, kid := range replaced {
+		if err := k.r.SetSigningKeyExpiry(ctx, kid, notBefore.Add(retiredKeyTTL)); err != nil {
+			log.Printf("Keyring: Error setting expiry of key %s: %v", kid, err)
+			return err
+		}
+	}
+
+	log.Printf("Keyring: Rotated signing key, new key becomes active at %s", notBefore.Format(time.RFC3339))
+	return k.reload(ctx)
+}
+
+// StartRotation periodically reloads the keyring and rotates the signing key once it is older than the
+// rotation interval. Instances reload from the db, so a key rotated by one instance is picked up by all.
+func (k *Keyring) StartRotation() (stop func()) {
+	ticker := time.NewTicker(keyringRefreshInterval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				k.refresh()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (k *Keyring) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), keyringTimeout)
+	defer cancel()
+
+	if err := k.reload(ctx); err != nil {
+		log.Printf("Keyring: Error reloading keys: %v", err)
+		return
+	}
+	if k.needsRotation(time.Now()) {
+		if err := k.Rotate(ctx); err != nil {
+			log.Printf("Keyring: Error rotating keys: %v", err)
+		}
+	}
+}
+
+func (k *Keyring) needsRotation(now time.Time) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var newest time.Time
+	for _, key := range k.keys {
+		if key.CreatedAt.After(newest) {
+			newest = key.CreatedAt
+		}
+	}
+	return now.Sub(newest) >= k.rotationInterval
+}
+
+// signingKey returns the newest key that is past its prepublish window
+func (k *Keyring) signingKey() (SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	var current *SigningKey
+	for i, key := range k.keys {
+		if key.NotBefore.After(now) || key.IsExpired(now) {
+			continue
+		}
+		if current == nil || key.NotBefore.After(current.NotBefore) {
+			current = &k.keys[i]
+		}
+	}
+	if current == nil {
+		return SigningKey{}, errors.New("no active signing key")
+	}
+	return *current, nil
+}
+
+func (k *Keyring) verificationKey(kid string) (SigningKey, error) {
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+
+	// The key may have been added by another instance since the last reload
+	k.mu.RLock()
+	canReload := time.Since(k.lastLoaded) > unknownKidReloadInterval
+	k.mu.RUnlock()
+	if canReload {
+		// Verifying a token is not tied to a request, so the reload has its own deadline
+		ctx, cancel := context.WithTimeout(context.Background(), keyringTimeout)
+		defer cancel()
+		if err := k.reload(ctx); err != nil {
+			return SigningKey{}, err
+		}
+		if key, ok := k.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return SigningKey{}, fmt.Errorf("unknown kid: %s", kid)
+}
+
+func (k *Keyring) lookup(kid string) (SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range k.keys {
+		if key.Kid == kid && !key.IsExpired(now) {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+func (k *Keyring) reload(ctx context.Context) error {
+	keys, err := k.r.GetSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	loaded := make([]SigningKey, 0, len(keys))
+	for _, key := range keys {
+		if key.IsExpired(now) {
+			continue
+		}
+		privateKey, err := k.decryptPrivateKey(key.EncryptedPrivateKey)
+		if err != nil {
+			return fmt.Errorf("error decrypting signing key %s: %w", key.Kid, err)
+		}
+		key.privateKey = privateKey
+		loaded = append(loaded, key)
+	}
+
+	k.mu.Lock()
+	k.keys = loaded
+	k.lastLoaded = now
+	k.mu.Unlock()
+	return nil
+}
+
+func (k *Keyring) addKey(ctx context.Context, epoch int, notBefore time.Time) error {
+	var privateKey crypto.Signer
+	var err error
+	switch k.algorithm {
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return fmt.Errorf("error generating signing key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	encrypted, err := k.encryptPrivateKey(der)
+	if err != nil {
+		return err
+	}
+
+	return k.r.CreateSigningKey(ctx, SigningKey{
+		Kid:                 k.kid(epoch),
+		Epoch:               epoch,
+		Algorithm:           k.algorithm,
+		EncryptedPrivateKey: encrypted,
+		CreatedAt:           time.Now(),
+		NotBefore:           notBefore,
+	})
+}
+
+// kid derives the kid of the key of the rotation from the keyring secret, so it is the same on every instance
+// but can't be guessed for future rotations
+func (k *Keyring) kid(epoch int) string {
+	mac := hmac.New(sha256.New, k.encryptionKey)
+	fmt.Fprintf(mac, "signing-key:%d", epoch)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
+
+func (k *Keyring) encryptPrivateKey(der []byte) ([]byte, error) {
+	gcm, err := k.cipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, der, nil), nil
+}
+
+func (k *Keyring) decryptPrivateKey(encrypted []byte) (crypto.Signer, error) {
+	gcm, err := k.cipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) < gcm.NonceSize() {
+		return nil, errors.New("encrypted key is too short")
+	}
+	nonce, ciphertext := encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():]
+	der, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+func (k *Keyring) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
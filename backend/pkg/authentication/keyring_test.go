@@ -0,0 +1,309 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKeyring(t *testing.T, r KeyRepository, algorithm string) *Keyring {
+	t.Helper()
+	t.Setenv("JWT_KEYRING_SECRET", "test-keyring-secret")
+	t.Setenv("JWT_SIGNING_ALG", algorithm)
+	k, err := NewKeyring(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// activate ends the prepublish window of the keys in the repository and reloads the keyring
+func activate(t *testing.T, r *fakeRepository, k *Keyring) {
+	t.Helper()
+	r.mu.Lock()
+	for i := range r.signingKeys {
+		r.signingKeys[i].NotBefore = time.Now().Add(-time.Second)
+	}
+	r.mu.Unlock()
+	if err := k.reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "000000000000000000000001", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+// signedKid signs a token with the keyring and returns the kid it was signed with
+func signedKid(t *testing.T, k *Keyring) (string, string) {
+	t.Helper()
+	tokenString, err := k.Sign(testClaims(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenString, token.Header["kid"].(string)
+}
+
+func TestKeyringSignsAndVerifies(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			k := newTestKeyring(t, newFakeRepository(), algorithm)
+
+			tokenString, _ := signedKid(t, k)
+			token, err := k.Parse(tokenString, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Method.Alg() != algorithm {
+				t.Errorf("signed with %s, want %s", token.Method.Alg(), algorithm)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	r := newFakeRepository()
+	k := newTestKeyring(t, r, AlgorithmEdDSA)
+	oldToken, oldKid := signedKid(t, k)
+
+	// * 1. The new key is published, but the old key signs until the prepublish window has passed
+	if err := k.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.signingKeys) != 2 {
+		t.Fatalf("%d keys after the rotation, want 2", len(r.signingKeys))
+	}
+	newKey := r.signingKeys[1]
+	if newKey.Kid == oldKid || newKey.Epoch != 1 || time.Until(newKey.NotBefore) < keyPrepublishDuration-time.Minute {
+		t.Errorf("new key = %s, epoch %d, not before %v, want a key of rotation 1 prepublished for %v", newKey.Kid, newKey.Epoch, newKey.NotBefore, keyPrepublishDuration)
+	}
+	if set, err := k.JWKS(); err != nil || len(set.Keys) != 2 {
+		t.Errorf("JWKS = %+v, %v, want both keys published", set, err)
+	}
+	if _, kid := signedKid(t, k); kid != oldKid {
+		t.Errorf("signed with %s during the prepublish window, want %s", kid, oldKid)
+	}
+
+	// * 2. The old key is retired once the new key is active, and still verifies the tokens it signed
+	if want := newKey.NotBefore.Add(retiredKeyTTL); !r.signingKeys[0].ExpiresAt.Equal(want) {
+		t.Errorf("old key expires at %v, want %v", r.signingKeys[0].ExpiresAt, want)
+	}
+	activate(t, r, k)
+	if _, kid := signedKid(t, k); kid != newKey.Kid {
+		t.Errorf("signed with %s after the prepublish window, want %s", kid, newKey.Kid)
+	}
+	if _, err := k.Parse(oldToken, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("Parse of a token signed with the retired key: %v", err)
+	}
+
+	// * 3. Once the old key has expired, it is unpublished and no longer verifies
+	r.signingKeys[0].ExpiresAt = time.Now().Add(-time.Second)
+	if err := k.reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if set, err := k.JWKS(); err != nil || len(set.Keys) != 1 || set.Keys[0].Kid != newKey.Kid {
+		t.Errorf("JWKS = %+v, %v, want only the new key", set, err)
+	}
+	if _, err := k.Parse(oldToken, &jwt.RegisteredClaims{}); err == nil {
+		t.Error("Parse of a token signed with an expired key = nil, want an error")
+	}
+}
+
+func TestKeyringNeedsRotation(t *testing.T) {
+	k := newTestKeyring(t, newFakeRepository(), AlgorithmEdDSA)
+
+	if now := time.Now(); k.needsRotation(now) {
+		t.Error("needsRotation of a new key = true, want false")
+	}
+	if later := time.Now().Add(DefaultKeyRotationInterval); !k.needsRotation(later) {
+		t.Error("needsRotation after the rotation interval = false, want true")
+	}
+}
+
+func TestConcurrentRotationCreatesOneKey(t *testing.T) {
+	r := newFakeRepository()
+	instances := []*Keyring{newTestKeyring(t, r, AlgorithmEdDSA), newTestKeyring(t, r, AlgorithmEdDSA), newTestKeyring(t, r, AlgorithmEdDSA)}
+
+	var wg sync.WaitGroup
+	for _, k := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := k.Rotate(context.Background()); err != nil {
+				t.Errorf("Rotate: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(r.signingKeys) != 2 {
+		t.Fatalf("%d keys after rotating on %d instances at once, want 2", len(r.signingKeys), len(instances))
+	}
+	// Every instance signs with the same key once it is active
+	for _, k := range instances {
+		activate(t, r, k)
+		if _, kid := signedKid(t, k); kid != r.signingKeys[1].Kid {
+			t.Errorf("signed with %s, want %s", kid, r.signingKeys[1].Kid)
+		}
+	}
+}
+
+// startingRepository hides the keys from the first load, like for an instance which starts while another
+// creates the first key
+type startingRepository struct {
+	*fakeRepository
+	loaded bool
+}
+
+func (r *startingRepository) GetSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	if !r.loaded {
+		r.loaded = true
+		return []SigningKey{}, nil
+	}
+	return r.fakeRepository.GetSigningKeys(ctx)
+}
+
+func TestConcurrentStartCreatesOneKey(t *testing.T) {
+	r := newFakeRepository()
+	first := newTestKeyring(t, r, AlgorithmEdDSA)
+	second := newTestKeyring(t, &startingRepository{fakeRepository: r}, AlgorithmEdDSA)
+
+	if len(r.signingKeys) != 1 {
+		t.Fatalf("%d keys after starting 2 instances on an empty keyring, want 1", len(r.signingKeys))
+	}
+	tokenString, _ := signedKid(t, first)
+	if _, err := second.Parse(tokenString, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("Parse of a token of the other instance: %v", err)
+	}
+}
+
+func TestKeyringEncryptsPrivateKeys(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			r := newFakeRepository()
+			k := newTestKeyring(t, r, algorithm)
+			stored := r.signingKeys[0]
+			signer, err := k.signingKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// * 1. The stored key is not the private key in the clear
+			der, err := x509.MarshalPKCS8PrivateKey(signer.privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(stored.EncryptedPrivateKey, der) {
+				t.Error("stored key contains the private key in the clear")
+			}
+
+			// * 2. It decrypts to the private key
+			decrypted, err := k.decryptPrivateKey(stored.EncryptedPrivateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch public := decrypted.Public().(type) {
+			case ed25519.PublicKey:
+				if !public.Equal(signer.privateKey.Public()) {
+					t.Error("decrypted key differs from the private key")
+				}
+			case *rsa.PublicKey:
+				if !public.Equal(signer.privateKey.Public()) {
+					t.Error("decrypted key differs from the private key")
+				}
+			}
+
+			// * 3. A tampered key or another secret can't decrypt it
+			tampered := append([]byte{}, stored.EncryptedPrivateKey...)
+			tampered[len(tampered)-1] ^= 1
+			if _, err := k.decryptPrivateKey(tampered); err == nil {
+				t.Error("decryptPrivateKey of a tampered key = nil, want an error")
+			}
+			t.Setenv("JWT_KEYRING_SECRET", "other-keyring-secret")
+			if _, err := NewKeyring(context.Background(), r); err == nil {
+				t.Error("NewKeyring with another secret = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			k := newTestKeyring(t, newFakeRepository(), algorithm)
+			tokenString, kid := signedKid(t, k)
+
+			set, err := k.JWKS()
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, ok := set.Lookup(kid)
+			if !ok || key.Alg != algorithm {
+				t.Fatalf("JWKS = %+v, want the %s key %s", set, algorithm, kid)
+			}
+
+			// External verifiers check the tokens with the published key
+			publicKey, err := key.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+				return publicKey, nil
+			}, jwt.WithValidMethods([]string{algorithm}))
+			if err != nil {
+				t.Errorf("verifying with the published key: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyringVerifiesLegacyTokens(t *testing.T) {
+	legacySecret := "legacy-jwt-secret"
+	sign := func(method jwt.SigningMethod, secret string, kid string) string {
+		token := jwt.NewWithClaims(method, testClaims())
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		tokenString, err := token.SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenString
+	}
+
+	tests := []struct {
+		name         string
+		legacySecret string
+		token        string
+		wantErr      bool
+	}{
+		{"signed with JWT_SECRET", legacySecret, sign(jwt.SigningMethodHS256, legacySecret, ""), false},
+		{"after JWT_SECRET is unset", "", sign(jwt.SigningMethodHS256, legacySecret, ""), true},
+		{"signed with another secret", legacySecret, sign(jwt.SigningMethodHS256, "other-secret", ""), true},
+		{"signed with HS512", legacySecret, sign(jwt.SigningMethodHS512, legacySecret, ""), true},
+		// A kid makes the token be verified with a keyring key, never with the secret
+		{"with a kid", legacySecret, sign(jwt.SigningMethodHS256, legacySecret, "kid"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", tt.legacySecret)
+			k := newTestKeyring(t, newFakeRepository(), AlgorithmEdDSA)
+
+			_, err := k.Parse(tt.token, &jwt.RegisteredClaims{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+const AuthorizationCodeDuration = 5 * time.Minute
+
+type AuthorizationCode struct {
+	Code          string
+	ClientId      string
+	UserId        string
+	RedirectURI   string
+	Scopes        []authentication.Scope
+	CodeChallenge string
+	Nonce         string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	Used          bool
+}
+
+func (a *AuthorizationCode) Validate() error {
+	if a.Code == "" {
+		return errors.New("code is required")
+	}
+	if a.ClientId == "" || a.UserId == "" {
+		return errors.New("client and user are required")
+	}
+	if a.CodeChallenge == "" {
+		return errors.New("code challenge is required")
+	}
+	if time.Now().After(a.ExpiresAt) {
+		return errors.New("code has already expired")
+	}
+	if a.Used {
+		return errors.New("code has already been used")
+	}
+	return nil
+}
+
+// VerifyCodeVerifier checks the PKCE code verifier against the S256 challenge sent in the authorization request
+func (a *AuthorizationCode) VerifyCodeVerifier(codeVerifier string) bool {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(hash[:])
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(a.CodeChallenge)) == 1
+}
+
+func NewAuthorizationCode(rawCode string, req AuthorizationRequest, userId string, scopes []authentication.Scope) (*AuthorizationCode, error) {
+	now := time.Now()
+	code := &AuthorizationCode{
+		Code:          hashSecret(rawCode),
+		ClientId:      req.ClientId,
+		UserId:        userId,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(AuthorizationCodeDuration),
+		Used:          false,
+	}
+
+	if err := code.Validate(); err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
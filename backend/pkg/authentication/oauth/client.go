@@ -0,0 +1,86 @@
+package oauth
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+const MaxClientNameLen = 50
+
+// Client is an application registered to request access to users' jars.
+// Confidential clients authenticate with a secret; public clients rely on PKCE alone.
+type Client struct {
+	ClientId     string `bson:"_id,omitempty"`
+	OwnerUserId  string
+	Name         string
+	ClientSecret string `json:"-"`
+	RedirectURIs []string
+	Scopes       []authentication.Scope
+	Public       bool
+	CreatedAt    time.Time
+}
+
+func (c *Client) Validate() error {
+	if c.OwnerUserId == "" {
+		return errors.New("owner is required")
+	}
+	if c.Name == "" {
+		return apperror.InvalidField("name", "name is required")
+	}
+	if len(c.Name) > MaxClientNameLen {
+		return apperror.InvalidField("name", "name is too long")
+	}
+	if !c.Public && c.ClientSecret == "" {
+		return errors.New("client secret is required")
+	}
+	if len(c.RedirectURIs) == 0 {
+		return apperror.InvalidField("redirectURIs", "at least one redirect uri is required")
+	}
+	for _, redirectURI := range c.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return apperror.InvalidField("redirectURIs", "invalid redirect uri: "+redirectURI)
+		}
+		if u.Scheme != "https" && u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1" {
+			return apperror.InvalidField("redirectURIs", "redirect uri must use https: "+redirectURI)
+		}
+	}
+	if len(c.Scopes) == 0 {
+		return apperror.InvalidField("scopes", "at least one scope is required")
+	}
+	for _, scope := range c.Scopes {
+		if !IsValidScope(scope) {
+			return apperror.InvalidField("scopes", "invalid scope: "+string(scope))
+		}
+	}
+	return nil
+}
+
+func (c *Client) HasRedirectURI(redirectURI string) bool {
+	return slices.Contains(c.RedirectURIs, redirectURI)
+}
+
+func NewClient(ownerUserId string, name string, rawSecret string, redirectURIs []string, scopes []authentication.Scope, public bool) (*Client, error) {
+	client := &Client{
+		OwnerUserId:  ownerUserId,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		Public:       public,
+		CreatedAt:    time.Now(),
+	}
+	if !public {
+		client.ClientSecret = hashSecret(rawSecret)
+	}
+
+	if err := client.Validate(); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
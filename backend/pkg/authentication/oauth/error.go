@@ -0,0 +1,30 @@
+package oauth
+
+// Error is an OAuth2 error response (RFC 6749 section 5.2)
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func newError(code string, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+const (
+	ErrCodeInvalidRequest       = "invalid_request"
+	ErrCodeInvalidClient        = "invalid_client"
+	ErrCodeInvalidGrant         = "invalid_grant"
+	ErrCodeInvalidScope         = "invalid_scope"
+	ErrCodeUnsupportedGrantType = "unsupported_grant_type"
+	ErrCodeUnsupportedResponse  = "unsupported_response_type"
+	ErrCodeAccessDenied         = "access_denied"
+	ErrCodeInvalidToken         = "invalid_token"
+	ErrCodeServerError          = "server_error"
+)
@@ -0,0 +1,43 @@
+package oauth
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+// OpenID Connect scopes, in addition to the API scopes in the authentication package
+const (
+	ScopeOpenID  authentication.Scope = "openid"
+	ScopeEmail   authentication.Scope = "email"
+	ScopeProfile authentication.Scope = "profile"
+)
+
+func IsValidScope(s authentication.Scope) bool {
+	switch s {
+	case ScopeOpenID, ScopeEmail, ScopeProfile:
+		return true
+	default:
+		return s.IsValid()
+	}
+}
+
+// ParseScopes splits a space-delimited scope parameter, dropping duplicates
+func ParseScopes(scope string) []authentication.Scope {
+	scopes := []authentication.Scope{}
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, authentication.Scope(s)) {
+			scopes = append(scopes, authentication.Scope(s))
+		}
+	}
+	return scopes
+}
+
+func FormatScopes(scopes []authentication.Scope) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,497 @@
+// Package oauth implements a minimal OAuth2 authorization server with OpenID Connect support,
+// so other applications can let users "Sign in with SwearJar" and access their jars.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+const (
+	AccessTokenDuration = 1 * time.Hour
+	// accessTokenType distinguishes access tokens from ID tokens signed with the same key (RFC 9068)
+	accessTokenType = "at+jwt"
+)
+
+var ErrClientNotFound = apperror.NotFound("oauth_client_not_found", "oauth client not found")
+
+type Repository interface {
+	CreateOAuthClient(ctx context.Context, c Client) (Client, error)
+	GetOAuthClient(ctx context.Context, clientId string) (Client, error)
+	GetOAuthClientsByOwner(ctx context.Context, ownerUserId string) ([]Client, error)
+	DeleteOAuthClient(ctx context.Context, clientId string, ownerUserId string) error
+	CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, hashedCode string) (AuthorizationCode, error)
+	GetUserById(ctx context.Context, userId string) (authentication.UserResponse, error)
+}
+
+type Service interface {
+	RegisterClient(ctx context.Context, ownerUserId string, name string, redirectURIs []string, scopes []string, public bool) (c Client, clientSecret string, err error)
+	GetClients(ctx context.Context, ownerUserId string) ([]Client, error)
+	DeleteClient(ctx context.Context, ownerUserId string, clientId string) error
+	ValidateAuthorizationRequest(ctx context.Context, req AuthorizationRequest) (ConsentDetails, error)
+	Authorize(ctx context.Context, userId string, req AuthorizationRequest, approved bool) (redirectTo string, err error)
+	ExchangeCode(ctx context.Context, req TokenRequest) (TokenResponse, error)
+	Introspect(ctx context.Context, token string, clientId string, clientSecret string) (Introspection, error)
+	VerifyAccessToken(ctx context.Context, token string) (AccessTokenClaims, error)
+	UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error)
+	Discovery() DiscoveryDocument
+}
+
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// ConsentDetails is what the consent screen shows the user before they approve a client
+type ConsentDetails struct {
+	ClientId    string
+	ClientName  string
+	RedirectURI string
+	Scopes      []authentication.Scope
+}
+
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientId     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// Introspection is the token introspection response (RFC 7662)
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+type AccessTokenClaims struct {
+	ClientId string `json:"client_id"`
+	Scope    string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+func (c AccessTokenClaims) Scopes() []authentication.Scope {
+	return ParseScopes(c.Scope)
+}
+
+type idTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type DiscoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+}
+
+type service struct {
+	r      Repository
+	k      *authentication.Keyring
+	a      audit.Logger
+	issuer string
+}
+
+// NewService creates the authorization server. Tokens are signed with the same keyring as sessions,
+// so clients verify them against the keys published at /.well-known/jwks.json.
+func NewService(r Repository, k *authentication.Keyring, a audit.Logger) Service {
+	return &service{r, k, a, strings.TrimSuffix(os.Getenv("BACKEND_URL"), "/")}
+}
+
+func (s *service) RegisterClient(ctx context.Context, ownerUserId string, name string, redirectURIs []string, scopes []string, public bool) (c Client, clientSecret string, err error) {
+	if !public {
+		clientSecret, err = generateSecret()
+		if err != nil {
+			log.Printf("OAuthService: Error generating client secret: %v", err)
+			return Client{}, "", err
+		}
+	}
+
+	client, err := NewClient(ownerUserId, strings.TrimSpace(name), clientSecret, redirectURIs, ParseScopes(strings.Join(scopes, " ")), public)
+	if err != nil {
+		return Client{}, "", err
+	}
+
+	c, err = s.r.CreateOAuthClient(ctx, *client)
+	if err != nil {
+		log.Printf("OAuthService: Error storing client in db: %v", err)
+		return Client{}, "", err
+	}
+
+	s.logClientEvent(ctx, ownerUserId, audit.ActionOAuthClientRegistered, c.ClientId, map[string]string{"name": c.Name})
+	log.Printf("OAuthService: Client {%s} registered by user {%s}", c.ClientId, ownerUserId)
+	return c, clientSecret, nil
+}
+
+func (s *service) GetClients(ctx context.Context, ownerUserId string) ([]Client, error) {
+	return s.r.GetOAuthClientsByOwner(ctx, ownerUserId)
+}
+
+func (s *service) DeleteClient(ctx context.Context, ownerUserId string, clientId string) error {
+	if err := s.r.DeleteOAuthClient(ctx, clientId, ownerUserId); err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ErrClientNotFound
+		}
+		return err
+	}
+
+	s.logClientEvent(ctx, ownerUserId, audit.ActionOAuthClientDeleted, clientId, nil)
+	return nil
+}
+
+func (s *service) ValidateAuthorizationRequest(ctx context.Context, req AuthorizationRequest) (ConsentDetails, error) {
+	client, err := s.r.GetOAuthClient(ctx, req.ClientId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ConsentDetails{}, newError(ErrCodeInvalidClient, "unknown client")
+		}
+		return ConsentDetails{}, err
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return ConsentDetails{}, newError(ErrCodeInvalidRequest, "redirect_uri is not registered for this client")
+	}
+	if req.ResponseType != "code" {
+		return ConsentDetails{}, newError(ErrCodeUnsupportedResponse, "only the code response type is supported")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return ConsentDetails{}, newError(ErrCodeInvalidRequest, "PKCE with the S256 method is required")
+	}
+
+	scopes := ParseScopes(req.Scope)
+	if len(scopes) == 0 {
+		return ConsentDetails{}, newError(ErrCodeInvalidScope, "scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return ConsentDetails{}, newError(ErrCodeInvalidScope, "scope not allowed for this client: "+string(scope))
+		}
+	}
+
+	return ConsentDetails{
+		ClientId:    client.ClientId,
+		ClientName:  client.Name,
+		RedirectURI: req.RedirectURI,
+		Scopes:      scopes,
+	}, nil
+}
+
+// Authorize records the user's consent decision and returns the url the user is redirected back to the client with
+func (s *service) Authorize(ctx context.Context, userId string, req AuthorizationRequest, approved bool) (redirectTo string, err error) {
+	consent, err := s.ValidateAuthorizationRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !approved {
+		s.logClientEvent(ctx, userId, audit.ActionOAuthConsentDenied, consent.ClientId, nil)
+		params.Set("error", ErrCodeAccessDenied)
+		return appendQuery(req.RedirectURI, params), nil
+	}
+
+	rawCode, err := generateSecret()
+	if err != nil {
+		log.Printf("OAuthService: Error generating authorization code: %v", err)
+		return "", err
+	}
+	code, err := NewAuthorizationCode(rawCode, req, userId, consent.Scopes)
+	if err != nil {
+		return "", err
+	}
+	if err := s.r.CreateAuthorizationCode(ctx, *code); err != nil {
+		log.Printf("OAuthService: Error storing authorization code in db: %v", err)
+		return "", err
+	}
+
+	s.logClientEvent(ctx, userId, audit.ActionOAuthConsentGranted, consent.ClientId, map[string]string{"scope": FormatScopes(consent.Scopes)})
+	params.Set("code", rawCode)
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+func (s *service) ExchangeCode(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	if req.GrantType != "authorization_code" {
+		return TokenResponse{}, newError(ErrCodeUnsupportedGrantType, "only the authorization_code grant is supported")
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientId, req.ClientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	// The code is marked as used before any other check, so a leaked code can only be tried once
+	code, err := s.r.ConsumeAuthorizationCode(ctx, hashSecret(req.Code))
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return TokenResponse{}, newError(ErrCodeInvalidGrant, "invalid authorization code")
+		}
+		return TokenResponse{}, err
+	}
+	if time.Now().After(code.ExpiresAt) {
+		return TokenResponse{}, newError(ErrCodeInvalidGrant, "authorization code has expired")
+	}
+	if code.ClientId != client.ClientId || code.RedirectURI != req.RedirectURI {
+		return TokenResponse{}, newError(ErrCodeInvalidGrant, "authorization code was not issued to this client")
+	}
+	if !code.VerifyCodeVerifier(req.CodeVerifier) {
+		return TokenResponse{}, newError(ErrCodeInvalidGrant, "PKCE verification failed")
+	}
+
+	now := time.Now()
+	signedAccessToken, err := s.sign(AccessTokenClaims{
+		ClientId: client.ClientId,
+		Scope:    FormatScopes(code.Scopes),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   code.UserId,
+			Audience:  jwt.ClaimStrings{s.issuer},
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        hashSecret(req.Code)[:16],
+		},
+	}, map[string]interface{}{"typ": accessTokenType})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	response := TokenResponse{
+		AccessToken: signedAccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(AccessTokenDuration.Seconds()),
+		Scope:       FormatScopes(code.Scopes),
+	}
+
+	if slices.Contains(code.Scopes, ScopeOpenID) {
+		response.IDToken, err = s.createIDToken(ctx, client.ClientId, code, now)
+		if err != nil {
+			return TokenResponse{}, err
+		}
+	}
+
+	s.logClientEvent(ctx, code.UserId, audit.ActionOAuthTokenIssued, client.ClientId, map[string]string{"scope": response.Scope})
+	log.Printf("OAuthService: Issued access token to client {%s} for user {%s}", client.ClientId, code.UserId)
+	return response, nil
+}
+
+func (s *service) createIDToken(ctx context.Context, clientId string, code AuthorizationCode, now time.Time) (string, error) {
+	user, err := s.r.GetUserById(ctx, code.UserId)
+	if err != nil {
+		return "", err
+	}
+
+	claims := idTokenClaims{
+		Nonce: code.Nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   code.UserId,
+			Audience:  jwt.ClaimStrings{clientId},
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if slices.Contains(code.Scopes, ScopeEmail) {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.Verified
+	}
+	if slices.Contains(code.Scopes, ScopeProfile) {
+		claims.Name = user.Name
+	}
+
+	return s.sign(claims, nil)
+}
+
+func (s *service) Introspect(ctx context.Context, token string, clientId string, clientSecret string) (Introspection, error) {
+	if _, err := s.authenticateClient(ctx, clientId, clientSecret); err != nil {
+		return Introspection{}, err
+	}
+
+	claims, err := s.VerifyAccessToken(ctx, token)
+	if err != nil {
+		// Invalid tokens are reported as inactive rather than as an error
+		return Introspection{Active: false}, nil
+	}
+
+	return Introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientId:  claims.ClientId,
+		Subject:   claims.Subject,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		IssuedAt:  claims.IssuedAt.Unix(),
+		Issuer:    claims.Issuer,
+	}, nil
+}
+
+// VerifyAccessToken validates an access token issued by this server. Tokens of deleted clients are rejected.
+func (s *service) VerifyAccessToken(ctx context.Context, token string) (AccessTokenClaims, error) {
+	var claims AccessTokenClaims
+	parsed, err := s.k.Parse(token, &claims, jwt.WithIssuer(s.issuer), jwt.WithAudience(s.issuer))
+	if err != nil {
+		return AccessTokenClaims{}, newError(ErrCodeInvalidToken, err.Error())
+	}
+	if typ, _ := parsed.Header["typ"].(string); typ != accessTokenType {
+		return AccessTokenClaims{}, newError(ErrCodeInvalidToken, "not an access token")
+	}
+
+	if _, err := s.r.GetOAuthClient(ctx, claims.ClientId); err != nil {
+		return AccessTokenClaims{}, newError(ErrCodeInvalidToken, "client no longer exists")
+	}
+
+	return claims, nil
+}
+
+func (s *service) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	claims, err := s.VerifyAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	scopes := claims.Scopes()
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return nil, newError(ErrCodeInvalidToken, "token was not issued with the openid scope")
+	}
+
+	user, err := s.r.GetUserById(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	info := map[string]interface{}{"sub": user.UserId}
+	if slices.Contains(scopes, ScopeEmail) {
+		info["email"] = user.Email
+		info["email_verified"] = user.Verified
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		info["name"] = user.Name
+	}
+	return info, nil
+}
+
+func (s *service) Discovery() DiscoveryDocument {
+	scopes := []string{string(ScopeOpenID), string(ScopeEmail), string(ScopeProfile)}
+	for _, scope := range []authentication.Scope{authentication.ScopeSwearsRead, authentication.ScopeSwearsWrite, authentication.ScopeJarsRead, authentication.ScopeJarsWrite, authentication.ScopeUsersRead} {
+		scopes = append(scopes, string(scope))
+	}
+
+	return DiscoveryDocument{
+		Issuer:                            s.issuer,
+		AuthorizationEndpoint:             strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/") + "/oauth/authorize",
+		TokenEndpoint:                     s.issuer + "/oauth/token",
+		IntrospectionEndpoint:             s.issuer + "/oauth/introspect",
+		UserInfoEndpoint:                  s.issuer + "/oauth/userinfo",
+		JWKSURI:                           s.issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  s.k.Algorithms(),
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		ScopesSupported:                   scopes,
+	}
+}
+
+func (s *service) authenticateClient(ctx context.Context, clientId string, clientSecret string) (Client, error) {
+	client, err := s.r.GetOAuthClient(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return Client{}, newError(ErrCodeInvalidClient, "client authentication failed")
+		}
+		return Client{}, err
+	}
+	if client.Public {
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(clientSecret)), []byte(client.ClientSecret)) != 1 {
+		return Client{}, newError(ErrCodeInvalidClient, "client authentication failed")
+	}
+	return client, nil
+}
+
+func (s *service) sign(claims jwt.Claims, headers map[string]interface{}) (string, error) {
+	signed, err := s.k.Sign(claims, headers)
+	if err != nil {
+		log.Printf("OAuthService: Error signing token: %v", err)
+		return "", err
+	}
+	return signed, nil
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + params.Encode()
+}
+
+func generateSecret() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate random secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// logClientEvent records an audit event on the client, attributed to the user who owns it or granted it access
+func (s *service) logClientEvent(ctx context.Context, userId string, action audit.Action, clientId string, details map[string]string) {
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     action,
+		TargetType: audit.TargetOAuthClient,
+		TargetId:   clientId,
+		Details:    details,
+	})
+}
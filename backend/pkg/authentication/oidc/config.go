@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Providers maps provider names, as used in the login urls, to providers
+type Providers map[string]*Provider
+
+// Names returns the names of the configured providers
+func (ps Providers) Names() []string {
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	return names
+}
+
+// LoadProvidersFromEnv configures the providers listed in OIDC_PROVIDERS (e.g. "google,github,corp").
+// Each provider is configured with OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and, for generic providers,
+// OIDC_<NAME>_ISSUER. OIDC_<NAME>_TYPE is "oidc" (default) or "github", and OIDC_<NAME>_SCOPES overrides the
+// default scopes. Callbacks are served at BACKEND_URL/auth/oidc/<name>/callback.
+func LoadProvidersFromEnv() (Providers, error) {
+	providers := Providers{}
+	backendURL := strings.TrimSuffix(os.Getenv("BACKEND_URL"), "/")
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		config := ProviderConfig{
+			Name:         name,
+			Type:         ProviderType(os.Getenv(prefix + "TYPE")),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  backendURL + "/auth/oidc/" + name + "/callback",
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			config.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+
+		// Well-known providers only need client credentials
+		switch name {
+		case "google":
+			if config.Issuer == "" {
+				config.Issuer = "https://accounts.google.com"
+			}
+		case "github":
+			if config.Type == "" {
+				config.Type = ProviderTypeGitHub
+			}
+		}
+		if config.Type == "" {
+			config.Type = ProviderTypeOIDC
+		}
+		if config.Type == ProviderTypeGitHub {
+			config.AuthURL = "https://github.com/login/oauth/authorize"
+			config.TokenURL = "https://github.com/login/oauth/access_token"
+			config.UserInfoURL = "https://api.github.com/user"
+		}
+
+		provider, err := NewProvider(config, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring oidc provider %s: %w", name, err)
+		}
+		providers[name] = provider
+		log.Printf("OIDC: Configured provider %s", name)
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,72 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type githubUser struct {
+	Id    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// githubIdentity fetches the user and their primary verified email, as GitHub does not issue ID tokens
+func (p *Provider) githubIdentity(accessToken string) (Identity, error) {
+	var user githubUser
+	if err := p.githubGet(p.config.UserInfoURL, accessToken, &user); err != nil {
+		return Identity{}, err
+	}
+	if user.Id == 0 {
+		return Identity{}, errors.New("github user id is missing")
+	}
+
+	var emails []githubEmail
+	if err := p.githubGet(strings.TrimSuffix(p.config.UserInfoURL, "/")+"/emails", accessToken, &emails); err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{
+		Provider: p.config.Name,
+		Subject:  strconv.FormatInt(user.Id, 10),
+		Name:     user.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = e.Email
+			identity.EmailVerified = e.Verified
+			break
+		}
+	}
+
+	return identity, nil
+}
+
+func (p *Provider) githubGet(url string, accessToken string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	status, err := doJSON(p.httpClient, req, v)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return errors.New("github api returned status " + strconv.Itoa(status))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var allowedSigningMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256", "EdDSA"}
+
+type idTokenClaims struct {
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	Name          string       `json:"name"`
+	AZP           string       `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// flexibleBool accepts both true and "true", as some providers encode email_verified as a string
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = v == "true"
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// verifyIDToken checks the signature against the provider's JWKS along with the issuer, audience, expiry and nonce
+func (p *Provider) verifyIDToken(rawIDToken string, nonce string) (Identity, error) {
+	if _, err := p.getDiscovery(); err != nil {
+		return Identity{}, err
+	}
+
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.jwks.getKey(kid)
+		},
+		jwt.WithValidMethods(allowedSigningMethods),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		log.Printf("OIDC: Error verifying id token from %s: %v", p.config.Name, err)
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		log.Printf("OIDC: Nonce mismatch in id token from %s", p.config.Name)
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	// With multiple audiences, the authorized party must be us
+	if len(claims.Audience) > 1 && claims.AZP != p.config.ClientID {
+		log.Printf("OIDC: Unexpected authorized party in id token from %s: %s", p.config.Name, claims.AZP)
+		return Identity{}, ErrInvalidIDToken
+	}
+	if claims.AZP != "" && !slices.Contains(claims.Audience, claims.AZP) {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return Identity{
+		Provider:      p.config.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package oidc
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/jwk"
+)
+
+// minRefreshInterval limits how often an unknown kid can trigger a refetch of the JWKS
+const minRefreshInterval = 1 * time.Minute
+
+// keySet caches the provider's JWKS and refetches it when a token is signed with an unknown key
+type keySet struct {
+	uri        string
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	keys        jwk.Set
+	lastFetched time.Time
+}
+
+func newKeySet(uri string, httpClient *http.Client) *keySet {
+	return &keySet{uri: uri, httpClient: httpClient}
+}
+
+func (ks *keySet) getKey(kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys.Lookup(kid)
+	if !ok && time.Since(ks.lastFetched) > minRefreshInterval {
+		if err := ks.refresh(); err != nil {
+			return nil, err
+		}
+		key, ok = ks.keys.Lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("no key found for kid %q", kid)
+	}
+
+	return key.PublicKey()
+}
+
+func (ks *keySet) refresh() error {
+	req, err := http.NewRequest(http.MethodGet, ks.uri, nil)
+	if err != nil {
+		return err
+	}
+	var keys jwk.Set
+	status, err := doJSON(ks.httpClient, req, &keys)
+	if err != nil {
+		return fmt.Errorf("error fetching jwks: %w", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("jwks endpoint returned status %d", status)
+	}
+	if len(keys.Keys) == 0 {
+		return errors.New("jwks contains no keys")
+	}
+
+	ks.keys = keys
+	ks.lastFetched = time.Now()
+	return nil
+}
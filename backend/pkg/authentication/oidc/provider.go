@@ -0,0 +1,257 @@
+// Package oidc implements the client side of the OAuth2 authorization code flow with PKCE
+// for signing in with external identity providers (OpenID Connect providers and GitHub).
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ProviderType string
+
+const (
+	ProviderTypeOIDC   ProviderType = "oidc"
+	ProviderTypeGitHub ProviderType = "github"
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// Identity is the user information asserted by an identity provider
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type ProviderConfig struct {
+	Name         string
+	Type         ProviderType
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// Endpoints are discovered from the issuer for OIDC providers, and must be set for GitHub
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type Provider struct {
+	config     ProviderConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	jwks      *keySet
+}
+
+// NewProvider creates a provider. The discovery document of OIDC providers is fetched lazily on first use.
+func NewProvider(config ProviderConfig, httpClient *http.Client) (*Provider, error) {
+	if config.Name == "" {
+		return nil, errors.New("provider name is required")
+	}
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("client id is required for provider %s", config.Name)
+	}
+	if config.RedirectURL == "" {
+		return nil, fmt.Errorf("redirect url is required for provider %s", config.Name)
+	}
+	switch config.Type {
+	case ProviderTypeOIDC:
+		if config.Issuer == "" {
+			return nil, fmt.Errorf("issuer is required for provider %s", config.Name)
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = []string{"openid", "email", "profile"}
+		}
+	case ProviderTypeGitHub:
+		if config.AuthURL == "" || config.TokenURL == "" || config.UserInfoURL == "" {
+			return nil, fmt.Errorf("auth, token and user info urls are required for provider %s", config.Name)
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = []string{"read:user", "user:email"}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported provider type: %s", config.Type)
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{config: config, httpClient: httpClient}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL returns the url of the provider's consent page the user is redirected to
+func (p *Provider) AuthCodeURL(state string, nonce string, codeVerifier string) (string, error) {
+	authURL := p.config.AuthURL
+	if p.config.Type == ProviderTypeOIDC {
+		d, err := p.getDiscovery()
+		if err != nil {
+			return "", err
+		}
+		authURL = d.AuthorizationEndpoint
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", CodeChallengeS256(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+	if p.config.Type == ProviderTypeOIDC {
+		params.Set("nonce", nonce)
+	}
+
+	separator := "?"
+	if strings.Contains(authURL, "?") {
+		separator = "&"
+	}
+	return authURL + separator + params.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the identity of the user.
+// For OIDC providers the identity is taken from the verified ID token; the nonce must match the one sent in AuthCodeURL.
+func (p *Provider) Exchange(code string, codeVerifier string, nonce string) (Identity, error) {
+	if code == "" {
+		return Identity{}, errors.New("authorization code is required")
+	}
+
+	tokenURL := p.config.TokenURL
+	if p.config.Type == ProviderTypeOIDC {
+		d, err := p.getDiscovery()
+		if err != nil {
+			return Identity{}, err
+		}
+		tokenURL = d.TokenEndpoint
+	}
+
+	token, err := p.exchangeCode(tokenURL, code, codeVerifier)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	switch p.config.Type {
+	case ProviderTypeGitHub:
+		return p.githubIdentity(token.AccessToken)
+	default:
+		if token.IDToken == "" {
+			return Identity{}, errors.New("token response did not contain an id token")
+		}
+		return p.verifyIDToken(token.IDToken, nonce)
+	}
+}
+
+func (p *Provider) exchangeCode(tokenURL string, code string, codeVerifier string) (tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token tokenResponse
+	status, err := doJSON(p.httpClient, req, &token)
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("error exchanging authorization code: %w", err)
+	}
+	if token.Error != "" {
+		return tokenResponse{}, fmt.Errorf("token endpoint returned error: %s %s", token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK || token.AccessToken == "" {
+		return tokenResponse{}, fmt.Errorf("token endpoint returned status %d", status)
+	}
+	return token, nil
+}
+
+func (p *Provider) getDiscovery() (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequest(http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var d discoveryDocument
+	status, err := doJSON(p.httpClient, req, &d)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching discovery document: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery endpoint returned status %d", status)
+	}
+	if d.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", d.Issuer, p.config.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	p.discovery = &d
+	p.jwks = newKeySet(d.JWKSURI, p.httpClient)
+	return p.discovery, nil
+}
+
+// doJSON performs the request and decodes the JSON response body, returning the status code
+func doJSON(httpClient *http.Client, req *http.Request, v interface{}) (int, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return resp.StatusCode, fmt.Errorf("error decoding response with status %d: %w", resp.StatusCode, err)
+	}
+	return resp.StatusCode, nil
+}
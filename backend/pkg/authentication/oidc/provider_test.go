@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oidc/oidctest"
+)
+
+const testRedirectURL = "http://localhost:8080/auth/oidc/mock/callback"
+
+var testUser = oidctest.User{Subject: "1234", Email: "alex@example.com", EmailVerified: true, Name: "Alex"}
+
+func newTestProvider(t *testing.T, user oidctest.User) (*Provider, *oidctest.Server) {
+	t.Helper()
+	server := oidctest.NewServer("client", "secret", user)
+	t.Cleanup(server.Close)
+
+	provider, err := NewProvider(ProviderConfig{
+		Name:         "mock",
+		Type:         ProviderTypeOIDC,
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, server
+}
+
+// authorize follows the authorization url like the browser would and returns the query of the redirect back
+func authorize(t *testing.T, provider *Provider, state string, nonce string, codeVerifier string) url.Values {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(state, nonce, codeVerifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Scheme+"://"+location.Host+location.Path != testRedirectURL {
+		t.Fatalf("redirected to %s, want %s", location, testRedirectURL)
+	}
+	return location.Query()
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	provider, _ := newTestProvider(t, testUser)
+
+	authURL, err := provider.AuthCodeURL("state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        CodeChallengeS256("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	provider, _ := newTestProvider(t, testUser)
+	codeVerifier, _ := GenerateRandomString()
+
+	q := authorize(t, provider, "state", "nonce", codeVerifier)
+	if q.Get("state") != "state" {
+		t.Errorf("state = %q, want it returned unchanged", q.Get("state"))
+	}
+
+	identity, err := provider.Exchange(q.Get("code"), codeVerifier, "nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Identity{Provider: "mock", Subject: "1234", Email: "alex@example.com", EmailVerified: true, Name: "Alex"}
+	if identity != want {
+		t.Errorf("Exchange = %+v, want %+v", identity, want)
+	}
+
+	// A code can only be redeemed once
+	if _, err := provider.Exchange(q.Get("code"), codeVerifier, "nonce"); err == nil {
+		t.Error("redeeming the code twice succeeded")
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	provider, _ := newTestProvider(t, testUser)
+
+	q := authorize(t, provider, "state", "nonce", "verifier")
+	if _, err := provider.Exchange(q.Get("code"), "another verifier", "nonce"); err == nil {
+		t.Error("Exchange succeeded with a code verifier which does not match the code challenge")
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	provider, _ := newTestProvider(t, testUser)
+
+	for _, nonce := range []string{"another nonce", ""} {
+		q := authorize(t, provider, "state", "nonce", "verifier")
+		if _, err := provider.Exchange(q.Get("code"), "verifier", nonce); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("Exchange with nonce %q error = %v, want %v", nonce, err, ErrInvalidIDToken)
+		}
+	}
+}
+
+func TestExchangeReturnsUnverifiedEmail(t *testing.T) {
+	provider, server := newTestProvider(t, testUser)
+	server.SetUser(oidctest.User{Subject: "5678", Email: "sam@example.com", EmailVerified: false, Name: "Sam"})
+
+	q := authorize(t, provider, "state", "nonce", "verifier")
+	identity, err := provider.Exchange(q.Get("code"), "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	// Refusing to link or create accounts by an unverified email is up to the authentication service
+	if identity.EmailVerified {
+		t.Error("EmailVerified = true, want false")
+	}
+}
@@ -0,0 +1,385 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+)
+
+const PasskeyChallengeDuration = webauthn.DefaultTimeout
+
+var ErrPasskeyTaken = apperror.Conflict("passkey_taken", "passkey is already registered")
+var ErrInvalidPasskey = apperror.Validation("invalid_passkey", "passkey could not be verified", nil)
+var ErrPasskeyNotFound = apperror.NotFound("passkey_not_found", "passkey not found")
+var ErrNoPasskeys = apperror.Validation("no_passkeys", "register a passkey before enabling it as a second factor", nil)
+
+// Passkey is a WebAuthn credential registered by a user, stored with the user
+type Passkey struct {
+	CredentialId   string // base64url encoded
+	Name           string
+	PublicKey      []byte `json:"-"` // COSE_Key
+	SignCount      uint32 `json:"-"`
+	Transports     []string
+	BackupEligible bool // Synced passkeys are backup eligible, security keys are not
+	CreatedAt      time.Time
+	LastUsedAt     time.Time
+}
+
+func (p Passkey) credential() (webauthn.Credential, error) {
+	id, err := base64.RawURLEncoding.DecodeString(p.CredentialId)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+	return webauthn.Credential{
+		ID:         id,
+		PublicKey:  p.PublicKey,
+		SignCount:  p.SignCount,
+		Transports: p.Transports,
+	}, nil
+}
+
+func (p Passkey) descriptor() webauthn.CredentialDescriptor {
+	id, _ := base64.RawURLEncoding.DecodeString(p.CredentialId)
+	return webauthn.CredentialDescriptor{Type: "public-key", ID: id, Transports: p.Transports}
+}
+
+// SecondFactorRequiredError is returned by logins of users who protect their account with a passkey.
+// The login is completed by signing the challenge in Options with one of their passkeys.
+type SecondFactorRequiredError struct {
+	Options webauthn.RequestOptions
+}
+
+func (e *SecondFactorRequiredError) Error() string {
+	return "a passkey is required to complete the login"
+}
+
+// createPasskeyChallenge stores a challenge for the ceremony. Challenges are stored like emailed tokens, except
+// that the authenticator signs them and returns them in the client data.
+func (s *service) createPasskeyChallenge(ctx context.Context, email string, purpose PurposeType) (string, error) {
+	challengeBytes := make([]byte, 32)
+	if _, err := rand.Read(challengeBytes); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(challengeBytes)
+
+	authToken, err := NewAuthToken(email, challenge, purpose, PasskeyChallengeDuration)
+	if err != nil {
+		return "", err
+	}
+	if err := s.r.CreateAuthToken(ctx, *authToken); err != nil {
+		log.Printf("AuthService: Error storing passkey challenge in db: %v", err)
+		return "", err
+	}
+	return challenge, nil
+}
+
+func (s *service) BeginPasskeyRegistration(ctx context.Context, userId string) (webauthn.CreationOptions, error) {
+	user, err := s.r.GetUserById(ctx, userId)
+	if err != nil {
+		log.Printf("AuthService: Error fetching user {%s}: %v", userId, err)
+		return webauthn.CreationOptions{}, err
+	}
+	passkeys, err := s.r.GetPasskeys(ctx, userId)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+
+	challenge, err := s.createPasskeyChallenge(ctx, user.Email, PurposePasskeyRegistration)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, passkey.descriptor())
+	}
+
+	// The user id is the user handle, which discoverable credentials return on passwordless login
+	return s.w.CreationOptions(challenge, webauthn.UserEntity{
+		ID:          []byte(user.UserId),
+		Name:        user.Email,
+		DisplayName: user.Name,
+	}, exclude), nil
+}
+
+func (s *service) FinishPasskeyRegistration(ctx context.Context, userId string, name string, resp webauthn.RegistrationResponse) (Passkey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len([]rune(name)) > 50 {
+		return Passkey{}, apperror.InvalidField("name", "name must be at most 50 characters")
+	}
+
+	user, err := s.r.GetUserById(ctx, userId)
+	if err != nil {
+		log.Printf("AuthService: Error fetching user {%s}: %v", userId, err)
+		return Passkey{}, err
+	}
+
+	// * 1. The challenge must have been issued to this user
+	challenge, err := resp.Challenge()
+	if err != nil {
+		return Passkey{}, ErrInvalidToken
+	}
+	authToken, err := s.verifyAndGetAuthToken(ctx, challenge, string(PurposePasskeyRegistration))
+	if err != nil {
+		return Passkey{}, err
+	}
+	if authToken.Email != user.Email {
+		log.Printf("AuthService: Passkey registration challenge was not issued to user {%s}", userId)
+		return Passkey{}, ErrInvalidToken
+	}
+
+	// * 2. Verify the response of the authenticator
+	cred, err := s.w.VerifyRegistration(resp, challenge, false)
+	if err != nil {
+		log.Printf("AuthService: Error verifying passkey registration for user {%s}: %v", userId, err)
+		return Passkey{}, ErrInvalidPasskey.WithCause(err)
+	}
+
+	// * 3. Store the passkey and consume the challenge
+	now := time.Now()
+	passkey := Passkey{
+		CredentialId:   base64.RawURLEncoding.EncodeToString(cred.ID),
+		Name:           name,
+		PublicKey:      cred.PublicKey,
+		SignCount:      cred.SignCount,
+		Transports:     cred.Transports,
+		BackupEligible: cred.BackupEligible,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+	}
+	if err := s.r.AddPasskeyAndMarkToken(ctx, userId, passkey, encryptToken(challenge)); err != nil {
+		if !errors.Is(err, ErrPasskeyTaken) {
+			log.Printf("AuthService: Error storing passkey for user {%s}: %v", userId, err)
+		}
+		return Passkey{}, err
+	}
+
+	s.logUserEvent(ctx, userId, audit.ActionPasskeyRegistered, userId, map[string]string{"credentialId": passkey.CredentialId, "name": name})
+	log.Printf("AuthService: Passkey registered for user {%s}", userId)
+	return passkey, nil
+}
+
+func (s *service) GetPasskeys(ctx context.Context, userId string) ([]Passkey, error) {
+	return s.r.GetPasskeys(ctx, userId)
+}
+
+// DeletePasskey removes the passkey. Removing the last passkey also turns off the second factor, so the user
+// is not locked out.
+func (s *service) DeletePasskey(ctx context.Context, userId string, credentialId string) error {
+	if err := s.r.DeletePasskey(ctx, userId, credentialId); err != nil {
+		if errors.Is(err, ErrNoDocuments) {
+			return ErrPasskeyNotFound
+		}
+		log.Printf("AuthService: Error deleting passkey for user {%s}: %v", userId, err)
+		return err
+	}
+
+	s.logUserEvent(ctx, userId, audit.ActionPasskeyDeleted, userId, map[string]string{"credentialId": credentialId})
+	return nil
+}
+
+// SetPasskeySecondFactor turns requiring a passkey after the password or magic link on or off.
+// The user must reauthenticate, see Reauthentication.
+func (s *service) SetPasskeySecondFactor(ctx context.Context, userId string, reauth Reauthentication, enabled bool) error {
+	storedUser, err := s.getUserWithPassword(ctx, userId)
+	if err != nil {
+		log.Printf("AuthService: Error fetching user {%s}: %v", userId, err)
+		return err
+	}
+	if err := s.reauthenticate(ctx, storedUser, reauth); err != nil {
+		return err
+	}
+
+	if enabled {
+		passkeys, err := s.r.GetPasskeys(ctx, userId)
+		if err != nil {
+			return err
+		}
+		if len(passkeys) == 0 {
+			return ErrNoPasskeys
+		}
+	}
+
+	if err := s.r.SetPasskeySecondFactor(ctx, userId, enabled); err != nil {
+		log.Printf("AuthService: Error updating second factor for user {%s}: %v", userId, err)
+		return err
+	}
+
+	action := audit.ActionSecondFactorDisabled
+	if enabled {
+		action = audit.ActionSecondFactorEnabled
+	}
+	s.logUserEvent(ctx, userId, action, userId, nil)
+	return nil
+}
+
+// BeginReauthentication issues the challenge a passkey of the user signs to confirm it's them before a sensitive
+// change to their account. The passkey stands in for the password, so the authenticator must verify the user.
+func (s *service) BeginReauthentication(ctx context.Context, userId string) (webauthn.RequestOptions, error) {
+	storedUser, err := s.getUserWithPassword(ctx, userId)
+	if err != nil {
+		return webauthn.RequestOptions{}, err
+	}
+	passkeys, err := s.r.GetPasskeys(ctx, userId)
+	if err != nil {
+		return webauthn.RequestOptions{}, err
+	}
+	if len(passkeys) == 0 {
+		return webauthn.RequestOptions{}, ErrPasskeyNotFound
+	}
+
+	challenge, err := s.createPasskeyChallenge(ctx, storedUser.Email, PurposeReauthentication)
+	if err != nil {
+		return webauthn.RequestOptions{}, err
+	}
+	allow := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		allow = append(allow, passkey.descriptor())
+	}
+	return s.w.RequestOptions(challenge, allow, webauthn.RequirementRequired), nil
+}
+
+// BeginPasskeyLogin starts a passwordless login. No email is needed, as the authenticator offers the
+// discoverable credentials it holds for SwearJar.
+func (s *service) BeginPasskeyLogin(ctx context.Context) (webauthn.RequestOptions, error) {
+	challenge, err := s.createPasskeyChallenge(ctx, "", PurposePasskeyLogin)
+	if err != nil {
+		return webauthn.RequestOptions{}, err
+	}
+
+	// The passkey replaces the password, so the authenticator must verify the user, e.g. with biometrics
+	return s.w.RequestOptions(challenge, nil, webauthn.RequirementRequired), nil
+}
+
+func (s *service) FinishPasskeyLogin(ctx context.Context, resp webauthn.AuthenticationResponse) (ur UserResponse, jwt string, csrfToken string, err error) {
+	storedUser, err := s.r.GetUserByPasskey(ctx, base64.RawURLEncoding.EncodeToString(resp.RawID))
+	if err != nil {
+		if errors.Is(err, ErrNoDocuments) {
+			return UserResponse{}, "", "", ErrUnauthorized
+		}
+		return UserResponse{}, "", "", err
+	}
+
+	// Discoverable credentials return the user handle they were registered with
+	if len(resp.Response.UserHandle) != 0 && string(resp.Response.UserHandle) != storedUser.UserId {
+		log.Printf("AuthService: Passkey user handle does not match user {%s}", storedUser.UserId)
+		return UserResponse{}, "", "", ErrUnauthorized
+	}
+
+	if err := s.verifyPasskeyAssertion(ctx, storedUser, resp, PurposePasskeyLogin, true); err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	s.logUserEvent(ctx, storedUser.UserId, audit.ActionLogin, storedUser.UserId, map[string]string{"method": "passkey"})
+	return s.issueSession(storedUser)
+}
+
+// FinishSecondFactor completes a login which returned SecondFactorRequiredError
+func (s *service) FinishSecondFactor(ctx context.Context, resp webauthn.AuthenticationResponse) (ur UserResponse, jwt string, csrfToken string, err error) {
+	challenge, err := resp.Challenge()
+	if err != nil {
+		return UserResponse{}, "", "", ErrInvalidToken
+	}
+	authToken, err := s.verifyAndGetAuthToken(ctx, challenge, string(PurposePasskeySecondFactor))
+	if err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	storedUser, err := s.r.GetUserByEmail(ctx, authToken.Email)
+	if err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	if err := s.verifyPasskeyAssertion(ctx, storedUser, resp, PurposePasskeySecondFactor, false); err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	s.logUserEvent(ctx, storedUser.UserId, audit.ActionLogin, storedUser.UserId, map[string]string{"method": "passkey_second_factor"})
+	return s.issueSession(storedUser)
+}
+
+// requireSecondFactor issues the challenge a passkey of the user must sign to complete the login
+func (s *service) requireSecondFactor(ctx context.Context, storedUser User) error {
+	passkeys, err := s.r.GetPasskeys(ctx, storedUser.UserId)
+	if err != nil {
+		return err
+	}
+	challenge, err := s.createPasskeyChallenge(ctx, storedUser.Email, PurposePasskeySecondFactor)
+	if err != nil {
+		return err
+	}
+
+	allow := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		allow = append(allow, passkey.descriptor())
+	}
+	return &SecondFactorRequiredError{Options: s.w.RequestOptions(challenge, allow, webauthn.RequirementPreferred)}
+}
+
+// verifyPasskeyAssertion verifies the challenge was signed by one of the user's passkeys, then stores the new
+// signature counter and consumes the challenge
+func (s *service) verifyPasskeyAssertion(ctx context.Context, storedUser User, resp webauthn.AuthenticationResponse, purpose PurposeType, requireUserVerification bool) error {
+	// * 1. The challenge must be pending for this ceremony
+	challenge, err := resp.Challenge()
+	if err != nil {
+		return ErrInvalidToken
+	}
+	authToken, err := s.verifyAndGetAuthToken(ctx, challenge, string(purpose))
+	if err != nil {
+		return err
+	}
+	if authToken.Email != "" && authToken.Email != storedUser.Email {
+		return ErrInvalidToken
+	}
+
+	// * 2. Find the passkey the response was signed with
+	credentialId := base64.RawURLEncoding.EncodeToString(resp.RawID)
+	passkeys, err := s.r.GetPasskeys(ctx, storedUser.UserId)
+	if err != nil {
+		return err
+	}
+	var passkey *Passkey
+	for i := range passkeys {
+		if passkeys[i].CredentialId == credentialId {
+			passkey = &passkeys[i]
+			break
+		}
+	}
+	if passkey == nil {
+		return ErrUnauthorized
+	}
+	cred, err := passkey.credential()
+	if err != nil {
+		return err
+	}
+
+	// * 3. Verify the signature and the counter
+	signCount, err := s.w.VerifyAuthentication(resp, challenge, cred, requireUserVerification)
+	if err != nil {
+		log.Printf("AuthService: Error verifying passkey {%s} of user {%s}: %v", credentialId, storedUser.UserId, err)
+		reason := "invalid passkey assertion"
+		if errors.Is(err, webauthn.ErrSignCountRegression) {
+			reason = "passkey signature counter did not increase, the passkey may have been cloned"
+		}
+		s.logUserEvent(ctx, "", audit.ActionLoginFailed, storedUser.UserId, map[string]string{"reason": reason, "credentialId": credentialId})
+		return ErrUnauthorized
+	}
+
+	if err := s.r.UpdatePasskeyAndMarkToken(ctx, storedUser.UserId, credentialId, signCount, time.Now(), encryptToken(challenge)); err != nil {
+		log.Printf("AuthService: Error updating passkey {%s} of user {%s}: %v", credentialId, storedUser.UserId, err)
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package authentication
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn/webauthntest"
+)
+
+// registerPasskey registers a passkey of a new software authenticator for the user
+func registerPasskey(t *testing.T, s *service, userId string) (*webauthntest.Authenticator, Passkey) {
+	t.Helper()
+	ctx := context.Background()
+
+	opts, err := s.BeginPasskeyRegistration(ctx, userId)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration: %v", err)
+	}
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+	resp, err := authenticator.Register(opts)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	passkey, err := s.FinishPasskeyRegistration(ctx, userId, "Laptop", resp)
+	if err != nil {
+		t.Fatalf("FinishPasskeyRegistration: %v", err)
+	}
+	return authenticator, passkey
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	s, r, a := newTestService(t)
+	ctx := context.Background()
+	user := r.addUser(t, "alex@example.com", "correct horse battery staple")
+
+	authenticator, passkey := registerPasskey(t, s, user.UserId)
+
+	if passkey.Name != "Laptop" || len(passkey.PublicKey) == 0 || !passkey.BackupEligible {
+		t.Errorf("unexpected passkey: %+v", passkey)
+	}
+	passkeys, err := s.GetPasskeys(ctx, user.UserId)
+	if err != nil || len(passkeys) != 1 || passkeys[0].CredentialId != passkey.CredentialId {
+		t.Fatalf("GetPasskeys = %v, %v, want the registered passkey", passkeys, err)
+	}
+	if !a.has(audit.ActionPasskeyRegistered, map[string]string{"credentialId": passkey.CredentialId}) {
+		t.Error("registration was not audited")
+	}
+
+	// The challenge can only be used once
+	opts, err := s.BeginPasskeyRegistration(ctx, user.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.ExcludeCredentials) != 1 {
+		t.Fatalf("ExcludeCredentials = %v, want the registered passkey", opts.ExcludeCredentials)
+	}
+	other := webauthntest.NewAuthenticator(testOrigin)
+	resp, err := other.Register(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishPasskeyRegistration(ctx, user.UserId, "Phone", resp); err != nil {
+		t.Fatalf("FinishPasskeyRegistration: %v", err)
+	}
+	if _, err := s.FinishPasskeyRegistration(ctx, user.UserId, "Phone", resp); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("replayed registration error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	// The authenticator refuses to register a second credential it already holds
+	opts, err = s.BeginPasskeyRegistration(ctx, user.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authenticator.Register(opts); !errors.Is(err, webauthntest.ErrExcluded) {
+		t.Errorf("Register error = %v, want %v", err, webauthntest.ErrExcluded)
+	}
+}
+
+func TestPasskeyRegistrationRejectsOtherOrigin(t *testing.T) {
+	s, r, _ := newTestService(t)
+	ctx := context.Background()
+	user := r.addUser(t, "alex@example.com", "correct horse battery staple")
+
+	opts, err := s.BeginPasskeyRegistration(ctx, user.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := webauthntest.NewAuthenticator("https://evil.example.com").Register(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishPasskeyRegistration(ctx, user.UserId, "Laptop", resp); !errors.Is(err, ErrInvalidPasskey) {
+		t.Errorf("FinishPasskeyRegistration error = %v, want %v", err, ErrInvalidPasskey)
+	}
+}
+
+func TestPasswordlessPasskeyLogin(t *testing.T) {
+	s, r, a := newTestService(t)
+	ctx := context.Background()
+	user := r.addUser(t, "alex@example.com", "")
+	authenticator, _ := registerPasskey(t, s, user.UserId)
+
+	opts, err := s.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.AllowCredentials) != 0 {
+		t.Errorf("AllowCredentials = %v, want none for discoverable credentials", opts.AllowCredentials)
+	}
+	resp, err := authenticator.Login(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ur, jwt, csrfToken, err := s.FinishPasskeyLogin(ctx, resp)
+	if err != nil {
+		t.Fatalf("FinishPasskeyLogin: %v", err)
+	}
+	if ur.UserId != user.UserId || jwt == "" || csrfToken == "" {
+		t.Errorf("FinishPasskeyLogin = %+v, %q, %q, want a session of the user", ur, jwt, csrfToken)
+	}
+	if !a.has(audit.ActionLogin, map[string]string{"method": "passkey"}) {
+		t.Error("login was not audited")
+	}
+
+	// The signed challenge can't be replayed
+	if _, _, _, err := s.FinishPasskeyLogin(ctx, resp); err == nil {
+		t.Error("replayed login succeeded")
+	}
+}
+
+func TestPasswordlessPasskeyLoginRequiresUserVerification(t *testing.T) {
+	s, r, _ := newTestService(t)
+	ctx := context.Background()
+	user := r.addUser(t, "alex@example.com", "")
+	authenticator, _ := registerPasskey(t, s, user.UserId)
+
+	opts, err := s.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator.UserVerified = false
+	resp, err := authenticator.Login(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.FinishPasskeyLogin(ctx, resp); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("FinishPasskeyLogin error = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestPasskeySecondFactorLogin(t *testing.T) {
+	s, r, a := newTestService(t)
+	ctx := context.Background()
+	password := "correct horse battery staple"
+	user := r.addUser(t, "alex@example.com", password)
+	authenticator, passkey := registerPasskey(t, s, user.UserId)
+	if err := s.SetPasskeySecondFactor(ctx, user.UserId, Reauthentication{Password: password}, true); err != nil {
+		t.Fatalf("SetPasskeySecondFactor: %v", err)
+	}
+
+	// * 1. The password alone does not log in
+	_, jwt, _, err := s.Login(ctx, User{Email: user.Email, Password: password})
+	var secondFactorErr *SecondFactorRequiredError
+	if !errors.As(err, &secondFactorErr) || jwt != "" {
+		t.Fatalf("Login = %q, %v, want SecondFactorRequiredError", jwt, err)
+	}
+	allow := secondFactorErr.Options.AllowCredentials
+	if len(allow) != 1 || base64.RawURLEncoding.EncodeToString(allow[0].ID) != passkey.CredentialId {
+		t.Fatalf("AllowCredentials = %v, want the passkey of the user", allow)
+	}
+
+	// * 2. Signing the challenge with the passkey does
+	resp, err := authenticator.Login(secondFactorErr.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ur, jwt, csrfToken, err := s.FinishSecondFactor(ctx, resp)
+	if err != nil {
+		t.Fatalf("FinishSecondFactor: %v", err)
+	}
+	if ur.UserId != user.UserId || jwt == "" || csrfToken == "" {
+		t.Errorf("FinishSecondFactor = %+v, %q, %q, want a session of the user", ur, jwt, csrfToken)
+	}
+	if !a.has(audit.ActionLogin, map[string]string{"method": "passkey_second_factor"}) {
+		t.Error("login was not audited")
+	}
+}
+
+func TestPasskeySecondFactorRejectsPasskeyOfOtherUser(t *testing.T) {
+	s, r, _ := newTestService(t)
+	ctx := context.Background()
+	password := "correct horse battery staple"
+	user := r.addUser(t, "alex@example.com", password)
+	registerPasskey(t, s, user.UserId)
+	if err := s.SetPasskeySecondFactor(ctx, user.UserId, Reauthentication{Password: password}, true); err != nil {
+		t.Fatal(err)
+	}
+	attacker := r.addUser(t, "sam@example.com", password)
+	attackerAuthenticator, _ := registerPasskey(t, s, attacker.UserId)
+
+	_, _, _, err := s.Login(ctx, User{Email: user.Email, Password: password})
+	var secondFactorErr *SecondFactorRequiredError
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Login error = %v, want SecondFactorRequiredError", err)
+	}
+
+	// The authenticator of the attacker signs the challenge with their own passkey
+	opts := secondFactorErr.Options
+	opts.AllowCredentials = nil
+	resp, err := attackerAuthenticator.Login(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.FinishSecondFactor(ctx, resp); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("FinishSecondFactor error = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	s, r, a := newTestService(t)
+	ctx := context.Background()
+	user := r.addUser(t, "alex@example.com", "")
+	authenticator, passkey := registerPasskey(t, s, user.UserId)
+
+	login := func() error {
+		opts, err := s.BeginPasskeyLogin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := authenticator.Login(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _, err = s.FinishPasskeyLogin(ctx, resp)
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := login(); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+
+	// A clone of the authenticator carries on from an older counter
+	credentialId, err := base64.RawURLEncoding.DecodeString(passkey.CredentialId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticator.SetSignCount(credentialId, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := login(); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("login with a lower counter error = %v, want %v", err, ErrUnauthorized)
+	}
+	reason := "passkey signature counter did not increase, the passkey may have been cloned"
+	if !a.has(audit.ActionLoginFailed, map[string]string{"reason": reason, "credentialId": passkey.CredentialId}) {
+		t.Error("the counter regression was not audited")
+	}
+
+	passkeys, err := s.GetPasskeys(ctx, user.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passkeys[0].SignCount != 3 {
+		t.Errorf("SignCount = %d, want 3", passkeys[0].SignCount)
+	}
+}
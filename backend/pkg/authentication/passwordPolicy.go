@@ -0,0 +1,178 @@
+package authentication
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"unicode"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+// bcrypt ignores everything after the first 72 bytes, so longer passwords are rejected
+const maxBcryptPasswordBytes = 72
+
+var ErrBreachedPassword = passwordPolicyError("password_breached", "password has appeared in a data breach, please choose a different one")
+var ErrWeakPassword = passwordPolicyError("password_weak", "password is too easy to guess, try a longer passphrase or adding more unusual words")
+
+// passwordPolicyError is returned when a password does not meet the policy
+func passwordPolicyError(code string, reason string) *apperror.Error {
+	return apperror.Validation(code, reason, map[string]string{"password": reason})
+}
+
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int // in bytes
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSpecial   bool
+	MinScore         int // 0 (too guessable) to 4 (very unguessable), see PasswordScore
+
+	// Breached is the list of breached passwords to check against, nil to skip the check
+	Breached *BreachedPasswordList
+}
+
+// DefaultPasswordPolicy favours length and unguessability over character classes
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: 8,
+		MaxLength: maxBcryptPasswordBytes,
+		MinScore:  3,
+	}
+}
+
+// LoadPasswordPolicyFromEnv overrides the default policy with the PASSWORD_* environment variables
+func LoadPasswordPolicyFromEnv() (*PasswordPolicy, error) {
+	p := DefaultPasswordPolicy()
+
+	ints := []struct {
+		name  string
+		value *int
+	}{
+		{"PASSWORD_MIN_LENGTH", &p.MinLength},
+		{"PASSWORD_MAX_LENGTH", &p.MaxLength},
+		{"PASSWORD_MIN_SCORE", &p.MinScore},
+	}
+	for _, i := range ints {
+		if v := os.Getenv(i.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", i.name, v)
+			}
+			*i.value = n
+		}
+	}
+
+	bools := []struct {
+		name  string
+		value *bool
+	}{
+		{"PASSWORD_REQUIRE_UPPERCASE", &p.RequireUppercase},
+		{"PASSWORD_REQUIRE_LOWERCASE", &p.RequireLowercase},
+		{"PASSWORD_REQUIRE_DIGIT", &p.RequireDigit},
+		{"PASSWORD_REQUIRE_SPECIAL", &p.RequireSpecial},
+	}
+	for _, b := range bools {
+		if v := os.Getenv(b.name); v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", b.name, v)
+			}
+			*b.value = parsed
+		}
+	}
+
+	if dir := os.Getenv("PASSWORD_BREACHED_DIR"); dir != "" {
+		minCount := 1
+		if v := os.Getenv("PASSWORD_BREACHED_MIN_COUNT"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid PASSWORD_BREACHED_MIN_COUNT: %s", v)
+			}
+			minCount = n
+		}
+		breached, err := NewBreachedPasswordList(dir, minCount)
+		if err != nil {
+			return nil, err
+		}
+		p.Breached = breached
+	}
+
+	if err := p.validateConfig(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PasswordPolicy) validateConfig() error {
+	if p.MinLength < 1 {
+		return errors.New("password min length must be at least 1")
+	}
+	if p.MaxLength < p.MinLength || p.MaxLength > maxBcryptPasswordBytes {
+		return fmt.Errorf("password max length must be between the min length and %d", maxBcryptPasswordBytes)
+	}
+	if p.MinScore < 0 || p.MinScore > 4 {
+		return errors.New("password min score must be between 0 and 4")
+	}
+	return nil
+}
+
+// Validate checks the password against the policy. userInputs such as the email and name of the user
+// make passwords containing them score lower.
+func (p *PasswordPolicy) Validate(password string, userInputs ...string) error {
+	if password == "" {
+		return passwordPolicyError("password_required", "password is required")
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		return passwordPolicyError("password_too_short", fmt.Sprintf("password must be at least %d characters", p.MinLength))
+	}
+
+	if len(password) > p.MaxLength {
+		return passwordPolicyError("password_too_long", fmt.Sprintf("password must be at most %d bytes", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSpecial = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		return passwordPolicyError("password_missing_uppercase", "password must contain at least one uppercase letter")
+	}
+	if p.RequireLowercase && !hasLower {
+		return passwordPolicyError("password_missing_lowercase", "password must contain at least one lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		return passwordPolicyError("password_missing_digit", "password must contain at least one digit")
+	}
+	if p.RequireSpecial && !hasSpecial {
+		return passwordPolicyError("password_missing_special", "password must contain at least one special character")
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("error checking breached passwords: %w", err)
+		}
+		if breached {
+			return ErrBreachedPassword
+		}
+	}
+
+	if PasswordScore(password, userInputs...) < p.MinScore {
+		return ErrWeakPassword
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package authentication
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+// errorCode returns the code of the policy error, empty if the password is valid
+func errorCode(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		t.Fatalf("error = %v, want a password policy error", err)
+	}
+	return appErr.Code
+}
+
+// writeBreachedPasswords stores the passwords in a range file directory, as seen in breaches count times
+func writeBreachedPasswords(t *testing.T, count int, passwords ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, password := range passwords {
+		hash := sha1.Sum([]byte(password))
+		hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+		line := fmt.Sprintf("%s:%d\n", hexHash[5:], count)
+		f, err := os.OpenFile(filepath.Join(dir, hexHash[:5]+".txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	return dir
+}
+
+func TestPasswordPolicyLength(t *testing.T) {
+	// A score of 0 lets through every password of a valid length
+	p := &PasswordPolicy{MinLength: 8, MaxLength: maxBcryptPasswordBytes}
+
+	tests := []struct {
+		name     string
+		password string
+		wantCode string
+	}{
+		{"empty", "", "password_required"},
+		{"one character short", "abcdefg", "password_too_short"},
+		{"min length", "abcdefgh", ""},
+		{"min length in multi-byte characters", "üüüüüüüü", ""},
+		{"max length", strings.Repeat("a", maxBcryptPasswordBytes), ""},
+		{"one byte too long", strings.Repeat("a", maxBcryptPasswordBytes+1), "password_too_long"},
+		// The max length is in bytes, as bcrypt ignores the bytes after it
+		{"too long in multi-byte characters", strings.Repeat("ü", maxBcryptPasswordBytes/2+1), "password_too_long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(t, p.Validate(tt.password)); got != tt.wantCode {
+				t.Errorf("Validate(%q) = %q, want %q", tt.password, got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyCharacterClasses(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 8, MaxLength: maxBcryptPasswordBytes, RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSpecial: true}
+
+	tests := []struct {
+		password string
+		wantCode string
+	}{
+		{"Abcdef1!", ""},
+		{"abcdef1!", "password_missing_uppercase"},
+		{"ABCDEF1!", "password_missing_lowercase"},
+		{"Abcdefg!", "password_missing_digit"},
+		{"Abcdefg1", "password_missing_special"},
+	}
+	for _, tt := range tests {
+		if got := errorCode(t, p.Validate(tt.password)); got != tt.wantCode {
+			t.Errorf("Validate(%q) = %q, want %q", tt.password, got, tt.wantCode)
+		}
+	}
+}
+
+func TestPasswordPolicyRejectsUserDetails(t *testing.T) {
+	p := DefaultPasswordPolicy()
+	email, name := "alexandra.smith@example.com", "Alexandra Smith"
+
+	tests := []struct {
+		name     string
+		password string
+		wantCode string
+	}{
+		{"name", "alexandra-smith", "password_weak"},
+		{"name reversed and capitalised", "Smith!Alexandra", "password_weak"},
+		{"email", "alexandra.smith@example.com", "password_weak"},
+		{"name and a year", "alexandra1990", "password_weak"},
+		{"unrelated passphrase", "purple-giraffe-dances", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(t, p.Validate(tt.password, email, name)); got != tt.wantCode {
+				t.Errorf("Validate(%q, %q, %q) = %q, want %q", tt.password, email, name, got, tt.wantCode)
+			}
+		})
+	}
+
+	// The same passwords are fine for other users
+	if err := p.Validate("alexandra-smith", "sam@example.com", "Sam"); err != nil {
+		t.Errorf("Validate of another user's name: %v", err)
+	}
+}
+
+func TestPasswordScore(t *testing.T) {
+	tests := []struct {
+		password   string
+		userInputs []string
+		want       int
+	}{
+		{"password", nil, 0},
+		{"P@ssw0rd", nil, 0},
+		{"qwertyuiop", nil, 0},
+		{"aaaaaaaaaaaa", nil, 1},
+		{"abcdefghijkl", nil, 1},
+		{"Password2024!", nil, 1},
+		{"swearjar2024", nil, 1},
+		{"alexandra1990", nil, 4},
+		{"alexandra1990", []string{"alexandra@example.com"}, 0},
+		{"xK9#mQ2$vL", nil, 4},
+		{"tr0ub4dor&3", nil, 4},
+		{"correct horse battery staple", nil, 4},
+	}
+	for _, tt := range tests {
+		if got := PasswordScore(tt.password, tt.userInputs...); got != tt.want {
+			t.Errorf("PasswordScore(%q, %q) = %d, want %d", tt.password, tt.userInputs, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordPolicyRejectsBreachedPasswords(t *testing.T) {
+	dir := writeBreachedPasswords(t, 3, "correct horse battery staple", "purple-giraffe-dances")
+
+	tests := []struct {
+		name     string
+		minCount int
+		password string
+		wantCode string
+	}{
+		{"breached", 1, "correct horse battery staple", "password_breached"},
+		{"breached as often as the min count", 3, "purple-giraffe-dances", "password_breached"},
+		{"breached less often than the min count", 4, "correct horse battery staple", ""},
+		{"not breached", 1, "lavender-otter-juggles", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breached, err := NewBreachedPasswordList(dir, tt.minCount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := DefaultPasswordPolicy()
+			p.Breached = breached
+
+			err = p.Validate(tt.password)
+			if got := errorCode(t, err); got != tt.wantCode {
+				t.Errorf("Validate(%q) = %q, want %q", tt.password, got, tt.wantCode)
+			}
+			if tt.wantCode != "" && !errors.Is(err, ErrBreachedPassword) {
+				t.Errorf("Validate(%q) = %v, want %v", tt.password, err, ErrBreachedPassword)
+			}
+		})
+	}
+}
+
+func TestLoadPasswordPolicyFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_REQUIRE_DIGIT", "true")
+	t.Setenv("PASSWORD_BREACHED_DIR", writeBreachedPasswords(t, 1, "correct horse battery staple"))
+
+	p, err := LoadPasswordPolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MinLength != 12 || p.MaxLength != maxBcryptPasswordBytes || !p.RequireDigit || p.MinScore != 3 || p.Breached == nil {
+		t.Errorf("LoadPasswordPolicyFromEnv = %+v, want the overrides on the default policy", p)
+	}
+
+	invalid := []struct {
+		name  string
+		value string
+	}{
+		{"PASSWORD_MIN_LENGTH", "twelve"},
+		{"PASSWORD_MIN_LENGTH", "0"},
+		{"PASSWORD_MAX_LENGTH", "73"},
+		{"PASSWORD_MIN_SCORE", "5"},
+		{"PASSWORD_REQUIRE_SPECIAL", "sometimes"},
+		{"PASSWORD_BREACHED_MIN_COUNT", "0"},
+		{"PASSWORD_BREACHED_DIR", "/nonexistent/breached-passwords"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.name, tt.value)
+			if _, err := LoadPasswordPolicyFromEnv(); err == nil {
+				t.Errorf("LoadPasswordPolicyFromEnv with %s=%s = nil, want an error", tt.name, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package authentication
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords are frequently used passwords, words and keyboard patterns, most common first.
+// A match costs roughly log2 of its rank to guess.
+var commonPasswords = []string{
+	"password", "123456", "12345678", "qwerty", "123456789", "12345", "1234", "111111", "1234567", "dragon",
+	"123123", "baseball", "abc123", "football", "monkey", "letmein", "696969", "shadow", "master", "666666",
+	"qwertyuiop", "123321", "mustang", "1234567890", "michael", "654321", "superman", "1qaz2wsx", "7777777", "121212",
+	"000000", "qazwsx", "123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou", "fuckyou", "2000",
+	"charlie", "robert", "thomas", "hockey", "ranger", "daniel", "starwars", "klaster", "112233", "george",
+	"computer", "michelle", "jessica", "pepper", "1111", "zxcvbn", "555555", "11111111", "131313", "freedom",
+	"777777", "pass", "maggie", "159753", "aaaaaa", "ginger", "princess", "joshua", "cheese", "amanda",
+	"summer", "love", "ashley", "nicole", "chelsea", "biteme", "matthew", "access", "yankees", "987654321",
+	"dallas", "austin", "thunder", "taylor", "matrix", "welcome", "admin", "login", "passw0rd", "asdf",
+	"winter", "spring", "autumn", "secret", "swearjar", "swear", "jar", "qwer", "asdfghjkl", "hello",
+}
+
+var leetSubstitutions = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+type passwordMatch struct {
+	start, end int // rune offsets, end exclusive
+	bits       float64
+}
+
+// PasswordScore estimates how hard the password is to guess, from 0 (too guessable) to 4 (very unguessable),
+// in the style of zxcvbn: common passwords, the user's own details, repeats, sequences and years are
+// cheap to guess, while the remaining characters are brute forced.
+func PasswordScore(password string, userInputs ...string) int {
+	guessesLog10 := estimateBits(password, userInputs) * math.Log10(2)
+	switch {
+	case guessesLog10 < 3:
+		return 0
+	case guessesLog10 < 6:
+		return 1
+	case guessesLog10 < 8:
+		return 2
+	case guessesLog10 < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func estimateBits(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	lower := []rune(strings.ToLower(password))
+	unleeted := []rune(leetSubstitutions.Replace(strings.ToLower(password)))
+	if len(unleeted) != len(lower) {
+		unleeted = lower
+	}
+
+	// * 1. Find dictionary matches, longest first without overlaps
+	var candidates []passwordMatch
+	addMatches := func(word string, bits float64) {
+		w := []rune(word)
+		if len(w) < 3 {
+			return
+		}
+		for _, haystack := range [][]rune{lower, unleeted} {
+			for i := 0; i+len(w) <= len(haystack); i++ {
+				if string(haystack[i:i+len(w)]) == word {
+					candidates = append(candidates, passwordMatch{i, i + len(w), bits + variationBits(runes[i:i+len(w)], lower[i:i+len(w)], unleeted[i:i+len(w)])})
+				}
+			}
+		}
+	}
+	for rank, word := range commonPasswords {
+		addMatches(word, math.Log2(float64(rank+2)))
+	}
+	for _, input := range userInputs {
+		for _, token := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			addMatches(token, 1)
+		}
+	}
+	candidates = append(candidates, yearMatches(lower)...)
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].end-candidates[i].start > candidates[j].end-candidates[j].start
+	})
+	covered := make([]bool, len(runes))
+	bits := 0.0
+	for _, m := range candidates {
+		free := true
+		for i := m.start; i < m.end; i++ {
+			if covered[i] {
+				free = false
+				break
+			}
+		}
+		if !free {
+			continue
+		}
+		for i := m.start; i < m.end; i++ {
+			covered[i] = true
+		}
+		bits += m.bits
+	}
+
+	// * 2. Brute force the remaining characters; repeats and sequences only cost a bit each
+	charBits := math.Log2(float64(poolSize(runes)))
+	for i, r := range runes {
+		if covered[i] {
+			continue
+		}
+		if i > 0 && !covered[i-1] {
+			delta := r - runes[i-1]
+			if delta == 0 || delta == 1 || delta == -1 {
+				bits++
+				continue
+			}
+		}
+		bits += charBits
+	}
+
+	return bits
+}
+
+// variationBits is the extra cost of capitalisation and leet substitutions in a dictionary match
+func variationBits(original []rune, lower []rune, unleeted []rune) float64 {
+	bits := 0.0
+	if string(original) != string(lower) {
+		bits++
+		// Capitalising anything other than the first letter is less common
+		if string(original[1:]) != string(lower[1:]) {
+			bits++
+		}
+	}
+	if string(lower) != string(unleeted) {
+		bits++
+	}
+	return bits
+}
+
+// yearMatches finds years between 1900 and 2099, which are common suffixes
+func yearMatches(lower []rune) []passwordMatch {
+	var matches []passwordMatch
+	for i := 0; i+4 <= len(lower); i++ {
+		year := string(lower[i : i+4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && isDigits(year) {
+			matches = append(matches, passwordMatch{i, i + 4, math.Log2(200)})
+		}
+	}
+	return matches
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// poolSize is the number of characters an attacker would have to try per position
+func poolSize(runes []rune) int {
+	var hasUpper, hasLower, hasDigit, hasSymbol, hasOther bool
+	for _, r := range runes {
+		switch {
+		case r > unicode.MaxASCII:
+			hasOther = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+
+	size := 0
+	if hasLower {
+		size += 26
+	}
+	if hasUpper {
+		size += 26
+	}
+	if hasDigit {
+		size += 10
+	}
+	if hasSymbol {
+		size += 33
+	}
+	if hasOther {
+		size += 100
+	}
+	if size < 2 {
+		size = 2
+	}
+	return size
+}
@@ -0,0 +1,78 @@
+package authentication
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+type AuthMethod string
+
+const (
+	AuthMethodSession  AuthMethod = "session"   // jwt cookie issued on login
+	AuthMethodAPIToken AuthMethod = "api_token" // personal access token sent as a bearer token
+	AuthMethodOAuth    AuthMethod = "oauth"     // access token issued to an OAuth client
+	AuthMethodSlack    AuthMethod = "slack"     // slash command of a Slack user mapped to the user by email
+	AuthMethodDiscord  AuthMethod = "discord"   // slash command of a Discord user linked to the user
+	AuthMethodTelegram AuthMethod = "telegram"  // bot command of a Telegram user linked to the user
+)
+
+// Principal is the authenticated caller of a request, independent of how the request was authenticated
+type Principal struct {
+	UserId     string
+	Verified   bool
+	AuthMethod AuthMethod
+	// Scopes the caller is limited to, nil if it is not restricted, as for sessions
+	Scopes []Scope
+	// SwearJarIds the caller is limited to, empty if it is not restricted to specific jars
+	SwearJarIds []string
+	// SessionId is the jti of the session jwt or OAuth access token, or the id of the API token
+	SessionId string
+	// AuthTime is when the user logged in to the session, zero for other methods and sessions issued without it
+	AuthTime time.Time
+}
+
+func SessionPrincipal(claims *Claims) Principal {
+	p := Principal{
+		UserId:     claims.UserId,
+		Verified:   claims.Verified,
+		AuthMethod: AuthMethodSession,
+		SessionId:  claims.ID,
+	}
+	if claims.AuthTime != nil {
+		p.AuthTime = claims.AuthTime.Time
+	}
+	return p
+}
+
+// APITokenPrincipal returns the principal of an API token. Only verified users can create tokens.
+func APITokenPrincipal(t APIToken) Principal {
+	return Principal{
+		UserId:      t.UserId,
+		Verified:    true,
+		AuthMethod:  AuthMethodAPIToken,
+		Scopes:      append([]Scope{}, t.Scopes...),
+		SwearJarIds: t.SwearJarIds,
+		SessionId:   t.TokenId,
+	}
+}
+
+func (p Principal) HasScope(scope Scope) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
+
+func (p Principal) CanAccessSwearJar(swearJarId string) bool {
+	return len(p.SwearJarIds) == 0 || slices.Contains(p.SwearJarIds, swearJarId)
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal of the request
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
@@ -5,11 +5,20 @@ type PurposeType string
 const (
 	PurposePasswordReset     PurposeType = "PasswordReset"
 	PurposeEmailVerification PurposeType = "EmailVerification"
+	PurposeMagicLogin        PurposeType = "MagicLogin"
+	PurposeEmailChange       PurposeType = "EmailChange"
+
+	// Challenges of passkey ceremonies, which are signed by the authenticator instead of being emailed
+	PurposePasskeyRegistration PurposeType = "PasskeyRegistration"
+	PurposePasskeyLogin        PurposeType = "PasskeyLogin"
+	PurposePasskeySecondFactor PurposeType = "PasskeySecondFactor"
+	PurposeReauthentication    PurposeType = "Reauthentication"
 )
 
 func (p PurposeType) IsValid() bool {
 	switch p {
-	case PurposePasswordReset, PurposeEmailVerification:
+	case PurposePasswordReset, PurposeEmailVerification, PurposeMagicLogin, PurposeEmailChange,
+		PurposePasskeyRegistration, PurposePasskeyLogin, PurposePasskeySecondFactor, PurposeReauthentication:
 		return true
 	default:
 		return false
@@ -0,0 +1,20 @@
+package authentication
+
+type Scope string
+
+const (
+	ScopeSwearsRead  Scope = "swears:read"
+	ScopeSwearsWrite Scope = "swears:write"
+	ScopeJarsRead    Scope = "jars:read"
+	ScopeJarsWrite   Scope = "jars:write"
+	ScopeUsersRead   Scope = "users:read"
+)
+
+func (s Scope) IsValid() bool {
+	switch s {
+	case ScopeSwearsRead, ScopeSwearsWrite, ScopeJarsRead, ScopeJarsWrite, ScopeUsersRead:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,88 +1,155 @@
 package authentication
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/url"
 	"os"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"html/template"
-
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/jwk"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
 	"github.com/mikeytheong/swearjar/backend/pkg/email"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	AuthTokenDuration = 1 * time.Hour
+	AuthTokenDuration       = 1 * time.Hour
+	MagicLoginTokenDuration = 15 * time.Minute
 )
 
-var ErrUnauthorized = errors.New("unauthorized")
-var ErrNoDocuments = errors.New("no documents found")
-var ErrInvalidToken = errors.New("invalid token")
+var ErrUnauthorized = apperror.Unauthorized("unauthorized", "unauthorized")
+var ErrIncorrectPassword = apperror.Unauthorized("incorrect_password", "incorrect password")
+var ErrNoDocuments = apperror.NotFound("not_found", "no documents found")
+var ErrInvalidToken = apperror.Unauthorized("invalid_token", "invalid or expired token")
+var ErrExpiredToken = apperror.Gone("token_expired", "token has expired").WithCause(ErrInvalidToken)
+var ErrResendCooldown = apperror.RateLimited("resend_cooldown", "please wait before requesting another email", 0)
+var ErrInsufficientScope = apperror.Forbidden("insufficient_scope", "insufficient scope")
+var ErrUnverifiedIdentity = apperror.Forbidden("unverified_identity", "email is not verified by the identity provider")
+var ErrEmailTaken = apperror.Conflict("email_taken", "email is already in use")
+var ErrAPITokenNotFound = apperror.NotFound("api_token_not_found", "api token not found")
+var ErrPasswordNotSet = apperror.Validation("password_not_set", "account has no password, use forgot password to set one", nil)
 
 type Claims struct {
 	Email    string
 	Name     string
 	UserId   string
 	Verified bool
+	// AuthTime is when the user logged in, refreshed sessions keep the time of the login they were refreshed from
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type Repository interface {
-	SignUp(User) error
-	GetUserByEmail(string) (User, error)
-	GetUserById(string) (UserResponse, error)
-	CreateAuthToken(AuthToken) error
-	GetAuthToken(string) (AuthToken, error)
-	UpdatePasswordAndMarkToken(email string, newPassword string, hashedToken string) error
-	VerifyEmailAndMarkToken(email string, hashedToken string) error
+	// WithTransaction runs fn in a transaction, the writes made with the context passed to fn are committed together
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	SignUp(ctx context.Context, u User) error
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserById(ctx context.Context, userId string) (UserResponse, error)
+	CreateAuthToken(ctx context.Context, t AuthToken) error
+	GetAuthToken(ctx context.Context, hashedToken string) (AuthToken, error)
+	UpdatePasswordAndMarkToken(ctx context.Context, email string, newPassword string, hashedToken string) error
+	VerifyEmailAndMarkToken(ctx context.Context, email string, hashedToken string) error
+	CreateAPIToken(ctx context.Context, t APIToken) (APIToken, error)
+	GetAPITokenByHash(ctx context.Context, hashedToken string) (APIToken, error)
+	GetAPITokensByUserId(ctx context.Context, userId string) ([]APIToken, error)
+	RevokeAPIToken(ctx context.Context, tokenId string, userId string) error
+	UpdateAPITokenLastUsed(ctx context.Context, tokenId string, lastUsedAt time.Time) error
+	GetUserByExternalIdentity(ctx context.Context, provider string, subject string) (User, error)
+	LinkExternalIdentity(ctx context.Context, userId string, identity ExternalIdentity, clearPassword bool) error
+	UpdateUserPassword(ctx context.Context, email string, newPassword string) error
+	UpdateUserProfile(ctx context.Context, userId string, name string, locale string) error
+	ChangeEmailAndMarkToken(ctx context.Context, email string, newEmail string, hashedToken string) error
+	DeleteUser(ctx context.Context, userId string) error
+	GetLatestAuthToken(ctx context.Context, email string, purpose PurposeType) (AuthToken, error)
+	GetUnverifiedUserIds(ctx context.Context, createdBefore time.Time) ([]string, error)
+	GetPasskeys(ctx context.Context, userId string) ([]Passkey, error)
+	GetUserByPasskey(ctx context.Context, credentialId string) (User, error)
+	AddPasskeyAndMarkToken(ctx context.Context, userId string, passkey Passkey, hashedToken string) error
+	UpdatePasskeyAndMarkToken(ctx context.Context, userId string, credentialId string, signCount uint32, lastUsedAt time.Time, hashedToken string) error
+	DeletePasskey(ctx context.Context, userId string, credentialId string) error
+	SetPasskeySecondFactor(ctx context.Context, userId string, enabled bool) error
 }
 
 type Service interface {
-	SignUp(email, name, password string) error
-	Login(User) (u UserResponse, jwt string, csrfToken string, err error)
-	ForgotPassword(email string) error
-	ResetPassword(token string, newPassword string) error
-	VerifyEmail(userId string, token string) (jwt string, err error)
-	VerifyAuthToken(token string, purpose string) error
-	GetUser(userId string) (ur UserResponse, jwt string, err error)
+	SignUp(ctx context.Context, email, name, password, locale string) error
+	Login(ctx context.Context, u User) (ur UserResponse, jwt string, csrfToken string, err error)
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	VerifyEmail(ctx context.Context, userId string, token string) (ur UserResponse, jwt string, csrfToken string, err error)
+	ResendVerificationEmail(ctx context.Context, email string) error
+	StartUnverifiedAccountCleanup() (stop func())
+	VerifyAuthToken(ctx context.Context, token string, purpose string) error
+	GetUser(ctx context.Context, userId string) (ur UserResponse, jwt string, csrfToken string, err error)
+	RequestMagicLogin(ctx context.Context, email string) error
+	MagicLogin(ctx context.Context, token string) (ur UserResponse, jwt string, csrfToken string, err error)
+	LoginWithExternalIdentity(ctx context.Context, identity ExternalIdentity) (ur UserResponse, jwt string, csrfToken string, err error)
+	CreateAPIToken(ctx context.Context, userId string, name string, scopes []string, swearJarIds []string, expiresInDays int) (rawToken string, t APIToken, err error)
+	GetAPITokens(ctx context.Context, userId string) ([]APIToken, error)
+	RevokeAPIToken(ctx context.Context, userId string, tokenId string) error
+	AuthenticateAPIToken(ctx context.Context, rawToken string) (APIToken, error)
+	ChangePassword(ctx context.Context, userId string, currentPassword string, newPassword string) error
+	RequestEmailChange(ctx context.Context, userId string, reauth Reauthentication, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	UpdateProfile(ctx context.Context, userId string, name string, locale string) (ur UserResponse, jwt string, csrfToken string, err error)
+	DeleteAccount(ctx context.Context, userId string, reauth Reauthentication) error
+	ParseToken(tokenString string) (*Claims, error)
+	VerifyCSRFToken(claims *Claims, csrfToken string) error
+	JWKS() (jwk.Set, error)
+	BeginPasskeyRegistration(ctx context.Context, userId string) (webauthn.CreationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, userId string, name string, resp webauthn.RegistrationResponse) (Passkey, error)
+	GetPasskeys(ctx context.Context, userId string) ([]Passkey, error)
+	DeletePasskey(ctx context.Context, userId string, credentialId string) error
+	SetPasskeySecondFactor(ctx context.Context, userId string, reauth Reauthentication, enabled bool) error
+	BeginReauthentication(ctx context.Context, userId string) (webauthn.RequestOptions, error)
+	BeginPasskeyLogin(ctx context.Context) (webauthn.RequestOptions, error)
+	FinishPasskeyLogin(ctx context.Context, resp webauthn.AuthenticationResponse) (ur UserResponse, jwt string, csrfToken string, err error)
+	FinishSecondFactor(ctx context.Context, resp webauthn.AuthenticationResponse) (ur UserResponse, jwt string, csrfToken string, err error)
 }
 
 type service struct {
 	r Repository
 	e email.Service
+	k *Keyring
+	p *PasswordPolicy
+	a audit.Logger
+	w *webauthn.RelyingParty
 }
 
-func NewService(r Repository, e email.Service) Service {
-	return &service{r, e}
+func NewService(r Repository, e email.Service, k *Keyring, p *PasswordPolicy, a audit.Logger, w *webauthn.RelyingParty) Service {
+	return &service{r, e, k, p, a, w}
 }
 
-func (s *service) SignUp(email, name, password string) error {
+func (s *service) SignUp(ctx context.Context, email, name, password, locale string) error {
 	// Check if email is valid
-	emailRegex := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
-	re := regexp.MustCompile(emailRegex)
-	if !re.MatchString(email) {
+	if err := validateEmail(email); err != nil {
 		log.Printf("Invalid email format: %s", email)
-		return errors.New("invalid email format")
+		return err
+	}
+	if err := validateLocale(locale); err != nil {
+		return err
 	}
 
 	// Check if email is used
-	result, err := s.r.GetUserByEmail(email)
+	result, err := s.r.GetUserByEmail(ctx, email)
 	if err != nil && !errors.Is(err, ErrNoDocuments) {
 		log.Printf("Error fetching user by email: %v", err)
 		return err
 	}
 	if result.Email == email {
 		log.Printf("User with email{%s} already exists", email)
-		return errors.New("User already exists")
+		return ErrEmailTaken
 	}
 
-	// Validate password
-	if err := validatePassword(password); err != nil {
+	// Validate password against the policy
+	if err := s.p.Validate(password, email, name); err != nil {
 		return err
 	}
 
@@ -93,18 +160,37 @@ func (s *service) SignUp(email, name, password string) error {
 		return err
 	}
 
-	// * 1. Create a user and store in db
 	// Create a new user with the validated data
 	newUser := NewUser(strings.ToLower(email), name, string(hashedPassword))
+	newUser.Locale = locale
+
+	// The user is stored together with the verification email, so a failing email neither leaves a user who was
+	// never sent the link nor fails a signup which was stored
+	err = s.r.WithTransaction(ctx, func(ctx context.Context) error {
+		// * 1. Insert the user into the database
+		if err := s.r.SignUp(ctx, newUser); err != nil {
+			log.Printf("Error inserting user into database: %v", err)
+			return err
+		}
 
-	// Insert the user into the database
-	err = s.r.SignUp(newUser)
+		// * 2. Send email with verification link
+		return s.sendVerificationEmail(ctx, newUser)
+	})
 	if err != nil {
-		log.Printf("Error inserting user into database: %v", err)
 		return err
 	}
 
-	// * 2. Generate raw token
+	if storedUser, err := s.r.GetUserByEmail(ctx, newUser.Email); err == nil {
+		s.logUserEvent(ctx, storedUser.UserId, audit.ActionSignUp, storedUser.UserId, map[string]string{"method": "password"})
+	}
+
+	log.Printf("User signed up successfully: %s", newUser.Email)
+	return nil
+}
+
+// sendVerificationEmail sends a new email verification link, superseding links sent before
+func (s *service) sendVerificationEmail(ctx context.Context, u User) error {
+	// * 1. Generate raw token
 	rawToken, err := generateToken()
 	if err != nil {
 		log.Printf("AuthService: Error generating token: %v", err)
@@ -112,120 +198,132 @@ func (s *service) SignUp(email, name, password string) error {
 	}
 	encodedToken := url.QueryEscape(rawToken)
 
-	// * 3. Create auth token and store in db
-	authToken, err := NewAuthToken(email, encodedToken, PurposeEmailVerification, AuthTokenDuration)
+	// * 2. Create auth token, which is stored with the email
+	authToken, err := NewAuthToken(u.Email, encodedToken, PurposeEmailVerification, AuthTokenDuration)
 	if err != nil {
 		log.Printf("AuthService: Error creating auth token: %v", err)
 		return err
 	}
-	err = s.r.CreateAuthToken(*authToken)
-	if err != nil {
-		log.Printf("AuthService: Error storing auth token in db: %v", err)
-		return err
-	}
-
-	// * 4. Send email with verification link
-	htmlTemplate := `
-		<!DOCTYPE html>
-		<html>
-			<body>
-				<p>Hello {{.Name}},</p>
-
-				<p>
-					Welcome to SwearJar! Please click the link below to verify your email:
-					<br>
-					<a href="{{.VerificationLink}}">{{.VerificationLink}}</a>
-				</p>
-
-				<p>
-					If you did not request a password reset, please ignore this email or contact us if you have any concerns.
-				</p>
-			</body>
-		</html>
-	`
 
+	// * 3. Send email with verification link
 	data := struct {
 		Name             string
 		VerificationLink string
 	}{
-		Name:             newUser.Name,
+		Name:             u.Name,
 		VerificationLink: os.Getenv("FRONTEND_URL") + "/auth/email/verify?token=" + encodedToken,
 	}
-	tmpl, err := template.New("verifyEmail").Parse(htmlTemplate)
-	if err != nil {
-		log.Printf("AuthService: Error parsing template: %v", err)
-		return err
-	}
-
-	if err := s.e.SendEmail(email, "Verify Your Email - SwearJar", tmpl, data); err != nil {
+	if err := s.sendTokenEmail(ctx, *authToken, u.Email, u.Locale, data); err != nil {
 		log.Printf("AuthService: Error sending verification email")
 		return err
 	}
 
-	log.Printf("User signed up successfully: %s", newUser.Email)
 	return nil
 }
 
-func (s *service) Login(u User) (ur UserResponse, jwt string, csrfToken string, err error) {
-	storedUser, err := s.r.GetUserByEmail(u.Email)
+func (s *service) Login(ctx context.Context, u User) (ur UserResponse, jwt string, csrfToken string, err error) {
+	storedUser, err := s.r.GetUserByEmail(ctx, u.Email)
 	if err != nil {
+		if errors.Is(err, ErrNoDocuments) {
+			s.logUserEvent(ctx, "", audit.ActionLoginFailed, "", map[string]string{"email": u.Email, "reason": "unknown email"})
+			return UserResponse{}, "", "", ErrUnauthorized
+		}
 		return UserResponse{}, "", "", err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(u.Password))
-	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+	// Users created through an external identity provider have no password until they reset it
+	if storedUser.Password == "" {
+		s.logUserEvent(ctx, "", audit.ActionLoginFailed, storedUser.UserId, map[string]string{"reason": "no password set"})
+		return UserResponse{}, "", "", ErrUnauthorized
+	}
+
+	if err := checkPassword(storedUser.Password, u.Password); err != nil {
+		if errors.Is(err, ErrIncorrectPassword) {
+			// The response does not tell apart an unknown email and an incorrect password
+			s.logUserEvent(ctx, "", audit.ActionLoginFailed, storedUser.UserId, map[string]string{"reason": "incorrect password"})
 			return UserResponse{}, "", "", ErrUnauthorized
 		}
 		return UserResponse{}, "", "", err
 	}
 
-	tokenString, err := CreateToken(storedUser)
-	if err != nil {
-		return UserResponse{}, "", "", err
+	if storedUser.PasskeySecondFactor {
+		return UserResponse{}, "", "", s.requireSecondFactor(ctx, storedUser)
 	}
 
-	csrfToken, err = GenerateCSRFToken()
+	s.logUserEvent(ctx, storedUser.UserId, audit.ActionLogin, storedUser.UserId, map[string]string{"method": "password"})
+	return s.issueSession(storedUser)
+}
+
+// issueSession creates the jwt and csrf token handed out on a successful login
+func (s *service) issueSession(storedUser User) (ur UserResponse, jwt string, csrfToken string, err error) {
+	tokenString, csrfToken, err := s.createSession(storedUser, time.Now())
 	if err != nil {
 		return UserResponse{}, "", "", err
 	}
 
 	return UserResponse{
-		UserId:   storedUser.UserId,
-		Email:    storedUser.Email,
-		Name:     storedUser.Name,
-		Verified: storedUser.Verified,
+		UserId:              storedUser.UserId,
+		Email:               storedUser.Email,
+		Name:                storedUser.Name,
+		Verified:            storedUser.Verified,
+		PasskeySecondFactor: storedUser.PasskeySecondFactor,
 	}, tokenString, csrfToken, nil
 }
 
-func (s *service) GetUser(userId string) (ur UserResponse, jwt string, err error) {
-	user, err := s.r.GetUserById(userId)
+// createSession signs a jwt with a new session id and the csrf token bound to it
+func (s *service) createSession(u User, authTime time.Time) (jwt string, csrfToken string, err error) {
+	sessionId, err := generateSessionId()
 	if err != nil {
-		return UserResponse{}, "", err
+		return "", "", err
 	}
 
-	tokenString, err := CreateToken(User{
-		UserId:   user.UserId,
-		Email:    user.Email,
-		Name:     user.Name,
-		Verified: user.Verified,
-	})
+	tokenString, err := createToken(s.k, u, sessionId, authTime)
 	if err != nil {
-		return UserResponse{}, "", err
+		return "", "", err
 	}
 
-	return UserResponse{
+	csrfToken, err = s.k.GenerateCSRFToken(sessionId)
+	if err != nil {
+		return "", "", err
+	}
+
+	return tokenString, csrfToken, nil
+}
+
+// GetUser returns the user with a refreshed jwt, which rotates the csrf token. The refreshed session keeps the
+// login time of the session it was refreshed from, so refreshing does not count as logging in again.
+func (s *service) GetUser(ctx context.Context, userId string) (ur UserResponse, jwt string, csrfToken string, err error) {
+	user, err := s.r.GetUserById(ctx, userId)
+	if err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	var authTime time.Time
+	if principal, ok := PrincipalFromContext(ctx); ok && principal.AuthMethod == AuthMethodSession {
+		authTime = principal.AuthTime
+	}
+	tokenString, csrfToken, err := s.createSession(User{
 		UserId:   user.UserId,
 		Email:    user.Email,
 		Name:     user.Name,
 		Verified: user.Verified,
-	}, tokenString, nil
+	}, authTime)
+	if err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	return user, tokenString, csrfToken, nil
 }
 
-func (s *service) ForgotPassword(email string) error {
+func (s *service) ForgotPassword(ctx context.Context, email string) error {
 	// * 1. Verify email exists
-	user, err := s.r.GetUserByEmail(email)
+	user, err := s.r.GetUserByEmail(ctx, email)
 	if err != nil {
+		if errors.Is(err, ErrNoDocuments) {
+			// Do not reveal whether an account exists for this email
+			log.Printf("AuthService: Password reset requested for unknown email {%s}", email)
+			return nil
+		}
 		log.Printf("AuthService: Error initiating Forget Password for email {%v}: %v", email, err)
 		return err
 	}
@@ -238,38 +336,14 @@ func (s *service) ForgotPassword(email string) error {
 	}
 	encodedToken := url.QueryEscape(rawToken)
 
-	// * 3. Create auth token and store in db
+	// * 3. Create auth token, which is stored with the email
 	authToken, err := NewAuthToken(email, encodedToken, PurposePasswordReset, AuthTokenDuration)
 	if err != nil {
 		log.Printf("AuthService: Error creating auth token: %v", err)
 		return err
 	}
-	err = s.r.CreateAuthToken(*authToken)
-	if err != nil {
-		log.Printf("AuthService: Error storing auth token in db: %v", err)
-		return err
-	}
 
 	// * 4. Send email with password reset link
-	htmlTemplate := `
-		<!DOCTYPE html>
-		<html>
-			<body>
-				<p>Hello {{.Name}},</p>
-				
-				<p>
-					We received a request to reset your password. If you made this request, please click the link below to set a new password:
-					<br>
-					<a href="{{.ResetLink}}">{{.ResetLink}}</a>
-				</p>
-				
-				<p>
-					If you did not request a password reset, please ignore this email or contact us if you have any concerns.
-				</p>
-			</body>
-		</html>
-	`
-
 	data := struct {
 		Name      string
 		ResetLink string
@@ -278,22 +352,17 @@ func (s *service) ForgotPassword(email string) error {
 		ResetLink: os.Getenv("FRONTEND_URL") + "/auth/password/reset?token=" + encodedToken,
 	}
 
-	tmpl, err := template.New("resetPassword").Parse(htmlTemplate)
-	if err != nil {
-		log.Printf("AuthService: Error parsing template: %v", err)
-		return err
-	}
-
-	if err := s.e.SendEmail(email, "Forgot Password Request - SwearJar", tmpl, data); err != nil {
+	if err := s.sendTokenEmail(ctx, *authToken, email, user.Locale, data); err != nil {
 		log.Printf("AuthService: Error sending password-reset email")
 		return err
 	}
-	log.Printf("AuthService: Password-reset email sent to %s", email)
+	s.logUserEvent(ctx, "", audit.ActionPasswordResetRequested, user.UserId, nil)
+	log.Printf("AuthService: Password-reset email queued for %s", email)
 	return nil
 }
 
-func (s *service) ResetPassword(token string, newPassword string) error {
-	authToken, err := s.verifyAndGetAuthToken(token, string(PurposePasswordReset))
+func (s *service) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	authToken, err := s.verifyAndGetAuthToken(ctx, token, string(PurposePasswordReset))
 	if err != nil {
 		log.Printf("AuthService: Error verifying auth token: %v", err)
 		return ErrInvalidToken
@@ -304,8 +373,8 @@ func (s *service) ResetPassword(token string, newPassword string) error {
 		return ErrInvalidToken
 	}
 
-	// Validate password
-	if err := validatePassword(newPassword); err != nil {
+	// Validate password against the policy
+	if err := s.p.Validate(newPassword, authToken.Email); err != nil {
 		return err
 	}
 
@@ -316,45 +385,197 @@ func (s *service) ResetPassword(token string, newPassword string) error {
 	}
 
 	// Update password and mark token as used in a single transaction
-	err = s.r.UpdatePasswordAndMarkToken(authToken.Email, string(hashedPassword), encryptToken(token))
+	err = s.r.UpdatePasswordAndMarkToken(ctx, authToken.Email, string(hashedPassword), encryptToken(token))
 	if err != nil {
 		log.Printf("AuthService: Error updating password and marking token: %v", err)
 		return err
 	}
 
+	if storedUser, err := s.r.GetUserByEmail(ctx, authToken.Email); err == nil {
+		s.logUserEvent(ctx, storedUser.UserId, audit.ActionPasswordReset, storedUser.UserId, nil)
+	}
+
 	return nil
 }
 
-func (s *service) VerifyEmail(userId string, token string) (jwt string, err error) {
+func (s *service) VerifyEmail(ctx context.Context, userId string, token string) (ur UserResponse, jwt string, csrfToken string, err error) {
 	log.Printf("AuthService: Verifying email with token: %s", token)
-	authToken, err := s.verifyAndGetAuthToken(token, string(PurposeEmailVerification))
+	authToken, err := s.verifyAndGetAuthToken(ctx, token, string(PurposeEmailVerification))
 	if err != nil {
 		log.Printf("AuthService: Error verifying auth token: %v", err)
-		return "", ErrInvalidToken
+		// Expired links are reported separately, so the user can be offered to resend the email
+		return UserResponse{}, "", "", err
 	}
 
 	if authToken.Purpose != PurposeType(PurposeEmailVerification) {
 		log.Printf("AuthService: Token purpose mismatch: expected %s, got %s", PurposeEmailVerification, authToken.Purpose)
-		return "", ErrInvalidToken
+		return UserResponse{}, "", "", ErrInvalidToken
 	}
 
-	err = s.r.VerifyEmailAndMarkToken(authToken.Email, encryptToken(token))
+	err = s.r.VerifyEmailAndMarkToken(ctx, authToken.Email, encryptToken(token))
 	if err != nil {
 		log.Printf("AuthService: Error verifying email and marking token: %v", err)
-		return "", ErrInvalidToken
+		return UserResponse{}, "", "", ErrInvalidToken
 	}
+	s.logUserEvent(ctx, userId, audit.ActionEmailVerified, userId, nil)
+
+	// The refreshed jwt carries the verified claim, which is required on protected routes
+	return s.GetUser(ctx, userId)
+}
 
-	_, jwt, err = s.GetUser(userId)
+func (s *service) RequestMagicLogin(ctx context.Context, email string) error {
+	email = strings.ToLower(email)
+
+	// * 1. Verify email exists
+	user, err := s.r.GetUserByEmail(ctx, email)
 	if err != nil {
-		return "", err
+		if errors.Is(err, ErrNoDocuments) {
+			// Do not reveal whether an account exists for this email
+			log.Printf("AuthService: Magic login requested for unknown email {%s}", email)
+			return nil
+		}
+		log.Printf("AuthService: Error initiating magic login for email {%v}: %v", email, err)
+		return err
+	}
+
+	// * 2. Generate raw token
+	rawToken, err := generateToken()
+	if err != nil {
+		log.Printf("AuthService: Error generating token: %v", err)
+		return err
 	}
+	encodedToken := url.QueryEscape(rawToken)
 
-	return jwt, nil
+	// * 3. Create auth token, which is stored with the email
+	authToken, err := NewAuthToken(email, encodedToken, PurposeMagicLogin, MagicLoginTokenDuration)
+	if err != nil {
+		log.Printf("AuthService: Error creating auth token: %v", err)
+		return err
+	}
+
+	// * 4. Send email with magic login link
+	data := struct {
+		Name      string
+		LoginLink string
+	}{
+		Name:      user.Name,
+		LoginLink: os.Getenv("FRONTEND_URL") + "/auth/login/magic?token=" + encodedToken,
+	}
+
+	if err := s.sendTokenEmail(ctx, *authToken, email, user.Locale, data); err != nil {
+		log.Printf("AuthService: Error sending magic login email")
+		return err
+	}
+	s.logUserEvent(ctx, "", audit.ActionMagicLoginRequested, user.UserId, nil)
+	log.Printf("AuthService: Magic login email queued for %s", email)
+	return nil
+}
+
+func (s *service) MagicLogin(ctx context.Context, token string) (ur UserResponse, jwt string, csrfToken string, err error) {
+	authToken, err := s.verifyAndGetAuthToken(ctx, token, string(PurposeMagicLogin))
+	if err != nil {
+		log.Printf("AuthService: Error verifying auth token: %v", err)
+		return UserResponse{}, "", "", ErrInvalidToken
+	}
+
+	// Receiving the link proves ownership of the email, so the email is marked as verified
+	// in the same transaction that consumes the token
+	err = s.r.VerifyEmailAndMarkToken(ctx, authToken.Email, encryptToken(token))
+	if err != nil {
+		log.Printf("AuthService: Error consuming magic login token: %v", err)
+		return UserResponse{}, "", "", ErrInvalidToken
+	}
+
+	storedUser, err := s.r.GetUserByEmail(ctx, authToken.Email)
+	if err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	if storedUser.PasskeySecondFactor {
+		return UserResponse{}, "", "", s.requireSecondFactor(ctx, storedUser)
+	}
+
+	s.logUserEvent(ctx, storedUser.UserId, audit.ActionLogin, storedUser.UserId, map[string]string{"method": "magic_link"})
+	return s.issueSession(storedUser)
 }
 
-func (s *service) verifyAndGetAuthToken(token, purpose string) (*AuthToken, error) {
+// LoginWithExternalIdentity logs in the user linked to the identity. Otherwise the identity is linked to the
+// user with the same verified email, or a new verified user is created on first login. Like the other logins, it
+// returns SecondFactorRequiredError for users who protect their account with a passkey.
+func (s *service) LoginWithExternalIdentity(ctx context.Context, identity ExternalIdentity) (ur UserResponse, jwt string, csrfToken string, err error) {
+	if err := identity.Validate(); err != nil {
+		return UserResponse{}, "", "", err
+	}
+
+	// * 1. Returning user
+	loginDetails := map[string]string{"method": "oidc:" + identity.Provider}
+	storedUser, err := s.r.GetUserByExternalIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if storedUser.PasskeySecondFactor {
+			return UserResponse{}, "", "", s.requireSecondFactor(ctx, storedUser)
+		}
+		s.logUserEvent(ctx, storedUser.UserId, audit.ActionLogin, storedUser.UserId, loginDetails)
+		return s.issueSession(storedUser)
+	}
+	if !errors.Is(err, ErrNoDocuments) {
+		log.Printf("AuthService: Error fetching user by external identity: %v", err)
+		return UserResponse{}, "", "", err
+	}
+
+	// Linking and creating accounts by email is only safe if the provider has verified the email
+	if !identity.EmailVerified || identity.Email == "" {
+		log.Printf("AuthService: Unverified email from provider %s for subject %s", identity.Provider, identity.Subject)
+		return UserResponse{}, "", "", ErrUnverifiedIdentity
+	}
+	email := strings.ToLower(identity.Email)
+
+	// * 2. Existing user with the same email
+	storedUser, err = s.r.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, ErrNoDocuments) {
+		log.Printf("AuthService: Error fetching user by email: %v", err)
+		return UserResponse{}, "", "", err
+	}
+
+	if errors.Is(err, ErrNoDocuments) {
+		// * 3. First login, create a verified user without a password
+		newUser := NewUser(email, identity.Name, "")
+		newUser.Verified = true
+		if newUser.Name == "" {
+			newUser.Name = strings.Split(email, "@")[0]
+		}
+		if err := s.r.SignUp(ctx, newUser); err != nil {
+			log.Printf("AuthService: Error inserting user into database: %v", err)
+			return UserResponse{}, "", "", err
+		}
+		storedUser, err = s.r.GetUserByEmail(ctx, email)
+		if err != nil {
+			return UserResponse{}, "", "", err
+		}
+		s.logUserEvent(ctx, storedUser.UserId, audit.ActionSignUp, storedUser.UserId, loginDetails)
+		log.Printf("AuthService: User signed up with provider %s: %s", identity.Provider, email)
+	}
+
+	// An unverified account may have been registered by someone who does not own the email,
+	// so its password is cleared when the real owner links their identity
+	clearPassword := !storedUser.Verified
+	if err := s.r.LinkExternalIdentity(ctx, storedUser.UserId, identity, clearPassword); err != nil {
+		log.Printf("AuthService: Error linking external identity: %v", err)
+		return UserResponse{}, "", "", err
+	}
+	storedUser.Verified = true
+	s.logUserEvent(ctx, storedUser.UserId, audit.ActionExternalIdentityLinked, storedUser.UserId, map[string]string{"provider": identity.Provider, "passwordCleared": strconv.FormatBool(clearPassword)})
+
+	if storedUser.PasskeySecondFactor {
+		return UserResponse{}, "", "", s.requireSecondFactor(ctx, storedUser)
+	}
+
+	s.logUserEvent(ctx, storedUser.UserId, audit.ActionLogin, storedUser.UserId, loginDetails)
+	return s.issueSession(storedUser)
+}
+
+func (s *service) verifyAndGetAuthToken(ctx context.Context, token, purpose string) (*AuthToken, error) {
 	hashedToken := encryptToken(token)
-	authToken, err := s.r.GetAuthToken(hashedToken)
+	authToken, err := s.r.GetAuthToken(ctx, hashedToken)
 	if err != nil {
 		if errors.Is(err, ErrNoDocuments) {
 			log.Printf("AuthService: Token not found: %v", err)
@@ -366,6 +587,9 @@ func (s *service) verifyAndGetAuthToken(token, purpose string) (*AuthToken, erro
 
 	if err := authToken.Validate(); err != nil {
 		log.Printf("AuthService: Invalid token: %v", err)
+		if !authToken.Used && time.Now().After(authToken.ExpiresAt) {
+			return nil, ErrExpiredToken
+		}
 		return nil, ErrInvalidToken
 	}
 
@@ -377,7 +601,126 @@ func (s *service) verifyAndGetAuthToken(token, purpose string) (*AuthToken, erro
 	return &authToken, nil
 }
 
-func (s *service) VerifyAuthToken(token string, purpose string) error {
-	_, err := s.verifyAndGetAuthToken(token, purpose)
+func (s *service) VerifyAuthToken(ctx context.Context, token string, purpose string) error {
+	_, err := s.verifyAndGetAuthToken(ctx, token, purpose)
 	return err
 }
+
+func (s *service) CreateAPIToken(ctx context.Context, userId string, name string, scopes []string, swearJarIds []string, expiresInDays int) (rawToken string, t APIToken, err error) {
+	if expiresInDays < 0 {
+		return "", APIToken{}, apperror.InvalidField("expiresInDays", "expiry must not be negative")
+	}
+
+	tokenScopes := make([]Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(tokenScopes, Scope(scope)) {
+			tokenScopes = append(tokenScopes, Scope(scope))
+		}
+	}
+
+	// * 1. Generate raw token
+	randomToken, err := generateToken()
+	if err != nil {
+		log.Printf("AuthService: Error generating API token: %v", err)
+		return "", APIToken{}, err
+	}
+	rawToken = APITokenPrefix + randomToken
+
+	// * 2. Create API token and store its hash in db
+	apiToken, err := NewAPIToken(userId, strings.TrimSpace(name), rawToken, tokenScopes, swearJarIds, time.Duration(expiresInDays)*24*time.Hour)
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	t, err = s.r.CreateAPIToken(ctx, *apiToken)
+	if err != nil {
+		log.Printf("AuthService: Error storing API token in db: %v", err)
+		return "", APIToken{}, err
+	}
+
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     audit.ActionAPITokenCreated,
+		TargetType: audit.TargetAPIToken,
+		TargetId:   t.TokenId,
+		Details:    map[string]string{"name": t.Name, "scopes": strings.Join(scopes, ",")},
+	})
+	log.Printf("AuthService: API token {%s} created for user {%s}", t.TokenId, userId)
+	return rawToken, t, nil
+}
+
+func (s *service) GetAPITokens(ctx context.Context, userId string) ([]APIToken, error) {
+	return s.r.GetAPITokensByUserId(ctx, userId)
+}
+
+func (s *service) RevokeAPIToken(ctx context.Context, userId string, tokenId string) error {
+	err := s.r.RevokeAPIToken(ctx, tokenId, userId)
+	if err != nil {
+		if errors.Is(err, ErrNoDocuments) {
+			return ErrAPITokenNotFound
+		}
+		log.Printf("AuthService: Error revoking API token {%s}: %v", tokenId, err)
+		return err
+	}
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     audit.ActionAPITokenRevoked,
+		TargetType: audit.TargetAPIToken,
+		TargetId:   tokenId,
+	})
+	return nil
+}
+
+func (s *service) AuthenticateAPIToken(ctx context.Context, rawToken string) (APIToken, error) {
+	if !strings.HasPrefix(rawToken, APITokenPrefix) {
+		return APIToken{}, ErrUnauthorized
+	}
+
+	apiToken, err := s.r.GetAPITokenByHash(ctx, encryptToken(rawToken))
+	if err != nil {
+		if !errors.Is(err, ErrNoDocuments) {
+			log.Printf("AuthService: Error getting API token: %v", err)
+		}
+		return APIToken{}, ErrUnauthorized
+	}
+
+	if apiToken.Revoked || apiToken.IsExpired() {
+		return APIToken{}, ErrUnauthorized
+	}
+
+	// The owner must still exist and be verified, same as for cookie sessions
+	user, err := s.r.GetUserById(ctx, apiToken.UserId)
+	if err != nil || !user.Verified {
+		return APIToken{}, ErrUnauthorized
+	}
+
+	now := time.Now()
+	if err := s.r.UpdateAPITokenLastUsed(ctx, apiToken.TokenId, now); err != nil {
+		log.Printf("AuthService: Error updating API token last used: %v", err)
+	}
+	apiToken.LastUsedAt = now
+
+	return apiToken, nil
+}
+
+// ParseToken verifies a session jwt against the keyring and returns its claims
+func (s *service) ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := s.k.Parse(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+	// Tokens issued to OAuth clients are signed with the same keys, but carry no session claims
+	if claims.UserId == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// VerifyCSRFToken checks the csrf token was issued together with the session jwt of the claims
+func (s *service) VerifyCSRFToken(claims *Claims, csrfToken string) error {
+	return s.k.VerifyCSRFToken(csrfToken, claims.ID)
+}
+
+func (s *service) JWKS() (jwk.Set, error) {
+	return s.k.JWKS()
+}
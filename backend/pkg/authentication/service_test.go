@@ -0,0 +1,513 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testOrigin = "http://localhost:3000"
+
+// fakeRepository keeps users, tokens and signing keys in memory
+type fakeRepository struct {
+	mu          sync.Mutex
+	users       []*fakeUser
+	authTokens  map[string]*AuthToken // by hash
+	signingKeys []SigningKey
+	nextId      int
+}
+
+type fakeUser struct {
+	User
+	identities []ExternalIdentity
+	passkeys   []Passkey
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{authTokens: map[string]*AuthToken{}}
+}
+
+// addUser stores a verified user with the password, which is hashed like on signup
+func (r *fakeRepository) addUser(t *testing.T, email string, password string) User {
+	t.Helper()
+	u := NewUser(email, "Alex", "")
+	u.Verified = true
+	if password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.Password = string(hashed)
+	}
+	if err := r.SignUp(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := r.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func (r *fakeRepository) find(match func(u *fakeUser) bool) *fakeUser {
+	for _, u := range r.users {
+		if match(u) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepository) byId(userId string) *fakeUser {
+	return r.find(func(u *fakeUser) bool { return u.UserId == userId })
+}
+
+func (r *fakeRepository) byEmail(email string) *fakeUser {
+	return r.find(func(u *fakeUser) bool { return u.Email == email })
+}
+
+func (r *fakeRepository) useAuthToken(hashedToken string) error {
+	token, ok := r.authTokens[hashedToken]
+	if !ok || token.Used {
+		return ErrInvalidToken
+	}
+	token.Used = true
+	return nil
+}
+
+func (r *fakeRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (r *fakeRepository) SignUp(ctx context.Context, u User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byEmail(u.Email) != nil {
+		return ErrEmailTaken
+	}
+	r.nextId++
+	u.UserId = fmt.Sprintf("%024x", r.nextId)
+	r.users = append(r.users, &fakeUser{User: u})
+	return nil
+}
+
+func (r *fakeRepository) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u := r.byEmail(email); u != nil {
+		return u.User, nil
+	}
+	return User{}, ErrNoDocuments
+}
+
+func (r *fakeRepository) GetUserById(ctx context.Context, userId string) (UserResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byId(userId)
+	if u == nil {
+		return UserResponse{}, ErrNoDocuments
+	}
+	return UserResponse{
+		UserId:              u.UserId,
+		Email:               u.Email,
+		Name:                u.Name,
+		Verified:            u.Verified,
+		PasskeySecondFactor: u.PasskeySecondFactor,
+		Locale:              u.Locale,
+	}, nil
+}
+
+func (r *fakeRepository) CreateAuthToken(ctx context.Context, t AuthToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.authTokens[t.Token] = &t
+	return nil
+}
+
+func (r *fakeRepository) GetAuthToken(ctx context.Context, hashedToken string) (AuthToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if token, ok := r.authTokens[hashedToken]; ok {
+		return *token, nil
+	}
+	return AuthToken{}, ErrNoDocuments
+}
+
+func (r *fakeRepository) UpdatePasswordAndMarkToken(ctx context.Context, email string, newPassword string, hashedToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byEmail(email)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	if err := r.useAuthToken(hashedToken); err != nil {
+		return err
+	}
+	u.Password = newPassword
+	return nil
+}
+
+func (r *fakeRepository) VerifyEmailAndMarkToken(ctx context.Context, email string, hashedToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byEmail(email)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	if err := r.useAuthToken(hashedToken); err != nil {
+		return err
+	}
+	u.Verified = true
+	return nil
+}
+
+func (r *fakeRepository) CreateAPIToken(ctx context.Context, t APIToken) (APIToken, error) {
+	return t, nil
+}
+
+func (r *fakeRepository) GetAPITokenByHash(ctx context.Context, hashedToken string) (APIToken, error) {
+	return APIToken{}, ErrNoDocuments
+}
+
+func (r *fakeRepository) GetAPITokensByUserId(ctx context.Context, userId string) ([]APIToken, error) {
+	return []APIToken{}, nil
+}
+
+func (r *fakeRepository) RevokeAPIToken(ctx context.Context, tokenId string, userId string) error {
+	return ErrNoDocuments
+}
+
+func (r *fakeRepository) UpdateAPITokenLastUsed(ctx context.Context, tokenId string, lastUsedAt time.Time) error {
+	return nil
+}
+
+func (r *fakeRepository) GetUserByExternalIdentity(ctx context.Context, provider string, subject string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.find(func(u *fakeUser) bool {
+		for _, identity := range u.identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return true
+			}
+		}
+		return false
+	})
+	if u == nil {
+		return User{}, ErrNoDocuments
+	}
+	return u.User, nil
+}
+
+func (r *fakeRepository) LinkExternalIdentity(ctx context.Context, userId string, identity ExternalIdentity, clearPassword bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byId(userId)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	u.Verified = true
+	if clearPassword {
+		u.Password = ""
+	}
+	u.identities = append(u.identities, identity)
+	return nil
+}
+
+func (r *fakeRepository) UpdateUserPassword(ctx context.Context, email string, newPassword string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byEmail(email)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	u.Password = newPassword
+	return nil
+}
+
+func (r *fakeRepository) UpdateUserProfile(ctx context.Context, userId string, name string, locale string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byId(userId)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	u.Name = name
+	if locale != "" {
+		u.Locale = locale
+	}
+	return nil
+}
+
+func (r *fakeRepository) ChangeEmailAndMarkToken(ctx context.Context, email string, newEmail string, hashedToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byEmail(email)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	if err := r.useAuthToken(hashedToken); err != nil {
+		return err
+	}
+	u.Email = newEmail
+	return nil
+}
+
+func (r *fakeRepository) DeleteUser(ctx context.Context, userId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, u := range r.users {
+		if u.UserId == userId {
+			r.users = append(r.users[:i], r.users[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNoDocuments
+}
+
+func (r *fakeRepository) GetLatestAuthToken(ctx context.Context, email string, purpose PurposeType) (AuthToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *AuthToken
+	for _, token := range r.authTokens {
+		if token.Email == email && token.Purpose == purpose && (latest == nil || token.CreatedAt.After(latest.CreatedAt)) {
+			latest = token
+		}
+	}
+	if latest == nil {
+		return AuthToken{}, ErrNoDocuments
+	}
+	return *latest, nil
+}
+
+func (r *fakeRepository) GetUnverifiedUserIds(ctx context.Context, createdBefore time.Time) ([]string, error) {
+	return nil, nil
+}
+
+func (r *fakeRepository) GetPasskeys(ctx context.Context, userId string) ([]Passkey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byId(userId)
+	if u == nil {
+		return nil, ErrNoDocuments
+	}
+	return append([]Passkey{}, u.passkeys...), nil
+}
+
+func (r *fakeRepository) GetUserByPasskey(ctx context.Context, credentialId string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.find(func(u *fakeUser) bool {
+		for _, passkey := range u.passkeys {
+			if passkey.CredentialId == credentialId {
+				return true
+			}
+		}
+		return false
+	})
+	if u == nil {
+		return User{}, ErrNoDocuments
+	}
+	return u.User, nil
+}
+
+func (r *fakeRepository) AddPasskeyAndMarkToken(ctx context.Context, userId string, passkey Passkey, hashedToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		for _, p := range u.passkeys {
+			if p.CredentialId == passkey.CredentialId {
+				return ErrPasskeyTaken
+			}
+		}
+	}
+	u := r.byId(userId)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	if err := r.useAuthToken(hashedToken); err != nil {
+		return err
+	}
+	u.passkeys = append(u.passkeys, passkey)
+	return nil
+}
+
+func (r *fakeRepository) UpdatePasskeyAndMarkToken(ctx context.Context, userId string, credentialId string, signCount uint32, lastUsedAt time.Time, hashedToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byId(userId)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	for i := range u.passkeys {
+		passkey := &u.passkeys[i]
+		if passkey.CredentialId != credentialId {
+			continue
+		}
+		if signCount != 0 && signCount <= passkey.SignCount {
+			return fmt.Errorf("signature counter did not increase")
+		}
+		if err := r.useAuthToken(hashedToken); err != nil {
+			return err
+		}
+		passkey.SignCount = signCount
+		passkey.LastUsedAt = lastUsedAt
+		return nil
+	}
+	return ErrNoDocuments
+}
+
+func (r *fakeRepository) DeletePasskey(ctx context.Context, userId string, credentialId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byId(userId)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	for i, passkey := range u.passkeys {
+		if passkey.CredentialId == credentialId {
+			u.passkeys = append(u.passkeys[:i], u.passkeys[i+1:]...)
+			if len(u.passkeys) == 0 {
+				u.PasskeySecondFactor = false
+			}
+			return nil
+		}
+	}
+	return ErrNoDocuments
+}
+
+func (r *fakeRepository) SetPasskeySecondFactor(ctx context.Context, userId string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.byId(userId)
+	if u == nil {
+		return ErrNoDocuments
+	}
+	u.PasskeySecondFactor = enabled
+	return nil
+}
+
+func (r *fakeRepository) CreateSigningKey(ctx context.Context, key SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.signingKeys {
+		if k.Kid == key.Kid {
+			return ErrSigningKeyExists
+		}
+	}
+	r.signingKeys = append(r.signingKeys, key)
+	return nil
+}
+
+func (r *fakeRepository) GetSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SigningKey{}, r.signingKeys...), nil
+}
+
+func (r *fakeRepository) SetSigningKeyExpiry(ctx context.Context, kid string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.signingKeys {
+		if r.signingKeys[i].Kid == kid {
+			r.signingKeys[i].ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+// fakeEmailService records the emails instead of queueing them
+type fakeEmailService struct {
+	mu   sync.Mutex
+	sent []string // templates
+}
+
+func (e *fakeEmailService) SendEmail(ctx context.Context, to string, locale string, template string, data interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sent = append(e.sent, template)
+	return nil
+}
+
+func (e *fakeEmailService) PreviewEmail(template string, locale string) (email.Email, error) {
+	return email.Email{}, nil
+}
+
+func (e *fakeEmailService) Start() (stop func()) {
+	return func() {}
+}
+
+// fakeAuditLogger records the events it is given
+type fakeAuditLogger struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (a *fakeAuditLogger) Log(ctx context.Context, e audit.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, e)
+}
+
+func (a *fakeAuditLogger) has(action audit.Action, details map[string]string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range a.events {
+		if e.Action != action {
+			continue
+		}
+		matches := true
+		for k, v := range details {
+			if e.Details[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestService(t *testing.T) (*service, *fakeRepository, *fakeAuditLogger) {
+	t.Helper()
+	t.Setenv("JWT_KEYRING_SECRET", "test-keyring-secret")
+	t.Setenv("JWT_SIGNING_ALG", AlgorithmEdDSA)
+	t.Setenv("JWT_EXPIRATION_TIME", "60")
+
+	r := newFakeRepository()
+	k, err := NewKeyring(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := &webauthn.RelyingParty{ID: "localhost", Name: "SwearJar", Origins: []string{testOrigin}, Timeout: webauthn.DefaultTimeout}
+	a := &fakeAuditLogger{}
+	return &service{r, &fakeEmailService{}, k, DefaultPasswordPolicy(), a, rp}, r, a
+}
+
+func TestForgotPassword(t *testing.T) {
+	s, r, _ := newTestService(t)
+	r.addUser(t, "alex@example.com", "correct horse battery staple")
+	e := s.e.(*fakeEmailService)
+
+	// An unknown email succeeds without sending anything, so the response does not reveal which emails have accounts
+	if err := s.ForgotPassword(context.Background(), "nobody@example.com"); err != nil {
+		t.Errorf("ForgotPassword of an unknown email = %v, want nil", err)
+	}
+	if len(e.sent) != 0 {
+		t.Errorf("sent %v for an unknown email, want nothing", e.sent)
+	}
+
+	if err := s.ForgotPassword(context.Background(), "alex@example.com"); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	if len(e.sent) != 1 || e.sent[0] != email.TemplateResetPassword {
+		t.Errorf("sent %v, want the password reset email", e.sent)
+	}
+}
@@ -1,25 +1,36 @@
 package authentication
 
+import "time"
+
 type User struct {
-	UserId   string `bson:"_id"`
-	Name     string
-	Password string
-	Email    string
-	Verified bool
+	UserId    string `bson:"_id"`
+	Name      string
+	Password  string
+	Email     string
+	Verified  bool
+	CreatedAt time.Time
+
+	// PasskeySecondFactor requires a passkey in addition to the password or magic link to log in
+	PasskeySecondFactor bool
+	// Locale is the language the user is emailed in, one of email.Locales or empty for email.DefaultLocale
+	Locale string
 }
 
 type UserResponse struct {
-	UserId   string `bson:"_id"`
-	Email    string
-	Name     string
-	Verified bool
+	UserId              string `bson:"_id"`
+	Email               string
+	Name                string
+	Verified            bool
+	PasskeySecondFactor bool
+	Locale              string
 }
 
 func NewUser(email string, name string, password string) User {
 	return User{
-		Email:    email,
-		Name:     name,
-		Password: password,
-		Verified: false,
+		Email:     email,
+		Name:      name,
+		Password:  password,
+		Verified:  false,
+		CreatedAt: time.Now(),
 	}
 }
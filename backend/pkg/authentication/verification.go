@@ -0,0 +1,104 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+)
+
+const (
+	DefaultResendCooldown               = 1 * time.Minute
+	DefaultUnverifiedAccountGracePeriod = 7 * 24 * time.Hour
+
+	unverifiedAccountCleanupInterval = 1 * time.Hour
+	unverifiedAccountCleanupTimeout  = 5 * time.Minute
+)
+
+// ResendVerificationEmail sends a new verification link to an unverified account, invalidating the links sent before.
+// Nothing is sent for unknown or already verified emails.
+func (s *service) ResendVerificationEmail(ctx context.Context, email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	user, err := s.r.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrNoDocuments) {
+			log.Printf("AuthService: Verification email requested for unknown email {%s}", email)
+			return nil
+		}
+		log.Printf("AuthService: Error fetching user by email: %v", err)
+		return err
+	}
+	if user.Verified {
+		return nil
+	}
+
+	// Limit how often the email can be sent
+	latest, err := s.r.GetLatestAuthToken(ctx, email, PurposeEmailVerification)
+	if err != nil && !errors.Is(err, ErrNoDocuments) {
+		log.Printf("AuthService: Error fetching latest verification token: %v", err)
+		return err
+	}
+	cooldown := durationFromEnv("VERIFICATION_RESEND_COOLDOWN", DefaultResendCooldown)
+	if err == nil && time.Since(latest.CreatedAt) < cooldown {
+		return ErrResendCooldown.WithRetryAfter(cooldown - time.Since(latest.CreatedAt))
+	}
+
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		return err
+	}
+
+	s.logUserEvent(ctx, "", audit.ActionVerificationEmailResent, user.UserId, nil)
+	log.Printf("AuthService: Verification email resent to %s", email)
+	return nil
+}
+
+// StartUnverifiedAccountCleanup periodically deletes accounts whose email has not been verified within the grace period
+// set by UNVERIFIED_ACCOUNT_GRACE_PERIOD. A grace period of 0 disables the cleanup.
+func (s *service) StartUnverifiedAccountCleanup() (stop func()) {
+	gracePeriod := durationFromEnv("UNVERIFIED_ACCOUNT_GRACE_PERIOD", DefaultUnverifiedAccountGracePeriod)
+	if gracePeriod == 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(unverifiedAccountCleanupInterval)
+	done := make(chan struct{})
+
+	go func() {
+		s.deleteUnverifiedAccounts(gracePeriod)
+		for {
+			select {
+			case <-ticker.C:
+				s.deleteUnverifiedAccounts(gracePeriod)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (s *service) deleteUnverifiedAccounts(gracePeriod time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), unverifiedAccountCleanupTimeout)
+	defer cancel()
+
+	userIds, err := s.r.GetUnverifiedUserIds(ctx, time.Now().Add(-gracePeriod))
+	if err != nil {
+		log.Printf("AuthService: Error fetching unverified accounts: %v", err)
+		return
+	}
+
+	for _, userId := range userIds {
+		if err := s.r.DeleteUser(ctx, userId); err != nil {
+			log.Printf("AuthService: Error deleting unverified account {%s}: %v", userId, err)
+			continue
+		}
+		s.logUserEvent(ctx, "", audit.ActionAccountDeleted, userId, map[string]string{"reason": "unverified"})
+		log.Printf("AuthService: Deleted unverified account {%s}", userId)
+	}
+}
@@ -0,0 +1,87 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagBackupEligible         = 0x08
+	flagBackedUp               = 0x10
+	flagAttestedCredentialData = 0x40
+	flagExtensionData          = 0x80
+)
+
+const maxCredentialIdLength = 1023
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	// Only present in registration responses
+	AAGUID       []byte
+	CredentialId []byte
+	PublicKey    []byte // COSE_Key
+}
+
+func (a authenticatorData) has(flag byte) bool {
+	return a.Flags&flag != 0
+}
+
+// parseAuthenticatorData parses the authenticator data (WebAuthn §6.1):
+// rpIdHash (32) | flags (1) | signCount (4) | [attested credential data] | [extensions]
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, errors.New("authenticator data is too short")
+	}
+
+	a := authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if a.has(flagAttestedCredentialData) {
+		// aaguid (16) | credentialIdLength (2) | credentialId | credentialPublicKey
+		if len(rest) < 18 {
+			return authenticatorData{}, errors.New("attested credential data is too short")
+		}
+		a.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > maxCredentialIdLength || len(rest) < idLength {
+			return authenticatorData{}, errors.New("invalid credential id length")
+		}
+		a.CredentialId = rest[:idLength]
+		rest = rest[idLength:]
+
+		// The public key is the only item without a length prefix, so its length is found by decoding it
+		_, afterKey, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, err
+		}
+		a.PublicKey = rest[:len(rest)-len(afterKey)]
+		rest = afterKey
+	}
+
+	if a.has(flagExtensionData) {
+		extensions, afterExtensions, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, err
+		}
+		if _, ok := extensions.(map[interface{}]interface{}); !ok {
+			return authenticatorData{}, errors.New("extensions are not a map")
+		}
+		rest = afterExtensions
+	}
+
+	if len(rest) != 0 {
+		return authenticatorData{}, errors.New("trailing data after authenticator data")
+	}
+	return a, nil
+}
@@ -0,0 +1,128 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSEAlgorithm identifies a signature algorithm in the IANA COSE Algorithms registry
+type COSEAlgorithm int64
+
+const (
+	AlgES256 COSEAlgorithm = -7
+	AlgEdDSA COSEAlgorithm = -8
+	AlgRS256 COSEAlgorithm = -257
+)
+
+// SupportedAlgorithms are offered to authenticators in order of preference
+var SupportedAlgorithms = []COSEAlgorithm{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE_Key labels and values (RFC 9052, RFC 9053)
+const (
+	coseKeyType      = 1
+	coseKeyAlgorithm = 3
+	coseKeyCurve     = -1 // EC2 and OKP keys
+	coseKeyX         = -2
+	coseKeyY         = -3
+	coseKeyModulus   = -1 // RSA keys
+	coseKeyExponent  = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+
+	minRSAKeyBits = 2048
+)
+
+type publicKey struct {
+	alg COSEAlgorithm
+	key crypto.PublicKey
+}
+
+// parsePublicKey parses a credential public key encoded as a COSE_Key
+func parsePublicKey(coseKey []byte) (publicKey, error) {
+	item, rest, err := decodeCBOR(coseKey)
+	if err != nil {
+		return publicKey{}, err
+	}
+	if len(rest) != 0 {
+		return publicKey{}, errors.New("trailing data after public key")
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return publicKey{}, errors.New("public key is not a map")
+	}
+
+	kty, _ := m[int64(coseKeyType)].(int64)
+	alg, _ := m[int64(coseKeyAlgorithm)].(int64)
+
+	switch COSEAlgorithm(alg) {
+	case AlgES256:
+		crv, _ := m[int64(coseKeyCurve)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		y, _ := m[int64(coseKeyY)].([]byte)
+		if kty != coseKeyTypeEC2 || crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, errors.New("invalid ES256 public key")
+		}
+		// Rejects points which are not on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return publicKey{}, fmt.Errorf("invalid ES256 public key: %v", err)
+		}
+		return publicKey{AlgES256, &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case AlgEdDSA:
+		crv, _ := m[int64(coseKeyCurve)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		if kty != coseKeyTypeOKP || crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, errors.New("invalid EdDSA public key")
+		}
+		return publicKey{AlgEdDSA, ed25519.PublicKey(x)}, nil
+	case AlgRS256:
+		n, _ := m[int64(coseKeyModulus)].([]byte)
+		e, _ := m[int64(coseKeyExponent)].([]byte)
+		if kty != coseKeyTypeRSA || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return publicKey{}, errors.New("invalid RS256 public key")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSAKeyBits || key.E < 3 {
+			return publicKey{}, errors.New("RS256 public key is too weak")
+		}
+		return publicKey{AlgRS256, key}, nil
+	default:
+		return publicKey{}, fmt.Errorf("unsupported algorithm %d", alg)
+	}
+}
+
+// verify checks the signature of the authenticator over data
+func (k publicKey) verify(data []byte, signature []byte) error {
+	var valid bool
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		valid = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Values of the clientDataJSON type member
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// User verification and resident key requirements
+const (
+	RequirementRequired    = "required"
+	RequirementPreferred   = "preferred"
+	RequirementDiscouraged = "discouraged"
+)
+
+const publicKeyCredentialType = "public-key"
+
+// Base64URL is binary data, encoded as unpadded base64url in JSON as in the WebAuthn JSON serialization
+// (PublicKeyCredential.toJSON). Padded input is accepted as well.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return errors.New("invalid base64url")
+	}
+	*b = decoded
+	return nil
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Base64URL `json:"id"` // The user handle, returned by discoverable credentials on login
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string        `json:"type"`
+	Alg  COSEAlgorithm `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are passed to navigator.credentials.create() to register a credential
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get() to authenticate with a credential.
+// Without AllowCredentials the authenticator offers its discoverable credentials for the relying party.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+	Transports        []string  `json:"transports,omitempty"`
+}
+
+// RegistrationResponse is the credential returned by navigator.credentials.create()
+type RegistrationResponse struct {
+	ID       string                           `json:"id"`
+	RawID    Base64URL                        `json:"rawId"`
+	Type     string                           `json:"type"`
+	Response AuthenticatorAttestationResponse `json:"response"`
+}
+
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle,omitempty"`
+}
+
+// AuthenticationResponse is the credential returned by navigator.credentials.get()
+type AuthenticationResponse struct {
+	ID       string                         `json:"id"`
+	RawID    Base64URL                      `json:"rawId"`
+	Type     string                         `json:"type"`
+	Response AuthenticatorAssertionResponse `json:"response"`
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func parseClientData(clientDataJSON []byte) (collectedClientData, error) {
+	var c collectedClientData
+	if err := json.Unmarshal(clientDataJSON, &c); err != nil {
+		return collectedClientData{}, errors.New("invalid client data")
+	}
+	return c, nil
+}
+
+// Challenge returns the challenge the response was created for, to look up the pending ceremony
+func (r RegistrationResponse) Challenge() (string, error) {
+	c, err := parseClientData(r.Response.ClientDataJSON)
+	return c.Challenge, err
+}
+
+// Challenge returns the challenge the response was created for, to look up the pending ceremony
+func (r AuthenticationResponse) Challenge() (string, error) {
+	c, err := parseClientData(r.Response.ClientDataJSON)
+	return c.Challenge, err
+}
@@ -0,0 +1,259 @@
+// Package webauthn implements the relying party side of the WebAuthn registration and authentication
+// ceremonies (https://www.w3.org/TR/webauthn-2/), so users can log in with passkeys and security keys.
+// Attestation is not requested, so the authenticator model is not verified.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const DefaultTimeout = 5 * time.Minute
+
+var ErrVerification = errors.New("webauthn verification failed")
+
+// ErrSignCountRegression means the authenticator reported a signature counter which did not increase,
+// which indicates that the credential has been cloned
+var ErrSignCountRegression = fmt.Errorf("%w: signature counter did not increase", ErrVerification)
+
+type RelyingParty struct {
+	ID      string   // Domain the credentials are scoped to, e.g. swearjar.app
+	Name    string   // Shown by the authenticator
+	Origins []string // Origins of the frontend allowed to perform ceremonies, e.g. https://swearjar.app
+	Timeout time.Duration
+}
+
+// Credential is a verified public key credential
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	UserVerified   bool
+	BackupEligible bool // Synced passkeys are backup eligible, security keys are not
+	BackedUp       bool
+}
+
+// LoadRelyingPartyFromEnv configures the relying party from WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME and WEBAUTHN_ORIGINS
+// (comma separated). The ID and origin default to the host and origin of FRONTEND_URL.
+func LoadRelyingPartyFromEnv() (*RelyingParty, error) {
+	frontendURL := strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/")
+
+	id := os.Getenv("WEBAUTHN_RP_ID")
+	if id == "" {
+		u, err := url.Parse(frontendURL)
+		if err != nil || u.Hostname() == "" {
+			return nil, errors.New("WEBAUTHN_RP_ID is required when FRONTEND_URL is not a valid url")
+		}
+		id = u.Hostname()
+	}
+
+	name := os.Getenv("WEBAUTHN_RP_NAME")
+	if name == "" {
+		name = "SwearJar"
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 && frontendURL != "" {
+		origins = []string{frontendURL}
+	}
+	if len(origins) == 0 {
+		return nil, errors.New("WEBAUTHN_ORIGINS is required when FRONTEND_URL is not set")
+	}
+
+	return &RelyingParty{ID: id, Name: name, Origins: origins, Timeout: DefaultTimeout}, nil
+}
+
+// CreationOptions returns the options to register a credential for the user. Existing credentials are excluded,
+// so the same authenticator is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge string, user UserEntity, exclude []CredentialDescriptor) CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: publicKeyCredentialType, Alg: alg})
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return CreationOptions{
+		Challenge:          challenge,
+		RP:                 RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		PubKeyCredParams:   params,
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		// Discoverable credentials allow logging in without entering an email first
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      RequirementPreferred,
+			UserVerification: RequirementPreferred,
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options to authenticate with one of the allowed credentials, or with any
+// discoverable credential if none are given
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor, userVerification string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// VerifyRegistration verifies the response to CreationOptions with the given challenge (WebAuthn §7.1)
+func (rp *RelyingParty) VerifyRegistration(resp RegistrationResponse, challenge string, requireUserVerification bool) (Credential, error) {
+	if resp.Type != publicKeyCredentialType {
+		return Credential{}, fmt.Errorf("%w: invalid credential type", ErrVerification)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyCreate, challenge); err != nil {
+		return Credential{}, err
+	}
+
+	// * 1. Decode the attestation object
+	item, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return Credential{}, fmt.Errorf("%w: invalid attestation object", ErrVerification)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: invalid attestation object", ErrVerification)
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if format == "" || statement == nil {
+		return Credential{}, fmt.Errorf("%w: invalid attestation object", ErrVerification)
+	}
+	// Attestation is not requested, so statements of other formats are not verified and treated as none
+	if format == "none" && len(statement) != 0 {
+		return Credential{}, fmt.Errorf("%w: none attestation must have an empty statement", ErrVerification)
+	}
+
+	// * 2. Verify the authenticator data
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUserVerification)
+	if err != nil {
+		return Credential{}, err
+	}
+	if !authData.has(flagAttestedCredentialData) {
+		return Credential{}, fmt.Errorf("%w: missing attested credential data", ErrVerification)
+	}
+	if !bytes.Equal(authData.CredentialId, resp.RawID) {
+		return Credential{}, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+
+	// * 3. Check the public key can be used
+	key, err := parsePublicKey(authData.PublicKey)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	if !slices.Contains(SupportedAlgorithms, key.alg) {
+		return Credential{}, fmt.Errorf("%w: unsupported algorithm", ErrVerification)
+	}
+
+	return Credential{
+		ID:             authData.CredentialId,
+		PublicKey:      authData.PublicKey,
+		SignCount:      authData.SignCount,
+		AAGUID:         authData.AAGUID,
+		Transports:     resp.Response.Transports,
+		UserVerified:   authData.has(flagUserVerified),
+		BackupEligible: authData.has(flagBackupEligible),
+		BackedUp:       authData.has(flagBackedUp),
+	}, nil
+}
+
+// VerifyAuthentication verifies the response to RequestOptions with the given challenge against the stored
+// credential (WebAuthn §7.2), and returns the new signature counter to store
+func (rp *RelyingParty) VerifyAuthentication(resp AuthenticationResponse, challenge string, cred Credential, requireUserVerification bool) (signCount uint32, err error) {
+	if resp.Type != publicKeyCredentialType {
+		return 0, fmt.Errorf("%w: invalid credential type", ErrVerification)
+	}
+	if !bytes.Equal(resp.RawID, cred.ID) {
+		return 0, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyGet, challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(resp.Response.AuthenticatorData, requireUserVerification)
+	if err != nil {
+		return 0, err
+	}
+
+	// * 1. The signature covers the authenticator data and the hash of the client data
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signedData := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := key.verify(signedData, resp.Response.Signature); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	// * 2. Authenticators which do not support counters always report 0, others must increase it on every use
+	if (authData.SignCount != 0 || cred.SignCount != 0) && authData.SignCount <= cred.SignCount {
+		return 0, ErrSignCountRegression
+	}
+
+	return authData.SignCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge string) error {
+	c, err := parseClientData(clientDataJSON)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	if c.Type != ceremony {
+		return fmt.Errorf("%w: unexpected ceremony type %q", ErrVerification, c.Type)
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(c.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if !slices.Contains(rp.Origins, c.Origin) {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrVerification, c.Origin)
+	}
+	if c.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin ceremonies are not allowed", ErrVerification)
+	}
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(rawAuthData []byte, requireUserVerification bool) (authenticatorData, error) {
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return authenticatorData{}, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	rpIdHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIdHash[:]) {
+		return authenticatorData{}, fmt.Errorf("%w: relying party id mismatch", ErrVerification)
+	}
+	if !authData.has(flagUserPresent) {
+		return authenticatorData{}, fmt.Errorf("%w: user not present", ErrVerification)
+	}
+	if requireUserVerification && !authData.has(flagUserVerified) {
+		return authenticatorData{}, fmt.Errorf("%w: user not verified", ErrVerification)
+	}
+	if authData.has(flagBackedUp) && !authData.has(flagBackupEligible) {
+		return authenticatorData{}, fmt.Errorf("%w: backed up credential is not backup eligible", ErrVerification)
+	}
+	return authData, nil
+}
@@ -0,0 +1,262 @@
+// Package webauthntest provides a software authenticator for exercising the passkey registration and login
+// ceremonies in tests and during local development, without a browser or hardware authenticator.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+)
+
+var ErrNoCredential = errors.New("webauthntest: no matching credential")
+var ErrExcluded = errors.New("webauthntest: authenticator already holds an excluded credential")
+
+type credential struct {
+	id         []byte
+	rpId       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// Authenticator is a platform authenticator holding discoverable ES256 credentials in memory
+type Authenticator struct {
+	Origin         string // Origin the browser would report, e.g. http://localhost:3000
+	UserVerified   bool   // Whether the user is verified, e.g. with biometrics, in addition to being present
+	BackupEligible bool   // Whether credentials are synced passkeys
+
+	mu          sync.Mutex
+	credentials []*credential
+}
+
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerified: true, BackupEligible: true}
+}
+
+// Register creates a credential as navigator.credentials.create() would
+func (a *Authenticator) Register(opts webauthn.CreationOptions) (webauthn.RegistrationResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !slices.ContainsFunc(opts.PubKeyCredParams, func(p webauthn.CredentialParameter) bool { return p.Alg == webauthn.AlgES256 }) {
+		return webauthn.RegistrationResponse{}, errors.New("webauthntest: ES256 is not offered")
+	}
+	for _, excluded := range opts.ExcludeCredentials {
+		if a.find(opts.RP.ID, excluded.ID) != nil {
+			return webauthn.RegistrationResponse{}, ErrExcluded
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return webauthn.RegistrationResponse{}, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return webauthn.RegistrationResponse{}, err
+	}
+	cred := &credential{id: id, rpId: opts.RP.ID, userHandle: opts.User.ID, key: key}
+	a.credentials = append(a.credentials, cred)
+
+	clientDataJSON, err := a.clientData("webauthn.create", opts.Challenge)
+	if err != nil {
+		return webauthn.RegistrationResponse{}, err
+	}
+
+	// attestedCredentialData: aaguid (16) | credentialIdLength (2) | credentialId | credentialPublicKey
+	attested := make([]byte, 16, 16+2+len(id))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, coseKey(&key.PublicKey)...)
+	authData := a.authenticatorData(cred, 0x40, attested)
+
+	attestationObject := new(bytes.Buffer)
+	writeMapHeader(attestationObject, 3)
+	writeString(attestationObject, "fmt")
+	writeString(attestationObject, "none")
+	writeString(attestationObject, "attStmt")
+	writeMapHeader(attestationObject, 0)
+	writeString(attestationObject, "authData")
+	writeBytes(attestationObject, authData)
+
+	return webauthn.RegistrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAttestationResponse{
+			ClientDataJSON:    clientDataJSON,
+			AttestationObject: attestationObject.Bytes(),
+			Transports:        []string{"internal", "hybrid"},
+		},
+	}, nil
+}
+
+// Login signs the challenge with a credential as navigator.credentials.get() would. Without allowed credentials,
+// the most recently registered discoverable credential for the relying party is used.
+func (a *Authenticator) Login(opts webauthn.RequestOptions) (webauthn.AuthenticationResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var cred *credential
+	if len(opts.AllowCredentials) == 0 {
+		for i := len(a.credentials) - 1; i >= 0; i-- {
+			if a.credentials[i].rpId == opts.RPID {
+				cred = a.credentials[i]
+				break
+			}
+		}
+	}
+	for _, allowed := range opts.AllowCredentials {
+		if cred = a.find(opts.RPID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return webauthn.AuthenticationResponse{}, ErrNoCredential
+	}
+
+	clientDataJSON, err := a.clientData("webauthn.get", opts.Challenge)
+	if err != nil {
+		return webauthn.AuthenticationResponse{}, err
+	}
+
+	cred.signCount++
+	authData := a.authenticatorData(cred, 0, nil)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return webauthn.AuthenticationResponse{}, err
+	}
+
+	return webauthn.AuthenticationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAssertionResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         signature,
+			UserHandle:        cred.userHandle,
+		},
+	}, nil
+}
+
+// SetSignCount overwrites the signature counter of the credential, e.g. to simulate a cloned authenticator
+func (a *Authenticator) SetSignCount(credentialId []byte, signCount uint32) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, cred := range a.credentials {
+		if bytes.Equal(cred.id, credentialId) {
+			cred.signCount = signCount
+			return nil
+		}
+	}
+	return ErrNoCredential
+}
+
+func (a *Authenticator) find(rpId string, credentialId []byte) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpId == rpId && bytes.Equal(cred.id, credentialId) {
+			return cred
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+// authenticatorData builds rpIdHash (32) | flags (1) | signCount (4) | attestedCredentialData
+func (a *Authenticator) authenticatorData(cred *credential, flags byte, attested []byte) []byte {
+	flags |= 0x01 // user present
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	if a.BackupEligible {
+		flags |= 0x08 | 0x10
+	}
+
+	rpIdHash := sha256.Sum256([]byte(cred.rpId))
+	data := append([]byte(nil), rpIdHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, cred.signCount)
+	return append(data, attested...)
+}
+
+// coseKey encodes the public key as an EC2 COSE_Key: {1: 2, 3: -7, -1: 1, -2: x, -3: y}
+func coseKey(key *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+
+	buf := new(bytes.Buffer)
+	writeMapHeader(buf, 5)
+	writeInt(buf, 1)
+	writeInt(buf, 2)
+	writeInt(buf, 3)
+	writeInt(buf, -7)
+	writeInt(buf, -1)
+	writeInt(buf, 1)
+	writeInt(buf, -2)
+	writeBytes(buf, x)
+	writeInt(buf, -3)
+	writeBytes(buf, y)
+	return buf.Bytes()
+}
+
+func writeHeader(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= 0xff:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func writeInt(buf *bytes.Buffer, n int64) {
+	if n < 0 {
+		writeHeader(buf, 1, uint64(-1-n))
+		return
+	}
+	writeHeader(buf, 0, uint64(n))
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	writeHeader(buf, 2, uint64(len(b)))
+	buf.Write(b)
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeHeader(buf, 3, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func writeMapHeader(buf *bytes.Buffer, n int) {
+	writeHeader(buf, 5, uint64(n))
+}
@@ -0,0 +1,247 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+// UpdateUserProfile sets the name of the user, and the locale unless it is empty
+func (r *MongoRepository) UpdateUserProfile(ctx context.Context, userId string, name string, locale string) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	set := bson.M{"Name": name}
+	if locale != "" {
+		set["Locale"] = locale
+	}
+	result, err := r.users.UpdateByID(ctx, userIdHex, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+func (r *MongoRepository) ChangeEmailAndMarkToken(ctx context.Context, email string, newEmail string, hashedToken string) error {
+	session, err := r.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// * 1. Make sure the new email was not taken since the change was requested
+		count, err := r.users.CountDocuments(sessCtx, bson.M{"Email": newEmail})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, authentication.ErrEmailTaken
+		}
+
+		// * 2. Change the email, which is verified by the use of the token
+		userFilter := bson.M{"Email": email}
+		userUpdate := bson.M{"$set": bson.M{"Email": newEmail, "Verified": true}}
+		userResult, err := r.users.UpdateOne(sessCtx, userFilter, userUpdate)
+		if err != nil {
+			return nil, err
+		}
+		if userResult.MatchedCount == 0 {
+			return nil, errors.New("user not found")
+		}
+
+		// * 3. Mark auth token as used
+		if err := r.useAuthToken(sessCtx, hashedToken); err != nil {
+			return nil, err
+		}
+
+		// * 4. Pending tokens sent to the old email must not be usable on the account anymore
+		_, err = r.authTokens.UpdateMany(sessCtx, bson.M{"Email": email, "Used": false}, bson.M{"$set": bson.M{"Used": true}})
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// GetUnverifiedUserIds returns the ids of users who signed up before createdBefore and never verified their email
+func (r *MongoRepository) GetUnverifiedUserIds(ctx context.Context, createdBefore time.Time) ([]string, error) {
+	filter := bson.M{"Verified": false, "CreatedAt": bson.M{"$lt": createdBefore}}
+	cursor, err := r.users.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []struct {
+		UserId primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	userIds := make([]string, 0, len(users))
+	for _, u := range users {
+		userIds = append(userIds, u.UserId.Hex())
+	}
+	return userIds, nil
+}
+
+// DeleteUser deletes the user together with their swears, the swear jars they are the only owner of,
+// and their tokens, OAuth clients, notifications and data exports. The user is removed from the owners of shared swear jars.
+func (r *MongoRepository) DeleteUser(ctx context.Context, userId string) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(ctx)
+
+	// GridFS can't take part in the transaction, so the export archives are deleted once it is committed
+	archiveIds, err := r.getExportArchiveIds(ctx, bson.M{"UserId": userIdHex})
+	if err != nil {
+		return err
+	}
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var user authentication.User
+		if err := r.users.FindOne(sessCtx, bson.M{"_id": userIdHex}).Decode(&user); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, authentication.ErrNoDocuments
+			}
+			return nil, err
+		}
+
+		// * 1. Delete swear jars the user is the only owner of, and their swears
+		cursor, err := r.swearJars.Find(sessCtx, bson.M{"Owners": bson.A{userIdHex}})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching swear jars: %v", err)
+		}
+		var ownedSwearJars []struct {
+			SwearJarId primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(sessCtx, &ownedSwearJars); err != nil {
+			return nil, fmt.Errorf("error decoding swear jars: %v", err)
+		}
+		swearJarIds := make([]primitive.ObjectID, 0, len(ownedSwearJars))
+		for _, sj := range ownedSwearJars {
+			swearJarIds = append(swearJarIds, sj.SwearJarId)
+		}
+		if len(swearJarIds) > 0 {
+			if _, err := r.swears.DeleteMany(sessCtx, bson.M{"SwearJarId": bson.M{"$in": swearJarIds}}); err != nil {
+				return nil, fmt.Errorf("error deleting swears: %v", err)
+			}
+			if _, err := r.swearJars.DeleteMany(sessCtx, bson.M{"_id": bson.M{"$in": swearJarIds}}); err != nil {
+				return nil, fmt.Errorf("error deleting swear jars: %v", err)
+			}
+			if _, err := r.webhooks.DeleteMany(sessCtx, bson.M{"SwearJarId": bson.M{"$in": swearJarIds}}); err != nil {
+				return nil, fmt.Errorf("error deleting webhooks: %v", err)
+			}
+			if _, err := r.webhookDeliveries.DeleteMany(sessCtx, bson.M{"SwearJarId": bson.M{"$in": swearJarIds}}); err != nil {
+				return nil, fmt.Errorf("error deleting webhook deliveries: %v", err)
+			}
+			if _, err := r.channelLinks.DeleteMany(sessCtx, bson.M{"SwearJarId": bson.M{"$in": swearJarIds}}); err != nil {
+				return nil, fmt.Errorf("error deleting channel links: %v", err)
+			}
+			if _, err := r.notifications.DeleteMany(sessCtx, bson.M{"SwearJarId": bson.M{"$in": swearJarIds}}); err != nil {
+				return nil, fmt.Errorf("error deleting notifications: %v", err)
+			}
+			if _, err := r.notificationPreferences.DeleteMany(sessCtx, bson.M{"SwearJarId": bson.M{"$in": swearJarIds}}); err != nil {
+				return nil, fmt.Errorf("error deleting notification preferences: %v", err)
+			}
+		}
+
+		// * 2. Leave shared swear jars and delete the swears the user recorded there
+		if _, err := r.swearJars.UpdateMany(sessCtx, bson.M{"Owners": userIdHex}, bson.M{"$pull": bson.M{"Owners": userIdHex}}); err != nil {
+			return nil, fmt.Errorf("error removing user from swear jars: %v", err)
+		}
+		if _, err := r.swears.DeleteMany(sessCtx, bson.M{"UserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting swears: %v", err)
+		}
+		if _, err := r.swears.UpdateMany(sessCtx, bson.M{"ReportedBy": userIdHex}, bson.M{"$unset": bson.M{"ReportedBy": ""}}); err != nil {
+			return nil, fmt.Errorf("error removing user from reported swears: %v", err)
+		}
+
+		// * 3. Delete tokens, OAuth clients, chat links, digest subscriptions, notifications, data exports and queued emails
+		if _, err := r.authTokens.DeleteMany(sessCtx, bson.M{"Email": user.Email}); err != nil {
+			return nil, fmt.Errorf("error deleting auth tokens: %v", err)
+		}
+		if _, err := r.apiTokens.DeleteMany(sessCtx, bson.M{"UserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting API tokens: %v", err)
+		}
+		if _, err := r.oauthCodes.DeleteMany(sessCtx, bson.M{"UserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting OAuth authorization codes: %v", err)
+		}
+		if _, err := r.oauthClients.DeleteMany(sessCtx, bson.M{"OwnerUserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting OAuth clients: %v", err)
+		}
+
+		if _, err := r.linkCodes.DeleteMany(sessCtx, bson.M{"CreatedBy": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting link codes: %v", err)
+		}
+		if _, err := r.accountLinks.DeleteMany(sessCtx, bson.M{"UserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting account links: %v", err)
+		}
+
+		if _, err := r.digestSubscriptions.DeleteMany(sessCtx, bson.M{"UserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting digest subscriptions: %v", err)
+		}
+
+		if _, err := r.notifications.DeleteMany(sessCtx, bson.M{"UserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting notifications: %v", err)
+		}
+		if _, err := r.notificationPreferences.DeleteMany(sessCtx, bson.M{"UserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting notification preferences: %v", err)
+		}
+		if _, err := r.notificationWebhooks.DeleteMany(sessCtx, bson.M{"_id": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting notification webhooks: %v", err)
+		}
+
+		if _, err := r.exportJobs.DeleteMany(sessCtx, bson.M{"UserId": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting export jobs: %v", err)
+		}
+		if _, err := r.emailOutbox.DeleteMany(sessCtx, bson.M{"To": user.Email}); err != nil {
+			return nil, fmt.Errorf("error deleting queued emails: %v", err)
+		}
+
+		// * 4. Delete the user
+		if _, err := r.users.DeleteOne(sessCtx, bson.M{"_id": userIdHex}); err != nil {
+			return nil, fmt.Errorf("error deleting user: %v", err)
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, archiveId := range archiveIds {
+		if err := r.exportArchives.DeleteContext(ctx, archiveId); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			log.Printf("Error deleting export archive {%s} of deleted user {%s}: %v", archiveId.Hex(), userId, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+func (r *MongoRepository) CreateAPIToken(ctx context.Context, t authentication.APIToken) (authentication.APIToken, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(t.UserId)
+	if err != nil {
+		return authentication.APIToken{}, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	swearJarIds, err := ConvertStringIDsToObjectIDs(t.SwearJarIds)
+	if err != nil {
+		return authentication.APIToken{}, apperror.InvalidField("swearJarIds", "swear jar ids must be swear jar ids").WithCause(err)
+	}
+
+	result, err := r.apiTokens.InsertOne(ctx, bson.D{
+		{Key: "UserId", Value: userIdHex},
+		{Key: "Name", Value: t.Name},
+		{Key: "Token", Value: t.Token},
+		{Key: "Scopes", Value: t.Scopes},
+		{Key: "SwearJarIds", Value: swearJarIds},
+		{Key: "CreatedAt", Value: t.CreatedAt},
+		{Key: "ExpiresAt", Value: t.ExpiresAt},
+		{Key: "LastUsedAt", Value: t.LastUsedAt},
+		{Key: "Revoked", Value: t.Revoked},
+	})
+	if err != nil {
+		return authentication.APIToken{}, err
+	}
+
+	t.TokenId = result.InsertedID.(primitive.ObjectID).Hex()
+	return t, nil
+}
+
+func (r *MongoRepository) GetAPITokenByHash(ctx context.Context, hashedToken string) (authentication.APIToken, error) {
+	var apiToken authentication.APIToken
+	err := r.apiTokens.FindOne(ctx, bson.M{"Token": hashedToken}).Decode(&apiToken)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return authentication.APIToken{}, authentication.ErrNoDocuments
+		}
+		return authentication.APIToken{}, err
+	}
+	return apiToken, nil
+}
+
+func (r *MongoRepository) GetAPITokensByUserId(ctx context.Context, userId string) ([]authentication.APIToken, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	filter := bson.M{"UserId": userIdHex, "Revoked": false}
+	findOptions := options.Find().SetSort(bson.D{{Key: "CreatedAt", Value: -1}})
+	cursor, err := r.apiTokens.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	apiTokens := []authentication.APIToken{}
+	if err := cursor.All(ctx, &apiTokens); err != nil {
+		return nil, err
+	}
+
+	return apiTokens, nil
+}
+
+func (r *MongoRepository) RevokeAPIToken(ctx context.Context, tokenId string, userId string) error {
+	tokenIdHex, err := primitive.ObjectIDFromHex(tokenId)
+	if err != nil {
+		return fmt.Errorf("invalid TokenId: %v", err)
+	}
+
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	// Filtering on UserId ensures users can only revoke their own tokens
+	filter := bson.M{"_id": tokenIdHex, "UserId": userIdHex}
+	update := bson.M{"$set": bson.M{"Revoked": true}}
+	result, err := r.apiTokens.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *MongoRepository) UpdateAPITokenLastUsed(ctx context.Context, tokenId string, lastUsedAt time.Time) error {
+	tokenIdHex, err := primitive.ObjectIDFromHex(tokenId)
+	if err != nil {
+		return fmt.Errorf("invalid TokenId: %v", err)
+	}
+
+	_, err = r.apiTokens.UpdateByID(ctx, tokenIdHex, bson.M{"$set": bson.M{"LastUsedAt": lastUsedAt}})
+	return err
+}
@@ -0,0 +1,49 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+)
+
+// Audit events are append-only, so there are intentionally no methods to update or delete them
+
+func (r *MongoRepository) CreateAuditEvent(ctx context.Context, e audit.Event) error {
+	_, err := r.auditEvents.InsertOne(ctx, e)
+	return err
+}
+
+func (r *MongoRepository) GetAuditEventsByUserId(ctx context.Context, userId string, before time.Time, limit int) ([]audit.Event, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"ActorId": userId},
+		bson.M{"TargetType": audit.TargetUser, "TargetId": userId},
+	}}
+	return r.findAuditEvents(ctx, filter, before, limit)
+}
+
+func (r *MongoRepository) GetAuditEventsBySwearJarId(ctx context.Context, swearJarId string, before time.Time, limit int) ([]audit.Event, error) {
+	return r.findAuditEvents(ctx, bson.M{"SwearJarId": swearJarId}, before, limit)
+}
+
+func (r *MongoRepository) findAuditEvents(ctx context.Context, filter bson.M, before time.Time, limit int) ([]audit.Event, error) {
+	if !before.IsZero() {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"Timestamp": bson.M{"$lt": before}}}}
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "Timestamp", Value: -1}}).SetLimit(int64(limit))
+
+	cursor, err := r.auditEvents.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []audit.Event{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
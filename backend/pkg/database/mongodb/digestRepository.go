@@ -0,0 +1,133 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/digest"
+)
+
+func (r *MongoRepository) UpsertDigestSubscription(ctx context.Context, s digest.Subscription) (digest.Subscription, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(s.UserId)
+	if err != nil {
+		return digest.Subscription{}, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"Frequency":  s.Frequency,
+			"Timezone":   s.Timezone,
+			"NextSendAt": s.NextSendAt,
+			"UpdatedAt":  s.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{
+			"UnsubscribeToken": s.UnsubscribeToken,
+			"CreatedAt":        s.CreatedAt,
+		},
+	}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var subscription digest.Subscription
+	err = r.digestSubscriptions.FindOneAndUpdate(ctx, bson.M{"UserId": userIdHex}, update, findOptions).Decode(&subscription)
+	if err != nil {
+		return digest.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+func (r *MongoRepository) GetDigestSubscription(ctx context.Context, userId string) (digest.Subscription, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return digest.Subscription{}, authentication.ErrNoDocuments
+	}
+
+	var subscription digest.Subscription
+	err = r.digestSubscriptions.FindOne(ctx, bson.M{"UserId": userIdHex}).Decode(&subscription)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return digest.Subscription{}, authentication.ErrNoDocuments
+		}
+		return digest.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+func (r *MongoRepository) DeleteDigestSubscription(ctx context.Context, userId string) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+	return r.deleteDigestSubscription(ctx, bson.M{"UserId": userIdHex})
+}
+
+func (r *MongoRepository) DeleteDigestSubscriptionByToken(ctx context.Context, token string) error {
+	return r.deleteDigestSubscription(ctx, bson.M{"UnsubscribeToken": token})
+}
+
+func (r *MongoRepository) deleteDigestSubscription(ctx context.Context, filter bson.M) error {
+	result, err := r.digestSubscriptions.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+	return nil
+}
+
+// ClaimDigestSubscription atomically claims the subscription whose digest has been due the longest, so a digest is
+// only sent by one worker at a time. The claim hides the subscription from other claims for the lease, after which a
+// digest whose worker was interrupted is sent again.
+func (r *MongoRepository) ClaimDigestSubscription(ctx context.Context, now time.Time, lease time.Duration) (digest.Subscription, error) {
+	filter := bson.M{"NextSendAt": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"NextSendAt": now.Add(lease)}}
+	findOptions := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "NextSendAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var subscription digest.Subscription
+	err := r.digestSubscriptions.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&subscription)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return digest.Subscription{}, authentication.ErrNoDocuments
+		}
+		return digest.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+func (r *MongoRepository) ScheduleDigestSubscription(ctx context.Context, subscriptionId string, lastSentAt time.Time, nextSendAt time.Time) error {
+	subscriptionIdHex, err := primitive.ObjectIDFromHex(subscriptionId)
+	if err != nil {
+		return fmt.Errorf("invalid SubscriptionId: %v", err)
+	}
+
+	update := bson.M{"$set": bson.M{"LastSentAt": lastSentAt, "NextSendAt": nextSendAt}}
+	_, err = r.digestSubscriptions.UpdateByID(ctx, subscriptionIdHex, update)
+	return err
+}
+
+func (r *MongoRepository) CountActiveSwearsByUser(ctx context.Context, swearJarId string, userId string) (int, error) {
+	swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SwearJarId: %v", err)
+	}
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return 0, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	count, err := r.swears.CountDocuments(ctx, bson.M{"SwearJarId": swearJarIdHex, "UserId": userIdHex, "Active": true})
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
@@ -0,0 +1,104 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+)
+
+// WithTransaction runs fn in a transaction, so the writes the repository makes with the context passed to fn are
+// committed together, e.g. a token with the email which sends it. Called with the context of a transaction, fn joins
+// that transaction. fn may be run more than once if the transaction is retried.
+func (r *MongoRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+func (r *MongoRepository) EnqueueEmail(ctx context.Context, m email.Message) error {
+	_, err := r.emailOutbox.InsertOne(ctx, bson.D{
+		{Key: "To", Value: m.To},
+		{Key: "Subject", Value: m.Subject},
+		{Key: "HTMLBody", Value: m.HTMLBody},
+		{Key: "TextBody", Value: m.TextBody},
+		{Key: "Status", Value: m.Status},
+		{Key: "Attempts", Value: m.Attempts},
+		{Key: "NextAttemptAt", Value: m.NextAttemptAt},
+		{Key: "CreatedAt", Value: m.CreatedAt},
+	})
+	return err
+}
+
+// ClaimEmail atomically claims the pending email which has been due the longest, so an email is only sent by one
+// worker at a time. The claim counts as an attempt and hides the email from other claims for the lease, after which
+// an email whose worker was interrupted is claimed again.
+func (r *MongoRepository) ClaimEmail(ctx context.Context, now time.Time, lease time.Duration) (email.Message, error) {
+	filter := bson.M{"Status": email.StatusPending, "NextAttemptAt": bson.M{"$lte": now}}
+	update := bson.M{
+		"$set": bson.M{"NextAttemptAt": now.Add(lease)},
+		"$inc": bson.M{"Attempts": 1},
+	}
+	findOptions := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "NextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var m email.Message
+	err := r.emailOutbox.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&m)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return email.Message{}, email.ErrNoPendingEmail
+		}
+		return email.Message{}, err
+	}
+	return m, nil
+}
+
+func (r *MongoRepository) UpdateEmail(ctx context.Context, m email.Message) error {
+	messageIdHex, err := primitive.ObjectIDFromHex(m.MessageId)
+	if err != nil {
+		return fmt.Errorf("invalid MessageId: %v", err)
+	}
+
+	update := bson.M{"$set": bson.M{
+		"Status":        m.Status,
+		"NextAttemptAt": m.NextAttemptAt,
+		"LastAttemptAt": m.LastAttemptAt,
+		"LastError":     m.LastError,
+		"SentAt":        m.SentAt,
+	}}
+	if m.HTMLBody == "" && m.TextBody == "" {
+		update["$unset"] = bson.M{"HTMLBody": "", "TextBody": ""}
+	}
+	_, err = r.emailOutbox.UpdateByID(ctx, messageIdHex, update)
+	return err
+}
+
+// DeleteEmailsBefore deletes the sent and dead-lettered emails created before the time. Pending emails are kept
+// however old they are.
+func (r *MongoRepository) DeleteEmailsBefore(ctx context.Context, before time.Time) error {
+	filter := bson.M{
+		"Status":    bson.M{"$in": bson.A{email.StatusSent, email.StatusDead}},
+		"CreatedAt": bson.M{"$lt": before},
+	}
+	_, err := r.emailOutbox.DeleteMany(ctx, filter)
+	return err
+}
@@ -0,0 +1,312 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/export"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+func (r *MongoRepository) CreateExportJob(ctx context.Context, job export.Job) (export.Job, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(job.UserId)
+	if err != nil {
+		return export.Job{}, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	result, err := r.exportJobs.InsertOne(ctx, bson.D{
+		{Key: "UserId", Value: userIdHex},
+		{Key: "Status", Value: job.Status},
+		{Key: "CreatedAt", Value: job.CreatedAt},
+		{Key: "StartedAt", Value: job.StartedAt},
+		{Key: "CompletedAt", Value: job.CompletedAt},
+		{Key: "ExpiresAt", Value: job.ExpiresAt},
+		{Key: "Token", Value: job.Token},
+	})
+	if err != nil {
+		return export.Job{}, err
+	}
+
+	job.JobId = result.InsertedID.(primitive.ObjectID).Hex()
+	return job, nil
+}
+
+func (r *MongoRepository) GetExportJob(ctx context.Context, jobId string) (export.Job, error) {
+	jobIdHex, err := primitive.ObjectIDFromHex(jobId)
+	if err != nil {
+		return export.Job{}, authentication.ErrNoDocuments
+	}
+
+	var job export.Job
+	err = r.exportJobs.FindOne(ctx, bson.M{"_id": jobIdHex}).Decode(&job)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return export.Job{}, authentication.ErrNoDocuments
+		}
+		return export.Job{}, err
+	}
+	return job, nil
+}
+
+func (r *MongoRepository) GetExportJobsByUserId(ctx context.Context, userId string) ([]export.Job, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "CreatedAt", Value: -1}})
+	cursor, err := r.exportJobs.Find(ctx, bson.M{"UserId": userIdHex}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []export.Job{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ClaimExportJob atomically marks the oldest pending job as running, so a job is only processed once.
+// Running jobs started before staleBefore are claimed again.
+func (r *MongoRepository) ClaimExportJob(ctx context.Context, staleBefore time.Time) (export.Job, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"Status": export.StatusPending},
+		bson.M{"Status": export.StatusRunning, "StartedAt": bson.M{"$lt": staleBefore}},
+	}}
+	update := bson.M{"$set": bson.M{"Status": export.StatusRunning, "StartedAt": time.Now()}}
+	findOptions := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "CreatedAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job export.Job
+	err := r.exportJobs.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&job)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return export.Job{}, authentication.ErrNoDocuments
+		}
+		return export.Job{}, err
+	}
+	return job, nil
+}
+
+// CompleteExportJob stores the archive in GridFS and references it from the job
+func (r *MongoRepository) CompleteExportJob(ctx context.Context, jobId string, archive []byte, hashedToken string, expiresAt time.Time) error {
+	jobIdHex, err := primitive.ObjectIDFromHex(jobId)
+	if err != nil {
+		return fmt.Errorf("invalid JobId: %v", err)
+	}
+
+	uploadStream, err := r.exportArchives.OpenUploadStream(jobId + ".zip")
+	if err != nil {
+		return fmt.Errorf("error opening archive upload: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		uploadStream.SetWriteDeadline(deadline)
+	}
+	if _, err := uploadStream.Write(archive); err != nil {
+		uploadStream.Abort()
+		return fmt.Errorf("error uploading archive: %v", err)
+	}
+	if err := uploadStream.Close(); err != nil {
+		return fmt.Errorf("error uploading archive: %v", err)
+	}
+	archiveId := uploadStream.FileID.(primitive.ObjectID)
+
+	update := bson.M{"$set": bson.M{
+		"Status":      export.StatusCompleted,
+		"CompletedAt": time.Now(),
+		"ExpiresAt":   expiresAt,
+		"Token":       hashedToken,
+		"ArchiveId":   archiveId,
+	}}
+	if _, err := r.exportJobs.UpdateByID(ctx, jobIdHex, update); err != nil {
+		// The archive would not be referenced, so it would never be deleted
+		if deleteErr := r.exportArchives.DeleteContext(ctx, archiveId); deleteErr != nil {
+			log.Printf("Error deleting archive {%s} of export job {%s}: %v", archiveId.Hex(), jobId, deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// GetExportArchive opens the archive of a job for reading, together with its size
+func (r *MongoRepository) GetExportArchive(ctx context.Context, archiveId string) (io.ReadCloser, int64, error) {
+	archiveIdHex, err := primitive.ObjectIDFromHex(archiveId)
+	if err != nil {
+		return nil, 0, authentication.ErrNoDocuments
+	}
+
+	downloadStream, err := r.exportArchives.OpenDownloadStream(archiveIdHex)
+	if err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, 0, authentication.ErrNoDocuments
+		}
+		return nil, 0, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		downloadStream.SetReadDeadline(deadline)
+	}
+	return downloadStream, downloadStream.GetFile().Length, nil
+}
+
+func (r *MongoRepository) FailExportJob(ctx context.Context, jobId string, reason string) error {
+	jobIdHex, err := primitive.ObjectIDFromHex(jobId)
+	if err != nil {
+		return fmt.Errorf("invalid JobId: %v", err)
+	}
+
+	update := bson.M{"$set": bson.M{"Status": export.StatusFailed, "CompletedAt": time.Now(), "Error": reason, "Token": ""}}
+	_, err = r.exportJobs.UpdateByID(ctx, jobIdHex, update)
+	return err
+}
+
+// DeleteExpiredExportJobs deletes jobs whose download link has expired, together with their archives
+func (r *MongoRepository) DeleteExpiredExportJobs(ctx context.Context, now time.Time) error {
+	filter := bson.M{"Status": export.StatusCompleted, "ExpiresAt": bson.M{"$lt": now}}
+	// The archives are deleted first, so an archive is not left behind if deleting them fails
+	if err := r.deleteExportArchives(ctx, filter); err != nil {
+		return err
+	}
+	_, err := r.exportJobs.DeleteMany(ctx, filter)
+	return err
+}
+
+// deleteExportArchives deletes the archives of the jobs matching the filter from GridFS
+func (r *MongoRepository) deleteExportArchives(ctx context.Context, filter bson.M) error {
+	archiveIds, err := r.getExportArchiveIds(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, archiveId := range archiveIds {
+		if err := r.exportArchives.DeleteContext(ctx, archiveId); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return fmt.Errorf("error deleting archive {%s}: %v", archiveId.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func (r *MongoRepository) getExportArchiveIds(ctx context.Context, filter bson.M) ([]primitive.ObjectID, error) {
+	filter = bson.M{"$and": bson.A{filter, bson.M{"ArchiveId": bson.M{"$exists": true}}}}
+	cursor, err := r.exportJobs.Find(ctx, filter, options.Find().SetProjection(bson.M{"ArchiveId": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching export jobs: %v", err)
+	}
+	var jobs []struct {
+		ArchiveId primitive.ObjectID `bson:"ArchiveId"`
+	}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("error decoding export jobs: %v", err)
+	}
+	archiveIds := make([]primitive.ObjectID, 0, len(jobs))
+	for _, job := range jobs {
+		archiveIds = append(archiveIds, job.ArchiveId)
+	}
+	return archiveIds, nil
+}
+
+func (r *MongoRepository) GetExportData(ctx context.Context, userId string) (export.Data, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return export.Data{}, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	var data export.Data
+
+	// * 1. Profile
+	if err := r.users.FindOne(ctx, bson.M{"_id": userIdHex}).Decode(&data.Profile); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return export.Data{}, authentication.ErrNoDocuments
+		}
+		return export.Data{}, fmt.Errorf("error fetching user: %v", err)
+	}
+
+	// * 2. Swear jars and swears
+	data.SwearJars = []swearJar.SwearJarBase{}
+	if err := findAll(ctx, r.swearJars, bson.M{"Owners": userIdHex}, &data.SwearJars); err != nil {
+		return export.Data{}, fmt.Errorf("error fetching swear jars: %v", err)
+	}
+
+	data.Swears = []swearJar.Swear{}
+	swearsFilter := bson.M{"$or": bson.A{bson.M{"UserId": userIdHex}, bson.M{"ReportedBy": userIdHex}}}
+	if err := findAll(ctx, r.swears, swearsFilter, &data.Swears); err != nil {
+		return export.Data{}, fmt.Errorf("error fetching swears: %v", err)
+	}
+
+	// * 3. Tokens and OAuth clients, including revoked and used ones
+	data.AuthTokens = []authentication.AuthToken{}
+	if err := findAll(ctx, r.authTokens, bson.M{"Email": data.Profile.Email}, &data.AuthTokens); err != nil {
+		return export.Data{}, fmt.Errorf("error fetching auth tokens: %v", err)
+	}
+
+	data.APITokens = []authentication.APIToken{}
+	if err := findAll(ctx, r.apiTokens, bson.M{"UserId": userIdHex}, &data.APITokens); err != nil {
+		return export.Data{}, fmt.Errorf("error fetching API tokens: %v", err)
+	}
+
+	data.OAuthClients, err = r.GetOAuthClientsByOwner(ctx, userId)
+	if err != nil {
+		return export.Data{}, fmt.Errorf("error fetching OAuth clients: %v", err)
+	}
+
+	data.ChatAccounts, err = r.GetAccountLinksByUserId(ctx, userId)
+	if err != nil {
+		return export.Data{}, fmt.Errorf("error fetching chat accounts: %v", err)
+	}
+
+	// * 4. Digest subscription, which users without one do not have
+	subscription, err := r.GetDigestSubscription(ctx, userId)
+	if err == nil {
+		data.DigestSubscription = &subscription
+	} else if !errors.Is(err, authentication.ErrNoDocuments) {
+		return export.Data{}, fmt.Errorf("error fetching digest subscription: %v", err)
+	}
+
+	// * 5. Notifications with their preferences and webhook, a limit of 0 returns all of them
+	data.Notifications, err = r.GetNotificationsByUserId(ctx, userId, false, 0)
+	if err != nil {
+		return export.Data{}, fmt.Errorf("error fetching notifications: %v", err)
+	}
+
+	data.NotificationPreferences, err = r.GetNotificationPreferences(ctx, userId)
+	if err != nil {
+		return export.Data{}, fmt.Errorf("error fetching notification preferences: %v", err)
+	}
+
+	webhook, err := r.GetNotificationWebhook(ctx, userId)
+	if err == nil {
+		data.NotificationWebhook = &webhook
+	} else if !errors.Is(err, authentication.ErrNoDocuments) {
+		return export.Data{}, fmt.Errorf("error fetching notification webhook: %v", err)
+	}
+
+	// * 6. Audit events, a limit of 0 returns all of them
+	data.AuditEvents, err = r.GetAuditEventsByUserId(ctx, userId, time.Time{}, 0)
+	if err != nil {
+		return export.Data{}, fmt.Errorf("error fetching audit events: %v", err)
+	}
+
+	return data, nil
+}
+
+// findAll decodes all documents matching the filter, oldest first, into results
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, results interface{}) error {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "CreatedAt", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, results)
+}
@@ -0,0 +1,57 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+func (r *MongoRepository) GetUserByExternalIdentity(ctx context.Context, provider string, subject string) (authentication.User, error) {
+	filter := bson.M{"Identities": bson.M{"$elemMatch": bson.M{"Provider": provider, "Subject": subject}}}
+	var result authentication.User
+
+	err := r.users.FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return authentication.User{}, authentication.ErrNoDocuments
+		}
+		return authentication.User{}, err
+	}
+
+	return result, nil
+}
+
+func (r *MongoRepository) LinkExternalIdentity(ctx context.Context, userId string, identity authentication.ExternalIdentity, clearPassword bool) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	set := bson.M{"Verified": true}
+	if clearPassword {
+		set["Password"] = ""
+	}
+	update := bson.M{
+		"$set": set,
+		"$addToSet": bson.M{"Identities": bson.D{
+			{Key: "Provider", Value: identity.Provider},
+			{Key: "Subject", Value: identity.Subject},
+		}},
+	}
+
+	result, err := r.users.UpdateByID(ctx, userIdHex, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
@@ -48,6 +48,7 @@ func GetSwearJarsPipeline(matchStage bson.M) mongo.Pipeline {
 						"Email":    "$$owner.Email",
 						"Name":     "$$owner.Name",
 						"Verified": "$$owner.Verified",
+						"Locale":   "$$owner.Locale",
 					},
 				},
 			},
@@ -6,6 +6,8 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
 )
 
 // ConvertStringIDsToObjectIDs converts a slice of string IDs to a slice of primitive.ObjectID
@@ -21,14 +23,15 @@ func ConvertStringIDsToObjectIDs(stringIDs []string) ([]primitive.ObjectID, erro
 	return objectIDs, nil
 }
 
-func (r *MongoRepository) AreUserIDsValid(userIDs []primitive.ObjectID) error {
+// AreUserIDsValid checks that the owners of a swear jar are existing users
+func (r *MongoRepository) AreUserIDsValid(ctx context.Context, userIDs []primitive.ObjectID) error {
 	for _, userID := range userIDs {
-		count, err := r.users.CountDocuments(context.TODO(), bson.M{"_id": userID})
+		count, err := r.users.CountDocuments(ctx, bson.M{"_id": userID})
 		if err != nil {
 			return fmt.Errorf("error checking user ID: %w", err)
 		}
 		if count == 0 {
-			return fmt.Errorf("invalid user ID: %s", userID.Hex())
+			return apperror.InvalidField("owners", fmt.Sprintf("user %s does not exist", userID.Hex()))
 		}
 	}
 	return nil
@@ -0,0 +1,201 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+)
+
+func (r *MongoRepository) CreateLinkCode(ctx context.Context, c integration.LinkCode) error {
+	createdByHex, err := primitive.ObjectIDFromHex(c.CreatedBy)
+	if err != nil {
+		return fmt.Errorf("invalid CreatedBy: %v", err)
+	}
+
+	document := bson.D{
+		{Key: "Code", Value: c.Code},
+		{Key: "Kind", Value: c.Kind},
+		{Key: "Platform", Value: c.Platform},
+		{Key: "CreatedBy", Value: createdByHex},
+		{Key: "CreatedAt", Value: c.CreatedAt},
+		{Key: "ExpiresAt", Value: c.ExpiresAt},
+	}
+	if c.SwearJarId != "" {
+		swearJarIdHex, err := primitive.ObjectIDFromHex(c.SwearJarId)
+		if err != nil {
+			return fmt.Errorf("invalid SwearJarId: %v", err)
+		}
+		document = append(document, bson.E{Key: "SwearJarId", Value: swearJarIdHex})
+	}
+
+	_, err = r.linkCodes.InsertOne(ctx, document)
+	return err
+}
+
+func (r *MongoRepository) ConsumeLinkCode(ctx context.Context, kind integration.LinkCodeKind, platform integration.Platform, hashedCode string, now time.Time) (integration.LinkCode, error) {
+	filter := bson.M{"Code": hashedCode, "Kind": kind, "Platform": platform, "ExpiresAt": bson.M{"$gt": now}}
+
+	var c integration.LinkCode
+	err := r.linkCodes.FindOneAndDelete(ctx, filter).Decode(&c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return integration.LinkCode{}, authentication.ErrNoDocuments
+		}
+		return integration.LinkCode{}, err
+	}
+	return c, nil
+}
+
+func (r *MongoRepository) UpsertChannelLink(ctx context.Context, l integration.ChannelLink) (integration.ChannelLink, error) {
+	swearJarIdHex, err := primitive.ObjectIDFromHex(l.SwearJarId)
+	if err != nil {
+		return integration.ChannelLink{}, fmt.Errorf("invalid SwearJarId: %v", err)
+	}
+	linkedByHex, err := primitive.ObjectIDFromHex(l.LinkedBy)
+	if err != nil {
+		return integration.ChannelLink{}, fmt.Errorf("invalid LinkedBy: %v", err)
+	}
+
+	filter := bson.M{"Platform": l.Platform, "WorkspaceId": l.WorkspaceId, "ChannelId": l.ChannelId}
+	update := bson.M{"$set": bson.M{
+		"SwearJarId": swearJarIdHex,
+		"LinkedBy":   linkedByHex,
+		"CreatedAt":  l.CreatedAt,
+	}}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var link integration.ChannelLink
+	if err := r.channelLinks.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&link); err != nil {
+		return integration.ChannelLink{}, err
+	}
+	return link, nil
+}
+
+func (r *MongoRepository) GetChannelLink(ctx context.Context, platform integration.Platform, workspaceId string, channelId string) (integration.ChannelLink, error) {
+	filter := bson.M{"Platform": platform, "WorkspaceId": workspaceId, "ChannelId": channelId}
+	return r.findChannelLink(ctx, filter)
+}
+
+func (r *MongoRepository) GetChannelLinkById(ctx context.Context, linkId string) (integration.ChannelLink, error) {
+	linkIdHex, err := primitive.ObjectIDFromHex(linkId)
+	if err != nil {
+		return integration.ChannelLink{}, authentication.ErrNoDocuments
+	}
+	return r.findChannelLink(ctx, bson.M{"_id": linkIdHex})
+}
+
+func (r *MongoRepository) GetChannelLinksBySwearJarId(ctx context.Context, swearJarId string) ([]integration.ChannelLink, error) {
+	swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SwearJarId: %v", err)
+	}
+
+	links := []integration.ChannelLink{}
+	if err := findAll(ctx, r.channelLinks, bson.M{"SwearJarId": swearJarIdHex}, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (r *MongoRepository) DeleteChannelLink(ctx context.Context, linkId string) error {
+	linkIdHex, err := primitive.ObjectIDFromHex(linkId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+
+	result, err := r.channelLinks.DeleteOne(ctx, bson.M{"_id": linkIdHex})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MongoRepository) UpsertAccountLink(ctx context.Context, l integration.AccountLink) (integration.AccountLink, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(l.UserId)
+	if err != nil {
+		return integration.AccountLink{}, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	filter := bson.M{"Platform": l.Platform, "ExternalUserId": l.ExternalUserId}
+	update := bson.M{"$set": bson.M{
+		"UserId":    userIdHex,
+		"CreatedAt": l.CreatedAt,
+	}}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var link integration.AccountLink
+	if err := r.accountLinks.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&link); err != nil {
+		return integration.AccountLink{}, err
+	}
+	return link, nil
+}
+
+func (r *MongoRepository) GetAccountLink(ctx context.Context, platform integration.Platform, externalUserId string) (integration.AccountLink, error) {
+	var link integration.AccountLink
+	err := r.accountLinks.FindOne(ctx, bson.M{"Platform": platform, "ExternalUserId": externalUserId}).Decode(&link)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return integration.AccountLink{}, authentication.ErrNoDocuments
+		}
+		return integration.AccountLink{}, err
+	}
+	return link, nil
+}
+
+func (r *MongoRepository) GetAccountLinksByUserId(ctx context.Context, userId string) ([]integration.AccountLink, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	links := []integration.AccountLink{}
+	if err := findAll(ctx, r.accountLinks, bson.M{"UserId": userIdHex}, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// DeleteAccountLink deletes the link if it belongs to the user
+func (r *MongoRepository) DeleteAccountLink(ctx context.Context, linkId string, userId string) error {
+	linkIdHex, err := primitive.ObjectIDFromHex(linkId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	result, err := r.accountLinks.DeleteOne(ctx, bson.M{"_id": linkIdHex, "UserId": userIdHex})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MongoRepository) findChannelLink(ctx context.Context, filter bson.M) (integration.ChannelLink, error) {
+	var link integration.ChannelLink
+	err := r.channelLinks.FindOne(ctx, filter).Decode(&link)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return integration.ChannelLink{}, authentication.ErrNoDocuments
+		}
+		return integration.ChannelLink{}, err
+	}
+	return link, nil
+}
@@ -0,0 +1,247 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/notification"
+)
+
+func (r *MongoRepository) CreateNotifications(ctx context.Context, notifications []notification.Notification) ([]notification.Notification, error) {
+	documents := make([]interface{}, 0, len(notifications))
+	for _, n := range notifications {
+		userIdHex, err := primitive.ObjectIDFromHex(n.UserId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UserId: %v", err)
+		}
+		swearJarIdHex, err := primitive.ObjectIDFromHex(n.SwearJarId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SwearJarId: %v", err)
+		}
+		actorIdHex, err := primitive.ObjectIDFromHex(n.ActorId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ActorId: %v", err)
+		}
+
+		documents = append(documents, bson.D{
+			{Key: "UserId", Value: userIdHex},
+			{Key: "Type", Value: n.Type},
+			{Key: "SwearJarId", Value: swearJarIdHex},
+			{Key: "ActorId", Value: actorIdHex},
+			{Key: "Title", Value: n.Title},
+			{Key: "Body", Value: n.Body},
+			{Key: "Read", Value: n.Read},
+			{Key: "CreatedAt", Value: n.CreatedAt},
+		})
+	}
+
+	result, err := r.notifications.InsertMany(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
+
+	created := make([]notification.Notification, len(notifications))
+	for i, n := range notifications {
+		n.NotificationId = result.InsertedIDs[i].(primitive.ObjectID).Hex()
+		created[i] = n
+	}
+	return created, nil
+}
+
+// GetNotificationsByUserId returns the most recent notifications of the user, newest first
+func (r *MongoRepository) GetNotificationsByUserId(ctx context.Context, userId string, unreadOnly bool, limit int) ([]notification.Notification, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	filter := bson.M{"UserId": userIdHex}
+	if unreadOnly {
+		filter["Read"] = false
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "CreatedAt", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.notifications.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []notification.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (r *MongoRepository) CountUnreadNotifications(ctx context.Context, userId string) (int, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return 0, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	count, err := r.notifications.CountDocuments(ctx, bson.M{"UserId": userIdHex, "Read": false})
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+func (r *MongoRepository) MarkNotificationRead(ctx context.Context, notificationId string, userId string, readAt time.Time) error {
+	notificationIdHex, err := primitive.ObjectIDFromHex(notificationId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+
+	// A notification which was already read keeps the time it was first read at
+	filter := bson.M{"_id": notificationIdHex, "UserId": userIdHex}
+	result, err := r.notifications.UpdateOne(ctx, filter, bson.A{
+		bson.M{"$set": bson.M{
+			"Read":   true,
+			"ReadAt": bson.M{"$ifNull": bson.A{"$ReadAt", readAt}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MongoRepository) MarkAllNotificationsRead(ctx context.Context, userId string, readAt time.Time) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	filter := bson.M{"UserId": userIdHex, "Read": false}
+	_, err = r.notifications.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"Read": true, "ReadAt": readAt}})
+	return err
+}
+
+func (r *MongoRepository) GetNotificationPreferences(ctx context.Context, userId string) ([]notification.Preference, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	cursor, err := r.notificationPreferences.Find(ctx, bson.M{"UserId": userIdHex})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	preferences := []notification.Preference{}
+	if err := cursor.All(ctx, &preferences); err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+// UpsertNotificationPreference replaces the preference of the user for the type of notification in the swear jar. The
+// preference for all swear jars is stored without a swear jar.
+func (r *MongoRepository) UpsertNotificationPreference(ctx context.Context, p notification.Preference) (notification.Preference, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(p.UserId)
+	if err != nil {
+		return notification.Preference{}, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	filter := bson.M{"UserId": userIdHex, "Type": p.Type, "SwearJarId": bson.M{"$exists": false}}
+	if p.SwearJarId != "" {
+		swearJarIdHex, err := primitive.ObjectIDFromHex(p.SwearJarId)
+		if err != nil {
+			return notification.Preference{}, fmt.Errorf("invalid SwearJarId: %v", err)
+		}
+		filter["SwearJarId"] = swearJarIdHex
+	}
+
+	update := bson.M{"$set": bson.M{"Channels": p.Channels, "UpdatedAt": p.UpdatedAt}}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var preference notification.Preference
+	err = r.notificationPreferences.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&preference)
+	if err != nil {
+		return notification.Preference{}, err
+	}
+	return preference, nil
+}
+
+func (r *MongoRepository) DeleteNotificationPreference(ctx context.Context, preferenceId string, userId string) error {
+	preferenceIdHex, err := primitive.ObjectIDFromHex(preferenceId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+
+	result, err := r.notificationPreferences.DeleteOne(ctx, bson.M{"_id": preferenceIdHex, "UserId": userIdHex})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MongoRepository) GetNotificationWebhook(ctx context.Context, userId string) (notification.WebhookEndpoint, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return notification.WebhookEndpoint{}, authentication.ErrNoDocuments
+	}
+
+	var endpoint notification.WebhookEndpoint
+	err = r.notificationWebhooks.FindOne(ctx, bson.M{"_id": userIdHex}).Decode(&endpoint)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return notification.WebhookEndpoint{}, authentication.ErrNoDocuments
+		}
+		return notification.WebhookEndpoint{}, err
+	}
+	return endpoint, nil
+}
+
+// UpsertNotificationWebhook replaces the webhook of the user, a user has at most one
+func (r *MongoRepository) UpsertNotificationWebhook(ctx context.Context, w notification.WebhookEndpoint) error {
+	userIdHex, err := primitive.ObjectIDFromHex(w.UserId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	document := bson.M{"URL": w.URL, "Secret": w.Secret, "CreatedAt": w.CreatedAt}
+	_, err = r.notificationWebhooks.ReplaceOne(ctx, bson.M{"_id": userIdHex}, document, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoRepository) DeleteNotificationWebhook(ctx context.Context, userId string) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+
+	result, err := r.notificationWebhooks.DeleteOne(ctx, bson.M{"_id": userIdHex})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oauth"
+)
+
+func (r *MongoRepository) CreateOAuthClient(ctx context.Context, c oauth.Client) (oauth.Client, error) {
+	ownerIdHex, err := primitive.ObjectIDFromHex(c.OwnerUserId)
+	if err != nil {
+		return oauth.Client{}, fmt.Errorf("invalid OwnerUserId: %v", err)
+	}
+
+	result, err := r.oauthClients.InsertOne(ctx, bson.D{
+		{Key: "OwnerUserId", Value: ownerIdHex},
+		{Key: "Name", Value: c.Name},
+		{Key: "ClientSecret", Value: c.ClientSecret},
+		{Key: "RedirectURIs", Value: c.RedirectURIs},
+		{Key: "Scopes", Value: c.Scopes},
+		{Key: "Public", Value: c.Public},
+		{Key: "CreatedAt", Value: c.CreatedAt},
+	})
+	if err != nil {
+		return oauth.Client{}, err
+	}
+
+	c.ClientId = result.InsertedID.(primitive.ObjectID).Hex()
+	return c, nil
+}
+
+func (r *MongoRepository) GetOAuthClient(ctx context.Context, clientId string) (oauth.Client, error) {
+	clientIdHex, err := primitive.ObjectIDFromHex(clientId)
+	if err != nil {
+		return oauth.Client{}, authentication.ErrNoDocuments
+	}
+
+	var client oauth.Client
+	err = r.oauthClients.FindOne(ctx, bson.M{"_id": clientIdHex}).Decode(&client)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return oauth.Client{}, authentication.ErrNoDocuments
+		}
+		return oauth.Client{}, err
+	}
+	return client, nil
+}
+
+func (r *MongoRepository) GetOAuthClientsByOwner(ctx context.Context, ownerUserId string) ([]oauth.Client, error) {
+	ownerIdHex, err := primitive.ObjectIDFromHex(ownerUserId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OwnerUserId: %v", err)
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "CreatedAt", Value: -1}})
+	cursor, err := r.oauthClients.Find(ctx, bson.M{"OwnerUserId": ownerIdHex}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	clients := []oauth.Client{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *MongoRepository) DeleteOAuthClient(ctx context.Context, clientId string, ownerUserId string) error {
+	clientIdHex, err := primitive.ObjectIDFromHex(clientId)
+	if err != nil {
+		return fmt.Errorf("invalid ClientId: %v", err)
+	}
+	ownerIdHex, err := primitive.ObjectIDFromHex(ownerUserId)
+	if err != nil {
+		return fmt.Errorf("invalid OwnerUserId: %v", err)
+	}
+
+	result, err := r.oauthClients.DeleteOne(ctx, bson.M{"_id": clientIdHex, "OwnerUserId": ownerIdHex})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MongoRepository) CreateAuthorizationCode(ctx context.Context, code oauth.AuthorizationCode) error {
+	clientIdHex, err := primitive.ObjectIDFromHex(code.ClientId)
+	if err != nil {
+		return fmt.Errorf("invalid ClientId: %v", err)
+	}
+	userIdHex, err := primitive.ObjectIDFromHex(code.UserId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	_, err = r.oauthCodes.InsertOne(ctx, bson.D{
+		{Key: "Code", Value: code.Code},
+		{Key: "ClientId", Value: clientIdHex},
+		{Key: "UserId", Value: userIdHex},
+		{Key: "RedirectURI", Value: code.RedirectURI},
+		{Key: "Scopes", Value: code.Scopes},
+		{Key: "CodeChallenge", Value: code.CodeChallenge},
+		{Key: "Nonce", Value: code.Nonce},
+		{Key: "CreatedAt", Value: code.CreatedAt},
+		{Key: "ExpiresAt", Value: code.ExpiresAt},
+		{Key: "Used", Value: code.Used},
+	})
+	return err
+}
+
+// ConsumeAuthorizationCode atomically marks an unused code as used and returns it
+func (r *MongoRepository) ConsumeAuthorizationCode(ctx context.Context, hashedCode string) (oauth.AuthorizationCode, error) {
+	var code oauth.AuthorizationCode
+	err := r.oauthCodes.FindOneAndUpdate(
+		ctx,
+		bson.M{"Code": hashedCode, "Used": false},
+		bson.M{"$set": bson.M{"Used": true}},
+	).Decode(&code)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return oauth.AuthorizationCode{}, authentication.ErrNoDocuments
+		}
+		return oauth.AuthorizationCode{}, err
+	}
+	return code, nil
+}
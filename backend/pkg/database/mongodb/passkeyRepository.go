@@ -0,0 +1,201 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+// Passkeys are stored in the Passkeys array of the user
+
+func (r *MongoRepository) GetPasskeys(ctx context.Context, userId string) ([]authentication.Passkey, error) {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	var result struct {
+		Passkeys []authentication.Passkey
+	}
+	findOptions := options.FindOne().SetProjection(bson.M{"Passkeys": 1})
+	err = r.users.FindOne(ctx, bson.M{"_id": userIdHex}, findOptions).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, authentication.ErrNoDocuments
+		}
+		return nil, err
+	}
+
+	if result.Passkeys == nil {
+		return []authentication.Passkey{}, nil
+	}
+	return result.Passkeys, nil
+}
+
+func (r *MongoRepository) GetUserByPasskey(ctx context.Context, credentialId string) (authentication.User, error) {
+	var result authentication.User
+	err := r.users.FindOne(ctx, bson.M{"Passkeys.CredentialId": credentialId}).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return authentication.User{}, authentication.ErrNoDocuments
+		}
+		return authentication.User{}, err
+	}
+	return result, nil
+}
+
+func (r *MongoRepository) AddPasskeyAndMarkToken(ctx context.Context, userId string, passkey authentication.Passkey, hashedToken string) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// * 1. A credential can only belong to one user
+		count, err := r.users.CountDocuments(sessCtx, bson.M{"Passkeys.CredentialId": passkey.CredentialId})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, authentication.ErrPasskeyTaken
+		}
+
+		// * 2. Add the passkey
+		update := bson.M{"$push": bson.M{"Passkeys": bson.D{
+			{Key: "CredentialId", Value: passkey.CredentialId},
+			{Key: "Name", Value: passkey.Name},
+			{Key: "PublicKey", Value: passkey.PublicKey},
+			{Key: "SignCount", Value: int64(passkey.SignCount)},
+			{Key: "Transports", Value: passkey.Transports},
+			{Key: "BackupEligible", Value: passkey.BackupEligible},
+			{Key: "CreatedAt", Value: passkey.CreatedAt},
+			{Key: "LastUsedAt", Value: passkey.LastUsedAt},
+		}}}
+		result, err := r.users.UpdateByID(sessCtx, userIdHex, update)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, errors.New("user not found")
+		}
+
+		// * 3. Mark the registration challenge as used
+		if err := r.useAuthToken(sessCtx, hashedToken); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (r *MongoRepository) UpdatePasskeyAndMarkToken(ctx context.Context, userId string, credentialId string, signCount uint32, lastUsedAt time.Time, hashedToken string) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// * 1. Store the new signature counter. Matching the old counter being lower prevents a concurrent
+		// login with the same counter value from succeeding twice.
+		filter := bson.M{
+			"_id":      userIdHex,
+			"Passkeys": bson.M{"$elemMatch": bson.M{"CredentialId": credentialId}},
+		}
+		if signCount != 0 {
+			filter["Passkeys"] = bson.M{"$elemMatch": bson.M{"CredentialId": credentialId, "SignCount": bson.M{"$lt": int64(signCount)}}}
+		}
+		update := bson.M{"$set": bson.M{
+			"Passkeys.$.SignCount":  int64(signCount),
+			"Passkeys.$.LastUsedAt": lastUsedAt,
+		}}
+		result, err := r.users.UpdateOne(sessCtx, filter, update)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, errors.New("passkey not found or signature counter did not increase")
+		}
+
+		// * 2. Mark the login challenge as used
+		if err := r.useAuthToken(sessCtx, hashedToken); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// DeletePasskey removes the passkey, and turns off the passkey second factor if it was the last one
+func (r *MongoRepository) DeletePasskey(ctx context.Context, userId string, credentialId string) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		filter := bson.M{"_id": userIdHex, "Passkeys.CredentialId": credentialId}
+		update := bson.M{"$pull": bson.M{"Passkeys": bson.M{"CredentialId": credentialId}}}
+		result, err := r.users.UpdateOne(sessCtx, filter, update)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, authentication.ErrNoDocuments
+		}
+
+		noPasskeysFilter := bson.M{"_id": userIdHex, "Passkeys": bson.M{"$size": 0}}
+		if _, err := r.users.UpdateOne(sessCtx, noPasskeysFilter, bson.M{"$set": bson.M{"PasskeySecondFactor": false}}); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (r *MongoRepository) SetPasskeySecondFactor(ctx context.Context, userId string, enabled bool) error {
+	userIdHex, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return fmt.Errorf("invalid UserId: %v", err)
+	}
+
+	result, err := r.users.UpdateByID(ctx, userIdHex, bson.M{"$set": bson.M{"PasskeySecondFactor": enabled}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
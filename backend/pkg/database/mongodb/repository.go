@@ -11,12 +11,16 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
 	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
 	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
 )
 
+const connectTimeout = 30 * time.Second
+
 type MongoRepository struct {
 	client     *mongo.Client
 	db         *mongo.Database
@@ -24,6 +28,28 @@ type MongoRepository struct {
 	swears     *mongo.Collection
 	users      *mongo.Collection
 	authTokens *mongo.Collection
+	apiTokens  *mongo.Collection
+
+	oauthClients *mongo.Collection
+	oauthCodes   *mongo.Collection
+	signingKeys  *mongo.Collection
+	exportJobs   *mongo.Collection
+	auditEvents  *mongo.Collection
+
+	exportArchives *gridfs.Bucket // Archives can exceed the size limit of a document
+
+	webhooks          *mongo.Collection
+	webhookDeliveries *mongo.Collection
+	channelLinks      *mongo.Collection
+	linkCodes         *mongo.Collection
+	accountLinks      *mongo.Collection
+
+	digestSubscriptions     *mongo.Collection
+	notifications           *mongo.Collection
+	notificationPreferences *mongo.Collection
+	notificationWebhooks    *mongo.Collection
+
+	emailOutbox *mongo.Collection
 }
 
 func NewMongoRepository() *MongoRepository {
@@ -33,7 +59,31 @@ func NewMongoRepository() *MongoRepository {
 	swears := db.Collection(os.Getenv("DB_COLLECTION_SWEARJAR"))
 	users := db.Collection(os.Getenv("DB_COLLECTION_USERS"))
 	authTokens := db.Collection(os.Getenv("DB_COLLECTION_AUTH_TOKENS"))
-	return &MongoRepository{client, db, swearJars, swears, users, authTokens}
+	apiTokens := db.Collection(os.Getenv("DB_COLLECTION_API_TOKENS"))
+	oauthClients := db.Collection(os.Getenv("DB_COLLECTION_OAUTH_CLIENTS"))
+	oauthCodes := db.Collection(os.Getenv("DB_COLLECTION_OAUTH_CODES"))
+	signingKeys := db.Collection(os.Getenv("DB_COLLECTION_SIGNING_KEYS"))
+	exportJobs := db.Collection(os.Getenv("DB_COLLECTION_EXPORT_JOBS"))
+	auditEvents := db.Collection(os.Getenv("DB_COLLECTION_AUDIT_EVENTS"))
+	bucketOptions := options.GridFSBucket() // Named "fs" unless configured
+	if name := os.Getenv("DB_BUCKET_EXPORT_ARCHIVES"); name != "" {
+		bucketOptions.SetName(name)
+	}
+	exportArchives, err := gridfs.NewBucket(db, bucketOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	webhooks := db.Collection(os.Getenv("DB_COLLECTION_WEBHOOKS"))
+	webhookDeliveries := db.Collection(os.Getenv("DB_COLLECTION_WEBHOOK_DELIVERIES"))
+	channelLinks := db.Collection(os.Getenv("DB_COLLECTION_CHANNEL_LINKS"))
+	linkCodes := db.Collection(os.Getenv("DB_COLLECTION_LINK_CODES"))
+	accountLinks := db.Collection(os.Getenv("DB_COLLECTION_ACCOUNT_LINKS"))
+	digestSubscriptions := db.Collection(os.Getenv("DB_COLLECTION_DIGEST_SUBSCRIPTIONS"))
+	notifications := db.Collection(os.Getenv("DB_COLLECTION_NOTIFICATIONS"))
+	notificationPreferences := db.Collection(os.Getenv("DB_COLLECTION_NOTIFICATION_PREFERENCES"))
+	notificationWebhooks := db.Collection(os.Getenv("DB_COLLECTION_NOTIFICATION_WEBHOOKS"))
+	emailOutbox := db.Collection(os.Getenv("DB_COLLECTION_EMAIL_OUTBOX"))
+	return &MongoRepository{client, db, swearJars, swears, users, authTokens, apiTokens, oauthClients, oauthCodes, signingKeys, exportJobs, auditEvents, exportArchives, webhooks, webhookDeliveries, channelLinks, linkCodes, accountLinks, digestSubscriptions, notifications, notificationPreferences, notificationWebhooks, emailOutbox}
 }
 
 func ConnectToDB() *mongo.Client {
@@ -41,13 +91,16 @@ func ConnectToDB() *mongo.Client {
 	connectionString := fmt.Sprintf("mongodb+srv://%s:%s@%s", username, password, clusterURL)
 	clientOptions := options.Client().ApplyURI(connectionString)
 
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, clientOptions)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = client.Ping(context.TODO(), nil) // Check the connection
+	err = client.Ping(ctx, nil) // Check the connection
 
 	if err != nil {
 		log.Fatal(err)
@@ -56,7 +109,7 @@ func ConnectToDB() *mongo.Client {
 	return client
 }
 
-func (r *MongoRepository) GetSwearJarsByUserId(userId string) ([]swearJar.SwearJarWithOwners, error) {
+func (r *MongoRepository) GetSwearJarsByUserId(ctx context.Context, userId string) ([]swearJar.SwearJarWithOwners, error) {
 	userIdHex, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
 		return nil, fmt.Errorf("invalid UserId: %v", err)
@@ -64,15 +117,15 @@ func (r *MongoRepository) GetSwearJarsByUserId(userId string) ([]swearJar.SwearJ
 
 	pipeline := GetSwearJarsPipeline(bson.M{"Owners": userIdHex})
 
-	cursor, err := r.swearJars.Aggregate(context.TODO(), pipeline)
+	cursor, err := r.swearJars.Aggregate(ctx, pipeline)
 	if err != nil {
 		log.Printf("Error fetching swear jars by user ID: %v", err)
 		return nil, err
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	var swearJars []swearJar.SwearJarWithOwners
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		var sj swearJar.SwearJarWithOwners
 		if err := cursor.Decode(&sj); err != nil {
 			log.Printf("Error decoding swear jar: %v", err)
@@ -88,40 +141,40 @@ func (r *MongoRepository) GetSwearJarsByUserId(userId string) ([]swearJar.SwearJ
 	return swearJars, nil
 }
 
-func (r *MongoRepository) GetSwearJarById(swearJarId string) (swearJar.SwearJarWithOwners, error) {
+func (r *MongoRepository) GetSwearJarById(ctx context.Context, swearJarId string) (swearJar.SwearJarWithOwners, error) {
 	swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
 	if err != nil {
-		return swearJar.SwearJarWithOwners{}, fmt.Errorf("invalid SwearJarId: %v", err)
+		return swearJar.SwearJarWithOwners{}, swearJar.ErrSwearJarNotFound.WithCause(err)
 	}
 
 	pipeline := GetSwearJarsPipeline(bson.M{"_id": swearJarIdHex})
 
-	cursor, err := r.swearJars.Aggregate(context.TODO(), pipeline)
+	cursor, err := r.swearJars.Aggregate(ctx, pipeline)
 	if err != nil {
 		return swearJar.SwearJarWithOwners{}, fmt.Errorf("error executing aggregation: %v", err)
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	var results []swearJar.SwearJarWithOwners
-	if err = cursor.All(context.TODO(), &results); err != nil {
+	if err = cursor.All(ctx, &results); err != nil {
 		return swearJar.SwearJarWithOwners{}, fmt.Errorf("error decoding aggregation results: %v", err)
 	}
 
 	if len(results) == 0 {
-		return swearJar.SwearJarWithOwners{}, fmt.Errorf("swear jar not found")
+		return swearJar.SwearJarWithOwners{}, swearJar.ErrSwearJarNotFound
 	}
 
 	return results[0], nil
 }
 
-func (r *MongoRepository) CreateSwearJar(sj swearJar.SwearJarBase) (swearJar.SwearJarBase, error) {
+func (r *MongoRepository) CreateSwearJar(ctx context.Context, sj swearJar.SwearJarBase) (swearJar.SwearJarBase, error) {
 	ownerIDs, err := ConvertStringIDsToObjectIDs(sj.Owners)
 	if err != nil {
-		return swearJar.SwearJarBase{}, fmt.Errorf("failed to convert owner IDs: %w", err)
+		return swearJar.SwearJarBase{}, apperror.InvalidField("owners", "owners must be user ids").WithCause(err)
 	}
 
 	// Check if all userIds in Owners field are valid users
-	if err := r.AreUserIDsValid(ownerIDs); err != nil {
+	if err := r.AreUserIDsValid(ctx, ownerIDs); err != nil {
 		return swearJar.SwearJarBase{}, err
 	}
 
@@ -136,7 +189,7 @@ func (r *MongoRepository) CreateSwearJar(sj swearJar.SwearJarBase) (swearJar.Swe
 	}
 
 	result, err := r.swearJars.InsertOne(
-		context.TODO(),
+		ctx,
 		bson.D{
 			{Key: "Name", Value: sj.Name},
 			{Key: "Desc", Value: sj.Desc},
@@ -155,7 +208,7 @@ func (r *MongoRepository) CreateSwearJar(sj swearJar.SwearJarBase) (swearJar.Swe
 	insertedID := result.InsertedID.(primitive.ObjectID)
 	filter := bson.M{"_id": insertedID}
 	var createdSwearJar swearJar.SwearJarBase
-	err = r.swearJars.FindOne(context.TODO(), filter).Decode(&createdSwearJar)
+	err = r.swearJars.FindOne(ctx, filter).Decode(&createdSwearJar)
 	if err != nil {
 		return swearJar.SwearJarBase{}, err
 	}
@@ -163,7 +216,7 @@ func (r *MongoRepository) CreateSwearJar(sj swearJar.SwearJarBase) (swearJar.Swe
 	return createdSwearJar, nil
 }
 
-func (r *MongoRepository) UpdateSwearJar(sj swearJar.SwearJarBase) error {
+func (r *MongoRepository) UpdateSwearJar(ctx context.Context, sj swearJar.SwearJarBase) error {
 	swearJarIdHex, err := primitive.ObjectIDFromHex(sj.SwearJarId)
 	if err != nil {
 		return fmt.Errorf("invalid SwearJarId: %v", err)
@@ -171,10 +224,10 @@ func (r *MongoRepository) UpdateSwearJar(sj swearJar.SwearJarBase) error {
 
 	ownerIDs, err := ConvertStringIDsToObjectIDs(sj.Owners)
 	if err != nil {
-		return fmt.Errorf("failed to convert owner IDs: %w", err)
+		return apperror.InvalidField("owners", "owners must be user ids").WithCause(err)
 	}
 
-	if err := r.AreUserIDsValid(ownerIDs); err != nil {
+	if err := r.AreUserIDsValid(ctx, ownerIDs); err != nil {
 		return err
 	}
 
@@ -191,7 +244,7 @@ func (r *MongoRepository) UpdateSwearJar(sj swearJar.SwearJarBase) error {
 		"LastUpdatedBy": lastUpdatedByID,
 	}}
 
-	result, err := r.swearJars.UpdateByID(context.TODO(), swearJarIdHex, update)
+	result, err := r.swearJars.UpdateByID(ctx, swearJarIdHex, update)
 	if err != nil {
 		return fmt.Errorf("Error updating Swear Jar: %v", err)
 	}
@@ -202,21 +255,24 @@ func (r *MongoRepository) UpdateSwearJar(sj swearJar.SwearJarBase) error {
 	return nil
 }
 
-func (r *MongoRepository) GetSwearJarOwners(swearJarId string) (owners []string, err error) {
+func (r *MongoRepository) GetSwearJarOwners(ctx context.Context, swearJarId string) (owners []string, err error) {
 	type SwearJarOwners struct {
 		Owners []primitive.ObjectID `bson:"Owners"`
 	}
 
 	swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
+	if err != nil {
+		return nil, swearJar.ErrSwearJarNotFound.WithCause(err)
+	}
 	var result SwearJarOwners
 	err = r.swearJars.FindOne(
-		context.TODO(),
+		ctx,
 		bson.M{"_id": swearJarIdHex},
 		options.FindOne().SetProjection(bson.M{"Owners": 1}),
 	).Decode(&result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("invalid SwearJar ID: %s", swearJarId)
+			return nil, swearJar.ErrSwearJarNotFound
 		}
 		return nil, err
 	}
@@ -228,7 +284,7 @@ func (r *MongoRepository) GetSwearJarOwners(swearJarId string) (owners []string,
 	return owners, nil
 }
 
-func (r *MongoRepository) SwearJarTrend(swearJarId string, period string, numOfDataPoints int) ([]swearJar.ChartData, error) {
+func (r *MongoRepository) SwearJarTrend(ctx context.Context, swearJarId string, period string, numOfDataPoints int) ([]swearJar.ChartData, error) {
 	swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
 	if err != nil {
 		return nil, fmt.Errorf("invalid SwearJarId: %v", err)
@@ -249,29 +305,29 @@ func (r *MongoRepository) SwearJarTrend(swearJarId string, period string, numOfD
 
 	pipeline := SwearJarTrendPipeline(period, numOfDataPoints, startDate, swearJarIdHex)
 
-	cursor, err := r.swearJars.Aggregate(context.TODO(), pipeline)
+	cursor, err := r.swearJars.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, fmt.Errorf("error aggregating swears: %v", err)
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
-	if err := cursor.All(context.TODO(), &results); err != nil {
+	if err := cursor.All(ctx, &results); err != nil {
 		return nil, fmt.Errorf("error decoding aggregation results: %v", err)
 	}
 
 	return results, nil
 }
 
-func (r *MongoRepository) AddSwear(s swearJar.Swear) error {
+func (r *MongoRepository) AddSwear(ctx context.Context, s swearJar.Swear) error {
 
 	session, err := r.client.StartSession()
 	if err != nil {
 		return fmt.Errorf("failed to start session: %v", err)
 	}
-	defer session.EndSession(context.TODO())
+	defer session.EndSession(ctx)
 
 	// Execute the transaction
-	_, err = session.WithTransaction(context.TODO(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
 		userIdHex, err := primitive.ObjectIDFromHex(s.UserId)
 		if err != nil {
 			return nil, fmt.Errorf("invalid UserId: %v", err)
@@ -282,6 +338,11 @@ func (r *MongoRepository) AddSwear(s swearJar.Swear) error {
 			return nil, fmt.Errorf("invalid SwearJarId: %v", err)
 		}
 
+		reportedByHex, err := primitive.ObjectIDFromHex(s.ReportedBy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ReportedBy: %v", err)
+		}
+
 		_, err = r.swears.InsertOne(
 			sessCtx,
 			bson.D{
@@ -290,6 +351,7 @@ func (r *MongoRepository) AddSwear(s swearJar.Swear) error {
 				{Key: "UserId", Value: userIdHex},
 				{Key: "SwearJarId", Value: swearJarIdHex},
 				{Key: "SwearDescription", Value: s.SwearDescription},
+				{Key: "ReportedBy", Value: reportedByHex},
 			},
 		)
 		if err != nil {
@@ -316,7 +378,7 @@ func (r *MongoRepository) AddSwear(s swearJar.Swear) error {
 	return err
 }
 
-func (r *MongoRepository) GetSwearsWithUsers(swearJarId string, limit int) (swearJar.RecentSwearsWithUsers, error) {
+func (r *MongoRepository) GetSwearsWithUsers(ctx context.Context, swearJarId string, limit int) (swearJar.RecentSwearsWithUsers, error) {
 	swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
 	if err != nil {
 		return swearJar.RecentSwearsWithUsers{}, fmt.Errorf("invalid SwearJarId: %v", err)
@@ -324,20 +386,20 @@ func (r *MongoRepository) GetSwearsWithUsers(swearJarId string, limit int) (swea
 
 	filter := bson.M{"SwearJarId": swearJarIdHex, "Active": true}
 	findOptions := options.Find().SetSort(bson.D{{Key: "CreatedAt", Value: -1}}).SetLimit(int64(limit))
-	cursor, err := r.swears.Find(context.TODO(), filter, findOptions)
+	cursor, err := r.swears.Find(ctx, filter, findOptions)
 	if err != nil {
 		return swearJar.RecentSwearsWithUsers{}, err
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	var swears []swearJar.Swear
-	if err := cursor.All(context.TODO(), &swears); err != nil {
+	if err := cursor.All(ctx, &swears); err != nil {
 		return swearJar.RecentSwearsWithUsers{}, err
 	}
 
 	var usersMap = make(map[string]authentication.UserResponse)
 	for _, s := range swears {
-		user, err := r.GetUserById(s.UserId)
+		user, err := r.GetUserById(ctx, s.UserId)
 		if err != nil {
 			return swearJar.RecentSwearsWithUsers{}, err
 		}
@@ -347,36 +409,68 @@ func (r *MongoRepository) GetSwearsWithUsers(swearJarId string, limit int) (swea
 	return swearJar.RecentSwearsWithUsers{Swears: swears, Users: usersMap}, nil
 }
 
-func (r *MongoRepository) SignUp(u authentication.User) error {
+func (r *MongoRepository) SignUp(ctx context.Context, u authentication.User) error {
 	_, err := r.users.InsertOne(
-		context.TODO(),
+		ctx,
 		bson.D{
 			{Key: "Email", Value: u.Email},
 			{Key: "Name", Value: u.Name},
 			{Key: "Password", Value: u.Password},
 			{Key: "Verified", Value: u.Verified},
+			{Key: "CreatedAt", Value: u.CreatedAt},
+			{Key: "Locale", Value: u.Locale},
 		},
 	)
 	return err
 }
 
-func (r *MongoRepository) CreateAuthToken(authToken authentication.AuthToken) error {
-	_, err := r.authTokens.InsertOne(context.TODO(), bson.D{
-		{Key: "Email", Value: authToken.Email},
-		{Key: "Token", Value: authToken.Token},
-		{Key: "CreatedAt", Value: authToken.CreatedAt},
-		{Key: "ExpiresAt", Value: authToken.ExpiresAt},
-		{Key: "Purpose", Value: authToken.Purpose},
-		{Key: "Used", Value: authToken.Used},
+// CreateAuthToken stores the token and invalidates the unused tokens of the same purpose sent to the email before,
+// so only the most recent link works
+func (r *MongoRepository) CreateAuthToken(ctx context.Context, authToken authentication.AuthToken) error {
+	return r.WithTransaction(ctx, func(ctx context.Context) error {
+		// * 1. Invalidate outstanding tokens. Passwordless passkey challenges are not tied to an email,
+		// so concurrent logins do not invalidate each other.
+		if authToken.Email != "" {
+			filter := bson.M{"Email": authToken.Email, "Purpose": authToken.Purpose, "Used": false}
+			if _, err := r.authTokens.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"Used": true}}); err != nil {
+				return err
+			}
+		}
+
+		// * 2. Insert the new token
+		_, err := r.authTokens.InsertOne(ctx, bson.D{
+			{Key: "Email", Value: authToken.Email},
+			{Key: "Token", Value: authToken.Token},
+			{Key: "CreatedAt", Value: authToken.CreatedAt},
+			{Key: "ExpiresAt", Value: authToken.ExpiresAt},
+			{Key: "Purpose", Value: authToken.Purpose},
+			{Key: "Used", Value: authToken.Used},
+			{Key: "NewEmail", Value: authToken.NewEmail},
+		})
+		return err
 	})
-	return err
 }
 
-func (r *MongoRepository) GetUserByEmail(e string) (authentication.User, error) {
+func (r *MongoRepository) GetLatestAuthToken(ctx context.Context, email string, purpose authentication.PurposeType) (authentication.AuthToken, error) {
+	filter := bson.M{"Email": email, "Purpose": purpose}
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "CreatedAt", Value: -1}})
+
+	var authToken authentication.AuthToken
+	err := r.authTokens.FindOne(ctx, filter, findOptions).Decode(&authToken)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return authentication.AuthToken{}, authentication.ErrNoDocuments
+		}
+		return authentication.AuthToken{}, err
+	}
+	return authToken, nil
+}
+
+func (r *MongoRepository) GetUserByEmail(ctx context.Context, e string) (authentication.User, error) {
 	filter := bson.D{{Key: "Email", Value: e}}
 	var result authentication.User
 
-	err := r.users.FindOne(context.TODO(), filter).Decode(&result)
+	err := r.users.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return authentication.User{}, authentication.ErrNoDocuments
@@ -387,7 +481,7 @@ func (r *MongoRepository) GetUserByEmail(e string) (authentication.User, error)
 	return result, nil
 }
 
-func (r *MongoRepository) GetUserById(userId string) (authentication.UserResponse, error) {
+func (r *MongoRepository) GetUserById(ctx context.Context, userId string) (authentication.UserResponse, error) {
 	userIdHex, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
 		return authentication.UserResponse{}, fmt.Errorf("invalid UserId: %v", err)
@@ -395,7 +489,7 @@ func (r *MongoRepository) GetUserById(userId string) (authentication.UserRespons
 
 	var result authentication.UserResponse
 	filter := bson.M{"_id": userIdHex}
-	err = r.users.FindOne(context.TODO(), filter).Decode(&result)
+	err = r.users.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
 		return authentication.UserResponse{}, err
 	}
@@ -403,9 +497,7 @@ func (r *MongoRepository) GetUserById(userId string) (authentication.UserRespons
 	return result, nil
 }
 
-func (r *MongoRepository) FindUsersByEmailPattern(query string, maxNumResults int, currentUserId string) ([]authentication.UserResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (r *MongoRepository) FindUsersByEmailPattern(ctx context.Context, query string, maxNumResults int, currentUserId string) ([]authentication.UserResponse, error) {
 
 	// Convert currentUserId from string to ObjectId
 	currentUserObjectId, err := primitive.ObjectIDFromHex(currentUserId)
@@ -469,9 +561,9 @@ func (r *MongoRepository) FindUsersByEmailPattern(query string, maxNumResults in
 	return decodedUsers, nil
 }
 
-func (r *MongoRepository) GetAuthToken(hashedToken string) (authentication.AuthToken, error) {
+func (r *MongoRepository) GetAuthToken(ctx context.Context, hashedToken string) (authentication.AuthToken, error) {
 	var authToken authentication.AuthToken
-	err := r.authTokens.FindOne(context.TODO(), bson.M{"Token": hashedToken}).Decode(&authToken)
+	err := r.authTokens.FindOne(ctx, bson.M{"Token": hashedToken}).Decode(&authToken)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return authToken, authentication.ErrNoDocuments
@@ -481,11 +573,11 @@ func (r *MongoRepository) GetAuthToken(hashedToken string) (authentication.AuthT
 	return authToken, nil
 }
 
-func (r *MongoRepository) UpdateUserPassword(email string, newPassword string) error {
+func (r *MongoRepository) UpdateUserPassword(ctx context.Context, email string, newPassword string) error {
 	filter := bson.M{"Email": email}
 	update := bson.M{"$set": bson.M{"Password": newPassword}}
 
-	result, err := r.users.UpdateOne(context.TODO(), filter, update)
+	result, err := r.users.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
@@ -497,11 +589,11 @@ func (r *MongoRepository) UpdateUserPassword(email string, newPassword string) e
 	return nil
 }
 
-func (r *MongoRepository) MarkAuthTokenAsUsed(hashedToken string) error {
+func (r *MongoRepository) MarkAuthTokenAsUsed(ctx context.Context, hashedToken string) error {
 	filter := bson.M{"Token": hashedToken}
 	update := bson.M{"$set": bson.M{"Used": true}}
 
-	result, err := r.authTokens.UpdateOne(context.TODO(), filter, update)
+	result, err := r.authTokens.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
@@ -513,14 +605,14 @@ func (r *MongoRepository) MarkAuthTokenAsUsed(hashedToken string) error {
 	return nil
 }
 
-func (r *MongoRepository) UpdatePasswordAndMarkToken(email string, newPassword string, hashedToken string) error {
+func (r *MongoRepository) UpdatePasswordAndMarkToken(ctx context.Context, email string, newPassword string, hashedToken string) error {
 	session, err := r.client.StartSession()
 	if err != nil {
 		return err
 	}
-	defer session.EndSession(context.Background())
+	defer session.EndSession(ctx)
 
-	_, err = session.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
 		// * 1. Update user's password
 		userFilter := bson.M{"Email": email}
 		userUpdate := bson.M{"$set": bson.M{"Password": newPassword}}
@@ -533,7 +625,7 @@ func (r *MongoRepository) UpdatePasswordAndMarkToken(email string, newPassword s
 		}
 
 		// * 2. Mark auth token as used
-		if err := r.useAuthToken(hashedToken); err != nil {
+		if err := r.useAuthToken(sessCtx, hashedToken); err != nil {
 			return nil, err
 		}
 
@@ -543,14 +635,14 @@ func (r *MongoRepository) UpdatePasswordAndMarkToken(email string, newPassword s
 	return err
 }
 
-func (r *MongoRepository) VerifyEmailAndMarkToken(email string, hashedToken string) error {
+func (r *MongoRepository) VerifyEmailAndMarkToken(ctx context.Context, email string, hashedToken string) error {
 	session, err := r.client.StartSession()
 	if err != nil {
 		return err
 	}
-	defer session.EndSession(context.Background())
+	defer session.EndSession(ctx)
 
-	_, err = session.WithTransaction(context.Background(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
 		// * 1. Mark user as verified
 		userFilter := bson.M{"Email": email}
 		userUpdate := bson.M{"$set": bson.M{"Verified": true}}
@@ -563,7 +655,7 @@ func (r *MongoRepository) VerifyEmailAndMarkToken(email string, hashedToken stri
 		}
 
 		// * 2. Mark auth token as used
-		if err := r.useAuthToken(hashedToken); err != nil {
+		if err := r.useAuthToken(sessCtx, hashedToken); err != nil {
 			return nil, err
 		}
 
@@ -573,11 +665,12 @@ func (r *MongoRepository) VerifyEmailAndMarkToken(email string, hashedToken stri
 	return err
 }
 
-func (r *MongoRepository) useAuthToken(hashedToken string) error {
-	filter := bson.M{"Token": hashedToken}
+func (r *MongoRepository) useAuthToken(ctx context.Context, hashedToken string) error {
+	// Only unused tokens match, so a token cannot be consumed twice by concurrent requests
+	filter := bson.M{"Token": hashedToken, "Used": false}
 	update := bson.M{"$set": bson.M{"Used": true}}
 
-	tokenResult, err := r.authTokens.UpdateOne(context.TODO(), filter, update)
+	tokenResult, err := r.authTokens.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
@@ -588,9 +681,7 @@ func (r *MongoRepository) useAuthToken(hashedToken string) error {
 	return nil
 }
 
-func (r *MongoRepository) SwearJarStats(swearJarId string) (swearJar.SwearJarStats, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (r *MongoRepository) SwearJarStats(ctx context.Context, swearJarId string) (swearJar.SwearJarStats, error) {
 
 	swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
 	if err != nil {
@@ -627,14 +718,14 @@ func (r *MongoRepository) SwearJarStats(swearJarId string) (swearJar.SwearJarSta
 	return stats, nil
 }
 
-func (r *MongoRepository) ClearSwearJar(swearJarId string, userId string) error {
+func (r *MongoRepository) ClearSwearJar(ctx context.Context, swearJarId string, userId string) error {
 	session, err := r.client.StartSession()
 	if err != nil {
 		return fmt.Errorf("failed to start session: %v", err)
 	}
-	defer session.EndSession(context.TODO())
+	defer session.EndSession(ctx)
 
-	_, err = session.WithTransaction(context.TODO(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
 		swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
 		if err != nil {
 			return nil, fmt.Errorf("invalid SwearJarId: %v", err)
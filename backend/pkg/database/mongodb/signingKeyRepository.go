@@ -0,0 +1,52 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+func (r *MongoRepository) CreateSigningKey(ctx context.Context, k authentication.SigningKey) error {
+	_, err := r.signingKeys.InsertOne(ctx, bson.D{
+		{Key: "_id", Value: k.Kid},
+		{Key: "Epoch", Value: k.Epoch},
+		{Key: "Algorithm", Value: k.Algorithm},
+		{Key: "EncryptedPrivateKey", Value: k.EncryptedPrivateKey},
+		{Key: "CreatedAt", Value: k.CreatedAt},
+		{Key: "NotBefore", Value: k.NotBefore},
+		{Key: "ExpiresAt", Value: k.ExpiresAt},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return authentication.ErrSigningKeyExists
+	}
+	return err
+}
+
+// GetSigningKeys returns the keys that have not expired yet, i.e. the active key, prepublished keys and retired keys
+// that can still verify tokens
+func (r *MongoRepository) GetSigningKeys(ctx context.Context) ([]authentication.SigningKey, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"ExpiresAt": time.Time{}},
+		bson.M{"ExpiresAt": bson.M{"$gt": time.Now()}},
+	}}
+	cursor, err := r.signingKeys.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []authentication.SigningKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *MongoRepository) SetSigningKeyExpiry(ctx context.Context, kid string, expiresAt time.Time) error {
+	_, err := r.signingKeys.UpdateByID(ctx, kid, bson.M{"$set": bson.M{"ExpiresAt": expiresAt}})
+	return err
+}
@@ -139,7 +139,6 @@ func SwearJarTrendPipeline(period string, numOfDataPoints int, startDate time.Ti
 		}
 	case "months":
 		dateFormat = "%Y-%m"
-		dateAdd = bson.D{{Key: "$multiply", Value: bson.A{"$$monthOffset", 30 * 24 * 60 * 60 * 1000}}}
 		labelFormat = bson.D{{Key: "$dateToString", Value: bson.D{
 			{Key: "date", Value: bson.D{
 				{Key: "$dateFromString", Value: bson.D{
@@ -152,6 +151,16 @@ func SwearJarTrendPipeline(period string, numOfDataPoints int, startDate time.Ti
 		}}}
 	}
 
+	offsetDate := bson.D{{Key: "$subtract", Value: bson.A{"$endDate", dateAdd}}}
+	if period == "months" {
+		// Months differ in length, stepping back a fixed 30 days skips or repeats months. $dateFromParts carries a
+		// month out of range over into the year, unlike $dateSubtract it does not need MongoDB 5.0.
+		offsetDate = bson.D{{Key: "$dateFromParts", Value: bson.D{
+			{Key: "year", Value: bson.D{{Key: "$year", Value: "$endDate"}}},
+			{Key: "month", Value: bson.D{{Key: "$subtract", Value: bson.A{bson.D{{Key: "$month", Value: "$endDate"}}, "$$monthOffset"}}}},
+		}}}
+	}
+
 	return mongo.Pipeline{
 		// Step 1: Match the specific SwearJar
 		{{Key: "$match", Value: bson.D{
@@ -180,12 +189,7 @@ func SwearJarTrendPipeline(period string, numOfDataPoints int, startDate time.Ti
 					{Key: "in", Value: bson.D{
 						{Key: "$dateToString", Value: bson.D{
 							{Key: "format", Value: dateFormat},
-							{Key: "date", Value: bson.D{
-								{Key: "$subtract", Value: bson.A{
-									"$endDate",
-									dateAdd,
-								}},
-							}},
+							{Key: "date", Value: offsetDate},
 						}},
 					}},
 				}},
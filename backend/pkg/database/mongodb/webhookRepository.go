@@ -0,0 +1,228 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/webhook"
+)
+
+func (r *MongoRepository) CreateWebhook(ctx context.Context, w webhook.Webhook) (webhook.Webhook, error) {
+	swearJarIdHex, err := primitive.ObjectIDFromHex(w.SwearJarId)
+	if err != nil {
+		return webhook.Webhook{}, fmt.Errorf("invalid SwearJarId: %v", err)
+	}
+	createdByHex, err := primitive.ObjectIDFromHex(w.CreatedBy)
+	if err != nil {
+		return webhook.Webhook{}, fmt.Errorf("invalid CreatedBy: %v", err)
+	}
+
+	result, err := r.webhooks.InsertOne(ctx, bson.D{
+		{Key: "SwearJarId", Value: swearJarIdHex},
+		{Key: "URL", Value: w.URL},
+		{Key: "Events", Value: w.Events},
+		{Key: "Secret", Value: w.Secret},
+		{Key: "CreatedAt", Value: w.CreatedAt},
+		{Key: "CreatedBy", Value: createdByHex},
+	})
+	if err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	w.WebhookId = result.InsertedID.(primitive.ObjectID).Hex()
+	return w, nil
+}
+
+func (r *MongoRepository) GetWebhook(ctx context.Context, webhookId string) (webhook.Webhook, error) {
+	webhookIdHex, err := primitive.ObjectIDFromHex(webhookId)
+	if err != nil {
+		return webhook.Webhook{}, authentication.ErrNoDocuments
+	}
+
+	var w webhook.Webhook
+	err = r.webhooks.FindOne(ctx, bson.M{"_id": webhookIdHex}).Decode(&w)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return webhook.Webhook{}, authentication.ErrNoDocuments
+		}
+		return webhook.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (r *MongoRepository) GetWebhooksBySwearJarId(ctx context.Context, swearJarId string) ([]webhook.Webhook, error) {
+	swearJarIdHex, err := primitive.ObjectIDFromHex(swearJarId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SwearJarId: %v", err)
+	}
+
+	webhooks := []webhook.Webhook{}
+	if err := findAll(ctx, r.webhooks, bson.M{"SwearJarId": swearJarIdHex}, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the webhook and its deliveries, including the ones still queued
+func (r *MongoRepository) DeleteWebhook(ctx context.Context, webhookId string) error {
+	webhookIdHex, err := primitive.ObjectIDFromHex(webhookId)
+	if err != nil {
+		return authentication.ErrNoDocuments
+	}
+
+	result, err := r.webhooks.DeleteOne(ctx, bson.M{"_id": webhookIdHex})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return authentication.ErrNoDocuments
+	}
+
+	_, err = r.webhookDeliveries.DeleteMany(ctx, bson.M{"WebhookId": webhookIdHex})
+	return err
+}
+
+func (r *MongoRepository) CreateWebhookDeliveries(ctx context.Context, deliveries []webhook.Delivery) ([]webhook.Delivery, error) {
+	documents := make([]interface{}, 0, len(deliveries))
+	for _, d := range deliveries {
+		webhookIdHex, err := primitive.ObjectIDFromHex(d.WebhookId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WebhookId: %v", err)
+		}
+		swearJarIdHex, err := primitive.ObjectIDFromHex(d.SwearJarId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SwearJarId: %v", err)
+		}
+
+		document := bson.D{
+			{Key: "WebhookId", Value: webhookIdHex},
+			{Key: "SwearJarId", Value: swearJarIdHex},
+			{Key: "EventId", Value: d.EventId},
+			{Key: "EventType", Value: d.EventType},
+			{Key: "Payload", Value: d.Payload},
+			{Key: "Status", Value: d.Status},
+			{Key: "Attempts", Value: d.Attempts},
+			{Key: "NextAttemptAt", Value: d.NextAttemptAt},
+			{Key: "LastAttemptAt", Value: d.LastAttemptAt},
+			{Key: "CreatedAt", Value: d.CreatedAt},
+		}
+		if d.RedeliveryOf != "" {
+			redeliveryOfHex, err := primitive.ObjectIDFromHex(d.RedeliveryOf)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RedeliveryOf: %v", err)
+			}
+			document = append(document, bson.E{Key: "RedeliveryOf", Value: redeliveryOfHex})
+		}
+		documents = append(documents, document)
+	}
+
+	result, err := r.webhookDeliveries.InsertMany(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
+
+	created := make([]webhook.Delivery, len(deliveries))
+	for i, d := range deliveries {
+		d.DeliveryId = result.InsertedIDs[i].(primitive.ObjectID).Hex()
+		created[i] = d
+	}
+	return created, nil
+}
+
+func (r *MongoRepository) GetWebhookDelivery(ctx context.Context, deliveryId string) (webhook.Delivery, error) {
+	deliveryIdHex, err := primitive.ObjectIDFromHex(deliveryId)
+	if err != nil {
+		return webhook.Delivery{}, authentication.ErrNoDocuments
+	}
+
+	var d webhook.Delivery
+	err = r.webhookDeliveries.FindOne(ctx, bson.M{"_id": deliveryIdHex}).Decode(&d)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return webhook.Delivery{}, authentication.ErrNoDocuments
+		}
+		return webhook.Delivery{}, err
+	}
+	return d, nil
+}
+
+// GetWebhookDeliveriesByWebhookId returns the most recent deliveries of the webhook, newest first
+func (r *MongoRepository) GetWebhookDeliveriesByWebhookId(ctx context.Context, webhookId string, limit int) ([]webhook.Delivery, error) {
+	webhookIdHex, err := primitive.ObjectIDFromHex(webhookId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebhookId: %v", err)
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "CreatedAt", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.webhookDeliveries.Find(ctx, bson.M{"WebhookId": webhookIdHex}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []webhook.Delivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDelivery atomically claims the pending delivery which has been due the longest, so a delivery is only
+// sent by one worker at a time. The claim counts as an attempt and hides the delivery from other claims for the lease,
+// after which a delivery whose worker was interrupted is claimed again.
+func (r *MongoRepository) ClaimWebhookDelivery(ctx context.Context, now time.Time, lease time.Duration) (webhook.Delivery, error) {
+	filter := bson.M{"Status": webhook.StatusPending, "NextAttemptAt": bson.M{"$lte": now}}
+	update := bson.M{
+		"$set": bson.M{"NextAttemptAt": now.Add(lease)},
+		"$inc": bson.M{"Attempts": 1},
+	}
+	findOptions := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "NextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var d webhook.Delivery
+	err := r.webhookDeliveries.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&d)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return webhook.Delivery{}, authentication.ErrNoDocuments
+		}
+		return webhook.Delivery{}, err
+	}
+	return d, nil
+}
+
+// UpdateWebhookDelivery stores the outcome of the last attempt of the delivery
+func (r *MongoRepository) UpdateWebhookDelivery(ctx context.Context, d webhook.Delivery) error {
+	deliveryIdHex, err := primitive.ObjectIDFromHex(d.DeliveryId)
+	if err != nil {
+		return fmt.Errorf("invalid DeliveryId: %v", err)
+	}
+
+	update := bson.M{"$set": bson.M{
+		"Status":         d.Status,
+		"NextAttemptAt":  d.NextAttemptAt,
+		"LastAttemptAt":  d.LastAttemptAt,
+		"ResponseStatus": d.ResponseStatus,
+		"ResponseBody":   d.ResponseBody,
+		"Error":          d.Error,
+	}}
+	_, err = r.webhookDeliveries.UpdateByID(ctx, deliveryIdHex, update)
+	return err
+}
+
+// DeleteWebhookDeliveriesBefore trims the delivery log. Pending deliveries are kept until they succeed or fail.
+func (r *MongoRepository) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) error {
+	filter := bson.M{"Status": bson.M{"$ne": webhook.StatusPending}, "CreatedAt": bson.M{"$lt": before}}
+	_, err := r.webhookDeliveries.DeleteMany(ctx, filter)
+	return err
+}
@@ -0,0 +1,274 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+const (
+	pollInterval = 5 * time.Minute
+	queryTimeout = 30 * time.Second // Bounds the queries of the worker outside of a digest
+	// claimLease is how long a claimed subscription is hidden from other claims. A digest whose worker was
+	// interrupted by a restart is sent after the lease, which must be longer than building and sending a digest.
+	claimLease  = 15 * time.Minute
+	sendTimeout = 5 * time.Minute
+	retryDelay  = 1 * time.Hour // Delay before a digest which failed to send is retried
+)
+
+var ErrNotSubscribed = apperror.NotFound("not_subscribed", "not subscribed to digest emails")
+var ErrInvalidUnsubscribeLink = apperror.NotFound("invalid_unsubscribe_link", "invalid unsubscribe link")
+
+// Config is the price of a swear, which the amount owed in a digest is calculated with. Swear jars have no price of
+// their own.
+type Config struct {
+	SwearPriceCents int64
+	Currency        string
+}
+
+// LoadConfigFromEnv reads the price of a swear from DIGEST_SWEAR_PRICE, e.g. 0.50, and its currency symbol from
+// DIGEST_CURRENCY. The amount owed is left out of digests if no price is set.
+func LoadConfigFromEnv() (Config, error) {
+	config := Config{Currency: os.Getenv("DIGEST_CURRENCY")}
+	if config.Currency == "" {
+		config.Currency = "$"
+	}
+
+	if rawPrice := os.Getenv("DIGEST_SWEAR_PRICE"); rawPrice != "" {
+		price, err := strconv.ParseFloat(rawPrice, 64)
+		if err != nil || price < 0 {
+			return Config{}, fmt.Errorf("invalid DIGEST_SWEAR_PRICE: %q", rawPrice)
+		}
+		config.SwearPriceCents = int64(math.Round(price * 100))
+	}
+	return config, nil
+}
+
+type Service interface {
+	GetSubscription(ctx context.Context, userId string) (Subscription, error)
+	Subscribe(ctx context.Context, userId string, frequency Frequency, timezone string) (Subscription, error)
+	Unsubscribe(ctx context.Context, userId string) error
+	// UnsubscribeWithToken unsubscribes the user of the unsubscribe link of a digest, which does not require a session
+	UnsubscribeWithToken(ctx context.Context, token string) error
+	Start() (stop func())
+}
+
+type Repository interface {
+	// UpsertDigestSubscription replaces the frequency, timezone and schedule of the subscription of the user, keeping
+	// the unsubscribe token of an existing subscription
+	UpsertDigestSubscription(ctx context.Context, s Subscription) (Subscription, error)
+	GetDigestSubscription(ctx context.Context, userId string) (Subscription, error)
+	DeleteDigestSubscription(ctx context.Context, userId string) error
+	DeleteDigestSubscriptionByToken(ctx context.Context, token string) error
+	// ClaimDigestSubscription atomically claims the subscription which has been due the longest, hiding it from other
+	// claims for the lease
+	ClaimDigestSubscription(ctx context.Context, now time.Time, lease time.Duration) (Subscription, error)
+	ScheduleDigestSubscription(ctx context.Context, subscriptionId string, lastSentAt time.Time, nextSendAt time.Time) error
+	CountActiveSwearsByUser(ctx context.Context, swearJarId string, userId string) (int, error)
+	GetUserById(ctx context.Context, userId string) (authentication.UserResponse, error)
+}
+
+type service struct {
+	r      Repository
+	sj     swearJar.Service
+	e      email.Service
+	config Config
+}
+
+func NewService(r Repository, sj swearJar.Service, e email.Service, config Config) Service {
+	return &service{r, sj, e, config}
+}
+
+func (s *service) GetSubscription(ctx context.Context, userId string) (Subscription, error) {
+	subscription, err := s.r.GetDigestSubscription(ctx, userId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return Subscription{}, ErrNotSubscribed
+		}
+		return Subscription{}, err
+	}
+	return subscription, nil
+}
+
+// Subscribe opts the user in to digest emails, or changes the frequency and timezone of their subscription
+func (s *service) Subscribe(ctx context.Context, userId string, frequency Frequency, timezone string) (Subscription, error) {
+	subscription, err := NewSubscription(userId, frequency, timezone)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	stored, err := s.r.UpsertDigestSubscription(ctx, *subscription)
+	if err != nil {
+		log.Printf("DigestService: Error storing digest subscription in db: %v", err)
+		return Subscription{}, err
+	}
+
+	log.Printf("DigestService: User {%s} subscribed to %s digests, next digest at %s", userId, frequency, stored.NextSendAt.UTC())
+	return stored, nil
+}
+
+func (s *service) Unsubscribe(ctx context.Context, userId string) error {
+	if err := s.r.DeleteDigestSubscription(ctx, userId); err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ErrNotSubscribed
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *service) UnsubscribeWithToken(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrInvalidUnsubscribeLink
+	}
+	if err := s.r.DeleteDigestSubscriptionByToken(ctx, token); err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ErrInvalidUnsubscribeLink
+		}
+		return err
+	}
+	return nil
+}
+
+// Start runs the scheduler which sends the digests which are due, until stop is called
+func (s *service) Start() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		s.processDigests(done)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.processDigests(done)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// processDigests sends the digests which are due, until there are none left or the scheduler is stopped
+func (s *service) processDigests(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		subscription, err := s.claimSubscription()
+		if err != nil {
+			if !errors.Is(err, authentication.ErrNoDocuments) {
+				log.Printf("DigestService: Error claiming digest subscription: %v", err)
+			}
+			return
+		}
+		s.runDigest(subscription)
+	}
+}
+
+func (s *service) claimSubscription() (Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	return s.r.ClaimDigestSubscription(ctx, time.Now(), claimLease)
+}
+
+// runDigest sends the digest and schedules the next one. A digest which fails to send is retried after retryDelay,
+// a digest which was missed while the scheduler was down is sent once and not for every missed period.
+func (s *service) runDigest(subscription Subscription) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	now := time.Now()
+	lastSentAt, nextSendAt := now, NextSendAt(subscription.Frequency, subscription.location(), now)
+	if err := s.sendDigest(ctx, subscription, now); err != nil {
+		log.Printf("DigestService: Digest of subscription {%s} failed: %v", subscription.SubscriptionId, err)
+		lastSentAt, nextSendAt = subscription.LastSentAt, now.Add(retryDelay)
+	}
+
+	// The schedule is stored with a deadline of its own, as the digest may have run out of time
+	updateCtx, cancelUpdate := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancelUpdate()
+	if err := s.r.ScheduleDigestSubscription(updateCtx, subscription.SubscriptionId, lastSentAt, nextSendAt); err != nil {
+		log.Printf("DigestService: Error scheduling digest subscription {%s}: %v", subscription.SubscriptionId, err)
+	}
+}
+
+func (s *service) sendDigest(ctx context.Context, subscription Subscription, now time.Time) error {
+	user, err := s.r.GetUserById(ctx, subscription.UserId)
+	if err != nil {
+		return err
+	}
+
+	// * 1. Summarize each swear jar of the user from its stats and trend
+	swearJars, err := s.sj.GetSwearJarsByUserId(ctx, subscription.UserId)
+	if err != nil {
+		return err
+	}
+	if len(swearJars) == 0 {
+		log.Printf("DigestService: User {%s} has no swear jars, skipping digest", subscription.UserId)
+		return nil
+	}
+
+	trendPeriod := subscription.Frequency.period()
+	summaries := make([]JarSummary, 0, len(swearJars))
+	for _, sj := range swearJars {
+		stats, err := s.sj.SwearJarStats(ctx, sj.SwearJarId, subscription.UserId)
+		if err != nil {
+			return err
+		}
+		trend, err := s.sj.SwearJarTrend(ctx, sj.SwearJarId, subscription.UserId, trendPeriod)
+		if err != nil {
+			return err
+		}
+		yourActiveSwears, err := s.r.CountActiveSwearsByUser(ctx, sj.SwearJarId, subscription.UserId)
+		if err != nil {
+			return err
+		}
+
+		last := lastCompletePeriod(trend, subscription.Frequency, now, subscription.location())
+		summary := summarize(sj, stats, trend, subscription.UserId, yourActiveSwears, last)
+		if s.config.SwearPriceCents > 0 {
+			summary.AmountOwed = formatAmount(int64(yourActiveSwears)*s.config.SwearPriceCents, s.config.Currency)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	// * 2. Send email with the summaries and the unsubscribe link
+	data := struct {
+		Name            string
+		Frequency       Frequency
+		SwearJars       []JarSummary
+		NextSendAt      time.Time
+		Location        *time.Location // Timezone of the subscription, which the times are shown in
+		UnsubscribeLink string
+	}{
+		Name:            user.Name,
+		Frequency:       subscription.Frequency,
+		SwearJars:       summaries,
+		NextSendAt:      NextSendAt(subscription.Frequency, subscription.location(), now),
+		Location:        subscription.location(),
+		UnsubscribeLink: os.Getenv("FRONTEND_URL") + "/digest/unsubscribe?token=" + subscription.UnsubscribeToken,
+	}
+
+	if err := s.e.SendEmail(ctx, user.Email, user.Locale, email.TemplateDigest, data); err != nil {
+		return err
+	}
+
+	log.Printf("DigestService: %s digest queued for user {%s}", subscription.Frequency, subscription.UserId)
+	return nil
+}
@@ -0,0 +1,116 @@
+package digest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+	_ "time/tzdata" // Timezones of the users are resolved on hosts without a zoneinfo database
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+type Frequency string
+
+const (
+	FrequencyWeekly  Frequency = "weekly"
+	FrequencyMonthly Frequency = "monthly"
+)
+
+// sendHour is the local hour of the user digests are sent at, on Mondays or the first of the month
+const sendHour = 9
+
+var ErrInvalidFrequency = apperror.InvalidField("frequency", "frequency must be weekly or monthly")
+var ErrInvalidTimezone = apperror.InvalidField("timezone", "unknown timezone")
+
+func (f Frequency) IsValid() bool {
+	return f == FrequencyWeekly || f == FrequencyMonthly
+}
+
+// period is the unit of the swear jar trend the digest summarizes
+func (f Frequency) period() string {
+	if f == FrequencyMonthly {
+		return "months"
+	}
+	return "weeks"
+}
+
+// Subscription is the opt-in of a user to digest emails summarizing their swear jars
+type Subscription struct {
+	SubscriptionId string    `bson:"_id,omitempty"`
+	UserId         string    `bson:"UserId"`
+	Frequency      Frequency `bson:"Frequency"`
+	Timezone       string    `bson:"Timezone"` // IANA name of the timezone the digest is scheduled in
+	// UnsubscribeToken is stored as is, unlike the other tokens, as it is embedded in every digest and only
+	// allows unsubscribing
+	UnsubscribeToken string    `bson:"UnsubscribeToken" json:"-"`
+	NextSendAt       time.Time `bson:"NextSendAt"`
+	LastSentAt       time.Time `bson:"LastSentAt"`
+	CreatedAt        time.Time `bson:"CreatedAt"`
+	UpdatedAt        time.Time `bson:"UpdatedAt"`
+}
+
+// NewSubscription returns the subscription of the user, scheduled for the next digest
+func NewSubscription(userId string, frequency Frequency, timezone string) (*Subscription, error) {
+	if !frequency.IsValid() {
+		return nil, ErrInvalidFrequency
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" || timezone == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+
+	token, err := generateUnsubscribeToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Subscription{
+		UserId:           userId,
+		Frequency:        frequency,
+		Timezone:         loc.String(),
+		UnsubscribeToken: token,
+		NextSendAt:       NextSendAt(frequency, loc, now),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}, nil
+}
+
+// location returns the timezone of the subscription, falling back to UTC for a timezone which is no longer known
+func (s *Subscription) location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// NextSendAt returns the first send time after the time, at sendHour in the timezone on the next Monday for weekly
+// digests or the first of the next month for monthly digests
+func NextSendAt(frequency Frequency, loc *time.Location, after time.Time) time.Time {
+	local := after.In(loc)
+
+	if frequency == FrequencyMonthly {
+		next := time.Date(local.Year(), local.Month(), 1, sendHour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 1, 0)
+		}
+		return next
+	}
+
+	daysUntilMonday := (int(time.Monday) - int(local.Weekday()) + 7) % 7
+	next := time.Date(local.Year(), local.Month(), local.Day()+daysUntilMonday, sendHour, 0, 0, 0, loc)
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
+
+func generateUnsubscribeToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
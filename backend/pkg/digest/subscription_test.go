@@ -0,0 +1,57 @@
+package digest
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestNextSendAt(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	newYork := mustLoadLocation(t, "America/New_York")
+	auckland := mustLoadLocation(t, "Pacific/Auckland")
+
+	tests := []struct {
+		name      string
+		frequency Frequency
+		loc       *time.Location
+		after     time.Time
+		want      time.Time // in UTC
+	}{
+		{"weekly before 9 on a monday", FrequencyWeekly, berlin, time.Date(2026, 3, 23, 8, 59, 0, 0, berlin), time.Date(2026, 3, 23, 8, 0, 0, 0, time.UTC)},
+		{"weekly at 9 on a monday", FrequencyWeekly, berlin, time.Date(2026, 3, 23, 9, 0, 0, 0, berlin), time.Date(2026, 3, 30, 7, 0, 0, 0, time.UTC)},
+		{"weekly over the spring DST change", FrequencyWeekly, berlin, time.Date(2026, 3, 25, 12, 0, 0, 0, berlin), time.Date(2026, 3, 30, 7, 0, 0, 0, time.UTC)},
+		{"weekly on the night of the spring DST change", FrequencyWeekly, berlin, time.Date(2026, 3, 29, 2, 30, 0, 0, time.UTC), time.Date(2026, 3, 30, 7, 0, 0, 0, time.UTC)},
+		{"weekly over the autumn DST change", FrequencyWeekly, berlin, time.Date(2026, 10, 21, 12, 0, 0, 0, berlin), time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC)},
+		{"weekly over the DST change behind UTC", FrequencyWeekly, newYork, time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), time.Date(2026, 3, 9, 13, 0, 0, 0, time.UTC)},
+		{"weekly ahead of UTC on a sunday in UTC", FrequencyWeekly, auckland, time.Date(2027, 1, 3, 19, 0, 0, 0, time.UTC), time.Date(2027, 1, 3, 20, 0, 0, 0, time.UTC)},
+		{"monthly before 9 on the first", FrequencyMonthly, berlin, time.Date(2026, 4, 1, 8, 59, 0, 0, berlin), time.Date(2026, 4, 1, 7, 0, 0, 0, time.UTC)},
+		{"monthly at 9 on the first", FrequencyMonthly, berlin, time.Date(2026, 4, 1, 9, 0, 0, 0, berlin), time.Date(2026, 5, 1, 7, 0, 0, 0, time.UTC)},
+		{"monthly on the 31st", FrequencyMonthly, berlin, time.Date(2026, 1, 31, 23, 30, 0, 0, berlin), time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{"monthly on the 31st in UTC, the 1st in the timezone", FrequencyMonthly, berlin, time.Date(2026, 1, 31, 23, 30, 0, 0, time.UTC), time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{"monthly over the spring DST change", FrequencyMonthly, berlin, time.Date(2026, 3, 15, 12, 0, 0, 0, berlin), time.Date(2026, 4, 1, 7, 0, 0, 0, time.UTC)},
+		{"monthly over the autumn DST change", FrequencyMonthly, berlin, time.Date(2026, 10, 19, 12, 0, 0, 0, berlin), time.Date(2026, 11, 1, 8, 0, 0, 0, time.UTC)},
+		{"monthly at the end of the year", FrequencyMonthly, newYork, time.Date(2026, 12, 31, 22, 0, 0, 0, newYork), time.Date(2027, 1, 1, 14, 0, 0, 0, time.UTC)},
+		{"monthly on a leap day", FrequencyMonthly, berlin, time.Date(2028, 2, 29, 12, 0, 0, 0, berlin), time.Date(2028, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{"monthly ahead of UTC on the 31st in UTC", FrequencyMonthly, auckland, time.Date(2026, 12, 31, 19, 0, 0, 0, time.UTC), time.Date(2026, 12, 31, 20, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NextSendAt(tt.frequency, tt.loc, tt.after)
+			if !got.Equal(tt.want) {
+				t.Errorf("NextSendAt(%s, %s, %v) = %v, want %v", tt.frequency, tt.loc, tt.after, got.UTC(), tt.want)
+			}
+			if local := got.In(tt.loc); local.Hour() != sendHour || local.Minute() != 0 {
+				t.Errorf("NextSendAt(%s, %s, %v) = %v, want %d:00 in the timezone", tt.frequency, tt.loc, tt.after, local, sendHour)
+			}
+		})
+	}
+}
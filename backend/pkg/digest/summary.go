@@ -0,0 +1,78 @@
+package digest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+// JarSummary is the part of a digest about one swear jar
+type JarSummary struct {
+	SwearJarId       string
+	Name             string
+	ActiveSwears     int    // Active swears of all owners, as in the swear jar stats
+	YourActiveSwears int    // Active swears of the user
+	AmountOwed       string // Empty if no price per swear is configured
+	PeriodSwears     int    // Swears of all owners in the last period
+	YourPeriodSwears int    // Swears of the user in the last period
+	Change           int    // Swears of the user in the last period minus the period before
+	Position         int    // Position of the user on the leaderboard of the last period, most swears first
+	Owners           int
+}
+
+// summarize builds the summary of the swear jar for the user from its stats and trend
+func summarize(sj swearJar.SwearJarWithOwners, stats swearJar.SwearJarStats, trend []swearJar.ChartData, userId string, yourActiveSwears int, last int) JarSummary {
+	summary := JarSummary{
+		SwearJarId:       sj.SwearJarId,
+		Name:             sj.Name,
+		ActiveSwears:     stats.ActiveSwears,
+		YourActiveSwears: yourActiveSwears,
+		Owners:           len(sj.Owners),
+	}
+	if last < 0 || last >= len(trend) {
+		return summary
+	}
+
+	leaderboard := swearJar.Leaderboard(trend[last : last+1])
+	for i, entry := range leaderboard {
+		summary.PeriodSwears += entry.Swears
+		if entry.UserId == userId {
+			summary.YourPeriodSwears = entry.Swears
+			summary.Position = i + 1
+		}
+	}
+
+	summary.Change = summary.YourPeriodSwears
+	if last > 0 {
+		for _, entry := range swearJar.Leaderboard(trend[last-1 : last]) {
+			if entry.UserId == userId {
+				summary.Change -= entry.Swears
+			}
+		}
+	}
+	return summary
+}
+
+// lastCompletePeriod returns the index of the last complete period of a trend ending now. The trend buckets swears
+// by UTC period, a digest sent ahead of UTC is sent before the UTC period it starts has begun.
+func lastCompletePeriod(trend []swearJar.ChartData, frequency Frequency, now time.Time, loc *time.Location) int {
+	utc, local := now.UTC(), now.In(loc)
+
+	samePeriod := utc.Year() == local.Year() && utc.Month() == local.Month()
+	if frequency == FrequencyWeekly {
+		utcYear, utcWeek := utc.ISOWeek()
+		localYear, localWeek := local.ISOWeek()
+		samePeriod = utcYear == localYear && utcWeek == localWeek
+	}
+
+	if samePeriod {
+		return len(trend) - 2
+	}
+	return len(trend) - 1
+}
+
+// formatAmount formats an amount in cents with the currency
+func formatAmount(cents int64, currency string) string {
+	return fmt.Sprintf("%s%d.%02d", currency, cents/100, cents%100)
+}
@@ -0,0 +1,44 @@
+package digest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+func TestLastCompletePeriod(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	newYork := mustLoadLocation(t, "America/New_York")
+	auckland := mustLoadLocation(t, "Pacific/Auckland")
+	// The trend ends with the UTC period of now, the last complete period is the one before unless the digest is
+	// sent ahead of UTC, before that period has begun
+	trend := make([]swearJar.ChartData, 3)
+
+	tests := []struct {
+		name      string
+		frequency Frequency
+		loc       *time.Location
+		now       time.Time
+		want      int
+	}{
+		{"weekly in UTC", FrequencyWeekly, time.UTC, time.Date(2026, 3, 30, 9, 0, 0, 0, time.UTC), 1},
+		{"weekly after the spring DST change", FrequencyWeekly, berlin, time.Date(2026, 3, 30, 9, 0, 0, 0, berlin), 1},
+		{"weekly after the autumn DST change", FrequencyWeekly, berlin, time.Date(2026, 10, 26, 9, 0, 0, 0, berlin), 1},
+		{"weekly behind UTC", FrequencyWeekly, newYork, time.Date(2026, 3, 9, 9, 0, 0, 0, newYork), 1},
+		{"weekly ahead of UTC", FrequencyWeekly, auckland, time.Date(2026, 3, 30, 9, 0, 0, 0, auckland), 2},
+		{"weekly ahead of UTC in the first week of the year", FrequencyWeekly, auckland, time.Date(2027, 1, 4, 9, 0, 0, 0, auckland), 2},
+		{"monthly in UTC", FrequencyMonthly, time.UTC, time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), 1},
+		{"monthly after the spring DST change", FrequencyMonthly, berlin, time.Date(2026, 4, 1, 9, 0, 0, 0, berlin), 1},
+		{"monthly behind UTC at the start of the year", FrequencyMonthly, newYork, time.Date(2027, 1, 1, 9, 0, 0, 0, newYork), 1},
+		{"monthly ahead of UTC after a short month", FrequencyMonthly, auckland, time.Date(2026, 3, 1, 9, 0, 0, 0, auckland), 2},
+		{"monthly ahead of UTC at the start of the year", FrequencyMonthly, auckland, time.Date(2027, 1, 1, 9, 0, 0, 0, auckland), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastCompletePeriod(trend, tt.frequency, tt.now, tt.loc); got != tt.want {
+				t.Errorf("lastCompletePeriod(%s, %v, %s) = %d, want %d", tt.frequency, tt.now, tt.loc, got, tt.want)
+			}
+		})
+	}
+}
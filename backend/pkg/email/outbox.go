@@ -0,0 +1,86 @@
+package email
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	MaxAttempts = 8
+
+	backoffBase = 30 * time.Second
+	backoffMax  = 2 * time.Hour
+)
+
+type Status string
+
+const (
+	StatusPending Status = "Pending"
+	StatusSent    Status = "Sent"
+	StatusDead    Status = "Dead" // Dead-lettered: the email failed permanently or ran out of attempts and is not retried
+)
+
+// ErrNoPendingEmail is returned by the repository when no email is due to be sent
+var ErrNoPendingEmail = errors.New("no pending email")
+
+// Message is an email in the outbox. It is stored together with the change which sends it and delivered by the
+// worker afterwards, so a failing email provider neither fails nor loses the email of the change.
+type Message struct {
+	MessageId     string    `bson:"_id,omitempty"`
+	To            string    `bson:"To"`
+	Subject       string    `bson:"Subject"`
+	HTMLBody      string    `bson:"HTMLBody,omitempty"` // The bodies are cleared once sent, as they may hold links with one-time tokens
+	TextBody      string    `bson:"TextBody,omitempty"`
+	Status        Status    `bson:"Status"`
+	Attempts      int       `bson:"Attempts"`
+	NextAttemptAt time.Time `bson:"NextAttemptAt"`
+	LastAttemptAt time.Time `bson:"LastAttemptAt,omitempty"`
+	LastError     string    `bson:"LastError,omitempty"`
+	SentAt        time.Time `bson:"SentAt,omitempty"`
+	CreatedAt     time.Time `bson:"CreatedAt"`
+}
+
+func (m *Message) Validate() error {
+	if m.To == "" {
+		return errors.New("recipient is required")
+	}
+	if m.Subject == "" {
+		return errors.New("subject is required")
+	}
+	switch m.Status {
+	case StatusPending, StatusSent, StatusDead:
+	default:
+		return errors.New("invalid status")
+	}
+	return nil
+}
+
+func NewMessage(to string, e Email) (*Message, error) {
+	now := time.Now()
+	message := &Message{
+		To:            to,
+		Subject:       e.Subject,
+		HTMLBody:      e.HTML,
+		TextBody:      e.Text,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+
+	if err := message.Validate(); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// backoff returns how long to wait before retrying an email which failed the given number of attempts. The delay
+// doubles with every attempt and is jittered, so emails which failed together are not retried together.
+func backoff(attempts int) time.Duration {
+	delay := backoffMax
+	if attempts < 20 {
+		delay = min(backoffBase<<(attempts-1), backoffMax)
+	}
+	return delay/2 + rand.N(delay/2)
+}
@@ -0,0 +1,92 @@
+package email
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+// PreviewConfig holds the settings of other packages which the sample data of previews depends on, as the email
+// package can't import them
+type PreviewConfig struct {
+	DownloadLinkDuration time.Duration // How long the link of a data export is valid
+}
+
+// previewData returns the sample data the email is previewed with, shaped like the data its service renders it with
+func (t *Templates) previewData(name string) (interface{}, bool) {
+	frontendURL := os.Getenv("FRONTEND_URL")
+
+	switch name {
+	case TemplateVerifyEmail:
+		return map[string]interface{}{
+			"Name":             "Alex",
+			"VerificationLink": frontendURL + "/auth/email/verify?token=preview",
+		}, true
+	case TemplateResetPassword:
+		return map[string]interface{}{
+			"Name":      "Alex",
+			"ResetLink": frontendURL + "/auth/password/reset?token=preview",
+		}, true
+	case TemplateMagicLogin:
+		return map[string]interface{}{
+			"Name":      "Alex",
+			"LoginLink": frontendURL + "/auth/login/magic?token=preview",
+		}, true
+	case TemplateConfirmEmailChange:
+		return map[string]interface{}{
+			"Name":        "Alex",
+			"ConfirmLink": frontendURL + "/auth/email/change?token=preview",
+		}, true
+	case TemplateEmailChanged:
+		return map[string]interface{}{
+			"Name":     "Alex",
+			"NewEmail": "alex@example.com",
+		}, true
+	case TemplateDataExport:
+		return map[string]interface{}{
+			"Name":         "Alex",
+			"DownloadLink": os.Getenv("BACKEND_URL") + "/export/preview/download?token=preview",
+			"ExpiresAt":    time.Now().Add(t.preview.DownloadLinkDuration),
+		}, true
+	case TemplateDigest:
+		return map[string]interface{}{
+			"Name":      "Alex",
+			"Frequency": "weekly",
+			"SwearJars": []map[string]interface{}{
+				{"Name": "Office", "ActiveSwears": 17, "YourActiveSwears": 6, "AmountOwed": "$3.00", "PeriodSwears": 11, "YourPeriodSwears": 4, "Change": -2, "Position": 2, "Owners": 3},
+				{"Name": "Home", "ActiveSwears": 5, "YourActiveSwears": 5, "PeriodSwears": 3, "YourPeriodSwears": 3, "Change": 1, "Position": 1, "Owners": 1},
+				{"Name": "Book club", "ActiveSwears": 0, "YourActiveSwears": 0, "PeriodSwears": 0, "YourPeriodSwears": 0, "Change": 0, "Position": 0, "Owners": 4},
+			},
+			"NextSendAt":      time.Now().AddDate(0, 0, 7),
+			"Location":        time.UTC,
+			"UnsubscribeLink": frontendURL + "/digest/unsubscribe?token=preview",
+		}, true
+	case TemplateNotification:
+		return map[string]interface{}{
+			"Name":         "Alex",
+			"Title":        "You were reported in Office",
+			"Body":         "Sam added a swear by you.",
+			"SwearJarName": "Office",
+			"SwearJarLink": frontendURL + "/swearjar/preview/view",
+		}, true
+	}
+	return nil, false
+}
+
+// Preview renders the email with sample data in the locale. Unlike Render, an unsupported locale is rejected, so a
+// typo in the locale does not silently show the default locale.
+func (t *Templates) Preview(name string, locale string) (Email, error) {
+	data, ok := t.previewData(name)
+	if !ok {
+		return Email{}, ErrTemplateNotFound
+	}
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	if _, ok := t.catalogs[locale]; !ok {
+		return Email{}, apperror.InvalidField("locale", "locale must be one of "+strings.Join(Locales, ", "))
+	}
+	return t.Render(name, locale, data)
+}
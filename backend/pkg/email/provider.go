@@ -0,0 +1,20 @@
+package email
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wneessen/go-mail"
+)
+
+// Provider delivers an email, see the providers package for the implementations. A *mail.SendError which isn't
+// temporary dead-letters the email, any other error is retried.
+type Provider interface {
+	Send(ctx context.Context, m *mail.Msg) error
+}
+
+// IsPermanent reports whether sending failed for a reason retrying does not fix, e.g. an address which does not exist
+func IsPermanent(err error) bool {
+	var sendErr *mail.SendError
+	return errors.Is(err, errInvalidRecipient) || errors.As(err, &sendErr) && !sendErr.IsTemp()
+}
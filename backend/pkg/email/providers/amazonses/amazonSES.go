@@ -1,21 +1,16 @@
 package amazonses
 
 import (
-	"os"
-	"strconv"
-
-	"github.com/wneessen/go-mail"
-	// "github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/smtp"
 )
 
-func NewClient() *mail.Client {
-	smtpHost := os.Getenv("AMAZON_SES_SMTP_HOST")
-	smtpPort := os.Getenv("AMAZON_SES_SMTP_PORT")
-	smtpUsername := os.Getenv("AMAZON_SES_SMTP_USERNAME")
-	smtpPassword := os.Getenv("AMAZON_SES_SMTP_PASSWORD")
-
-	port, _ := strconv.Atoi(smtpPort)
-
-	client, _ := mail.NewClient(smtpHost, mail.WithPort(port), mail.WithSMTPAuth(mail.SMTPAuthPlain), mail.WithUsername(smtpUsername), mail.WithPassword(smtpPassword))
-	return client
+// NewProvider sends emails through the SMTP interface of Amazon SES, configured with AMAZON_SES_SMTP_HOST,
+// AMAZON_SES_SMTP_PORT, AMAZON_SES_SMTP_USERNAME and AMAZON_SES_SMTP_PASSWORD. SES requires TLS, which is upgraded
+// with STARTTLS unless AMAZON_SES_SMTP_TLS is "tls".
+func NewProvider() (*smtp.Provider, error) {
+	config, err := smtp.LoadConfigFromEnv("AMAZON_SES_SMTP")
+	if err != nil {
+		return nil, err
+	}
+	return smtp.NewProvider(config)
 }
@@ -0,0 +1,113 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var linkPattern = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// Message is a captured email, with its bodies decoded
+type Message struct {
+	Id         int       `json:"id"`
+	From       string    `json:"from"`
+	To         []string  `json:"to"`
+	Subject    string    `json:"subject"`
+	Text       string    `json:"text,omitempty"`
+	HTML       string    `json:"html,omitempty"`
+	Links      []string  `json:"links"`
+	Raw        []byte    `json:"-"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// parseMessage decodes the bodies of a raw email. An email which can't be parsed is still captured, with its raw
+// content as the text body.
+func parseMessage(from string, to []string, raw []byte) Message {
+	message := Message{
+		From:       from,
+		To:         to,
+		Raw:        raw,
+		ReceivedAt: time.Now(),
+	}
+
+	m, err := netmail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		message.Text = string(raw)
+		message.Links = findLinks(message.Text)
+		return message
+	}
+
+	decoder := new(mime.WordDecoder)
+	message.Subject = m.Header.Get("Subject")
+	if subject, err := decoder.DecodeHeader(message.Subject); err == nil {
+		message.Subject = subject
+	}
+
+	readPart(&message, m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	message.Links = findLinks(message.Text + "\n" + message.HTML)
+	return message
+}
+
+// readPart sets the first text/plain and text/html bodies of the message, walking into multipart bodies
+func readPart(message *Message, contentType string, encoding string, body io.Reader) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := r.NextRawPart()
+			if err != nil {
+				return
+			}
+			readPart(message, part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+		}
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	switch mediaType {
+	case "text/plain":
+		if message.Text == "" {
+			message.Text = string(content)
+		}
+	case "text/html":
+		if message.HTML == "" {
+			message.HTML = string(content)
+		}
+	}
+}
+
+// findLinks returns the distinct links in the bodies, unescaping the HTML entities of links in href attributes
+func findLinks(s string) []string {
+	links := []string{}
+	seen := map[string]bool{}
+	for _, link := range linkPattern.FindAllString(s, -1) {
+		link = html.UnescapeString(link)
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
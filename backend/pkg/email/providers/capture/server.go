@@ -0,0 +1,271 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSMTPAddr = "127.0.0.1:1025"
+	DefaultHTTPAddr = "127.0.0.1:8025"
+
+	MaxMessages    = 100 // The oldest captured emails are dropped beyond this
+	maxMessageSize = 10 << 20
+	commandTimeout = 1 * time.Minute
+)
+
+// Server is an SMTP server which captures the emails sent to it instead of delivering them, and serves them over
+// HTTP, so the emails of flows such as signup and email verification can be followed during development:
+//
+//	GET    /messages          the captured emails, newest first
+//	GET    /messages/{id}     a captured email
+//	GET    /messages/{id}/raw the captured email as an .eml file
+//	DELETE /messages          deletes the captured emails
+//
+// The links of every captured email are also logged. It speaks just enough SMTP for the smtp provider, without TLS or
+// authentication, so it must only listen on a local address.
+type Server struct {
+	mu       sync.Mutex
+	messages []Message
+	nextId   int
+}
+
+func NewServer() *Server {
+	return &Server{nextId: 1}
+}
+
+// Start listens for SMTP on smtpAddr and serves the captured emails on httpAddr, until stop is called. It returns the
+// address SMTP is listened on, which differs from smtpAddr if its port is 0.
+func (s *Server) Start(smtpAddr string, httpAddr string) (addr string, stop func(), err error) {
+	smtpListener, err := net.Listen("tcp", smtpAddr)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to listen for smtp: %w", err)
+	}
+	httpListener, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		smtpListener.Close()
+		return "", nil, fmt.Errorf("failed to listen for http: %w", err)
+	}
+
+	httpServer := &http.Server{Handler: s.routes(), ReadHeaderTimeout: commandTimeout}
+	go func() {
+		if err := httpServer.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("EmailCapture: HTTP server stopped: %v", err)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := smtpListener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Printf("EmailCapture: SMTP server stopped: %v", err)
+				}
+				return
+			}
+			go s.serveSMTP(conn)
+		}
+	}()
+
+	log.Printf("EmailCapture: Capturing emails sent to %s, view them at http://%s/messages", smtpListener.Addr(), httpListener.Addr())
+	return smtpListener.Addr().String(), func() {
+		smtpListener.Close()
+		httpServer.Close()
+	}, nil
+}
+
+// Messages returns the captured emails, newest first
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.messages))
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		messages = append(messages, s.messages[i])
+	}
+	return messages
+}
+
+func (s *Server) message(id int) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.messages {
+		if m.Id == id {
+			return m, true
+		}
+	}
+	return Message{}, false
+}
+
+func (s *Server) store(from string, to []string, raw []byte) {
+	message := parseMessage(from, to, raw)
+
+	s.mu.Lock()
+	message.Id = s.nextId
+	s.nextId++
+	s.messages = append(s.messages, message)
+	if len(s.messages) > MaxMessages {
+		s.messages = s.messages[len(s.messages)-MaxMessages:]
+	}
+	s.mu.Unlock()
+
+	log.Printf("EmailCapture: Captured email {%d} to %s: %q, links: %v", message.Id, strings.Join(to, ", "), message.Subject, message.Links)
+}
+
+// serveSMTP runs an SMTP session, capturing every email sent in it
+func (s *Server) serveSMTP(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+
+	var from string
+	var to []string
+	reply := func(code int, msg string) error {
+		return tp.PrintfLine("%d %s", code, msg)
+	}
+
+	conn.SetDeadline(time.Now().Add(commandTimeout))
+	if err := reply(220, "SwearJar capture server ready"); err != nil {
+		return
+	}
+	for {
+		conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			err = tp.PrintfLine("250-capture\r\n250-8BITMIME\r\n250 SIZE %d", maxMessageSize)
+		case "HELO":
+			err = reply(250, "capture")
+		case "MAIL":
+			from, to = parsePath(arg), nil
+			err = reply(250, "OK")
+		case "RCPT":
+			if from == "" {
+				err = reply(503, "MAIL first")
+				break
+			}
+			to = append(to, parsePath(arg))
+			err = reply(250, "OK")
+		case "DATA":
+			if len(to) == 0 {
+				err = reply(503, "RCPT first")
+				break
+			}
+			if err = reply(354, "End data with <CR><LF>.<CR><LF>"); err != nil {
+				break
+			}
+			var raw []byte
+			raw, err = io.ReadAll(io.LimitReader(tp.DotReader(), maxMessageSize+1))
+			if err != nil {
+				break
+			}
+			if len(raw) > maxMessageSize {
+				// The rest of the message is discarded, so the session can carry on
+				io.Copy(io.Discard, tp.DotReader())
+				err = reply(552, "Message too large")
+				break
+			}
+			s.store(from, to, raw)
+			from, to = "", nil
+			err = reply(250, "OK captured")
+		case "RSET":
+			from, to = "", nil
+			err = reply(250, "OK")
+		case "NOOP":
+			err = reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			err = reply(502, "Command not implemented")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parsePath returns the address of a MAIL FROM or RCPT TO argument, e.g. "FROM:<a@example.com> BODY=8BITMIME"
+func parsePath(arg string) string {
+	start, end := strings.Index(arg, "<"), strings.Index(arg, ">")
+	if start < 0 || end < start {
+		_, address, _ := strings.Cut(arg, ":")
+		return strings.TrimSpace(address)
+	}
+	return arg[start+1 : end]
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, map[string]interface{}{"messages": s.Messages()})
+		case http.MethodDelete:
+			s.mu.Lock()
+			s.messages = nil
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if m, ok := s.lookup(w, r); ok {
+			writeJSON(w, map[string]interface{}{"message": m})
+		}
+	})
+
+	mux.HandleFunc("/messages/{id}/raw", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if m, ok := s.lookup(w, r); ok {
+			w.Header().Set("Content-Type", "message/rfc822")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%d.eml"`, m.Id))
+			w.Write(m.Raw)
+		}
+	})
+
+	return mux
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (Message, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return Message{}, false
+	}
+	m, ok := s.message(id)
+	if !ok {
+		http.Error(w, "Message not found", http.StatusNotFound)
+	}
+	return m, ok
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,40 @@
+package console
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/wneessen/go-mail"
+)
+
+// Logger prints every email to the log instead of sending it, so the links in emails can be followed during
+// development without an email account. The plain text body is printed if the email has one, else the HTML body.
+type Logger struct{}
+
+func NewLogger() *Logger {
+	return &Logger{}
+}
+
+func (l *Logger) Send(ctx context.Context, m *mail.Msg) error {
+	var body []byte
+	for _, part := range m.GetParts() {
+		content, err := part.GetContent()
+		if err != nil {
+			return err
+		}
+		if body == nil || part.GetContentType() == mail.TypeTextPlain {
+			body = content
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\n", strings.Join(m.GetFromString(), ", "))
+	fmt.Fprintf(&b, "To: %s\n", strings.Join(m.GetToString(), ", "))
+	fmt.Fprintf(&b, "Subject: %s\n\n", strings.Join(m.GetGenHeader(mail.HeaderSubject), " "))
+	b.Write(body)
+
+	log.Printf("EmailConsole: Email printed instead of sent\n%s", b.String())
+	return nil
+}
@@ -0,0 +1,36 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/wneessen/go-mail"
+)
+
+// Fallback sends through the primary provider and, if that fails temporarily, through the fallback provider, so an
+// outage of e.g. SES does not hold up emails another provider can deliver. An email the primary provider rejected
+// permanently is not sent again, as the fallback would reject it too.
+type Fallback struct {
+	primary  email.Provider
+	fallback email.Provider
+}
+
+func NewFallback(primary email.Provider, fallback email.Provider) *Fallback {
+	return &Fallback{primary, fallback}
+}
+
+func (f *Fallback) Send(ctx context.Context, m *mail.Msg) error {
+	err := f.primary.Send(ctx, m)
+	if err == nil || email.IsPermanent(err) {
+		return err
+	}
+
+	log.Printf("EmailService: Primary provider failed, sending through the fallback provider: %v", err)
+	if fallbackErr := f.fallback.Send(ctx, m); fallbackErr != nil {
+		// Only the error of the primary provider is wrapped, so the email is retried unless it failed permanently there
+		return fmt.Errorf("%w (fallback: %v)", err, fallbackErr)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/capture"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/smtp"
+	"github.com/wneessen/go-mail"
+)
+
+// fakeProvider returns err for every email
+type fakeProvider struct {
+	err   error
+	sends int
+}
+
+func (p *fakeProvider) Send(ctx context.Context, m *mail.Msg) error {
+	p.sends++
+	return p.err
+}
+
+func newMessage(t *testing.T) *mail.Msg {
+	t.Helper()
+	m := mail.NewMsg()
+	if err := m.From("SwearJar <noreply@example.com>"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.To("alex@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	m.Subject("Verify your email")
+	m.SetBodyString(mail.TypeTextPlain, "Hi Alex")
+	return m
+}
+
+// startCaptureServer returns the capture server and an SMTP provider which sends to it
+func startCaptureServer(t *testing.T) (*capture.Server, email.Provider) {
+	t.Helper()
+	server := capture.NewServer()
+	addr, stop, err := server.Start("127.0.0.1:0", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(stop)
+	return server, newSMTPProvider(t, addr)
+}
+
+func newSMTPProvider(t *testing.T, addr string) email.Provider {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := smtp.NewProvider(smtp.Config{Host: host, Port: portNumber, TLS: smtp.TLSNone, Timeout: smtp.DefaultTimeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// unreachableAddr returns an address nothing listens on, like an SES endpoint during an outage
+func unreachableAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestFallbackSendsThroughSMTPWhenSESIsDown(t *testing.T) {
+	server, fallback := startCaptureServer(t)
+	p := NewFallback(newSMTPProvider(t, unreachableAddr(t)), fallback)
+
+	if err := p.Send(context.Background(), newMessage(t)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 || messages[0].Subject != "Verify your email" || len(messages[0].To) != 1 || messages[0].To[0] != "alex@example.com" {
+		t.Errorf("captured %+v, want the email sent through the fallback", messages)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	errConnectionRefused := errors.New("dial tcp: connection refused")
+	permanent := &mail.SendError{Reason: mail.ErrSMTPRcptTo}
+
+	tests := []struct {
+		name          string
+		primaryErr    error
+		fallbackErr   error
+		wantFallback  bool
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{"primary delivers", nil, nil, false, false, false},
+		{"primary fails temporarily", errConnectionRefused, nil, true, false, false},
+		{"both fail", errConnectionRefused, errors.New("fallback down"), true, true, false},
+		// The error of the primary provider decides whether the email is retried
+		{"fallback rejects permanently", errConnectionRefused, permanent, true, true, false},
+		{"primary rejects permanently", permanent, nil, false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, fallback := &fakeProvider{err: tt.primaryErr}, &fakeProvider{err: tt.fallbackErr}
+
+			err := NewFallback(primary, fallback).Send(context.Background(), newMessage(t))
+
+			if (fallback.sends == 1) != tt.wantFallback {
+				t.Errorf("sent through the fallback %d times, want %v", fallback.sends, tt.wantFallback)
+			}
+			if (err != nil) != tt.wantErr || email.IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("Send error = %v, permanent %v, want error %v, permanent %v", err, email.IsPermanent(err), tt.wantErr, tt.wantPermanent)
+			}
+			if tt.wantFallback && tt.fallbackErr != nil && !strings.Contains(err.Error(), tt.fallbackErr.Error()) {
+				t.Errorf("Send error = %v, want it to mention %v", err, tt.fallbackErr)
+			}
+		})
+	}
+}
+
+func TestLoadProviderFromEnvWithFallback(t *testing.T) {
+	t.Setenv("EMAIL_PROVIDER", "ses")
+	t.Setenv("AMAZON_SES_SMTP_HOST", "email-smtp.eu-west-1.amazonaws.com")
+	t.Setenv("EMAIL_FALLBACK_PROVIDER", "smtp")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+
+	p, stop, err := LoadProviderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if _, ok := p.(*Fallback); !ok {
+		t.Errorf("provider = %T, want a fallback", p)
+	}
+
+	t.Setenv("EMAIL_FALLBACK_PROVIDER", "pigeon")
+	if _, _, err := LoadProviderFromEnv(); err == nil {
+		t.Error("LoadProviderFromEnv with an unknown fallback = nil, want an error")
+	}
+}
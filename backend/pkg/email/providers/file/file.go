@@ -0,0 +1,48 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/wneessen/go-mail"
+)
+
+// Sink writes every email to an .eml file in a directory instead of sending it, so emails can be opened in a mail
+// client during development. The files are named by the time they were written, so they sort in order.
+type Sink struct {
+	dir string
+}
+
+func NewSink(dir string) (*Sink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("email directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create email directory: %w", err)
+	}
+	return &Sink{dir}, nil
+}
+
+func (s *Sink) Send(ctx context.Context, m *mail.Msg) error {
+	// The random suffix keeps emails written in the same instant apart
+	f, err := os.CreateTemp(s.dir, time.Now().UTC().Format("20060102T150405.000000000Z")+"-*.eml")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := m.WriteTo(f); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	log.Printf("EmailFileSink: Email to %v written to %s", m.GetToString(), f.Name())
+	return nil
+}
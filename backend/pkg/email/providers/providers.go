@@ -0,0 +1,119 @@
+package providers
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/amazonses"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/capture"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/console"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/file"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/smtp"
+)
+
+const DefaultFileDir = "emails"
+
+// LoadProviderFromEnv returns the provider selected by EMAIL_PROVIDER:
+//   - "ses" (default): Amazon SES, see amazonses.NewProvider
+//   - "smtp": any SMTP server, configured with SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_TLS and
+//     SMTP_AUTH, see smtp.LoadConfigFromEnv
+//   - "file": .eml files in EMAIL_FILE_DIR, which defaults to DefaultFileDir
+//   - "console": the log
+//   - "capture": the in-process capture server, listening for SMTP on EMAIL_CAPTURE_SMTP_ADDR and serving the
+//     captured emails on EMAIL_CAPTURE_HTTP_ADDR, see capture.Server
+//
+// EMAIL_FALLBACK_PROVIDER optionally selects another of them, e.g. "smtp" with "ses", which emails are sent through
+// when the provider fails temporarily, see Fallback.
+//
+// stop shuts down the capture server, it does nothing for the other providers.
+func LoadProviderFromEnv() (p email.Provider, stop func(), err error) {
+	p, stop, err = loadProvider(os.Getenv("EMAIL_PROVIDER"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fallbackName := os.Getenv("EMAIL_FALLBACK_PROVIDER")
+	if fallbackName == "" {
+		return p, stop, nil
+	}
+	fallback, stopFallback, err := loadProvider(fallbackName)
+	if err != nil {
+		stop()
+		return nil, nil, fmt.Errorf("EMAIL_FALLBACK_PROVIDER: %w", err)
+	}
+	stopPrimary := stop
+	return NewFallback(p, fallback), func() {
+		stopPrimary()
+		stopFallback()
+	}, nil
+}
+
+func loadProvider(name string) (p email.Provider, stop func(), err error) {
+	stop = func() {}
+
+	switch name = strings.ToLower(name); name {
+	case "", "ses":
+		p, err = amazonses.NewProvider()
+	case "smtp":
+		var config smtp.Config
+		if config, err = smtp.LoadConfigFromEnv("SMTP"); err == nil {
+			p, err = smtp.NewProvider(config)
+		}
+	case "file":
+		dir := os.Getenv("EMAIL_FILE_DIR")
+		if dir == "" {
+			dir = DefaultFileDir
+		}
+		p, err = file.NewSink(dir)
+	case "console":
+		p = console.NewLogger()
+	case "capture":
+		p, stop, err = startCapture()
+	default:
+		err = fmt.Errorf("unknown email provider: %s", name)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, stop, nil
+}
+
+// startCapture starts the capture server and returns an SMTP provider which sends to it
+func startCapture() (email.Provider, func(), error) {
+	smtpAddr := os.Getenv("EMAIL_CAPTURE_SMTP_ADDR")
+	if smtpAddr == "" {
+		smtpAddr = capture.DefaultSMTPAddr
+	}
+	httpAddr := os.Getenv("EMAIL_CAPTURE_HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = capture.DefaultHTTPAddr
+	}
+
+	addr, stop, err := capture.NewServer().Start(smtpAddr, httpAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start capture server: %w", err)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+
+	p, err := smtp.NewProvider(smtp.Config{Host: host, Port: portNumber, TLS: smtp.TLSNone, Timeout: smtp.DefaultTimeout})
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	return p, stop, nil
+}
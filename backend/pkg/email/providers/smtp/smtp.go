@@ -0,0 +1,117 @@
+package smtp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wneessen/go-mail"
+)
+
+const DefaultTimeout = 15 * time.Second
+
+// TLSMode is how the connection to the SMTP server is encrypted
+type TLSMode string
+
+const (
+	TLSStartTLS TLSMode = "starttls" // Upgraded with STARTTLS, which the server must support
+	TLSImplicit TLSMode = "tls"      // TLS from the start, usually on port 465
+	TLSNone     TLSMode = "none"     // Unencrypted, only for servers on the same host such as the capture server
+)
+
+// Config is the SMTP server emails are sent through. A username enables authentication.
+type Config struct {
+	Host     string
+	Port     int // Defaults to the usual port of the TLS mode
+	Username string
+	Password string
+	TLS      TLSMode
+	Auth     mail.SMTPAuthType
+	Timeout  time.Duration
+}
+
+// LoadConfigFromEnv reads the config from the environment variables with the prefix, e.g. SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_TLS ("starttls", "tls" or "none") and SMTP_AUTH ("plain" or "login")
+func LoadConfigFromEnv(prefix string) (Config, error) {
+	config := Config{
+		Host:     os.Getenv(prefix + "_HOST"),
+		Username: os.Getenv(prefix + "_USERNAME"),
+		Password: os.Getenv(prefix + "_PASSWORD"),
+		TLS:      TLSStartTLS,
+		Auth:     mail.SMTPAuthPlain,
+		Timeout:  DefaultTimeout,
+	}
+
+	if v := os.Getenv(prefix + "_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s_PORT: %s", prefix, v)
+		}
+		config.Port = port
+	}
+	if v := os.Getenv(prefix + "_TLS"); v != "" {
+		config.TLS = TLSMode(strings.ToLower(v))
+	}
+	switch v := strings.ToLower(os.Getenv(prefix + "_AUTH")); v {
+	case "", "plain":
+	case "login":
+		config.Auth = mail.SMTPAuthLogin
+	default:
+		return Config{}, fmt.Errorf("invalid %s_AUTH: %s", prefix, v)
+	}
+
+	return config, nil
+}
+
+// Provider sends emails through an SMTP server, with a connection per email
+type Provider struct {
+	client *mail.Client
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+
+	options := []mail.Option{}
+	defaultPort := 0
+	switch config.TLS {
+	case TLSStartTLS:
+		options = append(options, mail.WithTLSPolicy(mail.TLSMandatory))
+		defaultPort = 587
+	case TLSImplicit:
+		options = append(options, mail.WithSSL())
+		defaultPort = 465
+	case TLSNone:
+		options = append(options, mail.WithTLSPolicy(mail.NoTLS))
+		defaultPort = 25
+	default:
+		return nil, fmt.Errorf("invalid smtp tls mode: %q", config.TLS)
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	options = append(options, mail.WithPort(port))
+	if config.Timeout > 0 {
+		options = append(options, mail.WithTimeout(config.Timeout))
+	}
+	if config.Username != "" {
+		options = append(options, mail.WithSMTPAuth(config.Auth), mail.WithUsername(config.Username), mail.WithPassword(config.Password))
+	}
+
+	client, err := mail.NewClient(config.Host, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create smtp client: %w", err)
+	}
+	return &Provider{client}, nil
+}
+
+func (p *Provider) Send(ctx context.Context, m *mail.Msg) error {
+	return p.client.DialAndSendWithContext(ctx, m)
+}
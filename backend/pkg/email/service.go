@@ -1,39 +1,210 @@
 package email
 
 import (
-	ht "html/template"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/wneessen/go-mail"
 )
 
+const (
+	Retention = 30 * 24 * time.Hour // How long sent and dead-lettered emails are kept
+
+	// pollInterval is short, as the worker is woken up before the change which enqueued an email is committed and
+	// the email is only picked up on the next poll if the commit had not happened by then
+	pollInterval = 10 * time.Second
+	queryTimeout = 30 * time.Second // Bounds the queries of the worker outside of sending an email
+	// claimLease is how long a claimed email is hidden from other claims. An email whose worker was interrupted by a
+	// restart is retried after the lease, which must be longer than sending an email can take.
+	claimLease  = 5 * time.Minute
+	sendTimeout = 1 * time.Minute
+)
+
+// errInvalidRecipient is permanent, the email is dead-lettered without retrying it
+var errInvalidRecipient = errors.New("invalid recipient")
+
 type Service interface {
-	SendEmail(to string, subject string, body *ht.Template, data interface{}) error
+	// SendEmail renders the email from its template in the locale and puts it in the outbox, it is sent by the
+	// worker. Called with the context of a transaction, the email is only sent if the transaction commits.
+	SendEmail(ctx context.Context, to string, locale string, template string, data interface{}) error
+	// PreviewEmail renders the email from its template with sample data, so developers can check the templates
+	PreviewEmail(template string, locale string) (Email, error)
+	Start() (stop func())
+}
+
+type Repository interface {
+	EnqueueEmail(ctx context.Context, m Message) error
+	// ClaimEmail atomically claims the pending email which has been due the longest, hiding it from other claims for
+	// the lease. ErrNoPendingEmail is returned if no email is due.
+	ClaimEmail(ctx context.Context, now time.Time, lease time.Duration) (Message, error)
+	UpdateEmail(ctx context.Context, m Message) error
+	DeleteEmailsBefore(ctx context.Context, before time.Time) error
 }
 
 type service struct {
-	client *mail.Client
+	p      Provider
+	t      *Templates
 	sender string
+	r      Repository
+	notify chan struct{}
 }
 
 // NewService creates an adding service with the necessary dependencies
-func NewService(providerClient *mail.Client) Service {
+func NewService(p Provider, t *Templates, r Repository) Service {
 	sender := os.Getenv("SENDER_ADDRESS")
-	return &service{providerClient, sender}
+	return &service{p, t, sender, r, make(chan struct{}, 1)}
+}
+
+func (s *service) SendEmail(ctx context.Context, to string, locale string, template string, data interface{}) error {
+	e, err := s.t.Render(template, locale, data)
+	if err != nil {
+		log.Printf("EmailService: Error rendering %s email: %v", template, err)
+		return err
+	}
+
+	message, err := NewMessage(to, e)
+	if err != nil {
+		return err
+	}
+	if err := s.r.EnqueueEmail(ctx, *message); err != nil {
+		log.Printf("EmailService: Error queueing email to %s: %v", to, err)
+		return err
+	}
+	s.wakeWorker()
+
+	log.Printf("EmailService: Email to %s queued", to)
+	return nil
+}
+
+func (s *service) PreviewEmail(template string, locale string) (Email, error) {
+	return s.t.Preview(template, locale)
+}
+
+// Start runs the worker which sends queued emails and deletes old ones from the outbox, until stop is called
+func (s *service) Start() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		s.processEmails(done)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.deleteOldEmails()
+				s.processEmails(done)
+			case <-s.notify:
+				s.processEmails(done)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// wakeWorker wakes up the worker, unless it has already been woken up
+func (s *service) wakeWorker() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *service) deleteOldEmails() {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if err := s.r.DeleteEmailsBefore(ctx, time.Now().Add(-Retention)); err != nil {
+		log.Printf("EmailService: Error deleting old emails: %v", err)
+	}
 }
 
-func (s *service) SendEmail(to string, subject string, body *ht.Template, data interface{}) error {
+// processEmails sends the emails which are due, until there are none left or the worker is stopped
+func (s *service) processEmails(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		message, err := s.claimEmail()
+		if err != nil {
+			if !errors.Is(err, ErrNoPendingEmail) {
+				log.Printf("EmailService: Error claiming email: %v", err)
+			}
+			return
+		}
+		s.runEmail(message)
+	}
+}
+
+func (s *service) claimEmail() (Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	return s.r.ClaimEmail(ctx, time.Now(), claimLease)
+}
+
+func (s *service) runEmail(message Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	s.attempt(ctx, &message)
+
+	// The outcome is stored with a deadline of its own, as sending may have run out of time
+	updateCtx, cancelUpdate := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancelUpdate()
+	if err := s.r.UpdateEmail(updateCtx, message); err != nil {
+		log.Printf("EmailService: Error storing outcome of email {%s}: %v", message.MessageId, err)
+	}
+}
+
+// attempt sends the email and records the outcome on it. An email which failed temporarily is scheduled for a retry
+// with exponential backoff, until it runs out of attempts. An email the provider rejected permanently, e.g. for an
+// address which does not exist, is dead-lettered right away.
+func (s *service) attempt(ctx context.Context, message *Message) {
+	message.LastAttemptAt = time.Now()
+	err := s.deliver(ctx, *message)
+	if err == nil {
+		message.Status = StatusSent
+		message.SentAt = message.LastAttemptAt
+		message.HTMLBody = ""
+		message.TextBody = ""
+		message.LastError = ""
+		log.Printf("EmailService: Email {%s} sent to %s", message.MessageId, message.To)
+		return
+	}
+	message.LastError = err.Error()
+
+	if IsPermanent(err) || message.Attempts >= MaxAttempts {
+		message.Status = StatusDead
+		log.Printf("EmailService: Email {%s} to %s dead-lettered after %d attempt(s): %s", message.MessageId, message.To, message.Attempts, message.LastError)
+		return
+	}
+	message.NextAttemptAt = time.Now().Add(backoff(message.Attempts))
+}
+
+func (s *service) deliver(ctx context.Context, message Message) error {
 	m := mail.NewMsg()
 	if err := m.From(s.sender); err != nil {
-		log.Printf("Error with From: %v", err)
+		return err
+	}
+	if err := m.To(message.To); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidRecipient, err)
 	}
-	if err := m.To(to); err != nil {
-		log.Printf("Error with To: %v", err)
+	m.Subject(message.Subject)
+	// Emails queued before plain text bodies were rendered only have the HTML body
+	if message.TextBody == "" {
+		m.SetBodyString(mail.TypeTextHTML, message.HTMLBody)
+	} else {
+		m.SetBodyString(mail.TypeTextPlain, message.TextBody)
+		m.AddAlternativeString(mail.TypeTextHTML, message.HTMLBody)
 	}
-	m.Subject(subject)
-	m.SetBodyHTMLTemplate(body, data)
 
-	log.Printf("EmailService: About to send email to %s", to) // ! Debug
-	return s.client.DialAndSend(m)
+	return s.p.Send(ctx, m)
 }
@@ -0,0 +1,311 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-mail"
+)
+
+// fakeRepository is an outbox in memory, which claims emails like the mongo repository
+type fakeRepository struct {
+	mu       sync.Mutex
+	nextId   int
+	messages []*Message
+}
+
+func (r *fakeRepository) EnqueueEmail(ctx context.Context, m Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextId++
+	m.MessageId = fmt.Sprintf("%024x", r.nextId)
+	r.messages = append(r.messages, &m)
+	return nil
+}
+
+func (r *fakeRepository) ClaimEmail(ctx context.Context, now time.Time, lease time.Duration) (Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due *Message
+	for _, m := range r.messages {
+		if m.Status == StatusPending && !m.NextAttemptAt.After(now) && (due == nil || m.NextAttemptAt.Before(due.NextAttemptAt)) {
+			due = m
+		}
+	}
+	if due == nil {
+		return Message{}, ErrNoPendingEmail
+	}
+	due.NextAttemptAt = now.Add(lease)
+	due.Attempts++
+	return *due, nil
+}
+
+func (r *fakeRepository) UpdateEmail(ctx context.Context, m Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.messages {
+		if stored.MessageId == m.MessageId {
+			// Like the mongo repository, the attempts are only counted by the claim
+			m.Attempts = stored.Attempts
+			*stored = m
+			return nil
+		}
+	}
+	return errors.New("email not found")
+}
+
+func (r *fakeRepository) DeleteEmailsBefore(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+// advance moves the outbox forward in time, making the emails which are due by then due now
+func (r *fakeRepository) advance(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.messages {
+		m.NextAttemptAt = m.NextAttemptAt.Add(-d)
+	}
+}
+
+func (r *fakeRepository) message(t *testing.T) Message {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.messages) != 1 {
+		t.Fatalf("%d emails in the outbox, want 1", len(r.messages))
+	}
+	return *r.messages[0]
+}
+
+var errConnectionRefused = errors.New("dial tcp: connection refused")
+
+// fakeProvider fails the first failures emails it is given with err, then delivers them
+type fakeProvider struct {
+	mu        sync.Mutex
+	failures  int
+	err       error
+	attempts  int
+	delivered []*mail.Msg
+}
+
+func (p *fakeProvider) Send(ctx context.Context, m *mail.Msg) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempts++
+	if p.attempts <= p.failures {
+		return p.err
+	}
+	p.delivered = append(p.delivered, m)
+	return nil
+}
+
+var neverDone = make(chan struct{})
+
+func newTestService(t *testing.T, p Provider) (*service, *fakeRepository) {
+	t.Helper()
+	templates, err := DefaultTemplates(PreviewConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRepository{}
+	return &service{p, templates, "SwearJar <noreply@example.com>", r, make(chan struct{}, 1)}, r
+}
+
+// enqueue puts an email to alex in the outbox
+func enqueue(t *testing.T, s *service) {
+	t.Helper()
+	message, err := NewMessage("alex@example.com", Email{Subject: "Verify your email", HTML: "<p>Hi Alex</p>", Text: "Hi Alex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.r.EnqueueEmail(context.Background(), *message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertRetryScheduled checks the email is pending after the attempts, due within the backoff of the last attempt
+func assertRetryScheduled(t *testing.T, m Message, attempts int, attemptedAt time.Time) {
+	t.Helper()
+	delay := min(backoffBase<<(attempts-1), backoffMax)
+	earliest, latest := attemptedAt.Add(delay/2), time.Now().Add(delay)
+	if m.Status != StatusPending || m.Attempts != attempts {
+		t.Errorf("after attempt %d: Status = %s, Attempts = %d, want %s, %d", attempts, m.Status, m.Attempts, StatusPending, attempts)
+	}
+	if m.NextAttemptAt.Before(earliest) || m.NextAttemptAt.After(latest) {
+		t.Errorf("after attempt %d: NextAttemptAt = %v, want between %v and %v", attempts, m.NextAttemptAt, earliest, latest)
+	}
+	if m.LastError != errConnectionRefused.Error() {
+		t.Errorf("after attempt %d: LastError = %q, want %q", attempts, m.LastError, errConnectionRefused)
+	}
+}
+
+func TestSendEmailQueuesRenderedEmail(t *testing.T) {
+	p := &fakeProvider{}
+	s, r := newTestService(t, p)
+
+	err := s.SendEmail(context.Background(), "alex@example.com", "en", TemplateVerifyEmail, struct {
+		Name             string
+		VerificationLink string
+	}{"Alex", "http://localhost:3000/auth/email/verify?token=token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The email is only queued, the worker sends it
+	m := r.message(t)
+	if m.Status != StatusPending || m.Attempts != 0 || m.Subject == "" || m.HTMLBody == "" || m.TextBody == "" || len(p.delivered) != 0 {
+		t.Errorf("queued %+v, want a pending email with the rendered bodies", m)
+	}
+	select {
+	case <-s.notify:
+	default:
+		t.Error("the worker was not woken up")
+	}
+}
+
+func TestEmailIsRetriedWithBackoff(t *testing.T) {
+	p := &fakeProvider{failures: 3, err: errConnectionRefused}
+	s, r := newTestService(t, p)
+	enqueue(t, s)
+
+	for attempts := 1; attempts <= 3; attempts++ {
+		attemptedAt := time.Now()
+		s.processEmails(neverDone)
+		assertRetryScheduled(t, r.message(t), attempts, attemptedAt)
+
+		// The email is not retried before its backoff has passed
+		s.processEmails(neverDone)
+		if p.attempts != attempts {
+			t.Fatalf("sent %d times after %d attempts, want the retry to wait", p.attempts, attempts)
+		}
+		r.advance(backoffMax)
+	}
+
+	s.processEmails(neverDone)
+	m := r.message(t)
+	if m.Status != StatusSent || m.Attempts != 4 || m.SentAt.IsZero() || m.LastError != "" {
+		t.Errorf("Status = %s, Attempts = %d, SentAt = %v, LastError = %q, want sent on attempt 4", m.Status, m.Attempts, m.SentAt, m.LastError)
+	}
+	// The bodies may hold one-time links, they are not kept once sent
+	if m.HTMLBody != "" || m.TextBody != "" {
+		t.Errorf("bodies = %q, %q, want them cleared", m.HTMLBody, m.TextBody)
+	}
+	if len(p.delivered) != 1 {
+		t.Errorf("%d emails delivered, want 1", len(p.delivered))
+	}
+}
+
+func TestEmailIsDeadLetteredAfterMaxAttempts(t *testing.T) {
+	p := &fakeProvider{failures: MaxAttempts + 1, err: errConnectionRefused}
+	s, r := newTestService(t, p)
+	enqueue(t, s)
+
+	for attempts := 1; attempts < MaxAttempts; attempts++ {
+		attemptedAt := time.Now()
+		s.processEmails(neverDone)
+		assertRetryScheduled(t, r.message(t), attempts, attemptedAt)
+		r.advance(backoffMax)
+	}
+
+	s.processEmails(neverDone)
+	m := r.message(t)
+	if m.Status != StatusDead || m.Attempts != MaxAttempts || m.LastError != errConnectionRefused.Error() {
+		t.Errorf("Status = %s, Attempts = %d, LastError = %q, want dead-lettered after %d attempts", m.Status, m.Attempts, m.LastError, MaxAttempts)
+	}
+
+	// A dead-lettered email is not claimed again
+	r.advance(backoffMax)
+	s.processEmails(neverDone)
+	if p.attempts != MaxAttempts {
+		t.Errorf("sent %d times, want %d", p.attempts, MaxAttempts)
+	}
+}
+
+func TestEmailRejectedPermanentlyIsDeadLettered(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		to   string
+	}{
+		{"rejected recipient", &mail.SendError{Reason: mail.ErrSMTPRcptTo}, "alex@example.com"},
+		{"invalid address", nil, "not an address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{failures: 1, err: tt.err}
+			s, r := newTestService(t, p)
+			message, err := NewMessage(tt.to, Email{Subject: "Verify your email", HTML: "<p>Hi Alex</p>"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.EnqueueEmail(context.Background(), *message); err != nil {
+				t.Fatal(err)
+			}
+
+			s.processEmails(neverDone)
+
+			m := r.message(t)
+			if m.Status != StatusDead || m.Attempts != 1 || m.LastError == "" {
+				t.Errorf("Status = %s, Attempts = %d, LastError = %q, want dead-lettered on the first attempt", m.Status, m.Attempts, m.LastError)
+			}
+		})
+	}
+}
+
+func TestEmailOfCrashedWorkerIsRetriedAfterLease(t *testing.T) {
+	p := &fakeProvider{}
+	s, r := newTestService(t, p)
+	enqueue(t, s)
+
+	// * 1. A worker claims the email and is killed before storing the outcome
+	claimedAt := time.Now()
+	if _, err := r.ClaimEmail(context.Background(), claimedAt, claimLease); err != nil {
+		t.Fatal(err)
+	}
+
+	// * 2. The email is hidden from other workers during the lease
+	s.processEmails(neverDone)
+	m := r.message(t)
+	if p.attempts != 0 || m.Status != StatusPending || m.Attempts != 1 || !m.NextAttemptAt.Equal(claimedAt.Add(claimLease)) {
+		t.Errorf("during the lease: sent %d times, Status = %s, Attempts = %d, NextAttemptAt = %v, want it left claimed", p.attempts, m.Status, m.Attempts, m.NextAttemptAt)
+	}
+	r.advance(claimLease - time.Minute)
+	s.processEmails(neverDone)
+	if p.attempts != 0 {
+		t.Errorf("sent %d times before the lease expired, want 0", p.attempts)
+	}
+
+	// * 3. Once the lease expires, it is claimed again and the interrupted attempt counts
+	r.advance(time.Minute)
+	s.processEmails(neverDone)
+	m = r.message(t)
+	if p.attempts != 1 || m.Status != StatusSent || m.Attempts != 2 {
+		t.Errorf("after the lease: sent %d times, Status = %s, Attempts = %d, want sent on attempt 2", p.attempts, m.Status, m.Attempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{9, 2 * time.Hour},
+		{40, 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			// The delay is jittered down to half, so emails which failed together are not retried together
+			if got := backoff(tt.attempts); got < tt.delay/2 || got >= tt.delay {
+				t.Fatalf("backoff(%d) = %v, want in [%v, %v)", tt.attempts, got, tt.delay/2, tt.delay)
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	ht "html/template"
+	"io/fs"
+	"strings"
+	tt "text/template"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+const DefaultLocale = "en"
+
+var ErrTemplateNotFound = apperror.NotFound("email_template_not_found", "email template not found")
+
+// Locales are the locales emails are translated to, each has a catalog in templates/locales
+var Locales = []string{"en", "de"}
+
+// The emails, each has a template of both formats in templates/emails
+const (
+	TemplateVerifyEmail        = "verify_email"
+	TemplateResetPassword      = "reset_password"
+	TemplateMagicLogin         = "magic_login"
+	TemplateConfirmEmailChange = "confirm_email_change"
+	TemplateEmailChanged       = "email_changed"
+	TemplateDataExport         = "data_export"
+	TemplateDigest             = "digest"
+	TemplateNotification       = "notification"
+)
+
+var TemplateNames = []string{
+	TemplateVerifyEmail,
+	TemplateResetPassword,
+	TemplateMagicLogin,
+	TemplateConfirmEmailChange,
+	TemplateEmailChanged,
+	TemplateDataExport,
+	TemplateDigest,
+	TemplateNotification,
+}
+
+// Email is a rendered email, with an HTML body and its plain text alternative
+type Email struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Templates renders emails from template files:
+//   - layouts/base.html and layouts/base.txt define the "layout" the body of every email is rendered in
+//   - partials/*.html and partials/*.txt define the blocks shared by the emails of their format
+//   - emails/<name>.html and emails/<name>.txt define the "content" of the email, the text template also defines
+//     its "subject"
+//   - locales/<locale>.json map the message keys used in the templates to their text, as fmt formats
+//
+// The templates translate text with {{t "key" args...}}, which falls back to DefaultLocale for keys a locale has
+// not translated yet. {{datetime .Time}} formats a time in UTC, {{datetimeIn .Time .Location}} in the timezone of the
+// user, and {{abs .Int}} drops the sign of a number.
+type Templates struct {
+	html     map[string]*ht.Template
+	text     map[string]*tt.Template
+	catalogs map[string]map[string]string
+	preview  PreviewConfig
+}
+
+// LoadTemplates parses the templates of TemplateNames from fsys, which is laid out as described on Templates
+func LoadTemplates(fsys fs.FS, preview PreviewConfig) (*Templates, error) {
+	t := &Templates{
+		html:     map[string]*ht.Template{},
+		text:     map[string]*tt.Template{},
+		catalogs: map[string]map[string]string{},
+		preview:  preview,
+	}
+
+	for _, locale := range Locales {
+		b, err := fs.ReadFile(fsys, "locales/"+locale+".json")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog of locale %s: %w", locale, err)
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(b, &catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse catalog of locale %s: %w", locale, err)
+		}
+		t.catalogs[locale] = catalog
+	}
+
+	// The funcs are replaced with those of the locale when an email is rendered
+	funcs := t.funcs(DefaultLocale)
+	htmlBase, err := ht.New("base").Funcs(ht.FuncMap(funcs)).ParseFS(fsys, "layouts/*.html", "partials/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html layouts: %w", err)
+	}
+	textBase, err := tt.New("base").Funcs(tt.FuncMap(funcs)).ParseFS(fsys, "layouts/*.txt", "partials/*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse text layouts: %w", err)
+	}
+
+	for _, name := range TemplateNames {
+		htmlTemplate, err := ht.Must(htmlBase.Clone()).ParseFS(fsys, "emails/"+name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse html template %s: %w", name, err)
+		}
+		textTemplate, err := tt.Must(textBase.Clone()).ParseFS(fsys, "emails/"+name+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse text template %s: %w", name, err)
+		}
+		if htmlTemplate.Lookup("content") == nil || textTemplate.Lookup("content") == nil || textTemplate.Lookup("subject") == nil {
+			return nil, fmt.Errorf("template %s must define the content of both formats and the subject", name)
+		}
+		t.html[name] = htmlTemplate
+		t.text[name] = textTemplate
+	}
+
+	// Rendering the previews checks the templates against the catalogs, e.g. for messages which are missing
+	for _, name := range TemplateNames {
+		for _, locale := range Locales {
+			if _, err := t.Preview(name, locale); err != nil {
+				return nil, fmt.Errorf("failed to render template %s in locale %s: %w", name, locale, err)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// DefaultTemplates loads the templates embedded in the binary
+func DefaultTemplates(preview PreviewConfig) (*Templates, error) {
+	fsys, err := fs.Sub(templateFiles, "templates")
+	if err != nil {
+		return nil, err
+	}
+	return LoadTemplates(fsys, preview)
+}
+
+// Render renders the email in the locale, or in DefaultLocale if the locale is not supported
+func (t *Templates) Render(name string, locale string, data interface{}) (Email, error) {
+	htmlTemplate, ok := t.html[name]
+	if !ok {
+		return Email{}, ErrTemplateNotFound
+	}
+	if _, ok := t.catalogs[locale]; !ok {
+		locale = DefaultLocale
+	}
+	funcs := t.funcs(locale)
+
+	htmlTemplate, err := htmlTemplate.Clone()
+	if err != nil {
+		return Email{}, err
+	}
+	var htmlBody bytes.Buffer
+	if err := htmlTemplate.Funcs(ht.FuncMap(funcs)).ExecuteTemplate(&htmlBody, "layout", data); err != nil {
+		return Email{}, err
+	}
+
+	textTemplate, err := t.text[name].Clone()
+	if err != nil {
+		return Email{}, err
+	}
+	textTemplate.Funcs(tt.FuncMap(funcs))
+	var subject, textBody bytes.Buffer
+	if err := textTemplate.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Email{}, err
+	}
+	if err := textTemplate.ExecuteTemplate(&textBody, "layout", data); err != nil {
+		return Email{}, err
+	}
+
+	return Email{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    htmlBody.String(),
+		Text:    textBody.String(),
+	}, nil
+}
+
+func (t *Templates) funcs(locale string) map[string]interface{} {
+	translate := func(key string, args ...interface{}) (string, error) {
+		format, ok := t.catalogs[locale][key]
+		if !ok {
+			format, ok = t.catalogs[DefaultLocale][key]
+		}
+		if !ok {
+			return "", fmt.Errorf("missing message %s", key)
+		}
+		if len(args) == 0 {
+			return format, nil
+		}
+		return fmt.Sprintf(format, args...), nil
+	}
+
+	datetimeIn := func(tm time.Time, loc *time.Location) (string, error) {
+		layout, err := translate("format.datetime")
+		if err != nil {
+			return "", err
+		}
+		return tm.In(loc).Format(layout), nil
+	}
+
+	return map[string]interface{}{
+		"t":      translate,
+		"locale": func() string { return locale },
+		"datetime": func(tm time.Time) (string, error) {
+			return datetimeIn(tm, time.UTC)
+		},
+		"datetimeIn": datetimeIn,
+		"abs": func(i int) int {
+			if i < 0 {
+				return -i
+			}
+			return i
+		},
+	}
+}
+
+// MatchLocale returns the first supported locale of an Accept-Language header or a single language tag such as
+// "de-AT", matching on the language. An empty string is returned if none is supported.
+func MatchLocale(accept string) string {
+	for _, tag := range strings.Split(accept, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		language, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+		language = strings.ToLower(language)
+		for _, locale := range Locales {
+			if language == locale {
+				return locale
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestDatetimeInFormatsInTheTimezone(t *testing.T) {
+	templates, err := DefaultTemplates(PreviewConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextSendAt := time.Date(2026, 11, 2, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"en", "2 Nov 2026 09:00 CET"},
+		{"de", "02.11.2026 09:00 CET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			e, err := templates.Render(TemplateDigest, tt.locale, map[string]interface{}{
+				"Name":            "Alex",
+				"Frequency":       "weekly",
+				"NextSendAt":      nextSendAt,
+				"Location":        berlin,
+				"UnsubscribeLink": "http://localhost:3000/digest/unsubscribe?token=token",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(e.Text, tt.want) || !strings.Contains(e.HTML, tt.want) {
+				t.Errorf("Render(%s) = %q, want the next digest at %s", TemplateDigest, e.Text, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/notification"
+)
+
+const readme = `SwearJar personal data export
+
+profile.json        Your account, including linked sign-in providers and passkeys
+swear_jars.json     Swear jars you are an owner of (also as swear_jars.csv)
+swears.json         Swears you made or reported (also as swears.csv)
+auth_tokens.json    Verification, password reset and login links sent to you
+api_tokens.json     Personal access tokens you created
+oauth_clients.json  OAuth applications you registered
+chat_accounts.json  Discord and Telegram accounts linked to your account
+digest.json         Your digest email schedule, timezone and when it was last sent
+notifications.json  Your notifications, notification preferences and notification webhook
+audit_events.json   Security events of your account, such as logins and password changes
+
+Sessions are not stored by SwearJar, so there is no session history to export.
+Secrets such as your password, token values, client secrets and webhook signing secrets are never included.
+`
+
+// notifications is the content of notifications.json
+type notifications struct {
+	Notifications []notification.Notification
+	Preferences   []notification.Preference
+	Webhook       *notification.WebhookEndpoint // The URL and when it was set, which is when its secret was created
+}
+
+// buildArchive writes the data as JSON files, and the tabular data additionally as CSV files, into a ZIP archive
+func buildArchive(data Data, exportedAt time.Time) ([]byte, error) {
+	// Token hashes are secrets of the server, not personal data
+	for i := range data.AuthTokens {
+		data.AuthTokens[i].Token = ""
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"profile.json", data.Profile},
+		{"swear_jars.json", data.SwearJars},
+		{"swears.json", data.Swears},
+		{"auth_tokens.json", data.AuthTokens},
+		{"api_tokens.json", data.APITokens},
+		{"oauth_clients.json", data.OAuthClients},
+		{"chat_accounts.json", data.ChatAccounts},
+		{"digest.json", data.DigestSubscription},
+		{"notifications.json", notifications{data.Notifications, data.NotificationPreferences, data.NotificationWebhook}},
+		{"audit_events.json", data.AuditEvents},
+	}
+	for _, f := range files {
+		content, err := json.MarshalIndent(f.v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFile(zw, f.name, content, exportedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	swearJarNames := map[string]string{}
+	swearJarRows := [][]string{{"SwearJarId", "Name", "Desc", "Owners", "CreatedAt", "CreatedBy"}}
+	for _, sj := range data.SwearJars {
+		swearJarNames[sj.SwearJarId] = sj.Name
+		swearJarRows = append(swearJarRows, []string{
+			sj.SwearJarId,
+			sj.Name,
+			sj.Desc,
+			strings.Join(sj.Owners, ";"),
+			sj.CreatedAt.UTC().Format(time.RFC3339),
+			sj.CreatedBy,
+		})
+	}
+	if err := writeCSV(zw, "swear_jars.csv", swearJarRows, exportedAt); err != nil {
+		return nil, err
+	}
+
+	swearRows := [][]string{{"CreatedAt", "SwearJarId", "SwearJarName", "UserId", "ReportedBy", "Active", "SwearDescription"}}
+	for _, s := range data.Swears {
+		swearRows = append(swearRows, []string{
+			s.CreatedAt.UTC().Format(time.RFC3339),
+			s.SwearJarId,
+			swearJarNames[s.SwearJarId],
+			s.UserId,
+			s.ReportedBy,
+			strconv.FormatBool(s.Active),
+			s.SwearDescription,
+		})
+	}
+	if err := writeCSV(zw, "swears.csv", swearRows, exportedAt); err != nil {
+		return nil, err
+	}
+
+	if err := writeFile(zw, "README.txt", []byte(readme), exportedAt); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeFile(zw *zip.Writer, name string, content []byte, modified time.Time) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func writeCSV(zw *zip.Writer, name string, rows [][]string, modified time.Time) error {
+	buf := new(bytes.Buffer)
+	cw := csv.NewWriter(buf)
+	for _, row := range rows {
+		for i := range row {
+			row[i] = escapeFormula(row[i])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return writeFile(zw, name, buf.Bytes(), modified)
+}
+
+// escapeFormula prevents spreadsheet applications from evaluating values written by other users as formulas
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,37 @@
+package export
+
+import (
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oauth"
+	"github.com/mikeytheong/swearjar/backend/pkg/digest"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/notification"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+// Profile is the stored user without the password hash
+type Profile struct {
+	UserId     string `bson:"_id"`
+	Email      string
+	Name       string
+	Verified   bool
+	Identities []authentication.ExternalIdentity
+	Passkeys   []authentication.Passkey
+}
+
+// Data is everything stored about a user
+type Data struct {
+	Profile                 Profile
+	SwearJars               []swearJar.SwearJarBase    // Swear jars the user is an owner of
+	Swears                  []swearJar.Swear           // Swears the user made or reported
+	AuthTokens              []authentication.AuthToken // Email verification, password reset and login links sent to the user
+	APITokens               []authentication.APIToken
+	OAuthClients            []oauth.Client
+	ChatAccounts            []integration.AccountLink   // Chat accounts linked to the user
+	DigestSubscription      *digest.Subscription        // Schedule of the digest emails, nil if the user is not subscribed
+	Notifications           []notification.Notification // Notifications of the inbox, most recent first
+	NotificationPreferences []notification.Preference
+	NotificationWebhook     *notification.WebhookEndpoint // Without its signing secret, nil if the user has not set one
+	AuditEvents             []audit.Event                 // Security events of the account, most recent first
+}
@@ -0,0 +1,91 @@
+package export
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "Pending"
+	StatusRunning   Status = "Running"
+	StatusCompleted Status = "Completed"
+	StatusFailed    Status = "Failed"
+)
+
+// Job is a request to export the personal data of a user. The archive is kept until the download link expires.
+type Job struct {
+	JobId       string    `bson:"_id,omitempty"`
+	UserId      string    `bson:"UserId"`
+	Status      Status    `bson:"Status"`
+	CreatedAt   time.Time `bson:"CreatedAt"`
+	StartedAt   time.Time `bson:"StartedAt"`
+	CompletedAt time.Time `bson:"CompletedAt"`
+	ExpiresAt   time.Time `bson:"ExpiresAt"`
+	Error       string    `bson:"Error,omitempty"`
+
+	Token     string `bson:"Token" json:"-"`               // Hash of the download token sent by email
+	ArchiveId string `bson:"ArchiveId,omitempty" json:"-"` // GridFS file of the ZIP archive
+}
+
+func (j *Job) Validate() error {
+	if j.UserId == "" {
+		return errors.New("user id is required")
+	}
+	switch j.Status {
+	case StatusPending, StatusRunning, StatusCompleted, StatusFailed:
+	default:
+		return errors.New("invalid status")
+	}
+	return nil
+}
+
+func (j *Job) InProgress() bool {
+	return j.Status == StatusPending || j.Status == StatusRunning
+}
+
+func (j *Job) IsExpired() bool {
+	return !j.ExpiresAt.IsZero() && time.Now().After(j.ExpiresAt)
+}
+
+// VerifyToken checks the raw download token against the stored hash
+func (j *Job) VerifyToken(rawToken string) bool {
+	if j.Token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(j.Token), []byte(hashToken(rawToken))) == 1
+}
+
+func NewJob(userId string) (*Job, error) {
+	job := &Job{
+		UserId:    userId,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+
+	if err := job.Validate(); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func generateToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
@@ -0,0 +1,252 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+)
+
+const (
+	DownloadLinkDuration = 48 * time.Hour
+
+	pollInterval = 1 * time.Minute
+	staleAfter   = 30 * time.Minute // Running jobs older than this were interrupted by a restart and are retried
+	jobTimeout   = 10 * time.Minute // Must be shorter than staleAfter, so a job is not retried while it is still running
+	queryTimeout = 30 * time.Second // Bounds the queries of the worker outside of a job
+)
+
+var ErrExportInProgress = apperror.Conflict("export_in_progress", "an export is already in progress")
+var ErrInvalidLink = apperror.NotFound("invalid_download_link", "invalid or expired download link")
+
+type Service interface {
+	RequestExport(ctx context.Context, userId string) (Job, error)
+	GetExportJobs(ctx context.Context, userId string) ([]Job, error)
+	Download(ctx context.Context, jobId string, token string) (archive io.ReadCloser, size int64, err error)
+	Start() (stop func())
+}
+
+type Repository interface {
+	CreateExportJob(ctx context.Context, j Job) (Job, error)
+	GetExportJob(ctx context.Context, jobId string) (Job, error)
+	GetExportJobsByUserId(ctx context.Context, userId string) ([]Job, error)
+	ClaimExportJob(ctx context.Context, staleBefore time.Time) (Job, error)
+	CompleteExportJob(ctx context.Context, jobId string, archive []byte, hashedToken string, expiresAt time.Time) error
+	GetExportArchive(ctx context.Context, archiveId string) (io.ReadCloser, int64, error)
+	FailExportJob(ctx context.Context, jobId string, reason string) error
+	DeleteExpiredExportJobs(ctx context.Context, now time.Time) error
+	GetExportData(ctx context.Context, userId string) (Data, error)
+	GetUserById(ctx context.Context, userId string) (authentication.UserResponse, error)
+}
+
+type service struct {
+	r      Repository
+	e      email.Service
+	a      audit.Logger
+	notify chan struct{}
+}
+
+func NewService(r Repository, e email.Service, a audit.Logger) Service {
+	return &service{r, e, a, make(chan struct{}, 1)}
+}
+
+// RequestExport queues an export of the user's data. The download link is emailed once the archive is ready.
+func (s *service) RequestExport(ctx context.Context, userId string) (Job, error) {
+	jobs, err := s.r.GetExportJobsByUserId(ctx, userId)
+	if err != nil {
+		return Job{}, err
+	}
+	for _, job := range jobs {
+		if job.InProgress() {
+			return Job{}, ErrExportInProgress
+		}
+	}
+
+	job, err := NewJob(userId)
+	if err != nil {
+		return Job{}, err
+	}
+	created, err := s.r.CreateExportJob(ctx, *job)
+	if err != nil {
+		log.Printf("ExportService: Error storing export job in db: %v", err)
+		return Job{}, err
+	}
+
+	// Wake up the worker, unless it has already been woken up
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     audit.ActionDataExportRequested,
+		TargetType: audit.TargetDataExport,
+		TargetId:   created.JobId,
+	})
+	log.Printf("ExportService: Export job {%s} queued for user {%s}", created.JobId, userId)
+	return created, nil
+}
+
+func (s *service) GetExportJobs(ctx context.Context, userId string) ([]Job, error) {
+	return s.r.GetExportJobsByUserId(ctx, userId)
+}
+
+// Download opens the archive of a completed job if the token from the emailed link is valid. The caller must close
+// the archive.
+func (s *service) Download(ctx context.Context, jobId string, token string) (io.ReadCloser, int64, error) {
+	job, err := s.r.GetExportJob(ctx, jobId)
+	if err != nil {
+		if !errors.Is(err, authentication.ErrNoDocuments) {
+			log.Printf("ExportService: Error fetching export job {%s}: %v", jobId, err)
+		}
+		return nil, 0, ErrInvalidLink
+	}
+
+	if job.Status != StatusCompleted || job.IsExpired() || !job.VerifyToken(token) || job.ArchiveId == "" {
+		return nil, 0, ErrInvalidLink
+	}
+
+	archive, size, err := s.r.GetExportArchive(ctx, job.ArchiveId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return nil, 0, ErrInvalidLink
+		}
+		log.Printf("ExportService: Error opening archive of export job {%s}: %v", jobId, err)
+		return nil, 0, err
+	}
+
+	// The link is not tied to a session, so the download is attributed to the owner of the export
+	s.a.Log(ctx, audit.Event{
+		ActorId:    job.UserId,
+		Action:     audit.ActionDataExportDownloaded,
+		TargetType: audit.TargetDataExport,
+		TargetId:   job.JobId,
+	})
+	return archive, size, nil
+}
+
+// Start runs the worker which builds queued exports and deletes expired archives, until stop is called
+func (s *service) Start() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		s.processJobs()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.deleteExpiredJobs()
+				s.processJobs()
+			case <-s.notify:
+				s.processJobs()
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (s *service) deleteExpiredJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if err := s.r.DeleteExpiredExportJobs(ctx, time.Now()); err != nil {
+		log.Printf("ExportService: Error deleting expired export jobs: %v", err)
+	}
+}
+
+func (s *service) processJobs() {
+	for {
+		job, err := s.claimJob()
+		if err != nil {
+			if !errors.Is(err, authentication.ErrNoDocuments) {
+				log.Printf("ExportService: Error claiming export job: %v", err)
+			}
+			return
+		}
+
+		if err := s.runJob(job); err != nil {
+			log.Printf("ExportService: Export job {%s} failed: %v", job.JobId, err)
+			s.failJob(job, err)
+		}
+	}
+}
+
+func (s *service) claimJob() (Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	return s.r.ClaimExportJob(ctx, time.Now().Add(-staleAfter))
+}
+
+func (s *service) runJob(job Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	return s.processJob(ctx, job)
+}
+
+// failJob marks the job as failed with a deadline of its own, as the job may have failed by running out of time
+func (s *service) failJob(job Job, jobErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if err := s.r.FailExportJob(ctx, job.JobId, jobErr.Error()); err != nil {
+		log.Printf("ExportService: Error marking export job {%s} as failed: %v", job.JobId, err)
+	}
+}
+
+func (s *service) processJob(ctx context.Context, job Job) error {
+	user, err := s.r.GetUserById(ctx, job.UserId)
+	if err != nil {
+		return err
+	}
+
+	// * 1. Collect the data and build the archive
+	exportData, err := s.r.GetExportData(ctx, job.UserId)
+	if err != nil {
+		return err
+	}
+	archive, err := buildArchive(exportData, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// * 2. Store the archive with the hash of the download token
+	rawToken, err := generateToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(DownloadLinkDuration)
+	if err := s.r.CompleteExportJob(ctx, job.JobId, archive, hashToken(rawToken), expiresAt); err != nil {
+		return err
+	}
+
+	// * 3. Send email with download link
+	data := struct {
+		Name         string
+		DownloadLink string
+		ExpiresAt    time.Time
+	}{
+		Name:         user.Name,
+		DownloadLink: os.Getenv("BACKEND_URL") + "/export/" + job.JobId + "/download?token=" + rawToken,
+		ExpiresAt:    expiresAt,
+	}
+
+	// The download token is only ever sent by email, so the job fails if the email cannot be sent
+	if err := s.e.SendEmail(ctx, user.Email, user.Locale, email.TemplateDataExport, data); err != nil {
+		return err
+	}
+
+	log.Printf("ExportService: Export job {%s} completed for user {%s}", job.JobId, job.UserId)
+	return nil
+}
@@ -0,0 +1,198 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+)
+
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"CurrentPassword"`
+		NewPassword     string `json:"NewPassword"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.authService.ChangePassword(r.Context(), userId, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		log.Printf("Error changing password: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]string{"msg": "Password changed successfully"}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Email      string                           `json:"Email"`
+		Password   string                           `json:"Password"`
+		Credential *webauthn.AuthenticationResponse `json:"Credential"` // Passkey assertion of accounts without a password
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.authService.RequestEmailChange(r.Context(), userId, authentication.Reauthentication{Password: req.Password, Passkey: req.Credential}, req.Email)
+	if err != nil {
+		log.Printf("Error requesting email change: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]string{"msg": "A confirmation link has been sent to the new email"}
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Token == "" {
+		RespondWithError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	err = h.authService.ConfirmEmailChange(r.Context(), req.Token)
+	if err != nil {
+		log.Printf("Error confirming email change: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// The jwt still carries the old email; the frontend refreshes it through GET /users
+	response := map[string]string{"msg": "Email changed successfully"}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Name   string `json:"Name"`
+		Locale string `json:"Locale"` // Optional, the current locale is kept if it is empty
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, jwt, csrfToken, err := h.authService.UpdateProfile(r.Context(), userId, req.Name, req.Locale)
+	if err != nil {
+		log.Printf("Error updating profile: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// The name is part of the jwt claims
+	setSessionCookies(w, jwt, csrfToken)
+
+	response := map[string]interface{}{
+		"msg":  "Profile updated successfully",
+		"user": user,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Password   string                           `json:"Password"`
+		Credential *webauthn.AuthenticationResponse `json:"Credential"` // Passkey assertion of accounts without a password
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.authService.DeleteAccount(r.Context(), userId, authentication.Reauthentication{Password: req.Password, Passkey: req.Credential})
+	if err != nil {
+		log.Printf("Error deleting account: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	clearSessionCookies(w)
+
+	response := map[string]string{"msg": "Account deleted successfully"}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
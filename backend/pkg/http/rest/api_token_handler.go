@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+// rejectAPIToken prevents API tokens and OAuth access tokens from being used to manage API tokens,
+// so a leaked token cannot be used to mint new ones.
+func rejectAPIToken(w http.ResponseWriter, r *http.Request) bool {
+	if principal, ok := getPrincipal(r); !ok || principal.AuthMethod != authentication.AuthMethodSession {
+		RespondWithError(w, http.StatusForbidden, "API tokens cannot be used for this action")
+		return true
+	}
+	return false
+}
+
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"Name"`
+		Scopes        []string `json:"Scopes"`
+		SwearJarIds   []string `json:"SwearJarIds"`
+		ExpiresInDays int      `json:"ExpiresInDays"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	rawToken, apiToken, err := h.authService.CreateAPIToken(r.Context(), userId, req.Name, req.Scopes, req.SwearJarIds, req.ExpiresInDays)
+	if err != nil {
+		log.Printf("Error creating API token: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// The raw token is only ever returned once
+	response := map[string]interface{}{
+		"msg":      "API token created successfully",
+		"token":    rawToken,
+		"apiToken": apiToken,
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	apiTokens, err := h.authService.GetAPITokens(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":       "fetch successful",
+		"apiTokens": apiTokens,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request, tokenId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.authService.RevokeAPIToken(r.Context(), userId, tokenId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]string{
+		"msg": "API token revoked successfully",
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
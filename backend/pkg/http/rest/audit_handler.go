@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+// parseAuditPage reads the limit and before query parameters. before is the RFC3339 timestamp of the last event
+// of the previous page.
+func parseAuditPage(r *http.Request) (before time.Time, limit int, err error) {
+	query := r.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+	}
+	if value := query.Get("before"); value != "" {
+		before, err = time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+	}
+	return before, limit, nil
+}
+
+func (h *Handler) GetUserAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	before, limit, err := parseAuditPage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid limit or before")
+		return
+	}
+
+	events, err := h.auditService.GetUserEvents(r.Context(), userId, before, limit)
+	if err != nil {
+		log.Printf("Error fetching audit events: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithAuditEvents(w, "Audit events fetched successfully", events)
+}
+
+// GetSwearJarAuditEvents returns the activity in the swear jar, which every owner of the swear jar can view
+func (h *Handler) GetSwearJarAuditEvents(w http.ResponseWriter, r *http.Request, swearJarId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	isOwner, err := h.sjService.IsOwner(r.Context(), swearJarId, userId)
+	if err != nil {
+		log.Printf("Error checking SwearJar owner: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+	if !isOwner {
+		respondWithServiceError(w, swearJar.ErrNotOwner)
+		return
+	}
+
+	before, limit, err := parseAuditPage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid limit or before")
+		return
+	}
+
+	events, err := h.auditService.GetSwearJarEvents(r.Context(), swearJarId, before, limit)
+	if err != nil {
+		log.Printf("Error fetching SwearJar audit events: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithAuditEvents(w, "SwearJar audit events fetched successfully", events)
+}
+
+func respondWithAuditEvents(w http.ResponseWriter, msg string, events []audit.Event) {
+	response := map[string]interface{}{
+		"msg":  msg,
+		"data": events,
+	}
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+const csrfHeader = "X-CSRF-Token"
+
+// ProtectedRouteMiddleware authenticates the request with AuthenticatedRouteMiddleware and only allows users who
+// have verified their email to access protected routes
+func (h *Handler) ProtectedRouteMiddleware(next http.Handler) http.Handler {
+	return h.AuthenticatedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := getPrincipal(r)
+		if !ok || !principal.Verified {
+			log.Println("User is not verified")
+			RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// AuthenticatedRouteMiddleware validates either a bearer token, or the JWT, request origin and CSRF token, and
+// stores the authenticated principal in the request context. Users who have not verified their email are allowed.
+func (h *Handler) AuthenticatedRouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Logging(r)
+
+		// Bearer tokens are never attached automatically by the browser, so they bypass the cookie-based CSRF check
+		if rawToken, ok := getBearerToken(r); ok {
+			principal, err := h.authenticateBearerToken(r.Context(), rawToken)
+			if err != nil {
+				log.Println("API token validation error:", err)
+				RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(authentication.WithPrincipal(r.Context(), principal)))
+			return
+		}
+
+		jwtCookie, err := r.Cookie("jwt")
+		if err != nil {
+			RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		// Validate JWT against the keyring
+		claims, err := h.authService.ParseToken(jwtCookie.Value)
+		if err != nil {
+			log.Println("JWT validation error:", err)
+			RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		// The browser attaches the jwt cookie to cross-site requests too, so requests which change state must come
+		// from an allowed origin and carry the csrf token bound to the jwt
+		if !isSafeMethod(r.Method) {
+			err = validateRequestOrigin(r)
+			if err != nil {
+				log.Println("Origin validation error:", err)
+				RespondWithError(w, http.StatusForbidden, err.Error())
+				return
+			}
+
+			err = h.authService.VerifyCSRFToken(claims, r.Header.Get(csrfHeader))
+			if err != nil {
+				log.Println("CSRF token validation error:", err)
+				respondWithServiceError(w, err)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(authentication.WithPrincipal(r.Context(), authentication.SessionPrincipal(claims))))
+	})
+}
+
+func Logging(r *http.Request) {
+	log.Printf("Method: %s, Route: %s\n", r.Method, r.URL.Path)
+}
+
+func getBearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	token, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// isSafeMethod reports whether the method is read-only, and therefore exempt from CSRF checks
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// validateRequestOrigin checks the Origin header, or the origin of the Referer if the browser omits it,
+// against ALLOWED_ORIGINS
+func validateRequestOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		referer, err := url.Parse(r.Header.Get("Referer"))
+		if err != nil || referer.Scheme == "" || referer.Host == "" {
+			return errors.New("request origin missing")
+		}
+		origin = referer.Scheme + "://" + referer.Host
+	}
+
+	if err := validateCORS(origin); err != nil {
+		return errors.New("request origin not allowed")
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/capture"
+	"github.com/mikeytheong/swearjar/backend/pkg/email/providers/smtp"
+)
+
+// fakeAuthRepository keeps the users, auth tokens and signing keys the signup, verification and password reset
+// flows use in memory. The other methods of the repository are not implemented.
+type fakeAuthRepository struct {
+	authentication.Repository
+	mu          sync.Mutex
+	nextId      int
+	users       map[string]*authentication.User // by email
+	authTokens  map[string]authentication.AuthToken
+	signingKeys []authentication.SigningKey
+}
+
+func newFakeAuthRepository() *fakeAuthRepository {
+	return &fakeAuthRepository{users: map[string]*authentication.User{}, authTokens: map[string]authentication.AuthToken{}}
+}
+
+func (r *fakeAuthRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (r *fakeAuthRepository) SignUp(ctx context.Context, u authentication.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[u.Email]; ok {
+		return authentication.ErrEmailTaken
+	}
+	r.nextId++
+	u.UserId = fmt.Sprintf("%024x", r.nextId)
+	r.users[u.Email] = &u
+	return nil
+}
+
+func (r *fakeAuthRepository) GetUserByEmail(ctx context.Context, email string) (authentication.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[email]; ok {
+		return *u, nil
+	}
+	return authentication.User{}, authentication.ErrNoDocuments
+}
+
+func (r *fakeAuthRepository) GetUserById(ctx context.Context, userId string) (authentication.UserResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.UserId == userId {
+			return authentication.UserResponse{UserId: u.UserId, Email: u.Email, Name: u.Name, Verified: u.Verified, Locale: u.Locale}, nil
+		}
+	}
+	return authentication.UserResponse{}, authentication.ErrNoDocuments
+}
+
+func (r *fakeAuthRepository) CreateAuthToken(ctx context.Context, t authentication.AuthToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.authTokens[t.Token] = t
+	return nil
+}
+
+func (r *fakeAuthRepository) GetAuthToken(ctx context.Context, hashedToken string) (authentication.AuthToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.authTokens[hashedToken]; ok {
+		return t, nil
+	}
+	return authentication.AuthToken{}, authentication.ErrNoDocuments
+}
+
+func (r *fakeAuthRepository) VerifyEmailAndMarkToken(ctx context.Context, email string, hashedToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[email]
+	t, found := r.authTokens[hashedToken]
+	if !ok || !found || t.Used {
+		return authentication.ErrNoDocuments
+	}
+	t.Used = true
+	r.authTokens[hashedToken] = t
+	u.Verified = true
+	return nil
+}
+
+func (r *fakeAuthRepository) CreateSigningKey(ctx context.Context, key authentication.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.signingKeys {
+		if k.Kid == key.Kid {
+			return authentication.ErrSigningKeyExists
+		}
+	}
+	r.signingKeys = append(r.signingKeys, key)
+	return nil
+}
+
+func (r *fakeAuthRepository) GetSigningKeys(ctx context.Context) ([]authentication.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]authentication.SigningKey{}, r.signingKeys...), nil
+}
+
+func (r *fakeAuthRepository) SetSigningKeyExpiry(ctx context.Context, kid string, expiresAt time.Time) error {
+	return nil
+}
+
+type nopAuditLogger struct{}
+
+func (nopAuditLogger) Log(ctx context.Context, e audit.Event) {}
+
+// stubEmailService records the templates of the emails it is asked to send
+type stubEmailService struct {
+	email.Service
+	mu   sync.Mutex
+	sent []string
+}
+
+func (e *stubEmailService) SendEmail(ctx context.Context, to string, locale string, template string, data interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sent = append(e.sent, template)
+	return nil
+}
+
+// newAuthTestHandler returns a handler backed by the real authentication service, which sends its emails with e
+func newAuthTestHandler(t *testing.T, e email.Service) (*Handler, *fakeAuthRepository) {
+	t.Helper()
+	t.Setenv("JWT_KEYRING_SECRET", "test-keyring-secret")
+	t.Setenv("JWT_SIGNING_ALG", authentication.AlgorithmEdDSA)
+	t.Setenv("JWT_EXPIRATION_TIME", "60")
+	t.Setenv("FRONTEND_URL", testFrontendURL)
+
+	r := newFakeAuthRepository()
+	k, err := authentication.NewKeyring(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := &webauthn.RelyingParty{ID: "localhost", Name: "SwearJar", Origins: []string{testFrontendURL}, Timeout: webauthn.DefaultTimeout}
+	authService := authentication.NewService(r, e, k, authentication.DefaultPasswordPolicy(), nopAuditLogger{}, rp)
+	return &Handler{authService: authService, emailService: e}, r
+}
+
+func TestForgotPasswordDoesNotRevealAccounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantSent int
+	}{
+		{"registered email", "alex@example.com", 1},
+		{"unknown email", "nobody@example.com", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &stubEmailService{}
+			h, r := newAuthTestHandler(t, e)
+			if err := r.SignUp(context.Background(), authentication.NewUser("alex@example.com", "Alex", "")); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ForgotPassword(rec, httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"`+tt.email+`"}`)))
+
+			// Both get the same response, only the registered email is sent the link
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if body := strings.TrimSpace(rec.Body.String()); body != `{"msg":"Password reset instructions sent"}` {
+				t.Errorf("body = %s, want the same response for every email", body)
+			}
+			if len(e.sent) != tt.wantSent {
+				t.Errorf("sent %v, want %d emails", e.sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+// memoryOutbox is an email outbox in memory, which hands out each pending email once
+type memoryOutbox struct {
+	mu       sync.Mutex
+	nextId   int
+	messages []email.Message
+}
+
+func (o *memoryOutbox) EnqueueEmail(ctx context.Context, m email.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.nextId++
+	m.MessageId = fmt.Sprintf("%024x", o.nextId)
+	o.messages = append(o.messages, m)
+	return nil
+}
+
+func (o *memoryOutbox) ClaimEmail(ctx context.Context, now time.Time, lease time.Duration) (email.Message, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, m := range o.messages {
+		if m.Status == email.StatusPending && !m.NextAttemptAt.After(now) {
+			o.messages[i].NextAttemptAt = now.Add(lease)
+			o.messages[i].Attempts++
+			return o.messages[i], nil
+		}
+	}
+	return email.Message{}, email.ErrNoPendingEmail
+}
+
+func (o *memoryOutbox) UpdateEmail(ctx context.Context, m email.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range o.messages {
+		if o.messages[i].MessageId == m.MessageId {
+			o.messages[i] = m
+			return nil
+		}
+	}
+	return errors.New("email not found")
+}
+
+func (o *memoryOutbox) DeleteEmailsBefore(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+// startCaptureEmailService returns an email service which sends through the outbox worker to the capture server
+func startCaptureEmailService(t *testing.T) (email.Service, *capture.Server) {
+	t.Helper()
+	t.Setenv("SENDER_ADDRESS", "SwearJar <noreply@example.com>")
+
+	server := capture.NewServer()
+	addr, stopServer, err := server.Start("127.0.0.1:0", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(stopServer)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := smtp.NewProvider(smtp.Config{Host: host, Port: portNumber, TLS: smtp.TLSNone, Timeout: smtp.DefaultTimeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := email.DefaultTemplates(email.PreviewConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := email.NewService(p, templates, &memoryOutbox{})
+	t.Cleanup(e.Start())
+	return e, server
+}
+
+// waitForEmail returns the first email captured for the address
+func waitForEmail(t *testing.T, server *capture.Server, to string) capture.Message {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, m := range server.Messages() {
+			if len(m.To) == 1 && m.To[0] == to {
+				return m
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no email to %s captured", to)
+	return capture.Message{}
+}
+
+// postJSON sends the request as the frontend does, with the csrf token of the session if there is one
+func postJSON(t *testing.T, client *http.Client, serverURL string, path string, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, serverURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", testFrontendURL)
+	u, _ := url.Parse(serverURL)
+	for _, cookie := range client.Jar.Cookies(u) {
+		if cookie.Name == "csrf_token" {
+			req.Header.Set(csrfHeader, cookie.Value)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestSignUpAndVerifyEmailThroughCapturedEmail(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", testFrontendURL)
+	e, captured := startCaptureEmailService(t)
+	h, r := newAuthTestHandler(t, e)
+	server := httptest.NewServer(h.RegisterRoutes())
+	defer server.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+
+	// * 1. Sign up, which sends the verification email through the outbox
+	credentials := `{"email":"alex@example.com","password":"purple-giraffe-dances"}`
+	if resp := postJSON(t, client, server.URL, "/auth/signup", `{"email":"alex@example.com","name":"Alex","password":"purple-giraffe-dances"}`); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("signup status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	// * 2. Follow the link of the captured email
+	message := waitForEmail(t, captured, "alex@example.com")
+	var token string
+	for _, link := range message.Links {
+		// The verification page sends the token encoded again, as it was stored
+		if u, err := url.Parse(link); err == nil && strings.HasPrefix(link, testFrontendURL+"/auth/email/verify?") {
+			token = url.QueryEscape(u.Query().Get("token"))
+		}
+	}
+	if token == "" {
+		t.Fatalf("links %v, want a verification link", message.Links)
+	}
+
+	// * 3. Log in and verify the email with the token of the link, as the verification page does
+	if resp := postJSON(t, client, server.URL, "/auth/login", credentials); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp := postJSON(t, client, server.URL, "/auth/email/verify", `{"token":"`+token+`"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("verify status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	user, err := r.GetUserByEmail(context.Background(), "alex@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Verified {
+		t.Error("user is not verified after following the link")
+	}
+
+	// The link is single use
+	if resp := postJSON(t, client, server.URL, "/auth/email/verify", `{"token":"`+token+`"}`); resp.StatusCode == http.StatusOK {
+		t.Error("verifying again with the same link succeeded, want it rejected")
+	}
+}
@@ -0,0 +1,40 @@
+package rest
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+)
+
+// ClientMiddleware stores the IP address and user agent of the client in the request context, so services can
+// record them in audit events. X-Forwarded-For is only trusted when TRUST_PROXY_HEADERS is set, i.e. when the
+// server runs behind a reverse proxy which overwrites the header.
+func ClientMiddleware(next http.Handler) http.Handler {
+	trustProxyHeaders := os.Getenv("TRUST_PROXY_HEADERS") == "true"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := audit.Client{
+			IP:        clientIP(r, trustProxyHeaders),
+			UserAgent: r.UserAgent(),
+		}
+		next.ServeHTTP(w, r.WithContext(audit.WithClient(r.Context(), client)))
+	})
+}
+
+func clientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		// The first address is the client, the rest are the proxies the request passed through
+		if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+			return strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
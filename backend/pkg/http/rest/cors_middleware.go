@@ -12,6 +12,14 @@ import (
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
+
+		// Requests without an Origin header do not come from a cross-origin browser context
+		// (e.g. scripts using API tokens), so CORS does not apply to them
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		err := validateCORS(origin)
 		if err != nil {
 			fmt.Println("CORS validation error:", err)
@@ -22,7 +30,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", "DELETE, GET, PATCH, POST, PUT, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-CSRF-Token")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		// Handle preflight request
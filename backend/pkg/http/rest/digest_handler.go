@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/digest"
+)
+
+func (h *Handler) GetDigestSubscription(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	subscription, err := h.digestService.GetSubscription(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":          "Digest subscription fetched successfully",
+		"subscription": subscription,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// SubscribeToDigest opts the user in to digest emails, or changes the frequency and timezone of their subscription
+func (h *Handler) SubscribeToDigest(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Frequency string `json:"Frequency"`
+		Timezone  string `json:"Timezone"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	subscription, err := h.digestService.Subscribe(r.Context(), userId, digest.Frequency(req.Frequency), req.Timezone)
+	if err != nil {
+		log.Printf("Error subscribing to digest: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":          "Subscribed to digest emails successfully",
+		"subscription": subscription,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) UnsubscribeFromDigest(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.digestService.Unsubscribe(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Unsubscribed from digest emails successfully",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// UnsubscribeFromDigestWithToken handles the unsubscribe link of a digest, which is opened without a session. The
+// frontend posts the token, so link scanners fetching the link do not unsubscribe the user.
+func (h *Handler) UnsubscribeFromDigestWithToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"Token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	err = h.digestService.UnsubscribeWithToken(r.Context(), req.Token)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Unsubscribed from digest emails successfully",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
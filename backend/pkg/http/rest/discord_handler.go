@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/discord"
+)
+
+// maxDiscordRequestSize bounds the body read before its signature is checked
+const maxDiscordRequestSize = 64 << 10
+
+// DiscordInteraction handles the slash commands of the Discord application. Requests are authenticated by their
+// Ed25519 signature instead of a session, the user is mapped to a SwearJar user by their account link.
+func (h *Handler) DiscordInteraction(w http.ResponseWriter, r *http.Request) {
+	if h.discordService == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDiscordRequestSize))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.discordService.VerifyRequest(r.Header.Get(discord.SignatureHeader), r.Header.Get(discord.TimestampHeader), body); err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid Discord signature")
+		return
+	}
+
+	var interaction discord.Interaction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	response := h.discordService.HandleInteraction(r.Context(), interaction)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding Discord response: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+)
+
+// GetEmailPreviews lists the email templates and locales which can be previewed
+func (h *Handler) GetEmailPreviews(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"msg":       "Email templates fetched successfully",
+		"templates": email.TemplateNames,
+		"locales":   email.Locales,
+	}
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// PreviewEmail renders an email template with sample data. The locale query parameter picks the language, and the
+// format query parameter picks the body: "html" (default) and "text" serve it as is to be viewed in the browser,
+// "json" returns the subject and both bodies.
+func (h *Handler) PreviewEmail(w http.ResponseWriter, r *http.Request) {
+	e, err := h.emailService.PreviewEmail(r.PathValue("name"), r.URL.Query().Get("locale"))
+	if err != nil {
+		log.Printf("Error previewing email: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(e.HTML))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(e.Subject + "\n\n" + e.Text))
+	case "json":
+		response := map[string]interface{}{
+			"msg":     "Email rendered successfully",
+			"subject": e.Subject,
+			"html":    e.HTML,
+			"text":    e.Text,
+		}
+		w.WriteHeader(http.StatusOK)
+		err := json.NewEncoder(w).Encode(response)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+	default:
+		RespondWithError(w, http.StatusBadRequest, "format must be html, text or json")
+	}
+}
@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+const genericErrorMessage = "An error occurred while processing your request"
+
+// errorResponse is the body of every error response. Error is a message which can be shown to the user,
+// Code is stable for clients to act on.
+type errorResponse struct {
+	Error      string            `json:"error"`
+	Code       string            `json:"code"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	RetryAfter int               `json:"retryAfter,omitempty"` // in seconds
+}
+
+var statusByKind = map[apperror.Kind]int{
+	apperror.KindValidation:   http.StatusBadRequest,
+	apperror.KindUnauthorized: http.StatusUnauthorized,
+	apperror.KindForbidden:    http.StatusForbidden,
+	apperror.KindNotFound:     http.StatusNotFound,
+	apperror.KindConflict:     http.StatusConflict,
+	apperror.KindGone:         http.StatusGone,
+	apperror.KindRateLimited:  http.StatusTooManyRequests,
+}
+
+// respondWithServiceError translates an error returned by a service to an error response. Domain errors get the
+// status of their kind and their code and message, any other error is logged and answered with a generic message,
+// so internal details never reach the client.
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	appErr, ok := apperror.As(err)
+	status, known := statusByKind[apperror.KindOf(err)]
+	switch {
+	case ok && known:
+		response := errorResponse{Error: appErr.Message, Code: appErr.Code, Fields: appErr.Fields}
+		if appErr.RetryAfter > 0 {
+			response.RetryAfter = int(math.Ceil(appErr.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfter))
+		}
+		writeErrorResponse(w, status, response)
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Printf("Request timed out: %v", err)
+		writeErrorResponse(w, http.StatusGatewayTimeout, errorResponse{Error: "Request timed out", Code: "timeout"})
+	default:
+		log.Printf("Unexpected error: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, errorResponse{Error: genericErrorMessage, Code: string(apperror.KindInternal)})
+	}
+}
+
+// RespondWithError responds with an error raised by the handler itself, such as an invalid request payload
+func RespondWithError(w http.ResponseWriter, statusCode int, message string) {
+	writeErrorResponse(w, statusCode, errorResponse{Error: message, Code: codeForStatus(statusCode)})
+}
+
+// codeForStatus returns the code of errors raised by handlers, matching the codes of the domain error kinds
+func codeForStatus(statusCode int) string {
+	for kind, status := range statusByKind {
+		if status == statusCode {
+			return string(kind)
+		}
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return string(apperror.KindInternal)
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+}
+
+func writeErrorResponse(w http.ResponseWriter, statusCode int, response errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Printf("Error encoding JSON error response: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+const (
+	// eventStreamHeartbeat keeps proxies from closing an idle stream
+	eventStreamHeartbeat = 25 * time.Second
+	// eventStreamRetry is how long the browser waits before reconnecting a dropped stream, in milliseconds
+	eventStreamRetry = 5000
+)
+
+// isEventStream reports whether the request opens an event stream, which is exempt from the request deadline
+func isEventStream(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/swearjar/") && strings.HasSuffix(r.URL.Path, "/events")
+}
+
+// StreamSwearJarEvents pushes the events of the swear jar to an owner as Server-Sent Events, until the client
+// disconnects or the owner is removed from the swear jar
+func (h *Handler) StreamSwearJarEvents(w http.ResponseWriter, r *http.Request, swearJarId string) {
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := authorizeRequest(r, authentication.ScopeJarsRead, swearJarId); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// The stream has no deadline, but the membership check still gets one
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeoutFromEnv())
+	events, unsubscribe, err := h.sjService.Subscribe(ctx, swearJarId, userId)
+	cancel()
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Stops nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry)
+	if err := rc.Flush(); err != nil {
+		log.Printf("Error flushing event stream: %v", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-events:
+			if !ok {
+				// The subscription was dropped, the client reconnects and refetches the swear jar
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("Error encoding SwearJar event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			if e.Type == swearJar.EventMemberLeft && e.Data["userId"] == userId {
+				rc.Flush()
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
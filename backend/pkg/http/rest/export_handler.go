@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *Handler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	job, err := h.exportService.RequestExport(r.Context(), userId)
+	if err != nil {
+		log.Printf("Error requesting export: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Export requested, a download link will be emailed once it is ready",
+		"job": job,
+	}
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetExportJobs(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	jobs, err := h.exportService.GetExportJobs(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":  "Export jobs fetched successfully",
+		"jobs": jobs,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// DownloadExport serves the archive for the emailed download link, which is authorized by its token rather than a session
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request, jobId string) {
+	archive, size, err := h.exportService.Download(r.Context(), jobId, r.URL.Query().Get("token"))
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	defer archive.Close()
+
+	fileName := "swearjar-export-" + time.Now().UTC().Format("20060102") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, archive); err != nil {
+		log.Printf("Error writing export archive: %v", err)
+	}
+}
@@ -2,32 +2,70 @@ package rest
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 
-	// "os"
 	"net/http"
-	// "strconv"
+	"os"
+	"strconv"
 	"time"
 
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
 	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oauth"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oidc"
+	"github.com/mikeytheong/swearjar/backend/pkg/digest"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/mikeytheong/swearjar/backend/pkg/export"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/discord"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/slack"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/telegram"
+	"github.com/mikeytheong/swearjar/backend/pkg/notification"
 	"github.com/mikeytheong/swearjar/backend/pkg/search"
 	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+	"github.com/mikeytheong/swearjar/backend/pkg/webhook"
 )
 
 type Handler struct {
-	authService authentication.Service
-	sjService   swearJar.Service
-	seService   search.Service
+	authService    authentication.Service
+	emailService   email.Service
+	sjService      swearJar.Service
+	seService      search.Service
+	oidcProviders  oidc.Providers
+	oauthService   oauth.Service
+	exportService  export.Service
+	auditService   audit.Service
+	webhookService webhook.Service
+	digestService  digest.Service
+
+	notificationService notification.Service
+
+	integrationService integration.Service
+	slackService       slack.Service    // nil if Slack is not configured
+	discordService     discord.Service  // nil if Discord is not configured
+	telegramService    telegram.Service // nil if Telegram is not configured
 }
 
-func NewHandler(a authentication.Service, sj swearJar.Service, se search.Service) *Handler {
+func NewHandler(a authentication.Service, e email.Service, sj swearJar.Service, se search.Service, op oidc.Providers, o oauth.Service, ex export.Service, au audit.Service, wh webhook.Service, dg digest.Service, n notification.Service, i integration.Service, sl slack.Service, d discord.Service, t telegram.Service) *Handler {
 	return &Handler{
-		authService: a,
-		sjService:   sj,
-		seService:   se,
+		authService:         a,
+		emailService:        e,
+		sjService:           sj,
+		seService:           se,
+		oidcProviders:       op,
+		oauthService:        o,
+		exportService:       ex,
+		auditService:        au,
+		webhookService:      wh,
+		digestService:       dg,
+		notificationService: n,
+		integrationService:  i,
+		slackService:        sl,
+		discordService:      d,
+		telegramService:     t,
 	}
 }
 
@@ -45,139 +83,672 @@ func (h *Handler) RegisterRoutes() http.Handler {
 		}
 	})
 
+	mux.HandleFunc("/auth/login/magic", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.RequestMagicLogin(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/login/magic/verify", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.MagicLogin(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/login/second-factor", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.FinishSecondFactor(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/passkey/login/{action}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			switch r.PathValue("action") {
+			case "begin":
+				h.BeginPasskeyLogin(w, r)
+			case "finish":
+				h.FinishPasskeyLogin(w, r)
+			default:
+				http.Error(w, "Invalid action", http.StatusNotFound)
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/oidc/providers", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetOIDCProviders(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/oidc/{provider}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			switch r.PathValue("action") {
+			case "login":
+				h.BeginOIDCLogin(w, r, r.PathValue("provider"))
+			case "callback":
+				h.OIDCCallback(w, r, r.PathValue("provider"))
+			default:
+				http.NotFound(w, r)
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	mux.HandleFunc("/auth/signup", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			h.SignUp(w, r)
+			h.SignUp(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.Handle("/users", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetUser(w, r)
+		case http.MethodPatch:
+			h.UpdateProfile(w, r)
+		case http.MethodDelete:
+			h.DeleteAccount(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/password", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			h.ChangePassword(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/email", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			h.RequestEmailChange(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/export", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetExportJobs(w, r)
+		case http.MethodPost:
+			h.RequestExport(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/passkeys", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetPasskeys(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/passkeys/register/{action}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			switch r.PathValue("action") {
+			case "begin":
+				h.BeginPasskeyRegistration(w, r)
+			case "finish":
+				h.FinishPasskeyRegistration(w, r)
+			default:
+				http.Error(w, "Invalid action", http.StatusNotFound)
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/passkeys/second-factor", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			h.SetPasskeySecondFactor(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/reauthenticate", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.BeginReauthentication(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/passkeys/{id}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			h.DeletePasskey(w, r, r.PathValue("id"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/audit", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetUserAuditEvents(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/digest", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetDigestSubscription(w, r)
+		case http.MethodPut:
+			h.SubscribeToDigest(w, r)
+		case http.MethodDelete:
+			h.UnsubscribeFromDigest(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.HandleFunc("/digest/unsubscribe", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.UnsubscribeFromDigestWithToken(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.Handle("/users/notifications", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetNotifications(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/notifications/unread-count", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetUnreadNotificationCount(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/notifications/read", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.MarkAllNotificationsAsRead(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	// The id follows read, /users/notifications/{notificationId}/read would conflict with the preference routes
+	mux.Handle("/users/notifications/read/{notificationId}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.MarkNotificationAsRead(w, r, r.PathValue("notificationId"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/notifications/preferences", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetNotificationPreferences(w, r)
+		case http.MethodPut:
+			h.SetNotificationPreference(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/notifications/preferences/{preferenceId}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			h.DeleteNotificationPreference(w, r, r.PathValue("preferenceId"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/notifications/webhook", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetNotificationWebhook(w, r)
+		case http.MethodPut:
+			h.SetNotificationWebhook(w, r)
+		case http.MethodDelete:
+			h.DeleteNotificationWebhook(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/integrations", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetAccountLinks(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/integrations/codes", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.CreateAccountLinkCode(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/users/integrations/{linkId}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			h.DeleteAccountLink(w, r, r.PathValue("linkId"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.HandleFunc("/export/{id}/download", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.DownloadExport(w, r, r.PathValue("id"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/password/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			passwordAction := strings.TrimPrefix(r.URL.Path, "/password/")
+			switch passwordAction {
+			case "forgot":
+				h.ForgotPassword(w, r)
+			case "reset":
+				h.ResetPassword(w, r)
+			default:
+				http.NotFound(w, r)
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/token/verify", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.VerifyToken(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Users verify their email while logged in, before they can access protected routes
+	mux.Handle("/auth/email/verify", h.AuthenticatedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.VerifyEmail(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.HandleFunc("/auth/email/verify/resend", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.ResendVerificationEmail(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/email/change", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.ConfirmEmailChange(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Wrap the /swearjar route with the ProtectedRouteMiddleware middleware
+	mux.Handle("/swearjar", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			swearJarId := r.URL.Query().Get("id")
+			if swearJarId == "" {
+				h.GetSwearJarsByUserId(w, r)
+			} else {
+				h.GetSwearJarById(w, r)
+			}
+		case http.MethodPost:
+			h.CreateSwearJar(w, r)
+		case http.MethodPut:
+			h.UpdateSwearJar(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/{action}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		parts := strings.Split(strings.TrimPrefix(path, "/swearjar/"), "/")
+
+		if len(parts) < 2 {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		swearJarId := parts[0]
+		action := parts[1]
+
+		if swearJarId == "" {
+			http.Error(w, "Swear jar ID is required", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			switch action {
+			case "trend":
+				h.ServeSwearJarTrend(w, r, swearJarId)
+			case "stats":
+				h.ServeSwearJarStats(w, r, swearJarId)
+			case "audit":
+				h.GetSwearJarAuditEvents(w, r, swearJarId)
+			case "events":
+				h.StreamSwearJarEvents(w, r, swearJarId)
+			default:
+				http.Error(w, "Invalid action", http.StatusNotFound)
+			}
+		case http.MethodPatch:
+			switch action {
+			case "clear":
+				h.ClearSwearJar(w, r, swearJarId)
+			default:
+				http.Error(w, "Invalid action", http.StatusNotFound)
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/webhooks", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetWebhooks(w, r, r.PathValue("id"))
+		case http.MethodPost:
+			h.CreateWebhook(w, r, r.PathValue("id"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/webhooks/{webhookId}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			h.DeleteWebhook(w, r, r.PathValue("id"), r.PathValue("webhookId"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/webhooks/{webhookId}/deliveries", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetWebhookDeliveries(w, r, r.PathValue("id"), r.PathValue("webhookId"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.RedeliverWebhookDelivery(w, r, r.PathValue("id"), r.PathValue("webhookId"), r.PathValue("deliveryId"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/webhooks/{webhookId}/test", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.SendWebhookTestEvent(w, r, r.PathValue("id"), r.PathValue("webhookId"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/integrations", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.GetChannelLinks(w, r, r.PathValue("id"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/integrations/codes", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.CreateLinkCode(w, r, r.PathValue("id"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/swearjar/{id}/integrations/{linkId}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			h.DeleteChannelLink(w, r, r.PathValue("id"), r.PathValue("linkId"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	// Chat platforms authenticate their requests with signatures instead of sessions
+	mux.HandleFunc("/integrations/slack/commands", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.SlackCommand(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/integrations/discord/interactions", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.DiscordInteraction(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/integrations/telegram/webhook", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.TelegramWebhook(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
-	mux.Handle("/users", ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/swear", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			h.GetUser(w, r)
+			h.GetSwearsWithUsers(w, r)
+		case http.MethodPost:
+			h.AddSwear(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})))
 
-	mux.HandleFunc("/password/", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/search/user", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
-		case http.MethodPost:
-			passwordAction := strings.TrimPrefix(r.URL.Path, "/password/")
-			switch passwordAction {
-			case "forgot":
-				h.ForgotPassword(w, r)
-			case "reset":
-				h.ResetPassword(w, r)
-			default:
-				http.NotFound(w, r)
-			}
+		case http.MethodGet:
+			h.GetTopClosestEmails(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})
+	})))
 
-	mux.HandleFunc("/auth/token/verify", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/tokens", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
+		case http.MethodGet:
+			h.GetAPITokens(w, r)
 		case http.MethodPost:
-			h.VerifyToken(w, r)
+			h.CreateAPIToken(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/tokens/{id}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			h.RevokeAPIToken(w, r, r.PathValue("id"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			h.OAuthDiscovery(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
-	mux.HandleFunc("/auth/email/verify", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
-		case http.MethodPost:
-			h.VerifyEmail(w, r)
+		case http.MethodGet:
+			h.JWKS(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
-	// Wrap the /swearjar route with the ProtectedRouteMiddleware middleware
-	mux.Handle("/swearjar", ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/oauth/clients", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			swearJarId := r.URL.Query().Get("id")
-			if swearJarId == "" {
-				h.GetSwearJarsByUserId(w, r)
-			} else {
-				h.GetSwearJarById(w, r)
-			}
+			h.GetOAuthClients(w, r)
 		case http.MethodPost:
-			h.CreateSwearJar(w, r)
-		case http.MethodPut:
-			h.UpdateSwearJar(w, r)
+			h.RegisterOAuthClient(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})))
 
-	mux.Handle("/swearjar/{id}/{action}", ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		parts := strings.Split(strings.TrimPrefix(path, "/swearjar/"), "/")
-
-		if len(parts) < 2 {
-			http.Error(w, "Invalid path", http.StatusBadRequest)
-			return
-		}
-
-		swearJarId := parts[0]
-		action := parts[1]
-
-		if swearJarId == "" {
-			http.Error(w, "Swear jar ID is required", http.StatusBadRequest)
-			return
+	mux.Handle("/oauth/clients/{id}", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			h.DeleteOAuthClient(w, r, r.PathValue("id"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
+	})))
 
+	// Consent screen: GET returns the details to display, POST records the user's decision
+	mux.Handle("/oauth/authorize", h.ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			switch action {
-			case "trend":
-				h.ServeSwearJarTrend(w, r, swearJarId)
-			case "stats":
-				h.ServeSwearJarStats(w, r, swearJarId)
-			default:
-				http.Error(w, "Invalid action", http.StatusNotFound)
-			}
-		case http.MethodPatch:
-			switch action {
-			case "clear":
-				h.ClearSwearJar(w, r, swearJarId)
-			default:
-				http.Error(w, "Invalid action", http.StatusNotFound)
-			}
+			h.GetOAuthConsent(w, r)
+		case http.MethodPost:
+			h.OAuthAuthorize(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})))
 
-	mux.Handle("/swear", ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
-		case http.MethodGet:
-			h.GetSwearsWithUsers(w, r)
 		case http.MethodPost:
-			h.AddSwear(w, r)
+			h.OAuthToken(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})))
+	})
+
+	mux.HandleFunc("/oauth/introspect", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			h.OAuthIntrospect(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 
-	mux.Handle("/search/user", ProtectedRouteMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/oauth/userinfo", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			h.GetTopClosestEmails(w, r)
+			h.OAuthUserInfo(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})))
+	})
+
+	// Email previews render the templates with sample data for developers, so they are not served in production
+	if isProdEnv, _ := strconv.ParseBool(os.Getenv("PRODUCTION_ENV")); !isProdEnv {
+		mux.HandleFunc("/dev/emails", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				h.GetEmailPreviews(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})
 
-	// Wrap the entire mux with the CORSMiddleware
-	return CORSMiddleware(mux)
+		mux.HandleFunc("/dev/emails/{name}", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				h.PreviewEmail(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})
+	}
+
+	// Wrap the entire mux with the CORSMiddleware, and record the client of each request for audit events
+	return CORSMiddleware(ClientMiddleware(TimeoutMiddleware(mux)))
 }
 
 func (h *Handler) Listening(w http.ResponseWriter, r *http.Request) {
@@ -188,24 +759,82 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	var req authentication.User
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	ur, jwt, csrfToken, err := h.authService.Login(req)
+	ur, jwt, csrfToken, err := h.authService.Login(r.Context(), req)
 	if err != nil {
-		if errors.Is(err, authentication.ErrUnauthorized) {
-			RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		} else {
-			RespondWithError(w, http.StatusInternalServerError, err.Error())
-		}
+		respondWithLoginError(w, err)
+		return
+	}
+
+	setSessionCookies(w, jwt, csrfToken)
+
+	response := map[string]interface{}{
+		"msg":  "Logged in successfully",
+		"user": ur,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) RequestMagicLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Email == "" {
+		RespondWithError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	err := h.authService.RequestMagicLogin(r.Context(), req.Email)
+	if err != nil {
+		log.Printf("Magic login request error: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// Same response whether or not the email belongs to an account
+	response := map[string]string{"msg": "If an account exists for this email, a login link has been sent"}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) MagicLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Token == "" {
+		RespondWithError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	ur, jwt, csrfToken, err := h.authService.MagicLogin(r.Context(), req.Token)
+	if err != nil {
+		respondWithLoginError(w, err)
 		return
 	}
 
-	// set jwt in httpOnly cookie and set csrf in both httpOnly & non-HttpOnly cookies
-	SetCookie(w, "jwt", jwt, true)
-	SetCookie(w, "csrf_token_http_only", csrfToken, true)
-	SetCookie(w, "csrf_token", csrfToken, false)
+	setSessionCookies(w, jwt, csrfToken)
 
 	response := map[string]interface{}{
 		"msg":  "Logged in successfully",
@@ -215,25 +844,33 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
 
 func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
 		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	user, jwt, err := h.authService.GetUser(userId)
+	if err := authorizeRequest(r, authentication.ScopeUsersRead, ""); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	user, jwt, csrfToken, err := h.authService.GetUser(r.Context(), userId)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
-	SetCookie(w, "jwt", jwt, true)
+	// Only refresh cookie sessions; a bearer token must not be exchangeable for a session
+	if principal, _ := getPrincipal(r); principal.AuthMethod == authentication.AuthMethodSession {
+		setSessionCookies(w, jwt, csrfToken)
+	}
 
 	response := map[string]interface{}{
 		"msg":  "User fetched successfully",
@@ -242,7 +879,7 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -251,14 +888,20 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 	var req authentication.User
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	err = h.authService.SignUp(req.Email, req.Name, req.Password)
+	// Emails are sent in the language of the browser unless a locale is chosen
+	locale := req.Locale
+	if locale == "" {
+		locale = email.MatchLocale(r.Header.Get("Accept-Language"))
+	}
+
+	err = h.authService.SignUp(r.Context(), req.Email, req.Name, req.Password, locale)
 	if err != nil {
 		log.Printf("Error during SignUp: %v", err)
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -266,7 +909,7 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 	err = json.NewEncoder(w).Encode(map[string]string{"msg": "User signed up successfully"})
 	if err != nil {
 		log.Printf("Error encoding JSON response: %v", err)
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -278,35 +921,66 @@ func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
 	}
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	jwtCookie, err := r.Cookie("jwt")
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
 		RespondWithError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
-	claims, err := decodeJWT(jwtCookie.Value)
+
+	user, jwt, csrfToken, err := h.authService.VerifyEmail(r.Context(), userId, req.Token)
 	if err != nil {
-		RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+		log.Printf("Error verifying email: %v", err)
+		respondWithServiceError(w, err)
 		return
 	}
 
-	jwt, err := h.authService.VerifyEmail(claims["UserId"].(string), req.Token)
+	// Only refresh cookie sessions; a bearer token must not be exchangeable for a session
+	if principal, _ := getPrincipal(r); principal.AuthMethod == authentication.AuthMethodSession {
+		setSessionCookies(w, jwt, csrfToken)
+	}
+
+	response := map[string]interface{}{
+		"msg":  "Email verified successfully",
+		"user": user,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		log.Printf("Error verifying email: %v", err)
-		RespondWithError(w, http.StatusUnauthorized, err.Error())
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Email == "" {
+		RespondWithError(w, http.StatusBadRequest, "Email is required")
 		return
 	}
 
-	SetCookie(w, "jwt", jwt, true)
+	err := h.authService.ResendVerificationEmail(r.Context(), req.Email)
+	if err != nil {
+		log.Printf("Resend verification email error: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
 
-	response := map[string]string{"msg": "Email verified successfully"}
+	// Same response whether or not the email belongs to an unverified account
+	response := map[string]string{"msg": "If the account is awaiting verification, a new link has been sent"}
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -324,30 +998,19 @@ func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	done := make(chan error, 1)
-
-	go func() {
-		err := h.authService.ForgotPassword(req.Email)
-		done <- err
-	}()
+	err := h.authService.ForgotPassword(r.Context(), req.Email)
+	if err != nil {
+		log.Printf("Forgot password error: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
 
-	select {
-	case err := <-done:
-		// log.Printf("Received from done channel, error: %v", err) // ! Debug
-		if err != nil {
-			log.Printf("Forgot password error: %v", err)
-			RespondWithError(w, http.StatusInternalServerError, "An error occurred while processing your request")
-			return
-		}
-		response := map[string]string{"msg": "Password reset instructions sent"}
-		w.WriteHeader(http.StatusOK)
-		err = json.NewEncoder(w).Encode(response)
-		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-	case <-time.After(20 * time.Second):
-		RespondWithError(w, http.StatusRequestTimeout, "Request timed out")
+	response := map[string]string{"msg": "Password reset instructions sent"}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
 	}
 }
 
@@ -358,13 +1021,14 @@ func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	}
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	err = h.authService.ResetPassword(req.Token, req.Password)
+	err = h.authService.ResetPassword(r.Context(), req.Token, req.Password)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		log.Printf("Error resetting password: %v", err)
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -372,7 +1036,7 @@ func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -384,7 +1048,7 @@ func (h *Handler) VerifyToken(w http.ResponseWriter, r *http.Request) {
 	}
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 	if req.Purpose == "" || req.Token == "" {
@@ -392,9 +1056,9 @@ func (h *Handler) VerifyToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.authService.VerifyAuthToken(req.Token, req.Purpose)
+	err = h.authService.VerifyAuthToken(r.Context(), req.Token, req.Purpose)
 	if err != nil {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -414,7 +1078,7 @@ func (h *Handler) AddSwear(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req Request
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
 		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
@@ -423,7 +1087,12 @@ func (h *Handler) AddSwear(w http.ResponseWriter, r *http.Request) {
 
 	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := authorizeRequest(r, authentication.ScopeSwearsWrite, req.SwearJarId); err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -433,14 +1102,11 @@ func (h *Handler) AddSwear(w http.ResponseWriter, r *http.Request) {
 		UserId:           req.UserId,
 		SwearJarId:       req.SwearJarId,
 		SwearDescription: req.SwearDescription,
+		ReportedBy:       userId,
 	}
-	err = h.sjService.AddSwear(s, userId)
+	err = h.sjService.AddSwear(r.Context(), s, userId)
 	if err != nil {
-		if errors.Is(err, authentication.ErrUnauthorized) {
-			RespondWithError(w, http.StatusUnauthorized, err.Error())
-			return
-		}
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -451,7 +1117,7 @@ func (h *Handler) AddSwear(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -464,15 +1130,20 @@ func (h *Handler) GetSwearsWithUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := authorizeRequest(r, authentication.ScopeSwearsRead, swearJarId); err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 
-	data, err := h.sjService.GetSwearsWithUsers(swearJarId, userId)
+	data, err := h.sjService.GetSwearsWithUsers(r.Context(), swearJarId, userId)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -487,32 +1158,21 @@ func (h *Handler) GetSwearsWithUsers(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
 
 func (h *Handler) GetTopClosestEmails(w http.ResponseWriter, r *http.Request) {
 	// ! Excludes the current user from the search results
-	cookie, err := r.Cookie("jwt")
-	// log.Printf("JWT: %v", cookie.Value)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
 		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Decode the UserId claim from the cookie
-	claims, err := decodeJWT(cookie.Value)
-	if err != nil {
-		log.Printf("Error decoding JWT: %v", err)
-		RespondWithError(w, http.StatusUnauthorized, "Error decoding JWT")
-		return
-	}
-
-	// Extract the UserId from the claims
-	userId, ok := claims["UserId"].(string)
-	if !ok {
-		RespondWithError(w, http.StatusUnauthorized, "UserId not found in token")
+	if err := authorizeRequest(r, authentication.ScopeUsersRead, ""); err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -523,9 +1183,9 @@ func (h *Handler) GetTopClosestEmails(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("Query received: %s", query)
 
-	results, err := h.seService.GetTopClosestEmails(query, userId)
+	results, err := h.seService.GetTopClosestEmails(r.Context(), query, userId)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -537,7 +1197,7 @@ func (h *Handler) GetTopClosestEmails(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -553,20 +1213,25 @@ func (h *Handler) CreateSwearJar(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		log.Printf("Error decoding JSON request: %v", err)
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := authorizeRequest(r, authentication.ScopeJarsWrite, ""); err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 
-	sj, err := h.sjService.CreateSwearJar(req.Name, req.Desc, req.Owners, userId)
+	sj, err := h.sjService.CreateSwearJar(r.Context(), req.Name, req.Desc, req.Owners, userId)
 	if err != nil {
 		log.Printf("Error creating SwearJar: %v", err)
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -578,7 +1243,7 @@ func (h *Handler) CreateSwearJar(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -588,20 +1253,25 @@ func (h *Handler) UpdateSwearJar(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		log.Printf("Error decoding JSON request: %v", err)
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := authorizeRequest(r, authentication.ScopeJarsWrite, body.SwearJarId); err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 
-	err = h.sjService.UpdateSwearJar(body, userId)
+	err = h.sjService.UpdateSwearJar(r.Context(), body, userId)
 	if err != nil {
 		log.Printf("Error updating SwearJar: %v", err)
-		RespondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -613,24 +1283,36 @@ func (h *Handler) UpdateSwearJar(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
 
 func (h *Handler) GetSwearJarsByUserId(w http.ResponseWriter, r *http.Request) {
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
 		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	swearJars, err := h.sjService.GetSwearJarsByUserId(userId)
+	if err := authorizeRequest(r, authentication.ScopeJarsRead, ""); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	swearJars, err := h.sjService.GetSwearJarsByUserId(r.Context(), userId)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
+	// API tokens restricted to specific jars only see those jars
+	if principal, ok := getPrincipal(r); ok {
+		swearJars = slices.DeleteFunc(swearJars, func(sj swearJar.SwearJarWithOwners) bool {
+			return !principal.CanAccessSwearJar(sj.SwearJarId)
+		})
+	}
+
 	response := map[string]interface{}{
 		"msg":       "fetch successful",
 		"swearJars": swearJars,
@@ -639,22 +1321,27 @@ func (h *Handler) GetSwearJarsByUserId(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
 
 func (h *Handler) GetSwearJarById(w http.ResponseWriter, r *http.Request) {
 	swearJarId := r.URL.Query().Get("id")
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	swearJar, err := h.sjService.GetSwearJarById(swearJarId, userId)
+	if err := authorizeRequest(r, authentication.ScopeJarsRead, swearJarId); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	swearJar, err := h.sjService.GetSwearJarById(r.Context(), swearJarId, userId)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -666,22 +1353,27 @@ func (h *Handler) GetSwearJarById(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
 
 func (h *Handler) ServeSwearJarStats(w http.ResponseWriter, r *http.Request, swearJarId string) {
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	stats, err := h.sjService.SwearJarStats(swearJarId, userId)
+	if err := authorizeRequest(r, authentication.ScopeJarsRead, swearJarId); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	stats, err := h.sjService.SwearJarStats(r.Context(), swearJarId, userId)
 	if err != nil {
 		log.Printf("Error fetching SwearJar stats: %v", err)
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -693,7 +1385,7 @@ func (h *Handler) ServeSwearJarStats(w http.ResponseWriter, r *http.Request, swe
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -705,15 +1397,20 @@ func (h *Handler) ServeSwearJarTrend(w http.ResponseWriter, r *http.Request, swe
 		return
 	}
 
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	chartData, err := h.sjService.SwearJarTrend(swearJarId, userId, period)
+	if err := authorizeRequest(r, authentication.ScopeJarsRead, swearJarId); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	chartData, err := h.sjService.SwearJarTrend(r.Context(), swearJarId, userId, period)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -738,25 +1435,26 @@ func (h *Handler) ServeSwearJarTrend(w http.ResponseWriter, r *http.Request, swe
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
 
 func (h *Handler) ClearSwearJar(w http.ResponseWriter, r *http.Request, swearJarId string) {
-	userId, err := GetUserIdFromCookie(w, r)
+	userId, err := GetUserIdFromRequest(r)
 	if err != nil {
 		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	err = h.sjService.ClearSwearJar(swearJarId, userId)
+	if err := authorizeRequest(r, authentication.ScopeJarsWrite, swearJarId); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	err = h.sjService.ClearSwearJar(r.Context(), swearJarId, userId)
 	if err != nil {
-		if errors.Is(err, authentication.ErrUnauthorized) {
-			RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
-			return
-		}
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
@@ -766,7 +1464,7 @@ func (h *Handler) ClearSwearJar(w http.ResponseWriter, r *http.Request, swearJar
 
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 }
@@ -0,0 +1,13 @@
+package rest
+
+import "testing"
+
+func TestRegisterRoutes(t *testing.T) {
+	// The mux panics on patterns which conflict
+	defer func() {
+		if err := recover(); err != nil {
+			t.Fatalf("RegisterRoutes panicked: %v", err)
+		}
+	}()
+	(&Handler{}).RegisterRoutes()
+}
@@ -1,16 +1,12 @@
 package rest
 
 import (
-	"encoding/json"
-	"errors"
-	"log"
-
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
 )
 
 // SetCookie sets a cookie with the provided name and value.
@@ -30,48 +26,56 @@ func SetCookie(w http.ResponseWriter, cookieName, value string, isHttpOnly bool)
 	})
 }
 
-func RespondWithError(w http.ResponseWriter, statusCode int, message string) {
-	w.WriteHeader(statusCode)
-	err := json.NewEncoder(w).Encode(map[string]string{"error": message})
-	if err != nil {
-		log.Printf("Error encoding JSON error response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}
+// setSessionCookies sets jwt in httpOnly cookie and the csrf token bound to it in a non-HttpOnly cookie,
+// which the frontend reads to send the X-CSRF-Token header
+func setSessionCookies(w http.ResponseWriter, jwt string, csrfToken string) {
+	SetCookie(w, "jwt", jwt, true)
+	SetCookie(w, "csrf_token", csrfToken, false)
 }
 
-func GetUserIdFromCookie(w http.ResponseWriter, r *http.Request) (string, error) {
-	cookie, err := r.Cookie("jwt")
-	if err != nil {
-		return "", err
-	}
-	claims, err := decodeJWT(cookie.Value)
-	if err != nil {
-		log.Printf("Error decoding JWT: %v", err)
-		return "", err
+// clearSessionCookies expires the cookies set by setSessionCookies. csrf_token_http_only is no longer set,
+// but is still cleared for browsers holding it from before csrf tokens were bound to the session.
+func clearSessionCookies(w http.ResponseWriter) {
+	isProdEnv, _ := strconv.ParseBool(os.Getenv("PRODUCTION_ENV"))
+	for _, cookieName := range []string{"jwt", "csrf_token_http_only", "csrf_token"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    "",
+			HttpOnly: cookieName != "csrf_token",
+			Secure:   isProdEnv,
+			SameSite: http.SameSiteNoneMode,
+			Path:     "/",
+			MaxAge:   -1,
+		})
 	}
+}
 
-	userId, ok := claims["UserId"].(string)
-	if !ok {
-		return "", err
+// GetUserIdFromRequest returns the id of the authenticated user, whichever way the request was authenticated
+func GetUserIdFromRequest(r *http.Request) (string, error) {
+	principal, ok := getPrincipal(r)
+	if !ok || principal.UserId == "" {
+		return "", authentication.ErrUnauthorized
 	}
+	return principal.UserId, nil
+}
 
-	return userId, nil
+// getPrincipal returns the principal stored in the request context by AuthenticatedRouteMiddleware
+func getPrincipal(r *http.Request) (authentication.Principal, bool) {
+	return authentication.PrincipalFromContext(r.Context())
 }
 
-// DecodeJWT decodes a JWT token string and returns the token object or an error if the token is invalid.
-func decodeJWT(tokenString string) (jwt.MapClaims, error) {
-	// Parse the token without validating the signature, as previously validated in the middleware
-	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
-	if err != nil {
-		return nil, err
+// authorizeRequest checks that the principal has the required scope and, if swearJarId is given, is allowed
+// to access that swear jar. Cookie sessions are not restricted.
+func authorizeRequest(r *http.Request, scope authentication.Scope, swearJarId string) error {
+	principal, ok := getPrincipal(r)
+	if !ok {
+		return authentication.ErrUnauthorized
 	}
-
-	// Extract claims and print them in a human-readable format
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		log.Printf("Decoded JWT Token: UserId: %s, Email: %s, Name: %s, Verified: %v, Issued At: %v, Expires At: %v", claims["UserId"], claims["Email"], claims["Name"], claims["Verified"], claims["iat"], claims["exp"])
-		return claims, nil
-	} else {
-		log.Printf("unable to extract claims from token")
-		return nil, errors.New("unable to extract claims from token")
+	if !principal.HasScope(scope) {
+		return authentication.ErrInsufficientScope
+	}
+	if swearJarId != "" && !principal.CanAccessSwearJar(swearJarId) {
+		return authentication.ErrInsufficientScope
 	}
+	return nil
 }
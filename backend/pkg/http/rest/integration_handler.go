@@ -0,0 +1,206 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+)
+
+// CreateLinkCode returns a one-time code which links the chat channel it is sent from to the swear jar
+func (h *Handler) CreateLinkCode(w http.ResponseWriter, r *http.Request, swearJarId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Platform string `json:"Platform"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	code, expiresAt, err := h.integrationService.CreateLinkCode(r.Context(), integration.Platform(req.Platform), swearJarId, userId)
+	if err != nil {
+		log.Printf("Error creating link code: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":       "Link code created successfully",
+		"code":      code,
+		"expiresAt": expiresAt,
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetChannelLinks(w http.ResponseWriter, r *http.Request, swearJarId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	links, err := h.integrationService.GetChannelLinks(r.Context(), swearJarId, userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":   "Channel links fetched successfully",
+		"links": links,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) DeleteChannelLink(w http.ResponseWriter, r *http.Request, swearJarId string, linkId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.integrationService.DeleteChannelLink(r.Context(), swearJarId, userId, linkId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Channel unlinked successfully",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// CreateAccountLinkCode returns a one-time code which links the chat user who sends it to the user, for platforms
+// which do not share the email of their users
+func (h *Handler) CreateAccountLinkCode(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Platform string `json:"Platform"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	code, expiresAt, err := h.integrationService.CreateAccountLinkCode(r.Context(), integration.Platform(req.Platform), userId)
+	if err != nil {
+		log.Printf("Error creating account link code: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":       "Account link code created successfully",
+		"code":      code,
+		"expiresAt": expiresAt,
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetAccountLinks(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	links, err := h.integrationService.GetAccountLinks(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":   "Account links fetched successfully",
+		"links": links,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) DeleteAccountLink(w http.ResponseWriter, r *http.Request, linkId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.integrationService.DeleteAccountLink(r.Context(), userId, linkId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Account unlinked successfully",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
@@ -0,0 +1,333 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/notification"
+)
+
+// GetNotifications returns the inbox of the user with the number of unread notifications. ?unread=true only returns
+// the unread notifications.
+func (h *Handler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	notifications, err := h.notificationService.GetNotifications(r.Context(), userId, r.URL.Query().Get("unread") == "true")
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	unreadCount, err := h.notificationService.GetUnreadCount(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":           "Notifications fetched successfully",
+		"notifications": notifications,
+		"unreadCount":   unreadCount,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	unreadCount, err := h.notificationService.GetUnreadCount(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":         "Unread notification count fetched successfully",
+		"unreadCount": unreadCount,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) MarkNotificationAsRead(w http.ResponseWriter, r *http.Request, notificationId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.notificationService.MarkAsRead(r.Context(), userId, notificationId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Notification marked as read",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) MarkAllNotificationsAsRead(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.notificationService.MarkAllAsRead(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "All notifications marked as read",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// GetNotificationPreferences returns the preferences of the user, with the channels of the types of notification
+// the user has no preference for
+func (h *Handler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	preferences, err := h.notificationService.GetPreferences(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":         "Notification preferences fetched successfully",
+		"preferences": preferences,
+		"defaults":    notification.DefaultChannels,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// SetNotificationPreference sets the channels of a type of notification, in one swear jar or in all swear jars of the
+// user if no SwearJarId is given. An empty list of channels mutes the notification.
+func (h *Handler) SetNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		SwearJarId string   `json:"SwearJarId"`
+		Type       string   `json:"Type"`
+		Channels   []string `json:"Channels"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	preference, err := h.notificationService.SetPreference(r.Context(), userId, req.SwearJarId, notification.Type(req.Type), req.Channels)
+	if err != nil {
+		log.Printf("Error setting notification preference: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":        "Notification preference saved successfully",
+		"preference": preference,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) DeleteNotificationPreference(w http.ResponseWriter, r *http.Request, preferenceId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.notificationService.DeletePreference(r.Context(), userId, preferenceId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Notification preference deleted successfully",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetNotificationWebhook(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	webhook, err := h.notificationService.GetWebhook(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "Notification webhook fetched successfully",
+		"webhook": webhook,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// SetNotificationWebhook sets the url the webhook channel sends notifications to. The secret which signs them is
+// regenerated and only returned here.
+func (h *Handler) SetNotificationWebhook(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		URL string `json:"URL"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	webhook, secret, err := h.notificationService.SetWebhook(r.Context(), userId, req.URL)
+	if err != nil {
+		log.Printf("Error setting notification webhook: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "Notification webhook saved successfully, the secret will not be shown again",
+		"webhook": webhook,
+		"secret":  secret,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) DeleteNotificationWebhook(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.notificationService.DeleteWebhook(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Notification webhook deleted successfully",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
@@ -0,0 +1,362 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oauth"
+)
+
+// respondWithOAuthError writes an RFC 6749 error response
+func respondWithOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		log.Printf("OAuth error: %v", err)
+		oauthErr = &oauth.Error{Code: oauth.ErrCodeServerError}
+	}
+
+	statusCode := http.StatusBadRequest
+	switch oauthErr.Code {
+	case oauth.ErrCodeInvalidClient, oauth.ErrCodeInvalidToken:
+		statusCode = http.StatusUnauthorized
+	case oauth.ErrCodeServerError:
+		statusCode = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	response := map[string]string{"error": oauthErr.Code}
+	if oauthErr.Description != "" {
+		response["error_description"] = oauthErr.Description
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding JSON error response: %v", err)
+	}
+}
+
+// authenticateBearerToken accepts personal API tokens and access tokens issued to OAuth clients.
+// An OAuth access token carries the scopes the user consented to.
+func (h *Handler) authenticateBearerToken(ctx context.Context, rawToken string) (authentication.Principal, error) {
+	if strings.HasPrefix(rawToken, authentication.APITokenPrefix) {
+		apiToken, err := h.authService.AuthenticateAPIToken(ctx, rawToken)
+		if err != nil {
+			return authentication.Principal{}, err
+		}
+		return authentication.APITokenPrincipal(apiToken), nil
+	}
+
+	claims, err := h.oauthService.VerifyAccessToken(ctx, rawToken)
+	if err != nil {
+		return authentication.Principal{}, err
+	}
+	return authentication.Principal{
+		UserId:     claims.Subject,
+		Verified:   true,
+		AuthMethod: authentication.AuthMethodOAuth,
+		Scopes:     append([]authentication.Scope{}, claims.Scopes()...),
+		SessionId:  claims.ID,
+	}, nil
+}
+
+func (h *Handler) OAuthDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(h.oauthService.Discovery()); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// JWKS publishes the public keys that session and OAuth tokens can be verified with
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.authService.JWKS()
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) RegisterOAuthClient(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Name         string   `json:"Name"`
+		RedirectURIs []string `json:"RedirectURIs"`
+		Scopes       []string `json:"Scopes"`
+		Public       bool     `json:"Public"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	client, clientSecret, err := h.oauthService.RegisterClient(r.Context(), userId, req.Name, req.RedirectURIs, req.Scopes, req.Public)
+	if err != nil {
+		log.Printf("Error registering OAuth client: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// The client secret is only ever returned once
+	response := map[string]interface{}{
+		"msg":          "OAuth client registered successfully",
+		"client":       client,
+		"clientSecret": clientSecret,
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	clients, err := h.oauthService.GetClients(r.Context(), userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "fetch successful",
+		"clients": clients,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) DeleteOAuthClient(w http.ResponseWriter, r *http.Request, clientId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.oauthService.DeleteClient(r.Context(), userId, clientId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]string{
+		"msg": "OAuth client deleted successfully",
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// GetOAuthConsent validates an authorization request and returns what the consent screen should display
+func (h *Handler) GetOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	consent, err := h.oauthService.ValidateAuthorizationRequest(r.Context(), oauth.AuthorizationRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientId:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+		Nonce:               q.Get("nonce"),
+	})
+	if err != nil {
+		respondWithOAuthError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "authorization request is valid",
+		"consent": consent,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// OAuthAuthorize records the user's consent decision and returns where to redirect the browser
+func (h *Handler) OAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		ResponseType        string `json:"response_type"`
+		ClientId            string `json:"client_id"`
+		RedirectURI         string `json:"redirect_uri"`
+		Scope               string `json:"scope"`
+		State               string `json:"state"`
+		CodeChallenge       string `json:"code_challenge"`
+		CodeChallengeMethod string `json:"code_challenge_method"`
+		Nonce               string `json:"nonce"`
+		Approved            bool   `json:"approved"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	redirectTo, err := h.oauthService.Authorize(r.Context(), userId, oauth.AuthorizationRequest{
+		ResponseType:        req.ResponseType,
+		ClientId:            req.ClientId,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+	}, req.Approved)
+	if err != nil {
+		respondWithOAuthError(w, err)
+		return
+	}
+
+	response := map[string]string{
+		"msg":        "authorization decision recorded",
+		"redirectTo": redirectTo,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, &oauth.Error{Code: oauth.ErrCodeInvalidRequest, Description: "invalid form body"})
+		return
+	}
+	clientId, clientSecret := getClientCredentials(r)
+
+	token, err := h.oauthService.ExchangeCode(r.Context(), oauth.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	})
+	if err != nil {
+		respondWithOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(token); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+func (h *Handler) OAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, &oauth.Error{Code: oauth.ErrCodeInvalidRequest, Description: "invalid form body"})
+		return
+	}
+	clientId, clientSecret := getClientCredentials(r)
+
+	introspection, err := h.oauthService.Introspect(r.Context(), r.PostForm.Get("token"), clientId, clientSecret)
+	if err != nil {
+		respondWithOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(introspection); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+func (h *Handler) OAuthUserInfo(w http.ResponseWriter, r *http.Request) {
+	rawToken, ok := getBearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		respondWithOAuthError(w, &oauth.Error{Code: oauth.ErrCodeInvalidToken, Description: "bearer token is required"})
+		return
+	}
+
+	info, err := h.oauthService.UserInfo(r.Context(), rawToken)
+	if err != nil {
+		respondWithOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+// getClientCredentials reads client credentials from HTTP basic auth, falling back to the form body
+func getClientCredentials(r *http.Request) (clientId string, clientSecret string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		return id, secret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
@@ -0,0 +1,208 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oidc"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+)
+
+const (
+	oidcFlowCookieName   = "oidc_flow"
+	oidcFlowCookiePath   = "/auth/oidc/"
+	oidcFlowCookieMaxAge = 10 * 60 // seconds
+)
+
+// oidcFlow holds the per-login secrets between the redirect to the provider and the callback
+type oidcFlow struct {
+	Provider     string
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+func (h *Handler) GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := h.oidcProviders.Names()
+	sort.Strings(names)
+
+	response := map[string]interface{}{
+		"msg":       "fetch successful",
+		"providers": names,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// BeginOIDCLogin redirects the browser to the identity provider
+func (h *Handler) BeginOIDCLogin(w http.ResponseWriter, r *http.Request, providerName string) {
+	provider, ok := h.oidcProviders[providerName]
+	if !ok {
+		RespondWithError(w, http.StatusNotFound, "Unknown identity provider")
+		return
+	}
+
+	flow := oidcFlow{Provider: providerName}
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.CodeVerifier} {
+		value, err := oidc.GenerateRandomString()
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, genericErrorMessage)
+			return
+		}
+		*v = value
+	}
+
+	authURL, err := provider.AuthCodeURL(flow.State, flow.Nonce, flow.CodeVerifier)
+	if err != nil {
+		log.Printf("Error building authorization url for %s: %v", providerName, err)
+		RespondWithError(w, http.StatusBadGateway, "Identity provider is unavailable")
+		return
+	}
+
+	if err := setOIDCFlowCookie(w, flow); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, genericErrorMessage)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback validates the state, redeems the code and logs the user in before redirecting back to the frontend
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request, providerName string) {
+	provider, ok := h.oidcProviders[providerName]
+	if !ok {
+		RespondWithError(w, http.StatusNotFound, "Unknown identity provider")
+		return
+	}
+
+	flow, err := getOIDCFlowCookie(r)
+	clearOIDCFlowCookie(w) // the flow can only be completed once
+	if err != nil {
+		log.Printf("OIDC flow cookie error: %v", err)
+		redirectToFrontendLogin(w, r, "oidc_state")
+		return
+	}
+
+	query := r.URL.Query()
+	if flow.Provider != providerName || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+		log.Printf("OIDC state mismatch for provider %s", providerName)
+		redirectToFrontendLogin(w, r, "oidc_state")
+		return
+	}
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("OIDC provider %s returned error: %s", providerName, providerError)
+		redirectToFrontendLogin(w, r, "oidc_denied")
+		return
+	}
+
+	identity, err := provider.Exchange(query.Get("code"), flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		log.Printf("Error exchanging code with %s: %v", providerName, err)
+		redirectToFrontendLogin(w, r, "oidc_failed")
+		return
+	}
+
+	_, jwt, csrfToken, err := h.authService.LoginWithExternalIdentity(r.Context(), authentication.ExternalIdentity{
+		Provider:      identity.Provider,
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Name:          identity.Name,
+	})
+	var secondFactorErr *authentication.SecondFactorRequiredError
+	if errors.As(err, &secondFactorErr) {
+		redirectToFrontendSecondFactor(w, r, secondFactorErr.Options)
+		return
+	}
+	if err != nil {
+		log.Printf("Error logging in with %s: %v", providerName, err)
+		if errors.Is(err, authentication.ErrUnverifiedIdentity) {
+			redirectToFrontendLogin(w, r, "oidc_unverified_email")
+			return
+		}
+		redirectToFrontendLogin(w, r, "oidc_failed")
+		return
+	}
+
+	setSessionCookies(w, jwt, csrfToken)
+	http.Redirect(w, r, os.Getenv("FRONTEND_URL")+"/swearjar", http.StatusFound)
+}
+
+func redirectToFrontendLogin(w http.ResponseWriter, r *http.Request, errorCode string) {
+	http.Redirect(w, r, os.Getenv("FRONTEND_URL")+"/auth/login?error="+url.QueryEscape(errorCode), http.StatusFound)
+}
+
+// redirectToFrontendSecondFactor hands the second factor challenge to the frontend, which completes the login by
+// posting the signed challenge to /auth/login/second-factor
+func redirectToFrontendSecondFactor(w http.ResponseWriter, r *http.Request, options webauthn.RequestOptions) {
+	value, err := json.Marshal(options)
+	if err != nil {
+		redirectToFrontendLogin(w, r, "oidc_failed")
+		return
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(value)
+	http.Redirect(w, r, os.Getenv("FRONTEND_URL")+"/auth/login/second-factor?options="+encoded, http.StatusFound)
+}
+
+func setOIDCFlowCookie(w http.ResponseWriter, flow oidcFlow) error {
+	value, err := json.Marshal(flow)
+	if err != nil {
+		return err
+	}
+	isProdEnv, _ := strconv.ParseBool(os.Getenv("PRODUCTION_ENV"))
+
+	// SameSite=Lax so the cookie is sent on the top-level redirect back from the provider
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		HttpOnly: true,
+		Secure:   isProdEnv,
+		SameSite: http.SameSiteLaxMode,
+		Path:     oidcFlowCookiePath,
+		MaxAge:   oidcFlowCookieMaxAge,
+	})
+	return nil
+}
+
+func getOIDCFlowCookie(r *http.Request) (oidcFlow, error) {
+	cookie, err := r.Cookie(oidcFlowCookieName)
+	if err != nil {
+		return oidcFlow{}, err
+	}
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return oidcFlow{}, err
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(value, &flow); err != nil {
+		return oidcFlow{}, err
+	}
+	if flow.State == "" || flow.Nonce == "" || flow.CodeVerifier == "" {
+		return oidcFlow{}, errors.New("incomplete oidc flow")
+	}
+	return flow, nil
+}
+
+func clearOIDCFlowCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    "",
+		HttpOnly: true,
+		Path:     oidcFlowCookiePath,
+		MaxAge:   -1,
+	})
+}
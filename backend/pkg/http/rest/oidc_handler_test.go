@@ -0,0 +1,220 @@
+package rest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oidc"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/oidc/oidctest"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+)
+
+const testFrontendURL = "http://localhost:3000"
+
+// stubAuthService records the identities logged in with and returns err for them
+type stubAuthService struct {
+	authentication.Service
+	identities []authentication.ExternalIdentity
+	err        error
+}
+
+func (s *stubAuthService) LoginWithExternalIdentity(ctx context.Context, identity authentication.ExternalIdentity) (authentication.UserResponse, string, string, error) {
+	s.identities = append(s.identities, identity)
+	if s.err != nil {
+		return authentication.UserResponse{}, "", "", s.err
+	}
+	return authentication.UserResponse{UserId: "user", Email: identity.Email}, "jwt", "csrf", nil
+}
+
+type oidcCallback struct {
+	query  url.Values
+	cookie *http.Cookie
+}
+
+func newOIDCTestHandler(t *testing.T, user oidctest.User) (*Handler, *stubAuthService) {
+	t.Helper()
+	t.Setenv("FRONTEND_URL", testFrontendURL)
+
+	server := oidctest.NewServer("client", "secret", user)
+	t.Cleanup(server.Close)
+	provider, err := oidc.NewProvider(oidc.ProviderConfig{
+		Name:         "mock",
+		Type:         oidc.ProviderTypeOIDC,
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  "http://localhost:8080/auth/oidc/mock/callback",
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authService := &stubAuthService{}
+	return &Handler{authService: authService, oidcProviders: oidc.Providers{"mock": provider}}, authService
+}
+
+// beginOIDCLogin starts the login and lets the mock provider approve it, returning what the browser brings back
+func beginOIDCLogin(t *testing.T, h *Handler) oidcCallback {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.BeginOIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil), "mock")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("BeginOIDCLogin status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookieName {
+		t.Fatalf("BeginOIDCLogin cookies = %v, want the flow cookie", cookies)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oidcCallback{query: location.Query(), cookie: cookies[0]}
+}
+
+func finishOIDCLogin(h *Handler, callback oidcCallback) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?"+callback.query.Encode(), nil)
+	r.AddCookie(callback.cookie)
+	rec := httptest.NewRecorder()
+	h.OIDCCallback(rec, r, "mock")
+	return rec
+}
+
+func TestOIDCCallback(t *testing.T) {
+	h, authService := newOIDCTestHandler(t, oidctest.User{Subject: "1234", Email: "alex@example.com", EmailVerified: true, Name: "Alex"})
+
+	rec := finishOIDCLogin(h, beginOIDCLogin(t, h))
+	if location := rec.Header().Get("Location"); location != testFrontendURL+"/swearjar" {
+		t.Fatalf("redirected to %s, want the app", location)
+	}
+	want := authentication.ExternalIdentity{Provider: "mock", Subject: "1234", Email: "alex@example.com", EmailVerified: true, Name: "Alex"}
+	if len(authService.identities) != 1 || authService.identities[0] != want {
+		t.Fatalf("logged in with %+v, want %+v", authService.identities, want)
+	}
+
+	cookies := map[string]string{}
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	if cookies["jwt"] != "jwt" || cookies["csrf_token"] != "csrf" {
+		t.Errorf("cookies = %v, want the session cookies", cookies)
+	}
+	if _, ok := cookies[oidcFlowCookieName]; !ok {
+		t.Error("the flow cookie was not cleared")
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	h, authService := newOIDCTestHandler(t, oidctest.User{Subject: "1234", Email: "alex@example.com", EmailVerified: true})
+
+	callback := beginOIDCLogin(t, h)
+	callback.query.Set("state", "forged")
+	rec := finishOIDCLogin(h, callback)
+
+	if location := rec.Header().Get("Location"); location != testFrontendURL+"/auth/login?error=oidc_state" {
+		t.Errorf("redirected to %s, want the oidc_state error", location)
+	}
+	if len(authService.identities) != 0 {
+		t.Error("logged in despite the state mismatch")
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	h, authService := newOIDCTestHandler(t, oidctest.User{Subject: "1234", Email: "alex@example.com", EmailVerified: true})
+
+	// The id token carries the nonce of the authorization request, which no longer matches the flow cookie
+	callback := beginOIDCLogin(t, h)
+	flow := decodeOIDCFlowCookie(t, callback.cookie)
+	flow.Nonce = "another nonce"
+	value, err := json.Marshal(flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback.cookie.Value = base64.RawURLEncoding.EncodeToString(value)
+	rec := finishOIDCLogin(h, callback)
+
+	if location := rec.Header().Get("Location"); location != testFrontendURL+"/auth/login?error=oidc_failed" {
+		t.Errorf("redirected to %s, want the oidc_failed error", location)
+	}
+	if len(authService.identities) != 0 {
+		t.Error("logged in despite the nonce mismatch")
+	}
+}
+
+func TestOIDCCallbackRefusesUnverifiedEmail(t *testing.T) {
+	h, authService := newOIDCTestHandler(t, oidctest.User{Subject: "1234", Email: "alex@example.com", EmailVerified: false})
+	authService.err = authentication.ErrUnverifiedIdentity
+
+	rec := finishOIDCLogin(h, beginOIDCLogin(t, h))
+
+	if len(authService.identities) != 1 || authService.identities[0].EmailVerified {
+		t.Fatalf("logged in with %+v, want the unverified identity", authService.identities)
+	}
+	if location := rec.Header().Get("Location"); location != testFrontendURL+"/auth/login?error=oidc_unverified_email" {
+		t.Errorf("redirected to %s, want the oidc_unverified_email error", location)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "jwt" {
+			t.Error("session cookie was set")
+		}
+	}
+}
+
+func TestOIDCCallbackRequiresSecondFactor(t *testing.T) {
+	h, authService := newOIDCTestHandler(t, oidctest.User{Subject: "1234", Email: "alex@example.com", EmailVerified: true})
+	options := webauthn.RequestOptions{Challenge: "challenge", RPID: "localhost"}
+	authService.err = &authentication.SecondFactorRequiredError{Options: options}
+
+	rec := finishOIDCLogin(h, beginOIDCLogin(t, h))
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), testFrontendURL+"/auth/login/second-factor?") {
+		t.Fatalf("redirected to %s, want the second factor page", location)
+	}
+	value, err := base64.RawURLEncoding.DecodeString(location.Query().Get("options"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got webauthn.RequestOptions
+	if err := json.Unmarshal(value, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Challenge != options.Challenge || got.RPID != options.RPID {
+		t.Errorf("options = %+v, want %+v", got, options)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "jwt" {
+			t.Error("session cookie was set before the second factor")
+		}
+	}
+}
+
+func decodeOIDCFlowCookie(t *testing.T, cookie *http.Cookie) oidcFlow {
+	t.Helper()
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(value, &flow); err != nil {
+		t.Fatal(err)
+	}
+	return flow
+}
@@ -0,0 +1,305 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication/webauthn"
+)
+
+// respondWithLoginError responds to a failed login. Users who protect their account with a passkey get the
+// options to sign the second factor challenge with.
+func respondWithLoginError(w http.ResponseWriter, err error) {
+	var secondFactorErr *authentication.SecondFactorRequiredError
+	switch {
+	case errors.As(err, &secondFactorErr):
+		response := map[string]interface{}{
+			"msg":                  "A passkey is required to complete the login",
+			"secondFactorRequired": true,
+			"options":              secondFactorErr.Options,
+		}
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			respondWithServiceError(w, err)
+		}
+	default:
+		respondWithServiceError(w, err)
+	}
+}
+
+func respondWithSession(w http.ResponseWriter, ur authentication.UserResponse, jwt string, csrfToken string) {
+	setSessionCookies(w, jwt, csrfToken)
+
+	response := map[string]interface{}{
+		"msg":  "Logged in successfully",
+		"user": ur,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	options, err := h.authService.BeginPasskeyRegistration(r.Context(), userId)
+	if err != nil {
+		log.Printf("Error starting passkey registration: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "Passkey registration started",
+		"options": options,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Name       string                        `json:"Name"`
+		Credential webauthn.RegistrationResponse `json:"Credential"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	passkey, err := h.authService.FinishPasskeyRegistration(r.Context(), userId, req.Name, req.Credential)
+	if err != nil {
+		log.Printf("Error finishing passkey registration: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "Passkey registered successfully",
+		"passkey": passkey,
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	passkeys, err := h.authService.GetPasskeys(r.Context(), userId)
+	if err != nil {
+		log.Printf("Error fetching passkeys: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":  "Passkeys fetched successfully",
+		"data": passkeys,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request, credentialId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.authService.DeletePasskey(r.Context(), userId, credentialId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]string{"msg": "Passkey deleted successfully"}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) SetPasskeySecondFactor(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		Enabled    bool                             `json:"Enabled"`
+		Password   string                           `json:"Password"`
+		Credential *webauthn.AuthenticationResponse `json:"Credential"` // Passkey assertion of accounts without a password
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.authService.SetPasskeySecondFactor(r.Context(), userId, authentication.Reauthentication{Password: req.Password, Passkey: req.Credential}, req.Enabled)
+	if err != nil {
+		log.Printf("Error updating passkey second factor: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "Second factor updated successfully",
+		"enabled": req.Enabled,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// BeginReauthentication returns the challenge users without a password sign with a passkey to confirm it's them
+// before deleting their account, changing their email or changing their second factor
+func (h *Handler) BeginReauthentication(w http.ResponseWriter, r *http.Request) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	options, err := h.authService.BeginReauthentication(r.Context(), userId)
+	if err != nil {
+		log.Printf("Error starting reauthentication: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "Reauthentication started",
+		"options": options,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	options, err := h.authService.BeginPasskeyLogin(r.Context())
+	if err != nil {
+		log.Printf("Error starting passkey login: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "Passkey login started",
+		"options": options,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Credential webauthn.AuthenticationResponse `json:"Credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	ur, jwt, csrfToken, err := h.authService.FinishPasskeyLogin(r.Context(), req.Credential)
+	if err != nil {
+		log.Printf("Passkey login error: %v", err)
+		respondWithLoginError(w, err)
+		return
+	}
+
+	respondWithSession(w, ur, jwt, csrfToken)
+}
+
+// FinishSecondFactor completes a password or magic link login with the passkey of the user
+func (h *Handler) FinishSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Credential webauthn.AuthenticationResponse `json:"Credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	ur, jwt, csrfToken, err := h.authService.FinishSecondFactor(r.Context(), req.Credential)
+	if err != nil {
+		log.Printf("Second factor error: %v", err)
+		respondWithLoginError(w, err)
+		return
+	}
+
+	respondWithSession(w, ur, jwt, csrfToken)
+}
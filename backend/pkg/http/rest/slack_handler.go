@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/slack"
+)
+
+// maxSlackRequestSize bounds the body read before its signature is checked
+const maxSlackRequestSize = 64 << 10
+
+// SlackCommand handles the slash commands of the Slack app. Requests are authenticated by their Slack signature
+// instead of a session, the user is mapped to a SwearJar user by the email of their Slack profile.
+func (h *Handler) SlackCommand(w http.ResponseWriter, r *http.Request) {
+	if h.slackService == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSlackRequestSize))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := h.slackService.VerifyRequest(r.Header.Get(slack.TimestampHeader), r.Header.Get(slack.SignatureHeader), body); err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid Slack signature")
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	// Slack checks the certificate of the endpoint with an empty command
+	if form.Get("ssl_check") == "1" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	response := h.slackService.HandleCommand(r.Context(), slack.ParseCommand(form))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding Slack response: %v", err)
+	}
+}
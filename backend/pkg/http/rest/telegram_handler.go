@@ -0,0 +1,44 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/telegram"
+)
+
+// maxTelegramRequestSize bounds the body of an update
+const maxTelegramRequestSize = 64 << 10
+
+// TelegramWebhook handles the updates of the Telegram bot. Requests are authenticated by the secret token the
+// webhook was registered with, the user is mapped to a SwearJar user by their account link.
+func (h *Handler) TelegramWebhook(w http.ResponseWriter, r *http.Request) {
+	if h.telegramService == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := h.telegramService.VerifyRequest(r.Header.Get(telegram.SecretTokenHeader)); err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid Telegram secret token")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTelegramRequestSize))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	var update telegram.Update
+	if err := json.Unmarshal(body, &update); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// A failed update is not redelivered, Telegram would run the command again when retrying
+	if err := h.telegramService.HandleUpdate(r.Context(), update); err != nil {
+		log.Printf("Error handling Telegram update {%d}: %v", update.UpdateId, err)
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,61 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/integration/telegram"
+)
+
+// stubTelegramService accepts the secret token and records the updates it handles
+type stubTelegramService struct {
+	secretToken string
+	updates     []telegram.Update
+}
+
+func (s *stubTelegramService) VerifyRequest(secretToken string) error {
+	return telegram.VerifySecretToken(s.secretToken, secretToken)
+}
+
+func (s *stubTelegramService) HandleUpdate(ctx context.Context, u telegram.Update) error {
+	s.updates = append(s.updates, u)
+	return nil
+}
+
+func TestTelegramWebhookChecksSecretToken(t *testing.T) {
+	body := `{"update_id":10000,"message":{"message_id":1,"from":{"id":1111111,"first_name":"Bob"},"chat":{"id":-1001234567890,"type":"supergroup"},"text":"/clear"}}`
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantUpdate bool
+	}{
+		{"valid token", "secret-token", http.StatusOK, true},
+		{"wrong token", "another-token", http.StatusUnauthorized, false},
+		{"no token", "", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telegramService := &stubTelegramService{secretToken: "secret-token"}
+			h := &Handler{telegramService: telegramService}
+
+			r := httptest.NewRequest(http.MethodPost, "/integrations/telegram/webhook", strings.NewReader(body))
+			if tt.token != "" {
+				r.Header.Set(telegram.SecretTokenHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			h.TelegramWebhook(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if handled := len(telegramService.updates) == 1; handled != tt.wantUpdate {
+				t.Errorf("update handled = %v, want %v", handled, tt.wantUpdate)
+			}
+		})
+	}
+}
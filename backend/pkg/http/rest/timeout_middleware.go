@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const DefaultRequestTimeout = 20 * time.Second
+
+// TimeoutMiddleware sets the deadline of every request, configured with REQUEST_TIMEOUT (e.g. "20s"). Services pass
+// the request context on to the db, so their calls are cancelled once the deadline passes or the client disconnects.
+// Event streams stay open until the client disconnects.
+func TimeoutMiddleware(next http.Handler) http.Handler {
+	timeout := requestTimeoutFromEnv()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isEventStream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestTimeoutFromEnv() time.Duration {
+	value := os.Getenv("REQUEST_TIMEOUT")
+	if value == "" {
+		return DefaultRequestTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		log.Printf("Invalid REQUEST_TIMEOUT: %s, using default %s", value, DefaultRequestTimeout)
+		return DefaultRequestTimeout
+	}
+	return timeout
+}
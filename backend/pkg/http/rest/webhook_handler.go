@@ -0,0 +1,196 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Webhooks are managed from a session only, as the secret of a new webhook is returned in the response
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request, swearJarId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	var req struct {
+		URL    string   `json:"URL"`
+		Events []string `json:"Events"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	webhook, secret, err := h.webhookService.CreateWebhook(r.Context(), swearJarId, userId, req.URL, req.Events)
+	if err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":     "Webhook created successfully, the secret will not be shown again",
+		"webhook": webhook,
+		"secret":  secret,
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request, swearJarId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	webhooks, err := h.webhookService.GetWebhooks(r.Context(), swearJarId, userId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":      "Webhooks fetched successfully",
+		"webhooks": webhooks,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request, swearJarId string, webhookId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.webhookService.DeleteWebhook(r.Context(), swearJarId, userId, webhookId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg": "Webhook deleted successfully",
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request, swearJarId string, webhookId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	deliveries, err := h.webhookService.GetDeliveries(r.Context(), swearJarId, userId, webhookId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":        "Webhook deliveries fetched successfully",
+		"deliveries": deliveries,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+func (h *Handler) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request, swearJarId string, webhookId string, deliveryId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(r.Context(), swearJarId, userId, webhookId, deliveryId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":      "Redelivery queued",
+		"delivery": delivery,
+	}
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
+
+// SendWebhookTestEvent sends a test event and responds with the outcome of the delivery, a failed delivery is not
+// an error of the request
+func (h *Handler) SendWebhookTestEvent(w http.ResponseWriter, r *http.Request, swearJarId string, webhookId string) {
+	if rejectAPIToken(w, r) {
+		return
+	}
+
+	userId, err := GetUserIdFromRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	delivery, err := h.webhookService.SendTestEvent(r.Context(), swearJarId, userId, webhookId)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"msg":      "Test event sent",
+		"delivery": delivery,
+	}
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+}
@@ -0,0 +1,58 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultAPIURL = "https://discord.com/api/v10"
+
+	clientTimeout = 10 * time.Second
+)
+
+// APIClient calls the Discord API with the bot token of the application. Interactions are answered in the response
+// to the interaction, so the client is only needed to register the commands.
+type APIClient struct {
+	baseURL    string
+	botToken   string
+	httpClient *http.Client
+}
+
+func NewAPIClient(baseURL string, botToken string) *APIClient {
+	return &APIClient{
+		baseURL:    baseURL,
+		botToken:   botToken,
+		httpClient: &http.Client{Timeout: clientTimeout},
+	}
+}
+
+// RegisterCommands replaces the global commands of the application, so it can be called on every start
+func (c *APIClient) RegisterCommands(ctx context.Context, applicationId string, commands []ApplicationCommand) error {
+	body, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+"/applications/"+applicationId+"/commands", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+c.botToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discord responded with status %d when registering commands", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package discord
+
+// ApplicationCommand is the definition of a slash command registered with Discord
+type ApplicationCommand struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Options     []OptionDefinition `json:"options,omitempty"`
+}
+
+type OptionDefinition struct {
+	Type        OptionType         `json:"type"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Required    bool               `json:"required,omitempty"`
+	Choices     []OptionChoice     `json:"choices,omitempty"`
+	Options     []OptionDefinition `json:"options,omitempty"`
+}
+
+type OptionChoice struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Commands are the slash commands handled by the service
+var Commands = []ApplicationCommand{
+	{
+		Name:        "swear",
+		Description: "Add a swear to the swear jar of this channel",
+		Options: []OptionDefinition{
+			{Type: OptionUser, Name: "user", Description: "Who swore", Required: true},
+			{Type: OptionString, Name: "description", Description: "What they said"},
+		},
+	},
+	{
+		Name:        "jar",
+		Description: "The swear jar of this channel",
+		Options: []OptionDefinition{
+			{Type: OptionSubCommand, Name: "stats", Description: "Show the stats of the swear jar"},
+			{Type: OptionSubCommand, Name: "leaderboard", Description: "Show who swore the most", Options: []OptionDefinition{
+				{Type: OptionString, Name: "period", Description: "Period of the leaderboard", Choices: []OptionChoice{
+					{Name: "Last 6 days", Value: "days"},
+					{Name: "Last 6 weeks", Value: "weeks"},
+					{Name: "Last 6 months", Value: "months"},
+				}},
+			}},
+			{Type: OptionSubCommand, Name: "link", Description: "Link this channel to a swear jar", Options: []OptionDefinition{
+				{Type: OptionString, Name: "code", Description: "Link code generated in SwearJar", Required: true},
+			}},
+			{Type: OptionSubCommand, Name: "unlink", Description: "Unlink this channel from its swear jar"},
+			{Type: OptionSubCommand, Name: "connect", Description: "Link your Discord account to your SwearJar account", Options: []OptionDefinition{
+				{Type: OptionString, Name: "code", Description: "Account link code generated in SwearJar", Required: true},
+			}},
+		},
+	},
+}
@@ -0,0 +1,171 @@
+package discord
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+type InteractionType int
+
+const (
+	InteractionPing               InteractionType = 1
+	InteractionApplicationCommand InteractionType = 2
+)
+
+type OptionType int
+
+const (
+	OptionSubCommand OptionType = 1
+	OptionString     OptionType = 3
+	OptionUser       OptionType = 6
+)
+
+// Interaction is a command invocation, as posted by Discord to the interactions endpoint
+type Interaction struct {
+	Id        string          `json:"id"`
+	Type      InteractionType `json:"type"`
+	Data      CommandData     `json:"data"`
+	GuildId   string          `json:"guild_id"`
+	ChannelId string          `json:"channel_id"`
+	Member    *Member         `json:"member"` // Set for commands sent in a guild
+	User      *User           `json:"user"`   // Set for commands sent in a direct message
+}
+
+type Member struct {
+	User        User   `json:"user"`
+	Permissions string `json:"permissions"` // Permissions of the member in the channel, as a decimal bit set
+}
+
+type User struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type CommandData struct {
+	Name    string          `json:"name"`
+	Options []CommandOption `json:"options"`
+}
+
+type CommandOption struct {
+	Name    string          `json:"name"`
+	Type    OptionType      `json:"type"`
+	Value   json.RawMessage `json:"value"`
+	Options []CommandOption `json:"options"`
+}
+
+// Sender returns the user who sent the command
+func (i Interaction) Sender() User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	if i.User != nil {
+		return *i.User
+	}
+	return User{}
+}
+
+// permissionManageChannels is required to link a channel, so not every member of a guild can move its channels
+const permissionManageChannels = 1 << 4
+
+func (i Interaction) canManageChannels() bool {
+	if i.Member == nil {
+		return false
+	}
+	permissions, err := strconv.ParseUint(i.Member.Permissions, 10, 64)
+	return err == nil && permissions&permissionManageChannels != 0
+}
+
+// subCommand returns the sub command of the command and its options
+func (d CommandData) subCommand() (string, []CommandOption) {
+	for _, option := range d.Options {
+		if option.Type == OptionSubCommand {
+			return option.Name, option.Options
+		}
+	}
+	return "", nil
+}
+
+// stringOption returns the value of a string or user option, which Discord sends as the id of the user
+func stringOption(options []CommandOption, name string) string {
+	for _, option := range options {
+		if option.Name == name {
+			var value string
+			if err := json.Unmarshal(option.Value, &value); err == nil {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+type ResponseType int
+
+const (
+	ResponsePong           ResponseType = 1
+	ResponseChannelMessage ResponseType = 4
+)
+
+// messageFlagEphemeral only shows the message to the user who sent the command
+const messageFlagEphemeral = 1 << 6
+
+// InteractionResponse is the immediate reply to an interaction
+type InteractionResponse struct {
+	Type ResponseType `json:"type"`
+	Data *MessageData `json:"data,omitempty"`
+}
+
+type MessageData struct {
+	Content         string           `json:"content,omitempty"`
+	Embeds          []Embed          `json:"embeds,omitempty"`
+	Flags           int              `json:"flags,omitempty"`
+	AllowedMentions *AllowedMentions `json:"allowed_mentions,omitempty"`
+}
+
+// AllowedMentions with no parse types renders mentions without notifying the mentioned users
+type AllowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+	Footer      *EmbedFooter `json:"footer,omitempty"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type EmbedFooter struct {
+	Text string `json:"text"`
+}
+
+func pong() InteractionResponse {
+	return InteractionResponse{Type: ResponsePong}
+}
+
+// ephemeral replies to the sender only
+func ephemeral(content string) InteractionResponse {
+	return InteractionResponse{Type: ResponseChannelMessage, Data: &MessageData{
+		Content:         content,
+		Flags:           messageFlagEphemeral,
+		AllowedMentions: &AllowedMentions{Parse: []string{}},
+	}}
+}
+
+// inChannel replies to the channel, without notifying the mentioned users
+func inChannel(content string, embeds ...Embed) InteractionResponse {
+	return InteractionResponse{Type: ResponseChannelMessage, Data: &MessageData{
+		Content:         content,
+		Embeds:          embeds,
+		AllowedMentions: &AllowedMentions{Parse: []string{}},
+	}}
+}
+
+func mention(userId string) string {
+	return "<@" + userId + ">"
+}
@@ -0,0 +1,344 @@
+package discord
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+const usage = "Usage:\n" +
+	"• `/swear user description` adds a swear by the user to the swear jar of this channel\n" +
+	"• `/jar stats` and `/jar leaderboard` show the swear jar of this channel\n" +
+	"• `/jar connect code` links your Discord account to the SwearJar account the code was generated for\n" +
+	"• `/jar link code` links this channel to the swear jar the code was generated for in SwearJar\n" +
+	"• `/jar unlink` unlinks this channel"
+
+const genericReply = "Something went wrong, please try again later."
+
+// embedColor is the accent color of the embeds
+const embedColor = 0xE8A33D
+
+// Config is the Discord application the interactions are sent to
+type Config struct {
+	PublicKey     ed25519.PublicKey
+	ApplicationId string
+	BotToken      string // Only needed to register the commands on start
+	APIURL        string
+}
+
+// LoadConfigFromEnv configures the application with DISCORD_PUBLIC_KEY and DISCORD_APPLICATION_ID, and optionally
+// DISCORD_BOT_TOKEN to register the commands. It returns nil if Discord is not configured.
+func LoadConfigFromEnv() (*Config, error) {
+	rawPublicKey, applicationId := os.Getenv("DISCORD_PUBLIC_KEY"), os.Getenv("DISCORD_APPLICATION_ID")
+	if rawPublicKey == "" && applicationId == "" {
+		return nil, nil
+	}
+	if rawPublicKey == "" || applicationId == "" {
+		return nil, errors.New("DISCORD_PUBLIC_KEY and DISCORD_APPLICATION_ID must both be set")
+	}
+
+	publicKey, err := hex.DecodeString(rawPublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("DISCORD_PUBLIC_KEY must be the hex encoded public key of the application")
+	}
+
+	apiURL := os.Getenv("DISCORD_API_URL")
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Config{
+		PublicKey:     publicKey,
+		ApplicationId: applicationId,
+		BotToken:      os.Getenv("DISCORD_BOT_TOKEN"),
+		APIURL:        apiURL,
+	}, nil
+}
+
+type Service interface {
+	VerifyRequest(signature string, timestamp string, body []byte) error
+	HandleInteraction(ctx context.Context, i Interaction) InteractionResponse
+}
+
+type service struct {
+	publicKey ed25519.PublicKey
+	i         integration.Service
+	sj        swearJar.Service
+}
+
+func NewService(config Config, i integration.Service, sj swearJar.Service) Service {
+	return &service{config.PublicKey, i, sj}
+}
+
+func (s *service) VerifyRequest(signature string, timestamp string, body []byte) error {
+	return VerifySignature(s.publicKey, signature, timestamp, body, time.Now())
+}
+
+// HandleInteraction runs a slash command and returns the reply. Errors are replied to the sender only, as Discord
+// shows a generic failure for anything but a successful response.
+func (s *service) HandleInteraction(ctx context.Context, i Interaction) InteractionResponse {
+	if i.Type == InteractionPing {
+		return pong()
+	}
+	if i.Type != InteractionApplicationCommand {
+		return ephemeral(usage)
+	}
+
+	switch i.Data.Name {
+	case "swear":
+		return s.addSwear(ctx, i)
+	case "jar":
+		subCommand, options := i.Data.subCommand()
+		switch subCommand {
+		case "stats":
+			return s.stats(ctx, i)
+		case "leaderboard":
+			return s.leaderboard(ctx, i, stringOption(options, "period"))
+		case "link":
+			return s.link(ctx, i, stringOption(options, "code"))
+		case "unlink":
+			return s.unlink(ctx, i)
+		case "connect":
+			return s.connect(ctx, i, stringOption(options, "code"))
+		}
+	}
+	return ephemeral(usage)
+}
+
+// connect links the sender to the SwearJar user who generated the account link code
+func (s *service) connect(ctx context.Context, i Interaction, code string) InteractionResponse {
+	if _, err := s.i.LinkAccount(ctx, integration.PlatformDiscord, code, i.Sender().Id); err != nil {
+		return s.errorReply(err)
+	}
+	return ephemeral("Your Discord account is now linked to your SwearJar account.")
+}
+
+// link links the channel to the swear jar of the code. Members who cannot manage the channel are not allowed to
+// move it to another swear jar.
+func (s *service) link(ctx context.Context, i Interaction, code string) InteractionResponse {
+	if i.GuildId == "" {
+		return ephemeral("Only server channels can be linked to a swear jar.")
+	}
+	if !i.canManageChannels() {
+		return ephemeral("You need the Manage Channels permission to link this channel.")
+	}
+
+	link, err := s.i.LinkChannel(ctx, integration.PlatformDiscord, code, i.GuildId, i.ChannelId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	name := "the swear jar"
+	if sj, err := s.sj.GetSwearJarById(ctx, link.SwearJarId, link.LinkedBy); err == nil {
+		name = "**" + sj.Name + "**"
+	}
+	return ephemeral("This channel is now linked to " + name + ".")
+}
+
+func (s *service) unlink(ctx context.Context, i Interaction) InteractionResponse {
+	link, userId, err := s.resolveChannel(ctx, i)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	if err := s.i.DeleteChannelLink(withPrincipal(ctx, userId), link.SwearJarId, userId, link.LinkId); err != nil {
+		return s.errorReply(err)
+	}
+	return ephemeral("This channel is no longer linked to a swear jar.")
+}
+
+// addSwear handles `/swear user description`, reported by the sender
+func (s *service) addSwear(ctx context.Context, i Interaction) InteractionResponse {
+	options := i.Data.Options
+	swearerDiscordId, description := stringOption(options, "user"), stringOption(options, "description")
+	if swearerDiscordId == "" {
+		return ephemeral("Pick who swore, e.g. `/swear user:@alice description:broke prod`.")
+	}
+
+	// * 1. Map the reporter and the swearer to SwearJar users by their account links
+	link, reporterId, err := s.resolveChannel(ctx, i)
+	if err != nil {
+		return s.errorReply(err)
+	}
+	swearer, err := s.i.GetAccountLink(ctx, integration.PlatformDiscord, swearerDiscordId)
+	if errors.Is(err, integration.ErrAccountNotLinked) {
+		return ephemeral(mention(swearerDiscordId) + " has not linked their Discord account to SwearJar.")
+	} else if err != nil {
+		return s.errorReply(err)
+	}
+
+	ctx = withPrincipal(ctx, reporterId)
+	if isOwner, err := s.sj.IsOwner(ctx, link.SwearJarId, swearer.UserId); err != nil {
+		return s.errorReply(err)
+	} else if !isOwner {
+		return ephemeral(mention(swearerDiscordId) + " is not an owner of the swear jar of this channel.")
+	}
+
+	// * 2. Add the swear as the reporter, who must be an owner of the swear jar
+	swear := swearJar.Swear{
+		CreatedAt:        time.Now(),
+		Active:           true,
+		UserId:           swearer.UserId,
+		SwearJarId:       link.SwearJarId,
+		SwearDescription: description,
+		ReportedBy:       reporterId,
+	}
+	if err := s.sj.AddSwear(ctx, swear, reporterId); err != nil {
+		return s.errorReply(err)
+	}
+
+	reply := mention(i.Sender().Id) + " added a swear by " + mention(swearerDiscordId)
+	if description != "" {
+		reply += ": " + description
+	}
+	return inChannel(reply)
+}
+
+// stats renders the stats of the swear jar with the weekly trend
+func (s *service) stats(ctx context.Context, i Interaction) InteractionResponse {
+	link, userId, err := s.resolveChannel(ctx, i)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	ctx = withPrincipal(ctx, userId)
+	sj, err := s.sj.GetSwearJarById(ctx, link.SwearJarId, userId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+	stats, err := s.sj.SwearJarStats(ctx, link.SwearJarId, userId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+	trend, err := s.sj.SwearJarTrend(ctx, link.SwearJarId, userId, "weeks")
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	embed := Embed{
+		Title:       sj.Name,
+		Description: sj.Desc,
+		Color:       embedColor,
+		Fields: []EmbedField{
+			{Name: "Active swears", Value: strconv.Itoa(stats.ActiveSwears), Inline: true},
+			{Name: "Owners", Value: strconv.Itoa(len(sj.Owners)), Inline: true},
+		},
+	}
+	if len(trend) > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "Swears per week", Value: formatTrend(trend)})
+	}
+	return inChannel("", embed)
+}
+
+// leaderboard ranks the owners by their swears over the last 6 periods of the trend
+func (s *service) leaderboard(ctx context.Context, i Interaction, period string) InteractionResponse {
+	if period == "" {
+		period = "weeks"
+	}
+
+	link, userId, err := s.resolveChannel(ctx, i)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	ctx = withPrincipal(ctx, userId)
+	sj, err := s.sj.GetSwearJarById(ctx, link.SwearJarId, userId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+	trend, err := s.sj.SwearJarTrend(ctx, link.SwearJarId, userId, period)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	embed := Embed{
+		Title:  "Leaderboard of " + sj.Name,
+		Color:  embedColor,
+		Footer: &EmbedFooter{Text: "Last " + strconv.Itoa(len(trend)) + " " + period},
+	}
+	leaderboard := swearJar.Leaderboard(trend)
+	if len(leaderboard) == 0 {
+		embed.Description = "Nobody swore, well done!"
+	}
+	lines := make([]string, len(leaderboard))
+	for rank, entry := range leaderboard {
+		lines[rank] = fmt.Sprintf("%d. **%s**: %d", rank+1, entry.Name, entry.Swears)
+	}
+	embed.Description += strings.Join(lines, "\n")
+	return inChannel("", embed)
+}
+
+// resolveChannel returns the link of the channel and the SwearJar user linked to the sender
+func (s *service) resolveChannel(ctx context.Context, i Interaction) (integration.ChannelLink, string, error) {
+	if i.GuildId == "" {
+		return integration.ChannelLink{}, "", integration.ErrChannelNotLinked
+	}
+	link, err := s.i.GetChannelLink(ctx, integration.PlatformDiscord, i.GuildId, i.ChannelId)
+	if err != nil {
+		return integration.ChannelLink{}, "", err
+	}
+	account, err := s.i.GetAccountLink(ctx, integration.PlatformDiscord, i.Sender().Id)
+	if err != nil {
+		return integration.ChannelLink{}, "", err
+	}
+	return link, account.UserId, nil
+}
+
+// errorReply explains a domain error to the sender. Any other error is logged and answered with a generic reply.
+func (s *service) errorReply(err error) InteractionResponse {
+	switch {
+	case errors.Is(err, integration.ErrAccountNotLinked):
+		return ephemeral("Your Discord account is not linked to SwearJar yet. Generate an account link code in SwearJar, then send `/jar connect code`.")
+	case errors.Is(err, integration.ErrChannelNotLinked):
+		return ephemeral("This channel is not linked to a swear jar yet. Generate a link code in SwearJar, then send `/jar link code`.")
+	case errors.Is(err, swearJar.ErrNotOwner):
+		return ephemeral("You are not an owner of the swear jar of this channel.")
+	}
+
+	if appErr, ok := apperror.As(err); ok && apperror.KindOf(err) != apperror.KindInternal {
+		return ephemeral(capitalize(appErr.Message) + ".")
+	}
+	log.Printf("DiscordService: Error handling interaction: %v", err)
+	return ephemeral(genericReply)
+}
+
+// formatTrend lists the total swears of each point of the trend
+func formatTrend(trend []swearJar.ChartData) string {
+	lines := make([]string, len(trend))
+	for i, point := range trend {
+		total := 0
+		for _, count := range point.Metrics {
+			total += count
+		}
+		lines[i] = fmt.Sprintf("%s: %d", point.Label, total)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withPrincipal marks the actions of the command as made through Discord in the swear jar activity. Account link
+// codes are generated from protected routes, so the linked user is verified.
+func withPrincipal(ctx context.Context, userId string) context.Context {
+	return authentication.WithPrincipal(ctx, authentication.Principal{
+		UserId:     userId,
+		Verified:   true,
+		AuthMethod: authentication.AuthMethodDiscord,
+	})
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,428 @@
+package discord
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+// fakeClient posts interactions to the service the way Discord does, signed with the key of the application
+type fakeClient struct {
+	key ed25519.PrivateKey
+}
+
+func (c *fakeClient) send(t *testing.T, s Service, i Interaction) InteractionResponse {
+	t.Helper()
+	body, err := json.Marshal(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.post(t, s, body)
+}
+
+// post verifies the signature of the body and handles the interaction, like the interactions endpoint
+func (c *fakeClient) post(t *testing.T, s Service, body []byte) InteractionResponse {
+	t.Helper()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := s.VerifyRequest(sign(c.key, timestamp, body), timestamp, body); err != nil {
+		t.Fatalf("VerifyRequest: %v", err)
+	}
+	var i Interaction
+	if err := json.Unmarshal(body, &i); err != nil {
+		t.Fatal(err)
+	}
+	return s.HandleInteraction(context.Background(), i)
+}
+
+// stubIntegrationService links the channels in links and the Discord users in accounts, and redeems the codes
+type stubIntegrationService struct {
+	integration.Service
+	links        map[string]integration.ChannelLink // by channel id
+	accounts     map[string]integration.AccountLink // by Discord user id
+	channelCodes map[string]integration.ChannelLink
+	accountCodes map[string]string // user id by code
+}
+
+func (s *stubIntegrationService) GetChannelLink(ctx context.Context, platform integration.Platform, workspaceId string, channelId string) (integration.ChannelLink, error) {
+	link, ok := s.links[channelId]
+	if !ok || platform != integration.PlatformDiscord || link.WorkspaceId != workspaceId {
+		return integration.ChannelLink{}, integration.ErrChannelNotLinked
+	}
+	return link, nil
+}
+
+func (s *stubIntegrationService) LinkChannel(ctx context.Context, platform integration.Platform, code string, workspaceId string, channelId string) (integration.ChannelLink, error) {
+	link, ok := s.channelCodes[code]
+	if !ok {
+		return integration.ChannelLink{}, integration.ErrInvalidLinkCode
+	}
+	delete(s.channelCodes, code)
+	link.Platform, link.WorkspaceId, link.ChannelId = platform, workspaceId, channelId
+	s.links[channelId] = link
+	return link, nil
+}
+
+func (s *stubIntegrationService) DeleteChannelLink(ctx context.Context, swearJarId string, userId string, linkId string) error {
+	for channelId, link := range s.links {
+		if link.LinkId == linkId && link.SwearJarId == swearJarId {
+			delete(s.links, channelId)
+			return nil
+		}
+	}
+	return integration.ErrLinkNotFound
+}
+
+func (s *stubIntegrationService) GetAccountLink(ctx context.Context, platform integration.Platform, externalUserId string) (integration.AccountLink, error) {
+	link, ok := s.accounts[externalUserId]
+	if !ok || platform != integration.PlatformDiscord {
+		return integration.AccountLink{}, integration.ErrAccountNotLinked
+	}
+	return link, nil
+}
+
+func (s *stubIntegrationService) LinkAccount(ctx context.Context, platform integration.Platform, code string, externalUserId string) (integration.AccountLink, error) {
+	userId, ok := s.accountCodes[code]
+	if !ok {
+		return integration.AccountLink{}, integration.ErrInvalidLinkCode
+	}
+	delete(s.accountCodes, code)
+	link := integration.AccountLink{Platform: platform, ExternalUserId: externalUserId, UserId: userId}
+	s.accounts[externalUserId] = link
+	return link, nil
+}
+
+// stubSwearJarService is a swear jar with the owners, which only accepts calls made as a Discord user
+type stubSwearJarService struct {
+	swearJar.Service
+	name    string
+	owners  []string
+	swears  []swearJar.Swear
+	trend   []swearJar.ChartData
+	periods []string
+}
+
+func (s *stubSwearJarService) authorize(ctx context.Context, userId string) error {
+	if !slices.Contains(s.owners, userId) {
+		return swearJar.ErrNotOwner
+	}
+	if principal, ok := authentication.PrincipalFromContext(ctx); !ok || principal.AuthMethod != authentication.AuthMethodDiscord || principal.UserId != userId {
+		return errors.New("not called as the Discord user")
+	}
+	return nil
+}
+
+func (s *stubSwearJarService) IsOwner(ctx context.Context, swearJarId string, userId string) (bool, error) {
+	return slices.Contains(s.owners, userId), nil
+}
+
+func (s *stubSwearJarService) AddSwear(ctx context.Context, swear swearJar.Swear, userId string) error {
+	if err := s.authorize(ctx, userId); err != nil {
+		return err
+	}
+	s.swears = append(s.swears, swear)
+	return nil
+}
+
+func (s *stubSwearJarService) GetSwearJarById(ctx context.Context, swearJarId string, userId string) (swearJar.SwearJarWithOwners, error) {
+	owners := []authentication.UserResponse{}
+	for _, ownerId := range s.owners {
+		owners = append(owners, authentication.UserResponse{UserId: ownerId})
+	}
+	return swearJar.SwearJarWithOwners{SwearJarId: swearJarId, Name: s.name, Desc: "Pay up", Owners: owners}, nil
+}
+
+func (s *stubSwearJarService) SwearJarStats(ctx context.Context, swearJarId string, userId string) (swearJar.SwearJarStats, error) {
+	if err := s.authorize(ctx, userId); err != nil {
+		return swearJar.SwearJarStats{}, err
+	}
+	return swearJar.SwearJarStats{ActiveSwears: len(s.swears)}, nil
+}
+
+func (s *stubSwearJarService) SwearJarTrend(ctx context.Context, swearJarId string, userId string, period string) ([]swearJar.ChartData, error) {
+	if err := s.authorize(ctx, userId); err != nil {
+		return nil, err
+	}
+	s.periods = append(s.periods, period)
+	return s.trend, nil
+}
+
+// The Discord users and channels of the recorded interactions: bob reports alice in the office guild
+const (
+	bobDiscordId    = "2100000000000000001"
+	aliceDiscordId  = "2200000000000000002"
+	officeGuildId   = "1000000000000000001"
+	officeChannelId = "1100000000000000002"
+	newChannelId    = "1100000000000000003"
+)
+
+func newTestService() (*service, *fakeClient, *stubIntegrationService, *stubSwearJarService) {
+	c := &fakeClient{key: testKey}
+	i := &stubIntegrationService{
+		links: map[string]integration.ChannelLink{
+			officeChannelId: {LinkId: "link", Platform: integration.PlatformDiscord, WorkspaceId: officeGuildId, ChannelId: officeChannelId, SwearJarId: "jar"},
+		},
+		accounts: map[string]integration.AccountLink{
+			bobDiscordId:   {Platform: integration.PlatformDiscord, ExternalUserId: bobDiscordId, UserId: "bob"},
+			aliceDiscordId: {Platform: integration.PlatformDiscord, ExternalUserId: aliceDiscordId, UserId: "alice"},
+		},
+		channelCodes: map[string]integration.ChannelLink{},
+		accountCodes: map[string]string{},
+	}
+	sj := &stubSwearJarService{name: "Office", owners: []string{"bob", "alice"}}
+	return &service{testKey.Public().(ed25519.PublicKey), i, sj}, c, i, sj
+}
+
+// readInteraction reads an interaction recorded from Discord
+func readInteraction(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// jarCommand is the `/jar` sub command sent by bob in the office channel
+func jarCommand(subCommand string, options ...CommandOption) Interaction {
+	return Interaction{
+		Id:        "1300000000000000009",
+		Type:      InteractionApplicationCommand,
+		Data:      CommandData{Name: "jar", Options: []CommandOption{{Name: subCommand, Type: OptionSubCommand, Options: options}}},
+		GuildId:   officeGuildId,
+		ChannelId: officeChannelId,
+		Member:    &Member{User: User{Id: bobDiscordId, Username: "bob"}, Permissions: "0"},
+	}
+}
+
+func stringValue(name string, value string) CommandOption {
+	raw, _ := json.Marshal(value)
+	return CommandOption{Name: name, Type: OptionString, Value: raw}
+}
+
+// assertEphemeral fails the test unless the response is a reply to the sender only with the content
+func assertEphemeral(t *testing.T, resp InteractionResponse, content string) {
+	t.Helper()
+	if resp.Type != ResponseChannelMessage || resp.Data == nil || resp.Data.Flags != messageFlagEphemeral || resp.Data.Content != content {
+		t.Errorf("response = %+v, want the ephemeral reply %q", resp.Data, content)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	s, _, _, _ := newTestService()
+	body := readInteraction(t, "swear_interaction.json")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	if err := s.VerifyRequest(sign(testKey, timestamp, body), timestamp, body); err != nil {
+		t.Errorf("VerifyRequest: %v", err)
+	}
+	if err := s.VerifyRequest(sign(otherKey, timestamp, body), timestamp, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifyRequest signed with another key = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestHandleInteractionPing(t *testing.T) {
+	s, c, _, _ := newTestService()
+
+	resp := c.post(t, s, []byte(`{"id":"1300000000000000000","application_id":"1234567890123456789","type":1,"version":1}`))
+
+	// Discord checks the endpoint with a ping before accepting it
+	body, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"type":1}` {
+		t.Errorf("response = %s, want a pong", body)
+	}
+}
+
+func TestHandleInteractionAddsSwear(t *testing.T) {
+	s, c, _, sj := newTestService()
+
+	resp := c.post(t, s, readInteraction(t, "swear_interaction.json"))
+
+	if len(sj.swears) != 1 {
+		t.Fatalf("%d swears added, want 1", len(sj.swears))
+	}
+	swear := sj.swears[0]
+	if swear.UserId != "alice" || swear.ReportedBy != "bob" || swear.SwearJarId != "jar" || swear.SwearDescription != "broke prod" || !swear.Active {
+		t.Errorf("added %+v, want a swear by alice reported by bob", swear)
+	}
+	if resp.Type != ResponseChannelMessage || resp.Data.Flags != 0 || resp.Data.Content != "<@2100000000000000001> added a swear by <@2200000000000000002>: broke prod" {
+		t.Errorf("response = %+v, want the swear announced in the channel", resp.Data)
+	}
+	// The mentions are rendered without notifying alice and bob
+	if resp.Data.AllowedMentions == nil || len(resp.Data.AllowedMentions.Parse) != 0 {
+		t.Errorf("allowed mentions = %+v, want none", resp.Data.AllowedMentions)
+	}
+}
+
+func TestHandleInteractionRefusesUnlinkedSwearer(t *testing.T) {
+	s, c, i, sj := newTestService()
+	delete(i.accounts, aliceDiscordId)
+
+	resp := c.post(t, s, readInteraction(t, "swear_interaction.json"))
+
+	assertEphemeral(t, resp, "<@2200000000000000002> has not linked their Discord account to SwearJar.")
+	if len(sj.swears) != 0 {
+		t.Errorf("added %+v, want no swear", sj.swears)
+	}
+}
+
+func TestHandleInteractionInUnlinkedChannel(t *testing.T) {
+	s, c, _, sj := newTestService()
+	i := jarCommand("stats")
+	i.ChannelId = newChannelId
+
+	resp := c.send(t, s, i)
+
+	if !strings.HasPrefix(resp.Data.Content, "This channel is not linked to a swear jar yet.") || len(sj.periods) != 0 {
+		t.Errorf("response = %+v, want the channel reported as unlinked", resp.Data)
+	}
+}
+
+func TestHandleInteractionStats(t *testing.T) {
+	s, c, _, sj := newTestService()
+	sj.swears = make([]swearJar.Swear, 3)
+	sj.trend = []swearJar.ChartData{
+		{Label: "Week 41", Metrics: map[string]int{"alice|-|Alice|-|alice@example.com": 2, "bob|-|Bob|-|bob@example.com": 1}},
+		{Label: "Week 42", Metrics: map[string]int{"alice|-|Alice|-|alice@example.com": 3}},
+	}
+
+	resp := c.send(t, s, jarCommand("stats"))
+
+	if resp.Data == nil || len(resp.Data.Embeds) != 1 {
+		t.Fatalf("response = %+v, want an embed", resp.Data)
+	}
+	embed := resp.Data.Embeds[0]
+	want := []EmbedField{
+		{Name: "Active swears", Value: "3", Inline: true},
+		{Name: "Owners", Value: "2", Inline: true},
+		{Name: "Swears per week", Value: "Week 41: 3\nWeek 42: 3"},
+	}
+	if embed.Title != "Office" || embed.Description != "Pay up" || !slices.Equal(embed.Fields, want) {
+		t.Errorf("embed = %+v, want the stats with the fields %+v", embed, want)
+	}
+	if !slices.Equal(sj.periods, []string{"weeks"}) {
+		t.Errorf("trend of periods %v, want weeks", sj.periods)
+	}
+}
+
+func TestHandleInteractionLeaderboard(t *testing.T) {
+	s, c, _, sj := newTestService()
+	sj.trend = []swearJar.ChartData{
+		{Label: "October", Metrics: map[string]int{"alice|-|Alice|-|alice@example.com": 2, "bob|-|Bob|-|bob@example.com": 1}},
+		{Label: "November", Metrics: map[string]int{"alice|-|Alice|-|alice@example.com": 3}},
+	}
+
+	resp := c.send(t, s, jarCommand("leaderboard", stringValue("period", "months")))
+
+	if resp.Data == nil || len(resp.Data.Embeds) != 1 {
+		t.Fatalf("response = %+v, want an embed", resp.Data)
+	}
+	embed := resp.Data.Embeds[0]
+	if embed.Description != "1. **Alice**: 5\n2. **Bob**: 1" || embed.Footer == nil || embed.Footer.Text != "Last 2 months" {
+		t.Errorf("embed = %+v, want the owners ranked over the months", embed)
+	}
+	if !slices.Equal(sj.periods, []string{"months"}) {
+		t.Errorf("trend of periods %v, want months", sj.periods)
+	}
+}
+
+func TestHandleInteractionRequiresOwner(t *testing.T) {
+	s, c, _, sj := newTestService()
+	sj.owners = []string{"alice"}
+
+	for _, subCommand := range []string{"stats", "leaderboard"} {
+		resp := c.send(t, s, jarCommand(subCommand))
+		assertEphemeral(t, resp, "You are not an owner of the swear jar of this channel.")
+	}
+	if resp := c.post(t, s, readInteraction(t, "swear_interaction.json")); len(sj.swears) != 0 {
+		t.Errorf("response = %+v, want the swear refused", resp.Data)
+	}
+}
+
+func TestHandleInteractionLinksChannel(t *testing.T) {
+	body := readInteraction(t, "link_interaction.json")
+
+	tests := []struct {
+		name        string
+		guildId     string
+		permissions string
+		want        string
+		wantLinked  bool
+	}{
+		// The recorded member has Manage Channels among other permissions
+		{"manage channels", officeGuildId, "2248473465835089", "This channel is now linked to **Office**.", true},
+		{"only manage channels", officeGuildId, "16", "This channel is now linked to **Office**.", true},
+		{"other permissions", officeGuildId, "2248473465835073", "You need the Manage Channels permission to link this channel.", false},
+		{"invalid permissions", officeGuildId, "manage", "You need the Manage Channels permission to link this channel.", false},
+		{"direct message", "", "2248473465835089", "Only server channels can be linked to a swear jar.", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c, i, _ := newTestService()
+			i.channelCodes["7KQ2MX4P"] = integration.ChannelLink{SwearJarId: "jar", LinkedBy: "bob"}
+
+			var interaction Interaction
+			if err := json.Unmarshal(body, &interaction); err != nil {
+				t.Fatal(err)
+			}
+			interaction.GuildId, interaction.Member.Permissions = tt.guildId, tt.permissions
+
+			assertEphemeral(t, c.send(t, s, interaction), tt.want)
+			link, linked := i.links[newChannelId]
+			if linked != tt.wantLinked || linked && (link.SwearJarId != "jar" || link.WorkspaceId != officeGuildId) {
+				t.Errorf("channel links = %v, want the channel linked %v", i.links, tt.wantLinked)
+			}
+		})
+	}
+}
+
+func TestHandleInteractionRedeemsLinkCodesOnce(t *testing.T) {
+	s, c, i, _ := newTestService()
+	i.channelCodes["7KQ2MX4P"] = integration.ChannelLink{SwearJarId: "jar", LinkedBy: "bob"}
+	i.accountCodes["H3NW8RZT"] = "carol"
+
+	// * 1. The channel is linked by the channel code
+	body := readInteraction(t, "link_interaction.json")
+	assertEphemeral(t, c.post(t, s, body), "This channel is now linked to **Office**.")
+	assertEphemeral(t, c.post(t, s, body), "Invalid or expired link code.")
+
+	// * 2. A Discord user is linked by the account code
+	carol := jarCommand("connect", stringValue("code", "H3NW8RZT"))
+	carol.Member.User = User{Id: "2300000000000000003", Username: "carol"}
+	assertEphemeral(t, c.send(t, s, carol), "Your Discord account is now linked to your SwearJar account.")
+	if account, ok := i.accounts["2300000000000000003"]; !ok || account.UserId != "carol" {
+		t.Errorf("account links = %v, want carol linked", i.accounts)
+	}
+
+	// Account codes can be redeemed in a direct message with the bot
+	mallory := jarCommand("connect", stringValue("code", "H3NW8RZT"))
+	mallory.GuildId, mallory.Member, mallory.User = "", nil, &User{Id: "2400000000000000004", Username: "mallory"}
+	assertEphemeral(t, c.send(t, s, mallory), "Invalid or expired link code.")
+	if _, ok := i.accounts["2400000000000000004"]; ok {
+		t.Error("the used code linked mallory")
+	}
+}
+
+func TestHandleInteractionUnlinksChannel(t *testing.T) {
+	s, c, i, _ := newTestService()
+
+	assertEphemeral(t, c.send(t, s, jarCommand("unlink")), "This channel is no longer linked to a swear jar.")
+	if _, ok := i.links[officeChannelId]; ok {
+		t.Errorf("channel links = %v, want the channel unlinked", i.links)
+	}
+}
@@ -0,0 +1,42 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Signature-Ed25519"
+	TimestampHeader = "X-Signature-Timestamp"
+
+	// signatureTolerance is how old a request may be, which limits replaying recorded requests
+	signatureTolerance = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid Discord request signature")
+
+// VerifySignature checks the Ed25519 signature Discord computes over the timestamp followed by the body with the
+// private key of the application, and that the timestamp is within the tolerance. Discord checks the endpoint
+// rejects invalid signatures before accepting it.
+func VerifySignature(publicKey ed25519.PublicKey, signature string, timestamp string, body []byte, now time.Time) error {
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize || len(publicKey) != ed25519.PublicKeySize {
+		return ErrInvalidSignature
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	message := append([]byte(timestamp), body...)
+	if !ed25519.Verify(publicKey, message, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
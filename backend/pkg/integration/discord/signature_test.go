@@ -0,0 +1,71 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testKey is the key pair of the application the test interactions are signed with
+var testKey = ed25519.NewKeyFromSeed([]byte("swearjar-discord-test-key-seed!!"))
+
+// sign returns the signature Discord sends with an interaction, the hex Ed25519 signature of the timestamp
+// followed by the body
+func sign(key ed25519.PrivateKey, timestamp string, body []byte) string {
+	return hex.EncodeToString(ed25519.Sign(key, append([]byte(timestamp), body...)))
+}
+
+func TestVerifySignature(t *testing.T) {
+	body, err := os.ReadFile("testdata/swear_interaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := testKey.Public().(ed25519.PublicKey)
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := sign(testKey, timestamp, body)
+
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-2] ^= 1
+	recent := strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	tests := []struct {
+		name      string
+		publicKey ed25519.PublicKey
+		signature string
+		timestamp string
+		body      []byte
+		wantErr   bool
+	}{
+		{"valid", publicKey, signature, timestamp, body, false},
+		{"recent timestamp", publicKey, sign(testKey, recent, body), recent, body, false},
+		{"tampered body", publicKey, signature, timestamp, tampered, true},
+		{"stale timestamp", publicKey, sign(testKey, stale, body), stale, body, true},
+		{"future timestamp", publicKey, sign(testKey, future, body), future, body, true},
+		{"replayed with a new timestamp", publicKey, signature, strconv.FormatInt(now.Unix()+1, 10), body, true},
+		{"invalid timestamp", publicKey, sign(testKey, "yesterday", body), "yesterday", body, true},
+		{"other key", publicKey, sign(otherKey, timestamp, body), timestamp, body, true},
+		{"bad hex", publicKey, "zz" + signature[2:], timestamp, body, true},
+		{"truncated signature", publicKey, signature[:len(signature)-2], timestamp, body, true},
+		{"no signature", publicKey, "", timestamp, body, true},
+		{"no public key", nil, signature, timestamp, body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.publicKey, tt.signature, tt.timestamp, tt.body, now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifySignature error = %v, want %v", err, ErrInvalidSignature)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("VerifySignature: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Platform string
+
+const (
+	PlatformSlack    Platform = "slack"
+	PlatformDiscord  Platform = "discord"
+	PlatformTelegram Platform = "telegram"
+)
+
+func (p Platform) IsValid() bool {
+	switch p {
+	case PlatformSlack, PlatformDiscord, PlatformTelegram:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	LinkCodeDuration = 15 * time.Minute
+
+	linkCodeLength = 8
+	// linkCodeAlphabet leaves out characters which are easily confused, as codes are typed into a chat
+	linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// LinkCodeKind is what a link code links when it is sent from a chat
+type LinkCodeKind string
+
+const (
+	LinkCodeChannel LinkCodeKind = "channel" // Links the channel to a swear jar
+	LinkCodeAccount LinkCodeKind = "account" // Links the chat user to the SwearJar user
+)
+
+// ChannelLink links a chat channel to a swear jar, so the commands sent in the channel act on the swear jar.
+// WorkspaceId is the Slack team or Discord guild the channel belongs to, Telegram chats have none.
+type ChannelLink struct {
+	LinkId      string    `bson:"_id,omitempty"`
+	Platform    Platform  `bson:"Platform"`
+	WorkspaceId string    `bson:"WorkspaceId"`
+	ChannelId   string    `bson:"ChannelId"`
+	SwearJarId  string    `bson:"SwearJarId"`
+	LinkedBy    string    `bson:"LinkedBy"` // Owner who generated the link code
+	CreatedAt   time.Time `bson:"CreatedAt"`
+}
+
+func (l *ChannelLink) Validate() error {
+	if !l.Platform.IsValid() {
+		return errors.New("invalid platform")
+	}
+	if l.ChannelId == "" {
+		return errors.New("channel id is required")
+	}
+	if l.SwearJarId == "" {
+		return errors.New("swear jar id is required")
+	}
+	return nil
+}
+
+// AccountLink links a chat user to a SwearJar user, for platforms which do not share the email of their users
+type AccountLink struct {
+	LinkId         string    `bson:"_id,omitempty"`
+	Platform       Platform  `bson:"Platform"`
+	ExternalUserId string    `bson:"ExternalUserId"`
+	UserId         string    `bson:"UserId"`
+	CreatedAt      time.Time `bson:"CreatedAt"`
+}
+
+func (l *AccountLink) Validate() error {
+	if !l.Platform.IsValid() {
+		return errors.New("invalid platform")
+	}
+	if l.ExternalUserId == "" {
+		return errors.New("external user id is required")
+	}
+	if l.UserId == "" {
+		return errors.New("user id is required")
+	}
+	return nil
+}
+
+// LinkCode is a one-time code generated in the web app. A channel code is generated by an owner of a swear jar,
+// sending it from a channel links the channel to the swear jar, which proves the sender was given the code by an
+// owner. An account code links the chat user who sends it to the user who generated it.
+type LinkCode struct {
+	Code       string       `bson:"Code" json:"-"` // Hash of the code
+	Kind       LinkCodeKind `bson:"Kind"`
+	Platform   Platform     `bson:"Platform"`
+	SwearJarId string       `bson:"SwearJarId,omitempty"` // Only set for channel codes
+	CreatedBy  string       `bson:"CreatedBy"`
+	CreatedAt  time.Time    `bson:"CreatedAt"`
+	ExpiresAt  time.Time    `bson:"ExpiresAt"`
+}
+
+// NewLinkCode returns the link code to store, with the hash of the raw code which is shown to the user
+func NewLinkCode(kind LinkCodeKind, platform Platform, swearJarId string, userId string) (*LinkCode, string, error) {
+	if !platform.IsValid() {
+		return nil, "", ErrInvalidPlatform
+	}
+	if kind == LinkCodeChannel && swearJarId == "" {
+		return nil, "", errors.New("swear jar id is required")
+	}
+
+	rawCode, err := generateLinkCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	return &LinkCode{
+		Code:       HashLinkCode(rawCode),
+		Kind:       kind,
+		Platform:   platform,
+		SwearJarId: swearJarId,
+		CreatedBy:  userId,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(LinkCodeDuration),
+	}, rawCode, nil
+}
+
+// HashLinkCode hashes a code as typed, so codes are matched regardless of case and surrounding spaces
+func HashLinkCode(code string) string {
+	hash := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	return hex.EncodeToString(hash[:])
+}
+
+func generateLinkCode() (string, error) {
+	codeBytes := make([]byte, linkCodeLength)
+	if _, err := rand.Read(codeBytes); err != nil {
+		return "", fmt.Errorf("failed to generate link code: %w", err)
+	}
+	for i, b := range codeBytes {
+		codeBytes[i] = linkCodeAlphabet[int(b)%len(linkCodeAlphabet)]
+	}
+	return string(codeBytes), nil
+}
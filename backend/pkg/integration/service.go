@@ -0,0 +1,267 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+var ErrInvalidPlatform = apperror.InvalidField("platform", "unknown chat platform")
+var ErrInvalidLinkCode = apperror.NotFound("invalid_link_code", "invalid or expired link code")
+var ErrChannelNotLinked = apperror.NotFound("channel_not_linked", "the channel is not linked to a swear jar")
+var ErrLinkNotFound = apperror.NotFound("channel_link_not_found", "channel link not found")
+var ErrAccountNotLinked = apperror.NotFound("account_not_linked", "the chat account is not linked to a SwearJar account")
+var ErrAccountLinkNotFound = apperror.NotFound("account_link_not_found", "account link not found")
+
+// Service links chat channels to swear jars. The chat platforms build their commands on top of it.
+type Service interface {
+	CreateLinkCode(ctx context.Context, platform Platform, swearJarId string, userId string) (code string, expiresAt time.Time, err error)
+	LinkChannel(ctx context.Context, platform Platform, code string, workspaceId string, channelId string) (ChannelLink, error)
+	GetChannelLink(ctx context.Context, platform Platform, workspaceId string, channelId string) (ChannelLink, error)
+	GetChannelLinks(ctx context.Context, swearJarId string, userId string) ([]ChannelLink, error)
+	DeleteChannelLink(ctx context.Context, swearJarId string, userId string, linkId string) error
+	CreateAccountLinkCode(ctx context.Context, platform Platform, userId string) (code string, expiresAt time.Time, err error)
+	LinkAccount(ctx context.Context, platform Platform, code string, externalUserId string) (AccountLink, error)
+	GetAccountLink(ctx context.Context, platform Platform, externalUserId string) (AccountLink, error)
+	GetAccountLinks(ctx context.Context, userId string) ([]AccountLink, error)
+	DeleteAccountLink(ctx context.Context, userId string, linkId string) error
+}
+
+type Repository interface {
+	CreateLinkCode(ctx context.Context, c LinkCode) error
+	// ConsumeLinkCode deletes the unexpired code with the hash and returns it, so a code is only used once
+	ConsumeLinkCode(ctx context.Context, kind LinkCodeKind, platform Platform, hashedCode string, now time.Time) (LinkCode, error)
+	// UpsertChannelLink replaces the link of the channel, a channel is linked to at most one swear jar
+	UpsertChannelLink(ctx context.Context, l ChannelLink) (ChannelLink, error)
+	GetChannelLink(ctx context.Context, platform Platform, workspaceId string, channelId string) (ChannelLink, error)
+	GetChannelLinkById(ctx context.Context, linkId string) (ChannelLink, error)
+	GetChannelLinksBySwearJarId(ctx context.Context, swearJarId string) ([]ChannelLink, error)
+	DeleteChannelLink(ctx context.Context, linkId string) error
+	// UpsertAccountLink replaces the link of the chat user, a chat user is linked to at most one SwearJar user
+	UpsertAccountLink(ctx context.Context, l AccountLink) (AccountLink, error)
+	GetAccountLink(ctx context.Context, platform Platform, externalUserId string) (AccountLink, error)
+	GetAccountLinksByUserId(ctx context.Context, userId string) ([]AccountLink, error)
+	DeleteAccountLink(ctx context.Context, linkId string, userId string) error
+	GetSwearJarOwners(ctx context.Context, swearJarId string) (owners []string, err error)
+}
+
+type service struct {
+	r Repository
+	a audit.Logger
+}
+
+func NewService(r Repository, a audit.Logger) Service {
+	return &service{r, a}
+}
+
+// CreateLinkCode returns a one-time code which links the channel it is sent from to the swear jar
+func (s *service) CreateLinkCode(ctx context.Context, platform Platform, swearJarId string, userId string) (string, time.Time, error) {
+	if err := s.authorize(ctx, swearJarId, userId); err != nil {
+		return "", time.Time{}, err
+	}
+
+	linkCode, rawCode, err := NewLinkCode(LinkCodeChannel, platform, swearJarId, userId)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := s.r.CreateLinkCode(ctx, *linkCode); err != nil {
+		log.Printf("IntegrationService: Error storing link code in db: %v", err)
+		return "", time.Time{}, err
+	}
+
+	return rawCode, linkCode.ExpiresAt, nil
+}
+
+// LinkChannel redeems the link code sent from the channel. A channel which was already linked is moved to the
+// swear jar of the code.
+func (s *service) LinkChannel(ctx context.Context, platform Platform, code string, workspaceId string, channelId string) (ChannelLink, error) {
+	linkCode, err := s.r.ConsumeLinkCode(ctx, LinkCodeChannel, platform, HashLinkCode(code), time.Now())
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ChannelLink{}, ErrInvalidLinkCode
+		}
+		return ChannelLink{}, err
+	}
+
+	// The owner may have left the swear jar since generating the code
+	if err := s.authorize(ctx, linkCode.SwearJarId, linkCode.CreatedBy); err != nil {
+		return ChannelLink{}, ErrInvalidLinkCode
+	}
+
+	link := ChannelLink{
+		Platform:    platform,
+		WorkspaceId: workspaceId,
+		ChannelId:   channelId,
+		SwearJarId:  linkCode.SwearJarId,
+		LinkedBy:    linkCode.CreatedBy,
+		CreatedAt:   time.Now(),
+	}
+	if err := link.Validate(); err != nil {
+		return ChannelLink{}, err
+	}
+	created, err := s.r.UpsertChannelLink(ctx, link)
+	if err != nil {
+		log.Printf("IntegrationService: Error storing %s channel link in db: %v", platform, err)
+		return ChannelLink{}, err
+	}
+
+	s.logEvent(ctx, linkCode.CreatedBy, audit.ActionIntegrationLinked, created)
+	log.Printf("IntegrationService: %s channel {%s} linked to SwearJar ID: %s", platform, channelId, created.SwearJarId)
+	return created, nil
+}
+
+func (s *service) GetChannelLink(ctx context.Context, platform Platform, workspaceId string, channelId string) (ChannelLink, error) {
+	link, err := s.r.GetChannelLink(ctx, platform, workspaceId, channelId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ChannelLink{}, ErrChannelNotLinked
+		}
+		return ChannelLink{}, err
+	}
+	return link, nil
+}
+
+func (s *service) GetChannelLinks(ctx context.Context, swearJarId string, userId string) ([]ChannelLink, error) {
+	if err := s.authorize(ctx, swearJarId, userId); err != nil {
+		return nil, err
+	}
+	return s.r.GetChannelLinksBySwearJarId(ctx, swearJarId)
+}
+
+func (s *service) DeleteChannelLink(ctx context.Context, swearJarId string, userId string, linkId string) error {
+	if err := s.authorize(ctx, swearJarId, userId); err != nil {
+		return err
+	}
+
+	link, err := s.r.GetChannelLinkById(ctx, linkId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ErrLinkNotFound
+		}
+		return err
+	}
+	if link.SwearJarId != swearJarId {
+		return ErrLinkNotFound
+	}
+
+	if err := s.r.DeleteChannelLink(ctx, link.LinkId); err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, userId, audit.ActionIntegrationUnlinked, link)
+	return nil
+}
+
+// CreateAccountLinkCode returns a one-time code which links the chat user who sends it to the user
+func (s *service) CreateAccountLinkCode(ctx context.Context, platform Platform, userId string) (string, time.Time, error) {
+	linkCode, rawCode, err := NewLinkCode(LinkCodeAccount, platform, "", userId)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := s.r.CreateLinkCode(ctx, *linkCode); err != nil {
+		log.Printf("IntegrationService: Error storing link code in db: %v", err)
+		return "", time.Time{}, err
+	}
+
+	return rawCode, linkCode.ExpiresAt, nil
+}
+
+// LinkAccount redeems the account link code sent by the chat user. A chat user who was already linked is moved to
+// the user of the code.
+func (s *service) LinkAccount(ctx context.Context, platform Platform, code string, externalUserId string) (AccountLink, error) {
+	linkCode, err := s.r.ConsumeLinkCode(ctx, LinkCodeAccount, platform, HashLinkCode(code), time.Now())
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return AccountLink{}, ErrInvalidLinkCode
+		}
+		return AccountLink{}, err
+	}
+
+	link := AccountLink{
+		Platform:       platform,
+		ExternalUserId: externalUserId,
+		UserId:         linkCode.CreatedBy,
+		CreatedAt:      time.Now(),
+	}
+	if err := link.Validate(); err != nil {
+		return AccountLink{}, err
+	}
+	created, err := s.r.UpsertAccountLink(ctx, link)
+	if err != nil {
+		log.Printf("IntegrationService: Error storing %s account link in db: %v", platform, err)
+		return AccountLink{}, err
+	}
+
+	s.a.Log(ctx, audit.Event{
+		ActorId:    created.UserId,
+		Action:     audit.ActionChatAccountLinked,
+		TargetType: audit.TargetAccountLink,
+		TargetId:   created.LinkId,
+		Details:    map[string]string{"platform": string(platform), "externalUserId": externalUserId},
+	})
+	return created, nil
+}
+
+func (s *service) GetAccountLink(ctx context.Context, platform Platform, externalUserId string) (AccountLink, error) {
+	link, err := s.r.GetAccountLink(ctx, platform, externalUserId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return AccountLink{}, ErrAccountNotLinked
+		}
+		return AccountLink{}, err
+	}
+	return link, nil
+}
+
+func (s *service) GetAccountLinks(ctx context.Context, userId string) ([]AccountLink, error) {
+	return s.r.GetAccountLinksByUserId(ctx, userId)
+}
+
+func (s *service) DeleteAccountLink(ctx context.Context, userId string, linkId string) error {
+	if err := s.r.DeleteAccountLink(ctx, linkId, userId); err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ErrAccountLinkNotFound
+		}
+		return err
+	}
+
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     audit.ActionChatAccountUnlinked,
+		TargetType: audit.TargetAccountLink,
+		TargetId:   linkId,
+	})
+	return nil
+}
+
+// authorize checks the user is an owner of the swear jar, owners manage the channels linked to it
+func (s *service) authorize(ctx context.Context, swearJarId string, userId string) error {
+	owners, err := s.r.GetSwearJarOwners(ctx, swearJarId)
+	if err != nil {
+		return err
+	}
+	for _, ownerId := range owners {
+		if ownerId == userId {
+			return nil
+		}
+	}
+	return swearJar.ErrNotOwner
+}
+
+// logEvent records the change to a channel link in the activity of its swear jar
+func (s *service) logEvent(ctx context.Context, userId string, action audit.Action, link ChannelLink) {
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     action,
+		TargetType: audit.TargetChannelLink,
+		TargetId:   link.LinkId,
+		SwearJarId: link.SwearJarId,
+		Details:    map[string]string{"platform": string(link.Platform), "channelId": link.ChannelId},
+	})
+}
@@ -0,0 +1,84 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultAPIURL = "https://slack.com/api"
+
+	clientTimeout = 5 * time.Second
+)
+
+var ErrUserNotFound = errors.New("slack user not found")
+
+// Client calls the Slack Web API. Tests use a fake instead of a live workspace.
+type Client interface {
+	// GetUserEmail returns the email of the Slack user, which requires the users:read.email scope
+	GetUserEmail(ctx context.Context, userId string) (string, error)
+}
+
+// APIClient calls the Web API with the bot token of the app
+type APIClient struct {
+	baseURL    string
+	botToken   string
+	httpClient *http.Client
+}
+
+func NewAPIClient(baseURL string, botToken string) *APIClient {
+	return &APIClient{
+		baseURL:    baseURL,
+		botToken:   botToken,
+		httpClient: &http.Client{Timeout: clientTimeout},
+	}
+}
+
+func (c *APIClient) GetUserEmail(ctx context.Context, userId string) (string, error) {
+	var response struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		User  struct {
+			Profile struct {
+				Email string `json:"email"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	if err := c.get(ctx, "users.info", url.Values{"user": {userId}}, &response); err != nil {
+		return "", err
+	}
+
+	switch {
+	case response.Error == "user_not_found":
+		return "", ErrUserNotFound
+	case !response.OK:
+		return "", fmt.Errorf("slack users.info failed: %s", response.Error)
+	case response.User.Profile.Email == "":
+		return "", ErrUserNotFound
+	}
+	return response.User.Profile.Email, nil
+}
+
+func (c *APIClient) get(ctx context.Context, method string, query url.Values, response interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/"+method+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.botToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack %s responded with status %d", method, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
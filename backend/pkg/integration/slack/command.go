@@ -0,0 +1,63 @@
+package slack
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Command is a slash command invocation, as posted by Slack in a form encoded body
+type Command struct {
+	TeamId      string
+	ChannelId   string
+	UserId      string
+	Command     string
+	Text        string
+	ResponseURL string
+}
+
+func ParseCommand(form url.Values) Command {
+	return Command{
+		TeamId:      form.Get("team_id"),
+		ChannelId:   form.Get("channel_id"),
+		UserId:      form.Get("user_id"),
+		Command:     form.Get("command"),
+		Text:        strings.TrimSpace(form.Get("text")),
+		ResponseURL: form.Get("response_url"),
+	}
+}
+
+type ResponseType string
+
+const (
+	ResponseEphemeral ResponseType = "ephemeral" // Only shown to the user who sent the command
+	ResponseInChannel ResponseType = "in_channel"
+)
+
+// Response is the immediate reply to a slash command
+type Response struct {
+	ResponseType ResponseType `json:"response_type"`
+	Text         string       `json:"text"`
+}
+
+func Ephemeral(text string) Response {
+	return Response{ResponseType: ResponseEphemeral, Text: text}
+}
+
+// mentionPattern matches a user mention at the start of the text. Slack only sends mentions as ids, e.g.
+// "<@U024BE7LH|alice>", when "Escape channels, users, and links" is enabled for the command.
+var mentionPattern = regexp.MustCompile(`^<@([UW][A-Z0-9]+)(?:\|[^>]*)?>\s*(.*)$`)
+
+// parseMention splits "<@U024BE7LH|alice> broke prod" into the mentioned user id and the rest of the text
+func parseMention(text string) (userId string, rest string, ok bool) {
+	match := mentionPattern.FindStringSubmatch(text)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], strings.TrimSpace(match[2]), true
+}
+
+// mention formats a user id as a mention Slack renders with the name of the user
+func mention(userId string) string {
+	return "<@" + userId + ">"
+}
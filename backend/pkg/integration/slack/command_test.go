@@ -0,0 +1,61 @@
+package slack
+
+import (
+	"net/url"
+	"os"
+	"testing"
+)
+
+// readCommand parses a recorded slash command payload from testdata
+func readCommand(t *testing.T, name string) Command {
+	t.Helper()
+	body, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ParseCommand(form)
+}
+
+func TestParseCommand(t *testing.T) {
+	cmd := readCommand(t, "swear_command.txt")
+	want := Command{
+		TeamId:      "T0001",
+		ChannelId:   "C2147483705",
+		UserId:      "U2147483697",
+		Command:     "/swear",
+		Text:        "<@U024BE7LH|alice> broke prod",
+		ResponseURL: "https://hooks.slack.com/commands/T0001/1234567890/abcdefGHIJKL",
+	}
+	if cmd != want {
+		t.Errorf("ParseCommand = %+v, want %+v", cmd, want)
+	}
+}
+
+func TestParseMention(t *testing.T) {
+	tests := []struct {
+		text       string
+		wantUserId string
+		wantRest   string
+		wantOk     bool
+	}{
+		{"<@U024BE7LH|alice> broke prod", "U024BE7LH", "broke prod", true},
+		{"<@U024BE7LH> broke prod", "U024BE7LH", "broke prod", true},
+		{"<@W0123ABCD|alice>", "W0123ABCD", "", true},
+		{"<@U024BE7LH|alice>   broke   prod  ", "U024BE7LH", "broke   prod", true},
+		// Without escaping, Slack sends the name as typed, which can't be mapped to a user
+		{"@alice broke prod", "", "", false},
+		{"broke prod <@U024BE7LH|alice>", "", "", false},
+		{"<#C2147483705|general> broke prod", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		userId, rest, ok := parseMention(tt.text)
+		if userId != tt.wantUserId || rest != tt.wantRest || ok != tt.wantOk {
+			t.Errorf("parseMention(%q) = %q, %q, %v, want %q, %q, %v", tt.text, userId, rest, ok, tt.wantUserId, tt.wantRest, tt.wantOk)
+		}
+	}
+}
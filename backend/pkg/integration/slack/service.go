@@ -0,0 +1,234 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+const usage = "Usage:\n" +
+	"• `/swear @alice broke prod` adds a swear by @alice to the swear jar of this channel\n" +
+	"• `/swear link <code>` links this channel to the swear jar the code was generated for in SwearJar\n" +
+	"• `/swear unlink` unlinks this channel"
+
+const genericReply = "Something went wrong, please try again later."
+
+var errNoAccount = errors.New("no verified SwearJar account with the email of the Slack user")
+
+// Config is the Slack app the commands are sent from
+type Config struct {
+	SigningSecret string
+	BotToken      string
+	APIURL        string
+}
+
+// LoadConfigFromEnv configures the app with SLACK_SIGNING_SECRET and SLACK_BOT_TOKEN. It returns nil if Slack is
+// not configured.
+func LoadConfigFromEnv() (*Config, error) {
+	signingSecret, botToken := os.Getenv("SLACK_SIGNING_SECRET"), os.Getenv("SLACK_BOT_TOKEN")
+	if signingSecret == "" && botToken == "" {
+		return nil, nil
+	}
+	if signingSecret == "" || botToken == "" {
+		return nil, errors.New("SLACK_SIGNING_SECRET and SLACK_BOT_TOKEN must both be set")
+	}
+
+	apiURL := os.Getenv("SLACK_API_URL")
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Config{SigningSecret: signingSecret, BotToken: botToken, APIURL: apiURL}, nil
+}
+
+type Service interface {
+	VerifyRequest(timestamp string, signature string, body []byte) error
+	HandleCommand(ctx context.Context, cmd Command) Response
+}
+
+// UserRepository finds the SwearJar user of a Slack user by email
+type UserRepository interface {
+	GetUserByEmail(ctx context.Context, email string) (authentication.User, error)
+}
+
+type service struct {
+	signingSecret string
+	c             Client
+	i             integration.Service
+	sj            swearJar.Service
+	r             UserRepository
+}
+
+func NewService(config Config, c Client, i integration.Service, sj swearJar.Service, r UserRepository) Service {
+	return &service{config.SigningSecret, c, i, sj, r}
+}
+
+func (s *service) VerifyRequest(timestamp string, signature string, body []byte) error {
+	return VerifySignature(s.signingSecret, timestamp, signature, body, time.Now())
+}
+
+// HandleCommand runs a slash command and returns the ephemeral reply. Errors are replied to the user, as Slack
+// shows a generic failure for anything but a successful response.
+func (s *service) HandleCommand(ctx context.Context, cmd Command) Response {
+	action, rest, _ := strings.Cut(cmd.Text, " ")
+	switch strings.ToLower(action) {
+	case "", "help":
+		return Ephemeral(usage)
+	case "link":
+		return s.link(ctx, cmd, strings.TrimSpace(rest))
+	case "unlink":
+		return s.unlink(ctx, cmd)
+	default:
+		return s.addSwear(ctx, cmd)
+	}
+}
+
+func (s *service) link(ctx context.Context, cmd Command, code string) Response {
+	if code == "" {
+		return Ephemeral("Generate a link code for the swear jar in SwearJar, then send `/swear link <code>` in this channel.")
+	}
+
+	link, err := s.i.LinkChannel(ctx, integration.PlatformSlack, code, cmd.TeamId, cmd.ChannelId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	name := "the swear jar"
+	if sj, err := s.sj.GetSwearJarById(ctx, link.SwearJarId, link.LinkedBy); err == nil {
+		name = "*" + sj.Name + "*"
+	}
+	return Ephemeral("This channel is now linked to " + name + ".")
+}
+
+func (s *service) unlink(ctx context.Context, cmd Command) Response {
+	link, err := s.i.GetChannelLink(ctx, integration.PlatformSlack, cmd.TeamId, cmd.ChannelId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+	user, err := s.resolveUser(ctx, cmd.UserId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	if err := s.i.DeleteChannelLink(withPrincipal(ctx, user), link.SwearJarId, user.UserId, link.LinkId); err != nil {
+		return s.errorReply(err)
+	}
+	return Ephemeral("This channel is no longer linked to a swear jar.")
+}
+
+// addSwear handles `/swear @alice broke prod`, reported by the user who sent the command
+func (s *service) addSwear(ctx context.Context, cmd Command) Response {
+	swearerSlackId, description, ok := parseMention(cmd.Text)
+	if !ok {
+		return Ephemeral("Mention who swore, e.g. `/swear @alice broke prod`.\n\n" + usage)
+	}
+
+	link, err := s.i.GetChannelLink(ctx, integration.PlatformSlack, cmd.TeamId, cmd.ChannelId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	// * 1. Map the reporter and the swearer to SwearJar users by their emails
+	reporter, err := s.resolveUser(ctx, cmd.UserId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+	swearer, err := s.resolveUser(ctx, swearerSlackId)
+	if errors.Is(err, errNoAccount) {
+		return Ephemeral(mention(swearerSlackId) + " does not have a verified SwearJar account with the email of their Slack profile.")
+	} else if err != nil {
+		return s.errorReply(err)
+	}
+
+	ctx = withPrincipal(ctx, reporter)
+	if isOwner, err := s.sj.IsOwner(ctx, link.SwearJarId, swearer.UserId); err != nil {
+		return s.errorReply(err)
+	} else if !isOwner {
+		return Ephemeral(mention(swearerSlackId) + " is not an owner of the swear jar of this channel.")
+	}
+
+	// * 2. Add the swear as the reporter, who must be an owner of the swear jar
+	swear := swearJar.Swear{
+		CreatedAt:        time.Now(),
+		Active:           true,
+		UserId:           swearer.UserId,
+		SwearJarId:       link.SwearJarId,
+		SwearDescription: description,
+		ReportedBy:       reporter.UserId,
+	}
+	if err := s.sj.AddSwear(ctx, swear, reporter.UserId); err != nil {
+		return s.errorReply(err)
+	}
+
+	reply := "Added a swear by " + mention(swearerSlackId)
+	if description != "" {
+		reply += ": " + description
+	}
+	return Ephemeral(reply)
+}
+
+// resolveUser returns the verified SwearJar user with the email of the Slack user. Only verified accounts are
+// matched, as an unverified account may have been signed up with someone else's email.
+func (s *service) resolveUser(ctx context.Context, slackUserId string) (authentication.User, error) {
+	email, err := s.c.GetUserEmail(ctx, slackUserId)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return authentication.User{}, errNoAccount
+		}
+		return authentication.User{}, fmt.Errorf("error fetching email of Slack user {%s}: %w", slackUserId, err)
+	}
+
+	user, err := s.r.GetUserByEmail(ctx, strings.ToLower(email))
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return authentication.User{}, errNoAccount
+		}
+		return authentication.User{}, err
+	}
+	if !user.Verified {
+		return authentication.User{}, errNoAccount
+	}
+	return user, nil
+}
+
+// errorReply explains a domain error to the user. Any other error is logged and answered with a generic reply.
+func (s *service) errorReply(err error) Response {
+	switch {
+	case errors.Is(err, errNoAccount):
+		return Ephemeral("Your Slack email does not match a verified SwearJar account.")
+	case errors.Is(err, integration.ErrChannelNotLinked):
+		return Ephemeral("This channel is not linked to a swear jar yet. Generate a link code in SwearJar, then send `/swear link <code>`.")
+	case errors.Is(err, swearJar.ErrNotOwner):
+		return Ephemeral("You are not an owner of the swear jar of this channel.")
+	}
+
+	if appErr, ok := apperror.As(err); ok && apperror.KindOf(err) != apperror.KindInternal {
+		return Ephemeral(capitalize(appErr.Message) + ".")
+	}
+	log.Printf("SlackService: Error handling command: %v", err)
+	return Ephemeral(genericReply)
+}
+
+// withPrincipal marks the actions of the command as made through Slack in the swear jar activity
+func withPrincipal(ctx context.Context, user authentication.User) context.Context {
+	return authentication.WithPrincipal(ctx, authentication.Principal{
+		UserId:     user.UserId,
+		Verified:   user.Verified,
+		AuthMethod: authentication.AuthMethodSlack,
+	})
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,219 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+// fakeClient returns the emails of the Slack users of the workspace
+type fakeClient struct {
+	emails map[string]string
+}
+
+func (c *fakeClient) GetUserEmail(ctx context.Context, userId string) (string, error) {
+	email, ok := c.emails[userId]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return email, nil
+}
+
+type fakeUserRepository struct {
+	users []authentication.User
+}
+
+func (r *fakeUserRepository) GetUserByEmail(ctx context.Context, email string) (authentication.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return authentication.User{}, authentication.ErrNoDocuments
+}
+
+// stubIntegrationService links the channels in links and the codes in codes
+type stubIntegrationService struct {
+	integration.Service
+	links map[string]integration.ChannelLink // by channel id
+	codes map[string]integration.ChannelLink // by code
+}
+
+func (s *stubIntegrationService) GetChannelLink(ctx context.Context, platform integration.Platform, workspaceId string, channelId string) (integration.ChannelLink, error) {
+	link, ok := s.links[channelId]
+	if !ok || platform != integration.PlatformSlack || link.WorkspaceId != workspaceId {
+		return integration.ChannelLink{}, integration.ErrChannelNotLinked
+	}
+	return link, nil
+}
+
+func (s *stubIntegrationService) LinkChannel(ctx context.Context, platform integration.Platform, code string, workspaceId string, channelId string) (integration.ChannelLink, error) {
+	link, ok := s.codes[code]
+	if !ok {
+		return integration.ChannelLink{}, integration.ErrInvalidLinkCode
+	}
+	delete(s.codes, code)
+	link.Platform, link.WorkspaceId, link.ChannelId = platform, workspaceId, channelId
+	s.links[channelId] = link
+	return link, nil
+}
+
+// stubSwearJarService records the swears added to the swear jar with the owners
+type stubSwearJarService struct {
+	swearJar.Service
+	name   string
+	owners []string
+	swears []swearJar.Swear
+}
+
+func (s *stubSwearJarService) IsOwner(ctx context.Context, swearJarId string, userId string) (bool, error) {
+	return slices.Contains(s.owners, userId), nil
+}
+
+func (s *stubSwearJarService) AddSwear(ctx context.Context, swear swearJar.Swear, userId string) error {
+	if !slices.Contains(s.owners, userId) {
+		return swearJar.ErrNotOwner
+	}
+	if principal, ok := authentication.PrincipalFromContext(ctx); !ok || principal.AuthMethod != authentication.AuthMethodSlack || principal.UserId != userId {
+		return errors.New("swear not added as the Slack user")
+	}
+	s.swears = append(s.swears, swear)
+	return nil
+}
+
+func (s *stubSwearJarService) GetSwearJarById(ctx context.Context, swearJarId string, userId string) (swearJar.SwearJarWithOwners, error) {
+	return swearJar.SwearJarWithOwners{SwearJarId: swearJarId, Name: s.name}, nil
+}
+
+// The Slack users of the recorded commands: bob sends them, mentioning alice
+const (
+	bobSlackId   = "U2147483697"
+	aliceSlackId = "U024BE7LH"
+)
+
+func newTestService() (*service, *fakeClient, *fakeUserRepository, *stubSwearJarService) {
+	c := &fakeClient{emails: map[string]string{
+		bobSlackId:   "bob@example.com",
+		aliceSlackId: "Alice@Example.com",
+	}}
+	r := &fakeUserRepository{users: []authentication.User{
+		{UserId: "bob", Email: "bob@example.com", Verified: true},
+		{UserId: "alice", Email: "alice@example.com", Verified: true},
+	}}
+	i := &stubIntegrationService{
+		links: map[string]integration.ChannelLink{
+			"C2147483705": {LinkId: "link", Platform: integration.PlatformSlack, WorkspaceId: "T0001", ChannelId: "C2147483705", SwearJarId: "jar"},
+		},
+		codes: map[string]integration.ChannelLink{},
+	}
+	sj := &stubSwearJarService{name: "Office", owners: []string{"bob", "alice"}}
+	return &service{"signing-secret", c, i, sj, r}, c, r, sj
+}
+
+func TestHandleCommandAddsSwear(t *testing.T) {
+	s, _, _, sj := newTestService()
+
+	resp := s.HandleCommand(context.Background(), readCommand(t, "swear_command.txt"))
+
+	if resp.ResponseType != ResponseEphemeral || resp.Text != "Added a swear by <@U024BE7LH>: broke prod" {
+		t.Errorf("HandleCommand = %+v, want the swear confirmed", resp)
+	}
+	if len(sj.swears) != 1 {
+		t.Fatalf("%d swears added, want 1", len(sj.swears))
+	}
+	swear := sj.swears[0]
+	if swear.UserId != "alice" || swear.ReportedBy != "bob" || swear.SwearJarId != "jar" || swear.SwearDescription != "broke prod" || !swear.Active {
+		t.Errorf("added %+v, want a swear by alice reported by bob", swear)
+	}
+}
+
+func TestHandleCommandRequiresEscapedMention(t *testing.T) {
+	s, _, _, sj := newTestService()
+
+	resp := s.HandleCommand(context.Background(), readCommand(t, "swear_command_unescaped.txt"))
+
+	if !strings.HasPrefix(resp.Text, "Mention who swore") || len(sj.swears) != 0 {
+		t.Errorf("HandleCommand = %+v, want the usage", resp)
+	}
+}
+
+func TestHandleCommandLinksChannel(t *testing.T) {
+	s, _, _, _ := newTestService()
+	cmd := readCommand(t, "link_command.txt")
+	cmd.ChannelId = "C0NEWCHANNEL"
+	s.i.(*stubIntegrationService).codes["7KQ2MX4P"] = integration.ChannelLink{SwearJarId: "jar", LinkedBy: "bob"}
+
+	if resp := s.HandleCommand(context.Background(), cmd); resp.Text != "This channel is now linked to *Office*." {
+		t.Errorf("HandleCommand = %+v, want the channel linked", resp)
+	}
+	// The code can only be used once
+	if resp := s.HandleCommand(context.Background(), cmd); resp.Text != "Invalid or expired link code." {
+		t.Errorf("HandleCommand with a used code = %+v, want it rejected", resp)
+	}
+}
+
+func TestHandleCommandInUnlinkedChannel(t *testing.T) {
+	s, _, _, sj := newTestService()
+	cmd := readCommand(t, "swear_command.txt")
+	cmd.ChannelId = "C0UNLINKED"
+
+	resp := s.HandleCommand(context.Background(), cmd)
+
+	if !strings.HasPrefix(resp.Text, "This channel is not linked to a swear jar yet.") || len(sj.swears) != 0 {
+		t.Errorf("HandleCommand = %+v, want the channel reported as unlinked", resp)
+	}
+}
+
+func TestResolveUserByEmail(t *testing.T) {
+	s, c, r, _ := newTestService()
+	c.emails["U0UNVERIFIED"] = "mallory@example.com"
+	c.emails["U0NOACCOUNT"] = "carol@example.com"
+	r.users = append(r.users, authentication.User{UserId: "mallory", Email: "mallory@example.com", Verified: false})
+
+	tests := []struct {
+		slackUserId string
+		wantUserId  string
+		wantErr     error
+	}{
+		{bobSlackId, "bob", nil},
+		// Slack keeps the case of the email, SwearJar stores it lowercase
+		{aliceSlackId, "alice", nil},
+		// An unverified account may have been signed up with the email of someone else
+		{"U0UNVERIFIED", "", errNoAccount},
+		{"U0NOACCOUNT", "", errNoAccount},
+		{"U0UNKNOWN", "", errNoAccount},
+	}
+	for _, tt := range tests {
+		user, err := s.resolveUser(context.Background(), tt.slackUserId)
+		if user.UserId != tt.wantUserId || !errors.Is(err, tt.wantErr) {
+			t.Errorf("resolveUser(%s) = %q, %v, want %q, %v", tt.slackUserId, user.UserId, err, tt.wantUserId, tt.wantErr)
+		}
+	}
+}
+
+func TestHandleCommandWithUnmappedUsers(t *testing.T) {
+	s, c, _, sj := newTestService()
+
+	// The swearer has no SwearJar account with the email of their Slack profile
+	c.emails[aliceSlackId] = "alice@elsewhere.com"
+	resp := s.HandleCommand(context.Background(), readCommand(t, "swear_command.txt"))
+	if resp.Text != "<@U024BE7LH> does not have a verified SwearJar account with the email of their Slack profile." {
+		t.Errorf("HandleCommand = %+v, want the swearer reported as unmapped", resp)
+	}
+
+	// Nor has the reporter
+	delete(c.emails, bobSlackId)
+	resp = s.HandleCommand(context.Background(), readCommand(t, "swear_command.txt"))
+	if resp.Text != "Your Slack email does not match a verified SwearJar account." {
+		t.Errorf("HandleCommand = %+v, want the reporter reported as unmapped", resp)
+	}
+	if len(sj.swears) != 0 {
+		t.Errorf("%d swears added, want none", len(sj.swears))
+	}
+}
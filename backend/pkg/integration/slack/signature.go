@@ -0,0 +1,46 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Slack-Signature"
+	TimestampHeader = "X-Slack-Request-Timestamp"
+
+	signatureVersion = "v0"
+	// signatureTolerance is how old a request may be, which limits replaying recorded requests
+	signatureTolerance = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid Slack request signature")
+
+// Sign returns the signature Slack sends with a request, "v0=<hex HMAC-SHA256>" of "v0:<timestamp>:<body>"
+// computed with the signing secret of the app
+func Sign(signingSecret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(signatureVersion + ":" + timestamp + ":"))
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the request was signed by Slack with the signing secret within the tolerance
+func VerifySignature(signingSecret string, timestamp string, signature string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signingSecret == "" {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(Sign(signingSecret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
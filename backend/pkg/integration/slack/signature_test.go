@@ -0,0 +1,75 @@
+package slack
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySignatureRecordedRequest(t *testing.T) {
+	// The example request of the Slack documentation on verifying requests
+	body, err := os.ReadFile("testdata/signed_request.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		signingSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+		timestamp     = "1531420618"
+		signature     = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+	)
+	now := time.Unix(1531420618, 0).Add(30 * time.Second)
+
+	if err := VerifySignature(signingSecret, timestamp, signature, body, now); err != nil {
+		t.Errorf("VerifySignature: %v", err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body, err := os.ReadFile("testdata/swear_command.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const signingSecret = "signing-secret"
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := Sign(signingSecret, timestamp, body)
+
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-1] ^= 1
+	recent := strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name          string
+		signingSecret string
+		timestamp     string
+		signature     string
+		body          []byte
+		wantErr       bool
+	}{
+		{"valid", signingSecret, timestamp, signature, body, false},
+		{"recent timestamp", signingSecret, recent, Sign(signingSecret, recent, body), body, false},
+		{"tampered body", signingSecret, timestamp, signature, tampered, true},
+		{"stale timestamp", signingSecret, stale, Sign(signingSecret, stale, body), body, true},
+		{"future timestamp", signingSecret, future, Sign(signingSecret, future, body), body, true},
+		{"replayed with a new timestamp", signingSecret, strconv.FormatInt(now.Unix()+1, 10), signature, body, true},
+		{"invalid timestamp", signingSecret, "yesterday", signature, body, true},
+		{"other secret", "another-secret", timestamp, signature, body, true},
+		{"no secret", "", timestamp, Sign("", timestamp, body), body, true},
+		{"no signature", signingSecret, timestamp, "", body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.signingSecret, tt.timestamp, tt.signature, tt.body, now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifySignature error = %v, want %v", err, ErrInvalidSignature)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("VerifySignature: %v", err)
+			}
+		})
+	}
+}
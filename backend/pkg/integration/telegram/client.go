@@ -0,0 +1,96 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultAPIURL = "https://api.telegram.org"
+
+	clientTimeout = 5 * time.Second
+)
+
+// Client calls the Telegram Bot API. Tests use a fake instead of a live bot.
+type Client interface {
+	// SendMessage sends an HTML formatted message to the chat, as a reply to the message if replyTo is set
+	SendMessage(ctx context.Context, chatId int64, text string, replyTo int64) error
+}
+
+// APIClient calls the Bot API with the token of the bot
+type APIClient struct {
+	baseURL    string
+	botToken   string
+	httpClient *http.Client
+}
+
+func NewAPIClient(baseURL string, botToken string) *APIClient {
+	return &APIClient{
+		baseURL:    baseURL,
+		botToken:   botToken,
+		httpClient: &http.Client{Timeout: clientTimeout},
+	}
+}
+
+func (c *APIClient) SendMessage(ctx context.Context, chatId int64, text string, replyTo int64) error {
+	request := map[string]interface{}{
+		"chat_id":    chatId,
+		"text":       text,
+		"parse_mode": "HTML",
+	}
+	if replyTo != 0 {
+		request["reply_parameters"] = map[string]interface{}{"message_id": replyTo, "allow_sending_without_reply": true}
+	}
+	return c.call(ctx, "sendMessage", request)
+}
+
+// SetWebhook points the bot to the webhook, Telegram sends the secret token with every update
+func (c *APIClient) SetWebhook(ctx context.Context, webhookURL string, secretToken string) error {
+	return c.call(ctx, "setWebhook", map[string]interface{}{
+		"url":             webhookURL,
+		"secret_token":    secretToken,
+		"allowed_updates": []string{"message"},
+	})
+}
+
+func (c *APIClient) call(ctx context.Context, method string, request interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/bot"+c.botToken+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// The url of the request contains the bot token, so it is left out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("telegram %s responded with status %d", method, resp.StatusCode)
+	}
+	if !response.OK {
+		return fmt.Errorf("telegram %s failed: %s", method, response.Description)
+	}
+	return nil
+}
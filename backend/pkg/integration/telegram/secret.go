@@ -0,0 +1,19 @@
+package telegram
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+// SecretTokenHeader carries the secret token the webhook was registered with, Telegram does not sign its updates
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+var ErrInvalidSecretToken = errors.New("invalid Telegram secret token")
+
+// VerifySecretToken checks the secret token of an update in constant time
+func VerifySecretToken(expected string, token string) error {
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		return ErrInvalidSecretToken
+	}
+	return nil
+}
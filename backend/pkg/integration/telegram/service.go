@@ -0,0 +1,369 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+const usage = "Usage:\n" +
+	"• Reply to a message with <code>/swear broke prod</code> to add a swear by its sender to the swear jar of this chat\n" +
+	"• <code>/stats</code> shows the swear jar of this chat\n" +
+	"• <code>/trend week</code> shows the swears per day, week or month\n" +
+	"• <code>/clear</code> clears the swear jar\n" +
+	"• <code>/connect code</code> links your Telegram account to the SwearJar account the code was generated for\n" +
+	"• <code>/link code</code> links this chat to the swear jar the code was generated for in SwearJar\n" +
+	"• <code>/unlink</code> unlinks this chat"
+
+const genericReply = "Something went wrong, please try again later."
+
+// trendPeriods maps the periods of `/trend` to the periods of the swear jar trend
+var trendPeriods = map[string]string{
+	"day":   "days",
+	"week":  "weeks",
+	"month": "months",
+}
+
+// Config is the Telegram bot the updates are sent to
+type Config struct {
+	BotToken    string
+	SecretToken string
+	APIURL      string
+	WebhookURL  string // Registered with Telegram on start if set
+}
+
+// LoadConfigFromEnv configures the bot with TELEGRAM_BOT_TOKEN and TELEGRAM_WEBHOOK_SECRET, and optionally
+// TELEGRAM_WEBHOOK_URL to register the webhook. It returns nil if Telegram is not configured.
+func LoadConfigFromEnv() (*Config, error) {
+	botToken, secretToken := os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("TELEGRAM_WEBHOOK_SECRET")
+	if botToken == "" && secretToken == "" {
+		return nil, nil
+	}
+	if botToken == "" || secretToken == "" {
+		return nil, errors.New("TELEGRAM_BOT_TOKEN and TELEGRAM_WEBHOOK_SECRET must both be set")
+	}
+
+	apiURL := os.Getenv("TELEGRAM_API_URL")
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Config{
+		BotToken:    botToken,
+		SecretToken: secretToken,
+		APIURL:      apiURL,
+		WebhookURL:  os.Getenv("TELEGRAM_WEBHOOK_URL"),
+	}, nil
+}
+
+type Service interface {
+	VerifyRequest(secretToken string) error
+	// HandleUpdate runs the command of the update and sends the reply to the chat. Only a failure to send the reply
+	// is returned, errors of the command are replied to the chat.
+	HandleUpdate(ctx context.Context, u Update) error
+}
+
+type service struct {
+	secretToken string
+	c           Client
+	i           integration.Service
+	sj          swearJar.Service
+}
+
+func NewService(config Config, c Client, i integration.Service, sj swearJar.Service) Service {
+	return &service{config.SecretToken, c, i, sj}
+}
+
+func (s *service) VerifyRequest(secretToken string) error {
+	return VerifySecretToken(s.secretToken, secretToken)
+}
+
+func (s *service) HandleUpdate(ctx context.Context, u Update) error {
+	msg := u.Message
+	if msg == nil || msg.From == nil || msg.From.IsBot {
+		return nil
+	}
+	cmd, ok := ParseCommand(msg.Text)
+	if !ok {
+		return nil
+	}
+
+	reply := s.handleCommand(ctx, msg, cmd)
+	if err := s.c.SendMessage(ctx, msg.Chat.Id, reply, msg.MessageId); err != nil {
+		return fmt.Errorf("error replying to Telegram chat {%d}: %w", msg.Chat.Id, err)
+	}
+	return nil
+}
+
+func (s *service) handleCommand(ctx context.Context, msg *Message, cmd Command) string {
+	switch cmd.Name {
+	case "swear":
+		return s.addSwear(ctx, msg, cmd)
+	case "stats":
+		return s.stats(ctx, msg)
+	case "trend":
+		return s.trend(ctx, msg, strings.ToLower(cmd.Args))
+	case "clear":
+		return s.clear(ctx, msg)
+	case "link":
+		return s.link(ctx, msg, cmd.Args)
+	case "unlink":
+		return s.unlink(ctx, msg)
+	case "connect":
+		return s.connect(ctx, msg, cmd.Args)
+	default:
+		return usage
+	}
+}
+
+// connect links the sender to the SwearJar user who generated the account link code
+func (s *service) connect(ctx context.Context, msg *Message, code string) string {
+	if code == "" {
+		return "Generate an account link code in SwearJar, then send <code>/connect code</code>."
+	}
+	if _, err := s.i.LinkAccount(ctx, integration.PlatformTelegram, code, msg.From.externalId()); err != nil {
+		return s.errorReply(err)
+	}
+	return "Your Telegram account is now linked to your SwearJar account."
+}
+
+func (s *service) link(ctx context.Context, msg *Message, code string) string {
+	if code == "" {
+		return "Generate a link code for the swear jar in SwearJar, then send <code>/link code</code> in this chat."
+	}
+
+	link, err := s.i.LinkChannel(ctx, integration.PlatformTelegram, code, "", msg.Chat.chatId())
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	name := "the swear jar"
+	if sj, err := s.sj.GetSwearJarById(ctx, link.SwearJarId, link.LinkedBy); err == nil {
+		name = "<b>" + html.EscapeString(sj.Name) + "</b>"
+	}
+	return "This chat is now linked to " + name + "."
+}
+
+func (s *service) unlink(ctx context.Context, msg *Message) string {
+	link, userId, err := s.resolveChat(ctx, msg)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	if err := s.i.DeleteChannelLink(withPrincipal(ctx, userId), link.SwearJarId, userId, link.LinkId); err != nil {
+		return s.errorReply(err)
+	}
+	return "This chat is no longer linked to a swear jar."
+}
+
+// addSwear handles `/swear broke prod`, sent as a reply to a message of the swearer or mentioning a swearer who
+// has no username. Mentions by username cannot be mapped to a Telegram user.
+func (s *service) addSwear(ctx context.Context, msg *Message, cmd Command) string {
+	description := cmd.Args
+	var swearerTelegram *User
+	if mentioned := msg.mentionedUser(); mentioned != nil {
+		swearerTelegram = mentioned
+		description = withoutMentions(msg)
+	} else if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && !msg.ReplyToMessage.From.IsBot {
+		swearerTelegram = msg.ReplyToMessage.From
+	}
+	if swearerTelegram == nil {
+		return "Reply to a message of who swore with <code>/swear broke prod</code>."
+	}
+
+	// * 1. Map the reporter and the swearer to SwearJar users by their account links
+	link, reporterId, err := s.resolveChat(ctx, msg)
+	if err != nil {
+		return s.errorReply(err)
+	}
+	swearer, err := s.i.GetAccountLink(ctx, integration.PlatformTelegram, swearerTelegram.externalId())
+	if errors.Is(err, integration.ErrAccountNotLinked) {
+		return displayName(swearerTelegram) + " has not linked their Telegram account to SwearJar."
+	} else if err != nil {
+		return s.errorReply(err)
+	}
+
+	ctx = withPrincipal(ctx, reporterId)
+	if isOwner, err := s.sj.IsOwner(ctx, link.SwearJarId, swearer.UserId); err != nil {
+		return s.errorReply(err)
+	} else if !isOwner {
+		return displayName(swearerTelegram) + " is not an owner of the swear jar of this chat."
+	}
+
+	// * 2. Add the swear as the reporter, who must be an owner of the swear jar
+	swear := swearJar.Swear{
+		CreatedAt:        time.Now(),
+		Active:           true,
+		UserId:           swearer.UserId,
+		SwearJarId:       link.SwearJarId,
+		SwearDescription: description,
+		ReportedBy:       reporterId,
+	}
+	if err := s.sj.AddSwear(ctx, swear, reporterId); err != nil {
+		return s.errorReply(err)
+	}
+
+	reply := "Added a swear by " + displayName(swearerTelegram)
+	if description != "" {
+		reply += ": " + html.EscapeString(description)
+	}
+	return reply
+}
+
+func (s *service) stats(ctx context.Context, msg *Message) string {
+	link, userId, err := s.resolveChat(ctx, msg)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	ctx = withPrincipal(ctx, userId)
+	sj, err := s.sj.GetSwearJarById(ctx, link.SwearJarId, userId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+	stats, err := s.sj.SwearJarStats(ctx, link.SwearJarId, userId)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	return fmt.Sprintf("<b>%s</b>\nActive swears: %d\nOwners: %d", html.EscapeString(sj.Name), stats.ActiveSwears, len(sj.Owners))
+}
+
+// trend lists the swears of the last 6 periods with the leaderboard over them
+func (s *service) trend(ctx context.Context, msg *Message, period string) string {
+	if period == "" {
+		period = "week"
+	}
+	trendPeriod, ok := trendPeriods[period]
+	if !ok {
+		return "Send <code>/trend day</code>, <code>/trend week</code> or <code>/trend month</code>."
+	}
+
+	link, userId, err := s.resolveChat(ctx, msg)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	ctx = withPrincipal(ctx, userId)
+	trend, err := s.sj.SwearJarTrend(ctx, link.SwearJarId, userId, trendPeriod)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	lines := []string{"<b>Swears per " + period + "</b>"}
+	for _, point := range trend {
+		total := 0
+		for _, count := range point.Metrics {
+			total += count
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d", html.EscapeString(point.Label), total))
+	}
+
+	leaderboard := swearJar.Leaderboard(trend)
+	if len(leaderboard) > 0 {
+		lines = append(lines, "", "<b>Leaderboard</b>")
+	}
+	for rank, entry := range leaderboard {
+		lines = append(lines, fmt.Sprintf("%d. %s: %d", rank+1, html.EscapeString(entry.Name), entry.Swears))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *service) clear(ctx context.Context, msg *Message) string {
+	link, userId, err := s.resolveChat(ctx, msg)
+	if err != nil {
+		return s.errorReply(err)
+	}
+
+	if err := s.sj.ClearSwearJar(withPrincipal(ctx, userId), link.SwearJarId, userId); err != nil {
+		return s.errorReply(err)
+	}
+	return "The swear jar was cleared by " + displayName(msg.From) + "."
+}
+
+// resolveChat returns the link of the chat and the SwearJar user linked to the sender
+func (s *service) resolveChat(ctx context.Context, msg *Message) (integration.ChannelLink, string, error) {
+	link, err := s.i.GetChannelLink(ctx, integration.PlatformTelegram, "", msg.Chat.chatId())
+	if err != nil {
+		return integration.ChannelLink{}, "", err
+	}
+	account, err := s.i.GetAccountLink(ctx, integration.PlatformTelegram, msg.From.externalId())
+	if err != nil {
+		return integration.ChannelLink{}, "", err
+	}
+	return link, account.UserId, nil
+}
+
+// errorReply explains a domain error to the sender. Any other error is logged and answered with a generic reply.
+func (s *service) errorReply(err error) string {
+	switch {
+	case errors.Is(err, integration.ErrAccountNotLinked):
+		return "Your Telegram account is not linked to SwearJar yet. Generate an account link code in SwearJar, then send <code>/connect code</code> to the bot."
+	case errors.Is(err, integration.ErrChannelNotLinked):
+		return "This chat is not linked to a swear jar yet. Generate a link code in SwearJar, then send <code>/link code</code>."
+	case errors.Is(err, swearJar.ErrNotOwner):
+		return "You are not an owner of the swear jar of this chat."
+	}
+
+	if appErr, ok := apperror.As(err); ok && apperror.KindOf(err) != apperror.KindInternal {
+		return html.EscapeString(capitalize(appErr.Message) + ".")
+	}
+	log.Printf("TelegramService: Error handling command: %v", err)
+	return genericReply
+}
+
+// withoutMentions returns the arguments of the command without the text of its text_mention entities. Entity
+// offsets count UTF-16 code units.
+func withoutMentions(msg *Message) string {
+	text := utf16.Encode([]rune(msg.Text))
+	kept := make([]uint16, 0, len(text))
+	last := 0
+	for _, entity := range msg.Entities {
+		if entity.Type != "text_mention" || entity.Offset < last || entity.Offset+entity.Length > len(text) {
+			continue
+		}
+		kept = append(kept, text[last:entity.Offset]...)
+		last = entity.Offset + entity.Length
+	}
+	kept = append(kept, text[last:]...)
+
+	cmd, _ := ParseCommand(string(utf16.Decode(kept)))
+	return strings.Join(strings.Fields(cmd.Args), " ")
+}
+
+// displayName links to the Telegram user, which mentions them in the reply
+func displayName(u *User) string {
+	name := u.FirstName
+	if u.Username != "" {
+		name = "@" + u.Username
+	}
+	return `<a href="tg://user?id=` + strconv.FormatInt(u.Id, 10) + `">` + html.EscapeString(name) + "</a>"
+}
+
+// withPrincipal marks the actions of the command as made through Telegram in the swear jar activity. Account link
+// codes are generated from protected routes, so the linked user is verified.
+func withPrincipal(ctx context.Context, userId string) context.Context {
+	return authentication.WithPrincipal(ctx, authentication.Principal{
+		UserId:     userId,
+		Verified:   true,
+		AuthMethod: authentication.AuthMethodTelegram,
+	})
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,402 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/integration"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+// fakeClient records the messages the bot sends instead of calling the Bot API
+type fakeClient struct {
+	messages []sentMessage
+}
+
+type sentMessage struct {
+	chatId  int64
+	text    string
+	replyTo int64
+}
+
+func (c *fakeClient) SendMessage(ctx context.Context, chatId int64, text string, replyTo int64) error {
+	c.messages = append(c.messages, sentMessage{chatId, text, replyTo})
+	return nil
+}
+
+// lastReply returns the text of the last message sent, failing the test if none was
+func (c *fakeClient) lastReply(t *testing.T) string {
+	t.Helper()
+	if len(c.messages) == 0 {
+		t.Fatal("no message sent")
+	}
+	return c.messages[len(c.messages)-1].text
+}
+
+// stubIntegrationService links the chats in links and the Telegram users in accounts, and redeems the codes
+type stubIntegrationService struct {
+	integration.Service
+	links        map[string]integration.ChannelLink // by chat id
+	accounts     map[string]integration.AccountLink // by Telegram user id
+	channelCodes map[string]integration.ChannelLink
+	accountCodes map[string]string // user id by code
+}
+
+func (s *stubIntegrationService) GetChannelLink(ctx context.Context, platform integration.Platform, workspaceId string, channelId string) (integration.ChannelLink, error) {
+	link, ok := s.links[channelId]
+	if !ok || platform != integration.PlatformTelegram {
+		return integration.ChannelLink{}, integration.ErrChannelNotLinked
+	}
+	return link, nil
+}
+
+func (s *stubIntegrationService) LinkChannel(ctx context.Context, platform integration.Platform, code string, workspaceId string, channelId string) (integration.ChannelLink, error) {
+	link, ok := s.channelCodes[code]
+	if !ok {
+		return integration.ChannelLink{}, integration.ErrInvalidLinkCode
+	}
+	delete(s.channelCodes, code)
+	link.Platform, link.ChannelId = platform, channelId
+	s.links[channelId] = link
+	return link, nil
+}
+
+func (s *stubIntegrationService) GetAccountLink(ctx context.Context, platform integration.Platform, externalUserId string) (integration.AccountLink, error) {
+	link, ok := s.accounts[externalUserId]
+	if !ok || platform != integration.PlatformTelegram {
+		return integration.AccountLink{}, integration.ErrAccountNotLinked
+	}
+	return link, nil
+}
+
+func (s *stubIntegrationService) LinkAccount(ctx context.Context, platform integration.Platform, code string, externalUserId string) (integration.AccountLink, error) {
+	userId, ok := s.accountCodes[code]
+	if !ok {
+		return integration.AccountLink{}, integration.ErrInvalidLinkCode
+	}
+	delete(s.accountCodes, code)
+	link := integration.AccountLink{Platform: platform, ExternalUserId: externalUserId, UserId: userId}
+	s.accounts[externalUserId] = link
+	return link, nil
+}
+
+// stubSwearJarService is a swear jar with the owners, which only accepts calls made as a Telegram user
+type stubSwearJarService struct {
+	swearJar.Service
+	name    string
+	owners  []string
+	swears  []swearJar.Swear
+	trend   []swearJar.ChartData
+	periods []string
+	cleared bool
+}
+
+func (s *stubSwearJarService) authorize(ctx context.Context, userId string) error {
+	if !slices.Contains(s.owners, userId) {
+		return swearJar.ErrNotOwner
+	}
+	if principal, ok := authentication.PrincipalFromContext(ctx); !ok || principal.AuthMethod != authentication.AuthMethodTelegram || principal.UserId != userId {
+		return errors.New("not called as the Telegram user")
+	}
+	return nil
+}
+
+func (s *stubSwearJarService) IsOwner(ctx context.Context, swearJarId string, userId string) (bool, error) {
+	return slices.Contains(s.owners, userId), nil
+}
+
+func (s *stubSwearJarService) AddSwear(ctx context.Context, swear swearJar.Swear, userId string) error {
+	if err := s.authorize(ctx, userId); err != nil {
+		return err
+	}
+	s.swears = append(s.swears, swear)
+	return nil
+}
+
+func (s *stubSwearJarService) GetSwearJarById(ctx context.Context, swearJarId string, userId string) (swearJar.SwearJarWithOwners, error) {
+	owners := []authentication.UserResponse{}
+	for _, ownerId := range s.owners {
+		owners = append(owners, authentication.UserResponse{UserId: ownerId})
+	}
+	return swearJar.SwearJarWithOwners{SwearJarId: swearJarId, Name: s.name, Owners: owners}, nil
+}
+
+func (s *stubSwearJarService) SwearJarStats(ctx context.Context, swearJarId string, userId string) (swearJar.SwearJarStats, error) {
+	if err := s.authorize(ctx, userId); err != nil {
+		return swearJar.SwearJarStats{}, err
+	}
+	return swearJar.SwearJarStats{ActiveSwears: len(s.swears)}, nil
+}
+
+func (s *stubSwearJarService) SwearJarTrend(ctx context.Context, swearJarId string, userId string, period string) ([]swearJar.ChartData, error) {
+	if err := s.authorize(ctx, userId); err != nil {
+		return nil, err
+	}
+	s.periods = append(s.periods, period)
+	return s.trend, nil
+}
+
+func (s *stubSwearJarService) ClearSwearJar(ctx context.Context, swearJarId string, userId string) error {
+	if err := s.authorize(ctx, userId); err != nil {
+		return err
+	}
+	s.cleared = true
+	return nil
+}
+
+// The Telegram users of the recorded updates: bob reports alice in the Office supergroup
+const (
+	bobTelegramId   = 1111111
+	aliceTelegramId = 2222222
+	officeChatId    = -1001234567890
+)
+
+func newTestService() (*service, *fakeClient, *stubIntegrationService, *stubSwearJarService) {
+	c := &fakeClient{}
+	i := &stubIntegrationService{
+		links: map[string]integration.ChannelLink{
+			"-1001234567890": {LinkId: "link", Platform: integration.PlatformTelegram, ChannelId: "-1001234567890", SwearJarId: "jar"},
+		},
+		accounts: map[string]integration.AccountLink{
+			"1111111": {Platform: integration.PlatformTelegram, ExternalUserId: "1111111", UserId: "bob"},
+			"2222222": {Platform: integration.PlatformTelegram, ExternalUserId: "2222222", UserId: "alice"},
+		},
+		channelCodes: map[string]integration.ChannelLink{},
+		accountCodes: map[string]string{},
+	}
+	sj := &stubSwearJarService{name: "Office <3", owners: []string{"bob", "alice"}}
+	return &service{"secret-token", c, i, sj}, c, i, sj
+}
+
+// readUpdate reads an update recorded from the Bot API
+func readUpdate(t *testing.T, name string) Update {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u Update
+	if err := json.Unmarshal(body, &u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// commandUpdate is a message with the text sent by bob to the chat
+func commandUpdate(chatId int64, text string) Update {
+	return Update{UpdateId: 1, Message: &Message{
+		MessageId: 42,
+		From:      &User{Id: bobTelegramId, FirstName: "Bob", Username: "bob_builds"},
+		Chat:      Chat{Id: chatId, Type: "supergroup", Title: "Office"},
+		Text:      text,
+	}}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	s, _, _, _ := newTestService()
+
+	tests := []struct {
+		token   string
+		wantErr error
+	}{
+		{"secret-token", nil},
+		{"another-token", ErrInvalidSecretToken},
+		{"secret-token ", ErrInvalidSecretToken},
+		{"", ErrInvalidSecretToken},
+	}
+	for _, tt := range tests {
+		if err := s.VerifyRequest(tt.token); !errors.Is(err, tt.wantErr) {
+			t.Errorf("VerifyRequest(%q) = %v, want %v", tt.token, err, tt.wantErr)
+		}
+	}
+
+	// A bot configured without a secret token accepts no update
+	s.secretToken = ""
+	if err := s.VerifyRequest(""); !errors.Is(err, ErrInvalidSecretToken) {
+		t.Errorf("VerifyRequest without a configured token = %v, want %v", err, ErrInvalidSecretToken)
+	}
+}
+
+func TestHandleUpdateAddsSwearByReply(t *testing.T) {
+	s, c, _, sj := newTestService()
+
+	if err := s.HandleUpdate(context.Background(), readUpdate(t, "swear_reply.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sj.swears) != 1 {
+		t.Fatalf("%d swears added, want 1", len(sj.swears))
+	}
+	swear := sj.swears[0]
+	if swear.UserId != "alice" || swear.ReportedBy != "bob" || swear.SwearJarId != "jar" || swear.SwearDescription != "broke prod" || !swear.Active {
+		t.Errorf("added %+v, want a swear by alice reported by bob", swear)
+	}
+	want := sentMessage{officeChatId, `Added a swear by <a href="tg://user?id=2222222">Alice</a>: broke prod`, 1365}
+	if len(c.messages) != 1 || c.messages[0] != want {
+		t.Errorf("sent %+v, want %+v", c.messages, want)
+	}
+}
+
+func TestHandleUpdateAddsSwearByTextMention(t *testing.T) {
+	s, _, _, sj := newTestService()
+
+	if err := s.HandleUpdate(context.Background(), readUpdate(t, "swear_text_mention.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The offsets of the mention count the emoji as two UTF-16 code units
+	if len(sj.swears) != 1 || sj.swears[0].UserId != "alice" || sj.swears[0].SwearDescription != "🤬 broke prod" {
+		t.Errorf("added %+v, want a swear by alice without the mention in the description", sj.swears)
+	}
+}
+
+func TestHandleUpdateRefusesUnlinkedSwearer(t *testing.T) {
+	s, c, i, sj := newTestService()
+	delete(i.accounts, "2222222")
+
+	if err := s.HandleUpdate(context.Background(), readUpdate(t, "swear_reply.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := c.lastReply(t)
+	if reply != `<a href="tg://user?id=2222222">Alice</a> has not linked their Telegram account to SwearJar.` || len(sj.swears) != 0 {
+		t.Errorf("reply = %q, want the swearer reported as unlinked", reply)
+	}
+}
+
+func TestHandleUpdateStats(t *testing.T) {
+	s, c, _, sj := newTestService()
+	sj.swears = make([]swearJar.Swear, 3)
+
+	if err := s.HandleUpdate(context.Background(), commandUpdate(officeChatId, "/stats@SwearJarBot")); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply := c.lastReply(t); reply != "<b>Office &lt;3</b>\nActive swears: 3\nOwners: 2" {
+		t.Errorf("reply = %q, want the stats of the swear jar", reply)
+	}
+}
+
+func TestHandleUpdateTrend(t *testing.T) {
+	s, c, _, sj := newTestService()
+	sj.trend = []swearJar.ChartData{
+		{Label: "Week 41", Metrics: map[string]int{"alice|-|Alice|-|alice@example.com": 2, "bob|-|Bob|-|bob@example.com": 1}},
+		{Label: "Week 42", Metrics: map[string]int{"alice|-|Alice|-|alice@example.com": 3}},
+	}
+
+	if err := s.HandleUpdate(context.Background(), commandUpdate(officeChatId, "/trend Week")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<b>Swears per week</b>\nWeek 41: 3\nWeek 42: 3\n\n<b>Leaderboard</b>\n1. Alice: 5\n2. Bob: 1"
+	if reply := c.lastReply(t); reply != want {
+		t.Errorf("reply = %q, want %q", reply, want)
+	}
+	if !slices.Equal(sj.periods, []string{"weeks"}) {
+		t.Errorf("trend of periods %v, want weeks", sj.periods)
+	}
+
+	if err := s.HandleUpdate(context.Background(), commandUpdate(officeChatId, "/trend year")); err != nil {
+		t.Fatal(err)
+	}
+	if reply := c.lastReply(t); !strings.HasPrefix(reply, "Send <code>/trend day</code>") || len(sj.periods) != 1 {
+		t.Errorf("reply = %q, want the periods listed", reply)
+	}
+}
+
+func TestHandleUpdateClear(t *testing.T) {
+	s, c, _, sj := newTestService()
+
+	if err := s.HandleUpdate(context.Background(), commandUpdate(officeChatId, "/clear")); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply := c.lastReply(t); reply != `The swear jar was cleared by <a href="tg://user?id=1111111">@bob_builds</a>.` || !sj.cleared {
+		t.Errorf("reply = %q, cleared %v, want the swear jar cleared", reply, sj.cleared)
+	}
+}
+
+func TestHandleUpdateRequiresOwner(t *testing.T) {
+	s, c, _, sj := newTestService()
+	sj.owners = []string{"alice"}
+
+	for _, text := range []string{"/stats", "/trend week", "/clear"} {
+		if err := s.HandleUpdate(context.Background(), commandUpdate(officeChatId, text)); err != nil {
+			t.Fatal(err)
+		}
+		if reply := c.lastReply(t); reply != "You are not an owner of the swear jar of this chat." {
+			t.Errorf("%s reply = %q, want the sender refused", text, reply)
+		}
+	}
+	if sj.cleared {
+		t.Error("the swear jar was cleared by a non-owner")
+	}
+}
+
+func TestHandleUpdateRedeemsLinkCodesOnce(t *testing.T) {
+	s, c, i, _ := newTestService()
+	ctx := context.Background()
+	const newChatId = -1009876543210
+	i.channelCodes["7KQ2MX4P"] = integration.ChannelLink{SwearJarId: "jar", LinkedBy: "bob"}
+	i.accountCodes["H3NW8RZT"] = "carol"
+
+	// * 1. The chat is linked by the channel code
+	if err := s.HandleUpdate(ctx, commandUpdate(newChatId, "/link 7KQ2MX4P")); err != nil {
+		t.Fatal(err)
+	}
+	if reply := c.lastReply(t); reply != "This chat is now linked to <b>Office &lt;3</b>." {
+		t.Errorf("reply = %q, want the chat linked", reply)
+	}
+	if link, ok := i.links["-1009876543210"]; !ok || link.SwearJarId != "jar" {
+		t.Errorf("chat links = %v, want the chat linked to the swear jar", i.links)
+	}
+	if err := s.HandleUpdate(ctx, commandUpdate(newChatId, "/link 7KQ2MX4P")); err != nil {
+		t.Fatal(err)
+	}
+	if reply := c.lastReply(t); reply != "Invalid or expired link code." {
+		t.Errorf("reply with a used code = %q, want it refused", reply)
+	}
+
+	// * 2. A Telegram user is linked by the account code
+	carol := commandUpdate(newChatId, "/connect H3NW8RZT")
+	carol.Message.From = &User{Id: 3333333, FirstName: "Carol"}
+	if err := s.HandleUpdate(ctx, carol); err != nil {
+		t.Fatal(err)
+	}
+	if reply := c.lastReply(t); reply != "Your Telegram account is now linked to your SwearJar account." {
+		t.Errorf("reply = %q, want the account linked", reply)
+	}
+	if account, ok := i.accounts["3333333"]; !ok || account.UserId != "carol" {
+		t.Errorf("account links = %v, want carol linked", i.accounts)
+	}
+	mallory := commandUpdate(newChatId, "/connect H3NW8RZT")
+	mallory.Message.From = &User{Id: 4444444, FirstName: "Mallory"}
+	if err := s.HandleUpdate(ctx, mallory); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := i.accounts["4444444"]; ok || c.lastReply(t) != "Invalid or expired link code." {
+		t.Errorf("reply with a used code = %q, want it refused", c.lastReply(t))
+	}
+}
+
+func TestHandleUpdateIgnoresBotsAndChatter(t *testing.T) {
+	s, c, _, _ := newTestService()
+
+	fromBot := commandUpdate(officeChatId, "/clear")
+	fromBot.Message.From.IsBot = true
+	for _, u := range []Update{{UpdateId: 1}, fromBot, commandUpdate(officeChatId, "who broke prod?")} {
+		if err := s.HandleUpdate(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.messages) != 0 {
+		t.Errorf("sent %+v, want no reply", c.messages)
+	}
+}
@@ -0,0 +1,79 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Update is an incoming update, as posted by Telegram to the webhook. Only messages are handled.
+type Update struct {
+	UpdateId int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+type Message struct {
+	MessageId      int64           `json:"message_id"`
+	From           *User           `json:"from"`
+	Chat           Chat            `json:"chat"`
+	Text           string          `json:"text"`
+	Entities       []MessageEntity `json:"entities"`
+	ReplyToMessage *Message        `json:"reply_to_message"`
+}
+
+type User struct {
+	Id        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username"`
+}
+
+type Chat struct {
+	Id    int64  `json:"id"`
+	Type  string `json:"type"` // private, group, supergroup or channel
+	Title string `json:"title"`
+}
+
+// MessageEntity marks a special part of the text. A text_mention carries the mentioned user, which is how users
+// without a username are mentioned.
+type MessageEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	User   *User  `json:"user"`
+}
+
+// Command is a bot command parsed from the text of a message
+type Command struct {
+	Name string // Name of the command without the leading slash or the bot username
+	Args string
+}
+
+// ParseCommand parses `/swear@SwearJarBot broke prod`, the bot username is appended to commands in groups
+func ParseCommand(text string) (Command, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return Command{}, false
+	}
+	name, args, _ := strings.Cut(text[1:], " ")
+	name, _, _ = strings.Cut(name, "@")
+	return Command{Name: strings.ToLower(name), Args: strings.TrimSpace(args)}, name != ""
+}
+
+// mentionedUser returns the user a text_mention of the message points to
+func (m *Message) mentionedUser() *User {
+	for _, entity := range m.Entities {
+		if entity.Type == "text_mention" && entity.User != nil {
+			return entity.User
+		}
+	}
+	return nil
+}
+
+// externalId is the id of the Telegram user as stored in account links
+func (u *User) externalId() string {
+	return strconv.FormatInt(u.Id, 10)
+}
+
+// chatId is the id of the Telegram chat as stored in channel links
+func (c Chat) chatId() string {
+	return strconv.FormatInt(c.Id, 10)
+}
@@ -0,0 +1,201 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+	"github.com/mikeytheong/swearjar/backend/pkg/webhook"
+)
+
+// WebhookPayload is the body of a notification sent to the webhook channel, signed like the deliveries of webhooks
+type WebhookPayload struct {
+	EventId    string    `json:"eventId"`
+	Type       Type      `json:"type"`
+	SwearJarId string    `json:"swearJarId"`
+	ActorId    string    `json:"actorId"`
+	Title      string    `json:"title"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// HandleEvent dispatches the notifications the event raises. They are dispatched in the background, as emails and
+// webhooks may take longer than the change should.
+func (s *service) HandleEvent(ctx context.Context, e swearJar.Event) {
+	switch e.Type {
+	case swearJar.EventSwearAdded, swearJar.EventSwearJarCleared, swearJar.EventMemberJoined:
+		go s.dispatch(e)
+	}
+}
+
+// dispatch sends every notification raised by the event on the channels its user prefers. A channel failing for a
+// user is logged and does not keep the notification from the other channels and users.
+func (s *service) dispatch(e swearJar.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), dispatchTimeout)
+	defer cancel()
+
+	sj, err := s.r.GetSwearJarById(ctx, e.SwearJarId)
+	if err != nil {
+		log.Printf("NotificationService: Error fetching SwearJar ID: %s for %s event: %v", e.SwearJarId, e.Type, err)
+		return
+	}
+
+	inbox := []Notification{}
+	for _, n := range notificationsFor(e, sj) {
+		preferences, err := s.r.GetNotificationPreferences(ctx, n.UserId)
+		if err != nil {
+			log.Printf("NotificationService: Error fetching notification preferences of user {%s}: %v", n.UserId, err)
+			continue
+		}
+
+		for _, channel := range resolveChannels(preferences, sj.SwearJarId, n.Type) {
+			switch channel {
+			case ChannelInApp:
+				inbox = append(inbox, n)
+			case ChannelEmail:
+				if err := s.sendEmail(ctx, sj, n); err != nil {
+					log.Printf("NotificationService: Error emailing %s notification to user {%s}: %v", n.Type, n.UserId, err)
+				}
+			case ChannelWebhook:
+				if err := s.sendWebhook(ctx, n); err != nil {
+					log.Printf("NotificationService: Error sending %s notification to webhook of user {%s}: %v", n.Type, n.UserId, err)
+				}
+			}
+		}
+	}
+
+	if len(inbox) == 0 {
+		return
+	}
+	if _, err := s.r.CreateNotifications(ctx, inbox); err != nil {
+		log.Printf("NotificationService: Error storing %d notification(s) of %s event in db: %v", len(inbox), e.Type, err)
+	}
+}
+
+// notificationsFor returns the notifications the event raises for the owners of the swear jar. Owners are not notified
+// of their own actions.
+func notificationsFor(e swearJar.Event, sj swearJar.SwearJarWithOwners) []Notification {
+	actorName := "Someone"
+	if actor, ok := findOwner(sj, e.ActorId); ok {
+		actorName = actor.Name
+	}
+
+	var recipients []string
+	var t Type
+	var title, body string
+	switch e.Type {
+	case swearJar.EventSwearAdded:
+		recipients, t = []string{e.Data["userId"]}, TypeReported
+		title = fmt.Sprintf("You were reported in %s", sj.Name)
+		body = fmt.Sprintf("%s added a swear by you.", actorName)
+		if description := e.Data["swearDescription"]; description != "" {
+			body = fmt.Sprintf("%s added a swear by you: %s", actorName, description)
+		}
+	case swearJar.EventSwearJarCleared:
+		for _, owner := range sj.Owners {
+			recipients = append(recipients, owner.UserId)
+		}
+		t = TypeJarCleared
+		title = fmt.Sprintf("%s was cleared", sj.Name)
+		body = fmt.Sprintf("%s cleared the swear jar.", actorName)
+	case swearJar.EventMemberJoined:
+		recipients, t = []string{e.Data["userId"]}, TypeInviteReceived
+		title = fmt.Sprintf("You were added to %s", sj.Name)
+		body = fmt.Sprintf("%s added you as an owner of the swear jar.", actorName)
+	default:
+		return nil
+	}
+
+	notifications := []Notification{}
+	for _, userId := range recipients {
+		if userId == "" || userId == e.ActorId {
+			continue
+		}
+		notification, err := NewNotification(userId, t, sj.SwearJarId, e.ActorId, title, body)
+		if err != nil {
+			log.Printf("NotificationService: Error creating %s notification for user {%s}: %v", t, userId, err)
+			continue
+		}
+		notifications = append(notifications, *notification)
+	}
+	return notifications
+}
+
+// sendEmail emails the notification to its user. Users who have not verified their email are skipped, so
+// notifications are not sent to an address which may not be theirs.
+func (s *service) sendEmail(ctx context.Context, sj swearJar.SwearJarWithOwners, n Notification) error {
+	recipient, ok := findOwner(sj, n.UserId)
+	if !ok || !recipient.Verified {
+		return nil
+	}
+
+	data := struct {
+		Name         string
+		Title        string
+		Body         string
+		SwearJarName string
+		SwearJarLink string
+	}{
+		Name:         recipient.Name,
+		Title:        n.Title,
+		Body:         n.Body,
+		SwearJarName: sj.Name,
+		SwearJarLink: os.Getenv("FRONTEND_URL") + "/swearjar/" + sj.SwearJarId + "/view",
+	}
+
+	return s.e.SendEmail(ctx, recipient.Email, recipient.Locale, email.TemplateNotification, data)
+}
+
+// sendWebhook posts the notification to the webhook of its user. Unlike the webhooks of swear jars, a notification
+// which fails to send is not retried.
+func (s *service) sendWebhook(ctx context.Context, n Notification) error {
+	endpoint, err := s.r.GetNotificationWebhook(ctx, n.UserId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+
+	eventId, err := webhook.GenerateEventId()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(WebhookPayload{
+		EventId:    eventId,
+		Type:       n.Type,
+		SwearJarId: n.SwearJarId,
+		ActorId:    n.ActorId,
+		Title:      n.Title,
+		Body:       n.Body,
+		CreatedAt:  n.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.c.Post(ctx, endpoint.URL, endpoint.Secret, string(n.Type), eventId, payload)
+	if err != nil {
+		return err
+	}
+	if !resp.IsSuccess() {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func findOwner(sj swearJar.SwearJarWithOwners, userId string) (authentication.UserResponse, bool) {
+	for _, owner := range sj.Owners {
+		if owner.UserId == userId {
+			return owner, true
+		}
+	}
+	return authentication.UserResponse{}, false
+}
@@ -0,0 +1,70 @@
+package notification
+
+import (
+	"errors"
+	"time"
+)
+
+type Type string
+
+const (
+	TypeReported       Type = "swear.reported"            // Another owner added a swear by the user
+	TypeJarCleared     Type = "swear_jar.cleared"         // Another owner cleared a swear jar of the user
+	TypeInviteReceived Type = "swear_jar.invite_received" // Owners add members directly, so an invite is being added to a swear jar
+)
+
+var Types = []Type{TypeReported, TypeJarCleared, TypeInviteReceived}
+
+func (t Type) IsValid() bool {
+	switch t {
+	case TypeReported, TypeJarCleared, TypeInviteReceived:
+		return true
+	default:
+		return false
+	}
+}
+
+// Notification is an entry of the in-app inbox of a user. It is also what is sent to the email and webhook channels.
+type Notification struct {
+	NotificationId string    `bson:"_id,omitempty"`
+	UserId         string    `bson:"UserId"`
+	Type           Type      `bson:"Type"`
+	SwearJarId     string    `bson:"SwearJarId"`
+	ActorId        string    `bson:"ActorId"`
+	Title          string    `bson:"Title"`
+	Body           string    `bson:"Body"`
+	Read           bool      `bson:"Read"`
+	ReadAt         time.Time `bson:"ReadAt,omitempty"`
+	CreatedAt      time.Time `bson:"CreatedAt"`
+}
+
+func (n *Notification) Validate() error {
+	if n.UserId == "" {
+		return errors.New("user id is required")
+	}
+	if !n.Type.IsValid() {
+		return errors.New("invalid notification type")
+	}
+	if n.Title == "" {
+		return errors.New("title is required")
+	}
+	return nil
+}
+
+func NewNotification(userId string, t Type, swearJarId string, actorId string, title string, body string) (*Notification, error) {
+	notification := &Notification{
+		UserId:     userId,
+		Type:       t,
+		SwearJarId: swearJarId,
+		ActorId:    actorId,
+		Title:      title,
+		Body:       body,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := notification.Validate(); err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
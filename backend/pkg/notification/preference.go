@@ -0,0 +1,112 @@
+package notification
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+type Channel string
+
+const (
+	ChannelInApp   Channel = "in_app"
+	ChannelEmail   Channel = "email"
+	ChannelWebhook Channel = "webhook"
+)
+
+func (c Channel) IsValid() bool {
+	switch c {
+	case ChannelInApp, ChannelEmail, ChannelWebhook:
+		return true
+	default:
+		return false
+	}
+}
+
+// DefaultChannels are the channels a type of notification is sent on to users who did not set a preference for it
+var DefaultChannels = map[Type][]Channel{
+	TypeReported:       {ChannelInApp},
+	TypeJarCleared:     {ChannelInApp},
+	TypeInviteReceived: {ChannelInApp, ChannelEmail},
+}
+
+// Preference is the channels a user receives a type of notification on. A preference without a swear jar applies to
+// every swear jar of the user which has no preference of its own. No channels mutes the notification.
+type Preference struct {
+	PreferenceId string    `bson:"_id,omitempty"`
+	UserId       string    `bson:"UserId"`
+	SwearJarId   string    `bson:"SwearJarId,omitempty"`
+	Type         Type      `bson:"Type"`
+	Channels     []Channel `bson:"Channels"`
+	UpdatedAt    time.Time `bson:"UpdatedAt"`
+}
+
+func (p *Preference) Validate() error {
+	if p.UserId == "" {
+		return apperror.InvalidField("userId", "user id is required")
+	}
+	if !p.Type.IsValid() {
+		return apperror.InvalidField("type", fmt.Sprintf("unknown notification type %q", p.Type))
+	}
+	for _, channel := range p.Channels {
+		if !channel.IsValid() {
+			return apperror.InvalidField("channels", fmt.Sprintf("unknown channel %q", channel))
+		}
+	}
+	return nil
+}
+
+func NewPreference(userId string, swearJarId string, t Type, channels []string) (*Preference, error) {
+	deduplicated := make([]Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !slices.Contains(deduplicated, Channel(channel)) {
+			deduplicated = append(deduplicated, Channel(channel))
+		}
+	}
+
+	preference := &Preference{
+		UserId:     userId,
+		SwearJarId: swearJarId,
+		Type:       t,
+		Channels:   deduplicated,
+		UpdatedAt:  time.Now(),
+	}
+
+	if err := preference.Validate(); err != nil {
+		return nil, err
+	}
+
+	return preference, nil
+}
+
+// resolveChannels returns the channels of the most specific of the preferences of a user for the type of notification
+// in the swear jar: the preference of the swear jar, then the preference for all swear jars, then the default
+func resolveChannels(preferences []Preference, swearJarId string, t Type) []Channel {
+	var fallback *Preference
+	for i := range preferences {
+		p := &preferences[i]
+		if p.Type != t {
+			continue
+		}
+		if p.SwearJarId == swearJarId {
+			return p.Channels
+		}
+		if p.SwearJarId == "" {
+			fallback = p
+		}
+	}
+	if fallback != nil {
+		return fallback.Channels
+	}
+	return DefaultChannels[t]
+}
+
+// WebhookEndpoint is the url a user receives the notifications of the webhook channel at
+type WebhookEndpoint struct {
+	UserId    string    `bson:"_id"`
+	URL       string    `bson:"URL"`
+	Secret    string    `bson:"Secret" json:"-"` // Signs the notifications, only returned when the endpoint is set
+	CreatedAt time.Time `bson:"CreatedAt"`
+}
@@ -0,0 +1,204 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/email"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+	"github.com/mikeytheong/swearjar/backend/pkg/webhook"
+)
+
+const (
+	InboxSize = 50
+
+	dispatchTimeout = 1 * time.Minute
+)
+
+var ErrNotificationNotFound = apperror.NotFound("notification_not_found", "notification not found")
+var ErrPreferenceNotFound = apperror.NotFound("notification_preference_not_found", "notification preference not found")
+var ErrWebhookNotSet = apperror.NotFound("notification_webhook_not_set", "no notification webhook is set")
+
+// Service is the inbox and the preferences of the notifications of users. It is also the dispatcher of notifications:
+// it listens to the events of swear jars and sends the notifications they raise on the channels users prefer.
+type Service interface {
+	swearJar.EventListener
+	GetNotifications(ctx context.Context, userId string, unreadOnly bool) ([]Notification, error)
+	GetUnreadCount(ctx context.Context, userId string) (int, error)
+	MarkAsRead(ctx context.Context, userId string, notificationId string) error
+	MarkAllAsRead(ctx context.Context, userId string) error
+	GetPreferences(ctx context.Context, userId string) ([]Preference, error)
+	SetPreference(ctx context.Context, userId string, swearJarId string, t Type, channels []string) (Preference, error)
+	DeletePreference(ctx context.Context, userId string, preferenceId string) error
+	GetWebhook(ctx context.Context, userId string) (WebhookEndpoint, error)
+	SetWebhook(ctx context.Context, userId string, url string) (WebhookEndpoint, string, error)
+	DeleteWebhook(ctx context.Context, userId string) error
+}
+
+type Repository interface {
+	CreateNotifications(ctx context.Context, notifications []Notification) ([]Notification, error)
+	GetNotificationsByUserId(ctx context.Context, userId string, unreadOnly bool, limit int) ([]Notification, error)
+	CountUnreadNotifications(ctx context.Context, userId string) (int, error)
+	MarkNotificationRead(ctx context.Context, notificationId string, userId string, readAt time.Time) error
+	MarkAllNotificationsRead(ctx context.Context, userId string, readAt time.Time) error
+	GetNotificationPreferences(ctx context.Context, userId string) ([]Preference, error)
+	// UpsertNotificationPreference replaces the preference of the user for the type of notification in the swear jar
+	UpsertNotificationPreference(ctx context.Context, p Preference) (Preference, error)
+	DeleteNotificationPreference(ctx context.Context, preferenceId string, userId string) error
+	GetNotificationWebhook(ctx context.Context, userId string) (WebhookEndpoint, error)
+	UpsertNotificationWebhook(ctx context.Context, w WebhookEndpoint) error
+	DeleteNotificationWebhook(ctx context.Context, userId string) error
+	GetSwearJarById(ctx context.Context, swearJarId string) (swearJar.SwearJarWithOwners, error)
+	GetSwearJarOwners(ctx context.Context, swearJarId string) (owners []string, err error)
+}
+
+type service struct {
+	r Repository
+	e email.Service
+	c *webhook.Client
+	a audit.Logger
+}
+
+func NewService(r Repository, e email.Service, c *webhook.Client, a audit.Logger) Service {
+	return &service{r, e, c, a}
+}
+
+// GetNotifications returns the most recent notifications of the user, newest first
+func (s *service) GetNotifications(ctx context.Context, userId string, unreadOnly bool) ([]Notification, error) {
+	return s.r.GetNotificationsByUserId(ctx, userId, unreadOnly, InboxSize)
+}
+
+func (s *service) GetUnreadCount(ctx context.Context, userId string) (int, error) {
+	return s.r.CountUnreadNotifications(ctx, userId)
+}
+
+func (s *service) MarkAsRead(ctx context.Context, userId string, notificationId string) error {
+	if err := s.r.MarkNotificationRead(ctx, notificationId, userId, time.Now()); err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ErrNotificationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *service) MarkAllAsRead(ctx context.Context, userId string) error {
+	return s.r.MarkAllNotificationsRead(ctx, userId, time.Now())
+}
+
+func (s *service) GetPreferences(ctx context.Context, userId string) ([]Preference, error) {
+	return s.r.GetNotificationPreferences(ctx, userId)
+}
+
+// SetPreference sets the channels the user receives the type of notification on, in the swear jar or in all their
+// swear jars if no swear jar is given
+func (s *service) SetPreference(ctx context.Context, userId string, swearJarId string, t Type, channels []string) (Preference, error) {
+	if swearJarId != "" {
+		if err := s.authorize(ctx, swearJarId, userId); err != nil {
+			return Preference{}, err
+		}
+	}
+
+	preference, err := NewPreference(userId, swearJarId, t, channels)
+	if err != nil {
+		return Preference{}, err
+	}
+	stored, err := s.r.UpsertNotificationPreference(ctx, *preference)
+	if err != nil {
+		log.Printf("NotificationService: Error storing notification preference in db: %v", err)
+		return Preference{}, err
+	}
+	return stored, nil
+}
+
+// DeletePreference deletes the preference, so the less specific preference or the default applies again
+func (s *service) DeletePreference(ctx context.Context, userId string, preferenceId string) error {
+	if err := s.r.DeleteNotificationPreference(ctx, preferenceId, userId); err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ErrPreferenceNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *service) GetWebhook(ctx context.Context, userId string) (WebhookEndpoint, error) {
+	endpoint, err := s.r.GetNotificationWebhook(ctx, userId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return WebhookEndpoint{}, ErrWebhookNotSet
+		}
+		return WebhookEndpoint{}, err
+	}
+	return endpoint, nil
+}
+
+// SetWebhook sets the url the user receives the notifications of the webhook channel at. A new secret is generated
+// every time, and is only returned here.
+func (s *service) SetWebhook(ctx context.Context, userId string, url string) (WebhookEndpoint, string, error) {
+	if url == "" {
+		return WebhookEndpoint{}, "", apperror.InvalidField("url", "url is required")
+	}
+	if err := s.c.ValidateURL(url); err != nil {
+		return WebhookEndpoint{}, "", err
+	}
+
+	secret, err := webhook.GenerateSecret()
+	if err != nil {
+		return WebhookEndpoint{}, "", err
+	}
+	endpoint := WebhookEndpoint{
+		UserId:    userId,
+		URL:       url,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+	if err := s.r.UpsertNotificationWebhook(ctx, endpoint); err != nil {
+		log.Printf("NotificationService: Error storing notification webhook in db: %v", err)
+		return WebhookEndpoint{}, "", err
+	}
+
+	s.logEvent(ctx, userId, audit.ActionNotifyWebhookSet, map[string]string{"url": url})
+	return endpoint, secret, nil
+}
+
+func (s *service) DeleteWebhook(ctx context.Context, userId string) error {
+	if err := s.r.DeleteNotificationWebhook(ctx, userId); err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return ErrWebhookNotSet
+		}
+		return err
+	}
+
+	s.logEvent(ctx, userId, audit.ActionNotifyWebhookDeleted, nil)
+	return nil
+}
+
+// authorize checks the user is an owner of the swear jar
+func (s *service) authorize(ctx context.Context, swearJarId string, userId string) error {
+	owners, err := s.r.GetSwearJarOwners(ctx, swearJarId)
+	if err != nil {
+		return err
+	}
+	for _, ownerId := range owners {
+		if ownerId == userId {
+			return nil
+		}
+	}
+	return swearJar.ErrNotOwner
+}
+
+func (s *service) logEvent(ctx context.Context, userId string, action audit.Action, details map[string]string) {
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetId:   userId,
+		Details:    details,
+	})
+}
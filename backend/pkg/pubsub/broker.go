@@ -0,0 +1,13 @@
+package pubsub
+
+import "context"
+
+// Broker fans the messages published on a topic out to its subscribers. InProcessBroker only reaches the subscribers
+// on the same instance, deployments running several instances plug in a broker backed by a shared message bus
+// (e.g. Redis pub/sub or NATS) instead.
+type Broker interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns the messages published on the topic until unsubscribe is called. The channel is closed when
+	// the subscription ends, which includes the broker dropping a subscriber that falls behind.
+	Subscribe(topic string) (messages <-chan []byte, unsubscribe func())
+}
@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// DefaultBufferSize is how many messages a subscriber can fall behind before it is dropped
+const DefaultBufferSize = 64
+
+type subscriber struct {
+	messages chan []byte
+	once     sync.Once
+}
+
+// InProcessBroker delivers messages to the subscribers of this instance
+type InProcessBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*subscriber]struct{}
+	bufferSize  int
+}
+
+func NewInProcessBroker(bufferSize int) *InProcessBroker {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &InProcessBroker{
+		subscribers: map[string]map[*subscriber]struct{}{},
+		bufferSize:  bufferSize,
+	}
+}
+
+// Publish never blocks on a slow subscriber. A subscriber whose buffer is full is dropped, so it can reconnect
+// and refetch the state instead of silently missing messages.
+func (b *InProcessBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var slow []*subscriber
+	b.mu.RLock()
+	for sub := range b.subscribers[topic] {
+		select {
+		case sub.messages <- payload:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range slow {
+		log.Printf("PubSub: Dropping subscriber of %s which fell behind", topic)
+		b.unsubscribe(topic, sub)
+	}
+	return nil
+}
+
+func (b *InProcessBroker) Subscribe(topic string) (<-chan []byte, func()) {
+	sub := &subscriber{messages: make(chan []byte, b.bufferSize)}
+
+	b.mu.Lock()
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = map[*subscriber]struct{}{}
+	}
+	b.subscribers[topic][sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.messages, func() { b.unsubscribe(topic, sub) }
+}
+
+func (b *InProcessBroker) unsubscribe(topic string, sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Closing under the lock ensures Publish, which sends under the read lock, never sends on a closed channel
+	sub.once.Do(func() {
+		delete(b.subscribers[topic], sub)
+		if len(b.subscribers[topic]) == 0 {
+			delete(b.subscribers, topic)
+		}
+		close(sub.messages)
+	})
+}
@@ -1,6 +1,7 @@
 package search
 
 import (
+	"context"
 	"sort"
 
 	"github.com/agnivade/levenshtein"
@@ -8,11 +9,11 @@ import (
 )
 
 type Service interface {
-	GetTopClosestEmails(query string, currentUserId string) ([]authentication.UserResponse, error)
+	GetTopClosestEmails(ctx context.Context, query string, currentUserId string) ([]authentication.UserResponse, error)
 }
 
 type Repository interface {
-	FindUsersByEmailPattern(query string, maxNumResults int, currentUserId string) ([]authentication.UserResponse, error)
+	FindUsersByEmailPattern(ctx context.Context, query string, maxNumResults int, currentUserId string) ([]authentication.UserResponse, error)
 }
 
 type service struct {
@@ -23,10 +24,10 @@ func NewService(r Repository) Service {
 	return &service{r}
 }
 
-func (s *service) GetTopClosestEmails(query string, currentUserId string) ([]authentication.UserResponse, error) {
+func (s *service) GetTopClosestEmails(ctx context.Context, query string, currentUserId string) ([]authentication.UserResponse, error) {
 	// Retrieve the users that match the regex pattern
 	maxNumResults := 5
-	users, err := s.r.FindUsersByEmailPattern(query, maxNumResults, currentUserId)
+	users, err := s.r.FindUsersByEmailPattern(ctx, query, maxNumResults, currentUserId)
 	if err != nil {
 		return nil, err
 	}
@@ -1,5 +1,10 @@
 package swearJar
 
+import (
+	"sort"
+	"strings"
+)
+
 type ChartData struct {
 	Label   string
 	Metrics map[string]int
@@ -13,3 +18,48 @@ type ChartData struct {
 // 		"userid2": 3
 // 	}
 // }
+
+// metricKeySeparator separates the user id, name and email the trend pipelines key the metrics by
+const metricKeySeparator = "|-|"
+
+// ParseMetricKey splits a metric key of the trend into the id and name of the owner
+func ParseMetricKey(key string) (userId string, name string) {
+	parts := strings.SplitN(key, metricKeySeparator, 3)
+	if len(parts) < 2 {
+		return key, key
+	}
+	return parts[0], parts[1]
+}
+
+// LeaderboardEntry is the number of swears of an owner over the period of a trend
+type LeaderboardEntry struct {
+	UserId string
+	Name   string
+	Swears int
+}
+
+// Leaderboard totals the swears of each owner over the trend, most swears first
+func Leaderboard(trend []ChartData) []LeaderboardEntry {
+	totals := map[string]*LeaderboardEntry{}
+	for _, point := range trend {
+		for key, count := range point.Metrics {
+			userId, name := ParseMetricKey(key)
+			if totals[userId] == nil {
+				totals[userId] = &LeaderboardEntry{UserId: userId, Name: name}
+			}
+			totals[userId].Swears += count
+		}
+	}
+
+	leaderboard := make([]LeaderboardEntry, 0, len(totals))
+	for _, entry := range totals {
+		leaderboard = append(leaderboard, *entry)
+	}
+	sort.Slice(leaderboard, func(i, j int) bool {
+		if leaderboard[i].Swears != leaderboard[j].Swears {
+			return leaderboard[i].Swears > leaderboard[j].Swears
+		}
+		return leaderboard[i].Name < leaderboard[j].Name
+	})
+	return leaderboard
+}
@@ -0,0 +1,48 @@
+package swearJar
+
+import (
+	"context"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventSwearAdded      EventType = "swear.added"
+	EventSwearRemoved    EventType = "swear.removed" // swears cannot be removed one by one yet, clearing the jar removes them all
+	EventSwearJarCleared EventType = "swear_jar.cleared"
+	EventSwearJarRenamed EventType = "swear_jar.renamed"
+	EventMemberJoined    EventType = "member.joined"
+	EventMemberLeft      EventType = "member.left"
+)
+
+// Event is pushed to the owners of a swear jar who are watching it, so they see the changes of other owners
+// without refreshing
+type Event struct {
+	Type       EventType         `json:"type"`
+	SwearJarId string            `json:"swearJarId"`
+	ActorId    string            `json:"actorId"`
+	Data       map[string]string `json:"data,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+// IsValid reports whether the event type is one that is published
+func (t EventType) IsValid() bool {
+	switch t {
+	case EventSwearAdded, EventSwearJarCleared, EventSwearJarRenamed, EventMemberJoined, EventMemberLeft:
+		return true
+	default:
+		return false
+	}
+}
+
+// EventListener is told about the events of every swear jar, e.g. to deliver them to webhooks. HandleEvent is called
+// after the change has been made, so it must not fail the change and should return quickly.
+type EventListener interface {
+	HandleEvent(ctx context.Context, e Event)
+}
+
+// eventTopic is the pub/sub topic the events of the swear jar are published on
+func eventTopic(swearJarId string) string {
+	return "swearjar." + swearJarId
+}
@@ -1,7 +1,22 @@
 package swearJar
 
-func (s *service) IsOwner(swearJarId string, userId string) (bool, error) {
-	owners, err := s.r.GetSwearJarOwners(swearJarId)
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"maps"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+)
+
+// publishTimeout bounds publishing an event, which outlives the request so a change is still pushed to the
+// other owners if the client disconnects right after making it
+const publishTimeout = 5 * time.Second
+
+func (s *service) IsOwner(ctx context.Context, swearJarId string, userId string) (bool, error) {
+	owners, err := s.r.GetSwearJarOwners(ctx, swearJarId)
 	if err != nil {
 		return false, err
 	}
@@ -14,3 +29,50 @@ func (s *service) IsOwner(swearJarId string, userId string) (bool, error) {
 
 	return false, nil
 }
+
+// logEvent records an audit event on the SwearJar, which is shown in the SwearJar activity of its owners.
+// Activity by API tokens and OAuth clients is marked with how the actor was authenticated.
+func (s *service) logEvent(ctx context.Context, userId string, action audit.Action, swearJarId string, details map[string]string) {
+	if principal, ok := authentication.PrincipalFromContext(ctx); ok && principal.AuthMethod != authentication.AuthMethodSession {
+		details = maps.Clone(details)
+		if details == nil {
+			details = map[string]string{}
+		}
+		details["authMethod"] = string(principal.AuthMethod)
+	}
+
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     action,
+		TargetType: audit.TargetSwearJar,
+		TargetId:   swearJarId,
+		SwearJarId: swearJarId,
+		Details:    details,
+	})
+}
+
+// publishEvent pushes the event to the owners watching the swear jar and tells the listeners about it. The change
+// has already been made, so failing to publish is only logged, and watchers catch up by refetching when they reconnect.
+func (s *service) publishEvent(ctx context.Context, userId string, eventType EventType, swearJarId string, data map[string]string) {
+	e := Event{
+		Type:       eventType,
+		SwearJarId: swearJarId,
+		ActorId:    userId,
+		Data:       data,
+		CreatedAt:  time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+	defer cancel()
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("SwearJarService: Error encoding %s event: %v", eventType, err)
+	} else if err := s.b.Publish(ctx, eventTopic(swearJarId), payload); err != nil {
+		log.Printf("SwearJarService: Error publishing %s event of SwearJar ID: %s: %v", eventType, swearJarId, err)
+	}
+
+	for _, l := range s.l {
+		l.HandleEvent(ctx, e)
+	}
+}
@@ -1,51 +1,64 @@
 package swearJar
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"log"
 	"slices"
+	"sync"
 	"time"
 
-	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/pubsub"
 )
 
+var ErrSwearJarNotFound = apperror.NotFound("swear_jar_not_found", "swear jar not found")
+var ErrNotOwner = apperror.Forbidden("not_swear_jar_owner", "user is not an owner of this swear jar")
+
 type Service interface {
-	AddSwear(s Swear, userId string) error
-	CreateSwearJar(Name string, Desc string, Owners []string, userId string) (SwearJarBase, error)
-	UpdateSwearJar(sj SwearJarBase, userId string) error
-	GetSwearJarById(swearJarId string, userId string) (SwearJarWithOwners, error)
-	GetSwearJarsByUserId(userId string) ([]SwearJarWithOwners, error)
-	GetSwearsWithUsers(swearJarId string, userId string) (RecentSwearsWithUsers, error)
-	SwearJarStats(swearJarId string, userId string) (SwearJarStats, error)
-	SwearJarTrend(swearJarId string, userId string, period string) ([]ChartData, error)
-	ClearSwearJar(swearJarId string, userId string) error
+	AddSwear(ctx context.Context, s Swear, userId string) error
+	CreateSwearJar(ctx context.Context, Name string, Desc string, Owners []string, userId string) (SwearJarBase, error)
+	UpdateSwearJar(ctx context.Context, sj SwearJarBase, userId string) error
+	GetSwearJarById(ctx context.Context, swearJarId string, userId string) (SwearJarWithOwners, error)
+	GetSwearJarsByUserId(ctx context.Context, userId string) ([]SwearJarWithOwners, error)
+	GetSwearsWithUsers(ctx context.Context, swearJarId string, userId string) (RecentSwearsWithUsers, error)
+	SwearJarStats(ctx context.Context, swearJarId string, userId string) (SwearJarStats, error)
+	SwearJarTrend(ctx context.Context, swearJarId string, userId string, period string) ([]ChartData, error)
+	ClearSwearJar(ctx context.Context, swearJarId string, userId string) error
+	IsOwner(ctx context.Context, swearJarId string, userId string) (bool, error)
+	Subscribe(ctx context.Context, swearJarId string, userId string) (events <-chan Event, unsubscribe func(), err error)
 }
 
 type Repository interface {
-	AddSwear(Swear) error
-	CreateSwearJar(SwearJarBase) (SwearJarBase, error)
-	UpdateSwearJar(SwearJarBase) error
-	GetSwearJarById(swearJarId string) (SwearJarWithOwners, error)
-	GetSwearJarOwners(swearJarId string) (owners []string, err error)
-	GetSwearJarsByUserId(userId string) ([]SwearJarWithOwners, error)
-	GetSwearsWithUsers(swearJarId string, limit int) (RecentSwearsWithUsers, error)
-	SwearJarStats(swearJarId string) (SwearJarStats, error)
-	SwearJarTrend(swearJarId string, period string, numOfDataPoints int) ([]ChartData, error)
-	ClearSwearJar(swearJarId string, userId string) error
+	AddSwear(ctx context.Context, s Swear) error
+	CreateSwearJar(ctx context.Context, sj SwearJarBase) (SwearJarBase, error)
+	UpdateSwearJar(ctx context.Context, sj SwearJarBase) error
+	GetSwearJarById(ctx context.Context, swearJarId string) (SwearJarWithOwners, error)
+	GetSwearJarOwners(ctx context.Context, swearJarId string) (owners []string, err error)
+	GetSwearJarsByUserId(ctx context.Context, userId string) ([]SwearJarWithOwners, error)
+	GetSwearsWithUsers(ctx context.Context, swearJarId string, limit int) (RecentSwearsWithUsers, error)
+	SwearJarStats(ctx context.Context, swearJarId string) (SwearJarStats, error)
+	SwearJarTrend(ctx context.Context, swearJarId string, period string, numOfDataPoints int) ([]ChartData, error)
+	ClearSwearJar(ctx context.Context, swearJarId string, userId string) error
 }
 
 type service struct {
 	r Repository
+	a audit.Logger
+	b pubsub.Broker
+	l []EventListener
 }
 
-// NewService creates an adding service with the necessary dependencies
-func NewService(r Repository) Service {
-	return &service{r}
+// NewService creates an adding service with the necessary dependencies. The listeners are told about every event
+// published on a swear jar.
+func NewService(r Repository, a audit.Logger, b pubsub.Broker, listeners ...EventListener) Service {
+	return &service{r, a, b, listeners}
 }
 
-func (s *service) CreateSwearJar(Name string, Desc string, Owners []string, userId string) (SwearJarBase, error) {
+func (s *service) CreateSwearJar(ctx context.Context, Name string, Desc string, Owners []string, userId string) (SwearJarBase, error) {
 	if len(Owners) == 0 {
-		return SwearJarBase{}, errors.New("at least one owner is required")
+		return SwearJarBase{}, apperror.InvalidField("owners", "at least one owner is required")
 	}
 
 	now := time.Now()
@@ -59,50 +72,87 @@ func (s *service) CreateSwearJar(Name string, Desc string, Owners []string, user
 		LastUpdatedBy: userId,
 	}
 
-	return s.r.CreateSwearJar(sj)
+	created, err := s.r.CreateSwearJar(ctx, sj)
+	if err != nil {
+		return SwearJarBase{}, err
+	}
+
+	s.logEvent(ctx, userId, audit.ActionSwearJarCreated, created.SwearJarId, map[string]string{"name": Name})
+	return created, nil
 }
 
-func (s *service) UpdateSwearJar(sj SwearJarBase, userId string) error {
+func (s *service) UpdateSwearJar(ctx context.Context, sj SwearJarBase, userId string) error {
 	// Check if user is an existing owner of the SwearJar
-	isOwner, err := s.IsOwner(sj.SwearJarId, userId)
+	previousOwners, err := s.r.GetSwearJarOwners(ctx, sj.SwearJarId)
 	if err != nil {
 		return err
 	}
-	if !isOwner {
-		return errors.New("user is not an owner of this SwearJar")
+	if !slices.Contains(previousOwners, userId) {
+		return ErrNotOwner
 	}
 
 	// User cannot remove themselves as an owner
 	if !slices.Contains(sj.Owners, userId) {
-		return errors.New("User making the request cannot be removed as an owner")
+		return apperror.InvalidField("owners", "user making the request cannot be removed as an owner")
+	}
+
+	previous, err := s.r.GetSwearJarById(ctx, sj.SwearJarId)
+	if err != nil {
+		return err
 	}
 
 	sj.LastUpdatedAt = time.Now()
 	sj.LastUpdatedBy = userId
-	return s.r.UpdateSwearJar(sj)
+	if err := s.r.UpdateSwearJar(ctx, sj); err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, userId, audit.ActionSwearJarUpdated, sj.SwearJarId, map[string]string{"name": sj.Name})
+	if sj.Name != previous.Name {
+		s.publishEvent(ctx, userId, EventSwearJarRenamed, sj.SwearJarId, map[string]string{"name": sj.Name, "previousName": previous.Name})
+	}
+	for _, owner := range sj.Owners {
+		if !slices.Contains(previousOwners, owner) {
+			s.logEvent(ctx, userId, audit.ActionSwearJarOwnerAdded, sj.SwearJarId, map[string]string{"ownerId": owner})
+			s.publishEvent(ctx, userId, EventMemberJoined, sj.SwearJarId, map[string]string{"userId": owner})
+		}
+	}
+	for _, owner := range previousOwners {
+		if !slices.Contains(sj.Owners, owner) {
+			s.logEvent(ctx, userId, audit.ActionSwearJarOwnerRemoved, sj.SwearJarId, map[string]string{"ownerId": owner})
+			s.publishEvent(ctx, userId, EventMemberLeft, sj.SwearJarId, map[string]string{"userId": owner})
+		}
+	}
+	return nil
 }
 
-func (s *service) AddSwear(swear Swear, userId string) error {
-	if isOwner, err := s.IsOwner(swear.SwearJarId, userId); err != nil {
+func (s *service) AddSwear(ctx context.Context, swear Swear, userId string) error {
+	if isOwner, err := s.IsOwner(ctx, swear.SwearJarId, userId); err != nil {
 		return err
 	} else if !isOwner {
 		log.Printf("User ID: %s is not an owner of SwearJar ID: %s", userId, swear.SwearJarId)
-		return authentication.ErrUnauthorized
+		return ErrNotOwner
 	}
 
-	return s.r.AddSwear(swear)
+	if err := s.r.AddSwear(ctx, swear); err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, userId, audit.ActionSwearAdded, swear.SwearJarId, nil)
+	s.publishEvent(ctx, userId, EventSwearAdded, swear.SwearJarId, map[string]string{"userId": swear.UserId, "swearDescription": swear.SwearDescription})
+	return nil
 }
 
-func (s *service) GetSwearsWithUsers(swearJarId string, userId string) (RecentSwearsWithUsers, error) {
-	if isOwner, err := s.IsOwner(swearJarId, userId); err != nil {
+func (s *service) GetSwearsWithUsers(ctx context.Context, swearJarId string, userId string) (RecentSwearsWithUsers, error) {
+	if isOwner, err := s.IsOwner(ctx, swearJarId, userId); err != nil {
 		return RecentSwearsWithUsers{}, err
 	} else if !isOwner {
 		log.Printf("User ID: %s is not an owner of SwearJar ID: %s", userId, swearJarId)
-		return RecentSwearsWithUsers{}, authentication.ErrUnauthorized
+		return RecentSwearsWithUsers{}, ErrNotOwner
 	}
 
 	maxSwearsToFetch := 5
-	data, err := s.r.GetSwearsWithUsers(swearJarId, maxSwearsToFetch)
+	data, err := s.r.GetSwearsWithUsers(ctx, swearJarId, maxSwearsToFetch)
 	if err != nil {
 		return RecentSwearsWithUsers{}, err
 	}
@@ -110,19 +160,19 @@ func (s *service) GetSwearsWithUsers(swearJarId string, userId string) (RecentSw
 	return RecentSwearsWithUsers{Swears: data.Swears, Users: data.Users}, nil
 }
 
-func (s *service) GetSwearJarsByUserId(userId string) ([]SwearJarWithOwners, error) {
-	return s.r.GetSwearJarsByUserId(userId)
+func (s *service) GetSwearJarsByUserId(ctx context.Context, userId string) ([]SwearJarWithOwners, error) {
+	return s.r.GetSwearJarsByUserId(ctx, userId)
 }
 
-func (s *service) GetSwearJarById(swearJarId string, userId string) (SwearJarWithOwners, error) {
-	if isOwner, err := s.IsOwner(swearJarId, userId); err != nil {
+func (s *service) GetSwearJarById(ctx context.Context, swearJarId string, userId string) (SwearJarWithOwners, error) {
+	if isOwner, err := s.IsOwner(ctx, swearJarId, userId); err != nil {
 		return SwearJarWithOwners{}, err
 	} else if !isOwner {
 		log.Printf("User ID: %s is not an owner of SwearJar ID: %s", userId, swearJarId)
-		return SwearJarWithOwners{}, authentication.ErrUnauthorized
+		return SwearJarWithOwners{}, ErrNotOwner
 	}
 
-	swearJar, err := s.r.GetSwearJarById(swearJarId)
+	swearJar, err := s.r.GetSwearJarById(ctx, swearJarId)
 	if err != nil {
 		return SwearJarWithOwners{}, err
 	}
@@ -130,15 +180,15 @@ func (s *service) GetSwearJarById(swearJarId string, userId string) (SwearJarWit
 	return swearJar, nil
 }
 
-func (s *service) SwearJarStats(swearJarId string, userId string) (SwearJarStats, error) {
-	if isOwner, err := s.IsOwner(swearJarId, userId); err != nil {
+func (s *service) SwearJarStats(ctx context.Context, swearJarId string, userId string) (SwearJarStats, error) {
+	if isOwner, err := s.IsOwner(ctx, swearJarId, userId); err != nil {
 		return SwearJarStats{}, err
 	} else if !isOwner {
 		log.Printf("User ID: %s is not an owner of SwearJar ID: %s", userId, swearJarId)
-		return SwearJarStats{}, authentication.ErrUnauthorized
+		return SwearJarStats{}, ErrNotOwner
 	}
 
-	stats, err := s.r.SwearJarStats(swearJarId)
+	stats, err := s.r.SwearJarStats(ctx, swearJarId)
 	if err != nil {
 		return SwearJarStats{}, err
 	}
@@ -146,20 +196,20 @@ func (s *service) SwearJarStats(swearJarId string, userId string) (SwearJarStats
 	return stats, nil
 }
 
-func (s *service) SwearJarTrend(swearJarId string, userId string, period string) ([]ChartData, error) {
+func (s *service) SwearJarTrend(ctx context.Context, swearJarId string, userId string, period string) ([]ChartData, error) {
 	numOfDataPoints := 6
 	if period != "days" && period != "weeks" && period != "months" {
-		return []ChartData{}, errors.New("invalid period")
+		return []ChartData{}, apperror.InvalidField("period", "period must be one of days, weeks or months")
 	}
 
-	if isOwner, err := s.IsOwner(swearJarId, userId); err != nil {
+	if isOwner, err := s.IsOwner(ctx, swearJarId, userId); err != nil {
 		return []ChartData{}, err
 	} else if !isOwner {
 		log.Printf("User ID: %s is not an owner of SwearJar ID: %s", userId, swearJarId)
-		return []ChartData{}, authentication.ErrUnauthorized
+		return []ChartData{}, ErrNotOwner
 	}
 
-	chartData, err := s.r.SwearJarTrend(swearJarId, period, numOfDataPoints)
+	chartData, err := s.r.SwearJarTrend(ctx, swearJarId, period, numOfDataPoints)
 	if err != nil {
 		return []ChartData{}, err
 	}
@@ -167,15 +217,69 @@ func (s *service) SwearJarTrend(swearJarId string, userId string, period string)
 	return chartData, nil
 }
 
-func (s *service) ClearSwearJar(swearJarId string, userId string) error {
-	isOwner, err := s.IsOwner(swearJarId, userId)
+func (s *service) ClearSwearJar(ctx context.Context, swearJarId string, userId string) error {
+	isOwner, err := s.IsOwner(ctx, swearJarId, userId)
 	if err != nil {
 		return err
 	}
 	if !isOwner {
 		log.Printf("User ID: %s is not an owner of SwearJar ID: %s", userId, swearJarId)
-		return authentication.ErrUnauthorized
+		return ErrNotOwner
+	}
+
+	if err := s.r.ClearSwearJar(ctx, swearJarId, userId); err != nil {
+		return err
 	}
 
-	return s.r.ClearSwearJar(swearJarId, userId)
+	s.logEvent(ctx, userId, audit.ActionSwearJarCleared, swearJarId, nil)
+	s.publishEvent(ctx, userId, EventSwearJarCleared, swearJarId, nil)
+	return nil
+}
+
+// Subscribe streams the events of the swear jar to one of its owners until unsubscribe is called. The channel is
+// closed early if the broker drops the subscription.
+func (s *service) Subscribe(ctx context.Context, swearJarId string, userId string) (<-chan Event, func(), error) {
+	if isOwner, err := s.IsOwner(ctx, swearJarId, userId); err != nil {
+		return nil, nil, err
+	} else if !isOwner {
+		log.Printf("User ID: %s is not an owner of SwearJar ID: %s", userId, swearJarId)
+		return nil, nil, ErrNotOwner
+	}
+
+	messages, unsubscribeTopic := s.b.Subscribe(eventTopic(swearJarId))
+	events := make(chan Event)
+	done := make(chan struct{})
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			close(done)
+			unsubscribeTopic()
+		})
+	}
+
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case <-done:
+				return
+			case payload, ok := <-messages:
+				if !ok {
+					return
+				}
+				var e Event
+				if err := json.Unmarshal(payload, &e); err != nil {
+					log.Printf("SwearJarService: Error decoding event of SwearJar ID: %s: %v", swearJarId, err)
+					continue
+				}
+				select {
+				case events <- e:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return events, unsubscribe, nil
 }
@@ -10,4 +10,5 @@ type Swear struct {
 	Active           bool
 	SwearJarId       string
 	SwearDescription string
+	ReportedBy       string // User who recorded the swear, empty for swears recorded before it was tracked
 }
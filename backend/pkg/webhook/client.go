@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+)
+
+const (
+	DefaultClientTimeout = 10 * time.Second
+
+	maxResponseBodySize = 1024
+	userAgent           = "SwearJar-Webhook/1.0"
+)
+
+var ErrPrivateAddress = errors.New("webhook url resolves to a private address")
+
+// Client sends deliveries to webhooks. Unless private addresses are allowed, webhook urls must use https and the client
+// refuses to connect to loopback, private and link-local addresses, so webhooks cannot be used to reach internal
+// services. Allowing private addresses lets the client send to receivers on the same host, such as httptest servers.
+type Client struct {
+	httpClient            *http.Client
+	allowPrivateAddresses bool
+}
+
+func NewClient(timeout time.Duration, allowPrivateAddresses bool) *Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivateAddresses {
+		// Checked on the resolved address of every connection, so a public hostname cannot resolve to a private address
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: timeout,
+				MaxIdleConnsPerHost: 2,
+			},
+			// A redirect counts as a failed delivery, it could point at a private address
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		allowPrivateAddresses: allowPrivateAddresses,
+	}
+}
+
+// LoadClientFromEnv configures the client with WEBHOOK_TIMEOUT (e.g. "10s") and WEBHOOK_ALLOW_PRIVATE_ADDRESSES,
+// which should only be enabled in development
+func LoadClientFromEnv() (*Client, error) {
+	timeout := DefaultClientTimeout
+	if v := os.Getenv("WEBHOOK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT: %s", v)
+		}
+		timeout = d
+	}
+
+	allowPrivateAddresses := false
+	if v := os.Getenv("WEBHOOK_ALLOW_PRIVATE_ADDRESSES"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_ALLOW_PRIVATE_ADDRESSES: %s", v)
+		}
+		allowPrivateAddresses = parsed
+	}
+
+	return NewClient(timeout, allowPrivateAddresses), nil
+}
+
+// ValidateURL checks the url of a webhook when it is registered. Addresses are checked again on every delivery,
+// as the host may resolve differently by then.
+func (c *Client) ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return apperror.InvalidField("url", "invalid url")
+	}
+	if u.Scheme != "https" && !(c.allowPrivateAddresses && u.Scheme == "http") {
+		return apperror.InvalidField("url", "url must use https")
+	}
+	if ip := net.ParseIP(u.Hostname()); !c.allowPrivateAddresses && (u.Hostname() == "localhost" || ip != nil && isPrivateIP(ip)) {
+		return apperror.InvalidField("url", "url must not point at a private address")
+	}
+	return nil
+}
+
+// Response is the outcome of sending a delivery to a webhook which responded
+type Response struct {
+	StatusCode int
+	Body       string
+}
+
+func (r Response) IsSuccess() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Send posts the signed payload of the delivery to the url
+func (c *Client) Send(ctx context.Context, url string, secret string, d Delivery) (Response, error) {
+	return c.Post(ctx, url, secret, string(d.EventType), d.DeliveryId, []byte(d.Payload))
+}
+
+// Post posts the payload to the url, signed with the secret and headed like the deliveries of webhooks, so receivers
+// of other events than those of swear jars verify them the same way
+func (c *Client) Post(ctx context.Context, url string, secret string, eventType string, deliveryId string, payload []byte) (Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, deliveryId)
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), payload))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize))
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{StatusCode: resp.StatusCode, Body: string(body)}, nil
+}
+
+// privatePrefixes are the address blocks webhooks may not be sent to: the ones not routed on the internet, which
+// internal services may listen on, and the multicast, broadcast and documentation ones
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // This network
+	netip.MustParsePrefix("10.0.0.0/8"),      // Private
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),     // Loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // Link-local, including cloud metadata services
+	netip.MustParsePrefix("172.16.0.0/12"),   // Private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("192.168.0.0/16"),  // Private
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // Multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("::/128"),          // Unspecified
+	netip.MustParsePrefix("::1/128"),         // Loopback
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("fc00::/7"),        // Unique local
+	netip.MustParsePrefix("fe80::/10"),       // Link-local
+	netip.MustParsePrefix("ff00::/8"),        // Multicast
+}
+
+// isPrivateIP reports whether the address is in privatePrefixes. IPv4-mapped IPv6 addresses such as ::ffff:10.0.0.1
+// are checked as the IPv4 address they reach.
+func isPrivateIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range privatePrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+// EventTest is only sent by SendTestEvent, so receivers can be checked without changing the swear jar
+const EventTest swearJar.EventType = "webhook.test"
+
+type Status string
+
+const (
+	StatusPending   Status = "Pending"
+	StatusSucceeded Status = "Succeeded"
+	StatusFailed    Status = "Failed"
+)
+
+const (
+	MaxAttempts = 10
+
+	backoffBase = 1 * time.Minute
+	backoffMax  = 6 * time.Hour
+)
+
+// Delivery is an event queued for, or sent to, a webhook. Deliveries are kept as the delivery log of the webhook.
+// A redelivery is a new delivery of the same event, so receivers can deduplicate on the event id.
+type Delivery struct {
+	DeliveryId     string             `bson:"_id,omitempty"`
+	WebhookId      string             `bson:"WebhookId"`
+	SwearJarId     string             `bson:"SwearJarId"`
+	EventId        string             `bson:"EventId"`
+	EventType      swearJar.EventType `bson:"EventType"`
+	Payload        string             `bson:"Payload"` // JSON body sent to the webhook
+	Status         Status             `bson:"Status"`
+	Attempts       int                `bson:"Attempts"`
+	NextAttemptAt  time.Time          `bson:"NextAttemptAt"`
+	LastAttemptAt  time.Time          `bson:"LastAttemptAt"`
+	ResponseStatus int                `bson:"ResponseStatus,omitempty"`
+	ResponseBody   string             `bson:"ResponseBody,omitempty"` // Truncated to maxResponseBodySize
+	Error          string             `bson:"Error,omitempty"`
+	RedeliveryOf   string             `bson:"RedeliveryOf,omitempty"`
+	CreatedAt      time.Time          `bson:"CreatedAt"`
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	EventId string `json:"eventId"`
+	swearJar.Event
+}
+
+func (d *Delivery) Validate() error {
+	if d.WebhookId == "" {
+		return errors.New("webhook id is required")
+	}
+	if d.EventId == "" || d.Payload == "" {
+		return errors.New("event is required")
+	}
+	switch d.Status {
+	case StatusPending, StatusSucceeded, StatusFailed:
+	default:
+		return errors.New("invalid status")
+	}
+	return nil
+}
+
+func NewDelivery(w Webhook, e swearJar.Event) (*Delivery, error) {
+	eventId, err := GenerateEventId()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(Payload{EventId: eventId, Event: e})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	delivery := &Delivery{
+		WebhookId:     w.WebhookId,
+		SwearJarId:    w.SwearJarId,
+		EventId:       eventId,
+		EventType:     e.Type,
+		Payload:       string(payload),
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+
+	if err := delivery.Validate(); err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// Redelivery queues the event of the delivery again, whatever the outcome of the delivery was
+func (d *Delivery) Redelivery() *Delivery {
+	now := time.Now()
+	return &Delivery{
+		WebhookId:     d.WebhookId,
+		SwearJarId:    d.SwearJarId,
+		EventId:       d.EventId,
+		EventType:     d.EventType,
+		Payload:       d.Payload,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		RedeliveryOf:  d.DeliveryId,
+		CreatedAt:     now,
+	}
+}
+
+// backoff returns how long to wait before retrying a delivery which failed the given number of attempts. The delay
+// doubles with every attempt and is jittered, so deliveries which failed together are not retried together.
+func backoff(attempts int) time.Duration {
+	delay := backoffMax
+	if attempts < 20 {
+		delay = min(backoffBase<<(attempts-1), backoffMax)
+	}
+	return delay/2 + rand.N(delay/2)
+}
+
+// GenerateEventId returns a random id for an event, which is kept by its redeliveries
+func GenerateEventId() (string, error) {
+	idBytes := make([]byte, 16)
+	if _, err := cryptorand.Read(idBytes); err != nil {
+		return "", fmt.Errorf("failed to generate event id: %w", err)
+	}
+	return "evt_" + hex.EncodeToString(idBytes), nil
+}
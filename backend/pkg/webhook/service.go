@@ -0,0 +1,388 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+const (
+	DeliveryLogSize   = 50
+	DeliveryRetention = 30 * 24 * time.Hour
+
+	pollInterval = 30 * time.Second
+	queryTimeout = 30 * time.Second // Bounds the queries of the worker outside of a delivery
+	// claimLease is how long a claimed delivery is hidden from other claims. A delivery whose worker was interrupted
+	// by a restart is retried after the lease, which must be longer than a delivery can take.
+	claimLease  = 5 * time.Minute
+	sendTimeout = 1 * time.Minute
+)
+
+var ErrWebhookNotFound = apperror.NotFound("webhook_not_found", "webhook not found")
+var ErrDeliveryNotFound = apperror.NotFound("webhook_delivery_not_found", "webhook delivery not found")
+var ErrTooManyWebhooks = apperror.Conflict("too_many_webhooks", "the swear jar has reached the maximum number of webhooks")
+
+type Service interface {
+	swearJar.EventListener
+	CreateWebhook(ctx context.Context, swearJarId string, userId string, url string, events []string) (Webhook, string, error)
+	GetWebhooks(ctx context.Context, swearJarId string, userId string) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, swearJarId string, userId string, webhookId string) error
+	GetDeliveries(ctx context.Context, swearJarId string, userId string, webhookId string) ([]Delivery, error)
+	Redeliver(ctx context.Context, swearJarId string, userId string, webhookId string, deliveryId string) (Delivery, error)
+	SendTestEvent(ctx context.Context, swearJarId string, userId string, webhookId string) (Delivery, error)
+	Start() (stop func())
+}
+
+type Repository interface {
+	CreateWebhook(ctx context.Context, w Webhook) (Webhook, error)
+	GetWebhook(ctx context.Context, webhookId string) (Webhook, error)
+	GetWebhooksBySwearJarId(ctx context.Context, swearJarId string) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookId string) error
+	CreateWebhookDeliveries(ctx context.Context, deliveries []Delivery) ([]Delivery, error)
+	GetWebhookDelivery(ctx context.Context, deliveryId string) (Delivery, error)
+	GetWebhookDeliveriesByWebhookId(ctx context.Context, webhookId string, limit int) ([]Delivery, error)
+	ClaimWebhookDelivery(ctx context.Context, now time.Time, lease time.Duration) (Delivery, error)
+	UpdateWebhookDelivery(ctx context.Context, d Delivery) error
+	DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) error
+	GetSwearJarOwners(ctx context.Context, swearJarId string) (owners []string, err error)
+}
+
+type service struct {
+	r      Repository
+	c      *Client
+	a      audit.Logger
+	notify chan struct{}
+}
+
+func NewService(r Repository, c *Client, a audit.Logger) Service {
+	return &service{r, c, a, make(chan struct{}, 1)}
+}
+
+// CreateWebhook registers a webhook on the swear jar. The secret which signs its deliveries is only returned here.
+func (s *service) CreateWebhook(ctx context.Context, swearJarId string, userId string, url string, events []string) (Webhook, string, error) {
+	if err := s.authorize(ctx, swearJarId, userId); err != nil {
+		return Webhook{}, "", err
+	}
+
+	if err := s.c.ValidateURL(url); err != nil {
+		return Webhook{}, "", err
+	}
+	webhooks, err := s.r.GetWebhooksBySwearJarId(ctx, swearJarId)
+	if err != nil {
+		return Webhook{}, "", err
+	}
+	if len(webhooks) >= MaxWebhooksPerSwearJar {
+		return Webhook{}, "", ErrTooManyWebhooks
+	}
+
+	webhook, err := NewWebhook(swearJarId, url, events, userId)
+	if err != nil {
+		return Webhook{}, "", err
+	}
+	created, err := s.r.CreateWebhook(ctx, *webhook)
+	if err != nil {
+		log.Printf("WebhookService: Error storing webhook in db: %v", err)
+		return Webhook{}, "", err
+	}
+
+	s.logEvent(ctx, userId, audit.ActionWebhookCreated, created, map[string]string{"url": created.URL})
+	return created, created.Secret, nil
+}
+
+func (s *service) GetWebhooks(ctx context.Context, swearJarId string, userId string) ([]Webhook, error) {
+	if err := s.authorize(ctx, swearJarId, userId); err != nil {
+		return nil, err
+	}
+	return s.r.GetWebhooksBySwearJarId(ctx, swearJarId)
+}
+
+// DeleteWebhook deletes the webhook with its delivery log, which cancels its queued deliveries
+func (s *service) DeleteWebhook(ctx context.Context, swearJarId string, userId string, webhookId string) error {
+	webhook, err := s.getWebhook(ctx, swearJarId, userId, webhookId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.r.DeleteWebhook(ctx, webhook.WebhookId); err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, userId, audit.ActionWebhookDeleted, webhook, map[string]string{"url": webhook.URL})
+	return nil
+}
+
+// GetDeliveries returns the most recent deliveries of the webhook, newest first
+func (s *service) GetDeliveries(ctx context.Context, swearJarId string, userId string, webhookId string) ([]Delivery, error) {
+	webhook, err := s.getWebhook(ctx, swearJarId, userId, webhookId)
+	if err != nil {
+		return nil, err
+	}
+	return s.r.GetWebhookDeliveriesByWebhookId(ctx, webhook.WebhookId, DeliveryLogSize)
+}
+
+// Redeliver queues the event of a delivery again, e.g. after the receiver was fixed
+func (s *service) Redeliver(ctx context.Context, swearJarId string, userId string, webhookId string, deliveryId string) (Delivery, error) {
+	webhook, err := s.getWebhook(ctx, swearJarId, userId, webhookId)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	delivery, err := s.r.GetWebhookDelivery(ctx, deliveryId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return Delivery{}, ErrDeliveryNotFound
+		}
+		return Delivery{}, err
+	}
+	if delivery.WebhookId != webhook.WebhookId {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+
+	created, err := s.r.CreateWebhookDeliveries(ctx, []Delivery{*delivery.Redelivery()})
+	if err != nil {
+		log.Printf("WebhookService: Error storing redelivery of delivery {%s} in db: %v", deliveryId, err)
+		return Delivery{}, err
+	}
+	s.wakeWorker()
+
+	s.logEvent(ctx, userId, audit.ActionWebhookRedelivered, webhook, map[string]string{"deliveryId": deliveryId})
+	return created[0], nil
+}
+
+// SendTestEvent sends a test event to the webhook right away and returns the outcome. It is recorded in the delivery
+// log, but not retried.
+func (s *service) SendTestEvent(ctx context.Context, swearJarId string, userId string, webhookId string) (Delivery, error) {
+	webhook, err := s.getWebhook(ctx, swearJarId, userId, webhookId)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	delivery, err := NewDelivery(webhook, swearJar.Event{
+		Type:       EventTest,
+		SwearJarId: swearJarId,
+		ActorId:    userId,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return Delivery{}, err
+	}
+	// The test delivery is stored as claimed by this request, so the worker does not pick it up
+	delivery.Attempts = 1
+	delivery.NextAttemptAt = time.Now().Add(claimLease)
+	created, err := s.r.CreateWebhookDeliveries(ctx, []Delivery{*delivery})
+	if err != nil {
+		return Delivery{}, err
+	}
+	test := created[0]
+
+	s.attempt(ctx, webhook, &test)
+	if test.Status == StatusPending {
+		test.Status = StatusFailed
+	}
+	if err := s.r.UpdateWebhookDelivery(ctx, test); err != nil {
+		return Delivery{}, err
+	}
+	return test, nil
+}
+
+// HandleEvent queues a delivery of the event to every webhook of the swear jar which subscribes to it
+func (s *service) HandleEvent(ctx context.Context, e swearJar.Event) {
+	webhooks, err := s.r.GetWebhooksBySwearJarId(ctx, e.SwearJarId)
+	if err != nil {
+		log.Printf("WebhookService: Error fetching webhooks of SwearJar ID: %s: %v", e.SwearJarId, err)
+		return
+	}
+
+	deliveries := []Delivery{}
+	for _, webhook := range webhooks {
+		if !webhook.Accepts(e.Type) {
+			continue
+		}
+		delivery, err := NewDelivery(webhook, e)
+		if err != nil {
+			log.Printf("WebhookService: Error creating delivery of %s event to webhook {%s}: %v", e.Type, webhook.WebhookId, err)
+			continue
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if _, err := s.r.CreateWebhookDeliveries(ctx, deliveries); err != nil {
+		log.Printf("WebhookService: Error queueing %s event of SwearJar ID: %s: %v", e.Type, e.SwearJarId, err)
+		return
+	}
+	s.wakeWorker()
+}
+
+// Start runs the worker which sends queued deliveries and deletes old ones from the delivery log, until stop is called
+func (s *service) Start() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		s.processDeliveries(done)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.deleteOldDeliveries()
+				s.processDeliveries(done)
+			case <-s.notify:
+				s.processDeliveries(done)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// wakeWorker wakes up the worker, unless it has already been woken up
+func (s *service) wakeWorker() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *service) deleteOldDeliveries() {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if err := s.r.DeleteWebhookDeliveriesBefore(ctx, time.Now().Add(-DeliveryRetention)); err != nil {
+		log.Printf("WebhookService: Error deleting old webhook deliveries: %v", err)
+	}
+}
+
+// processDeliveries sends the deliveries which are due, until there are none left or the worker is stopped
+func (s *service) processDeliveries(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		delivery, err := s.claimDelivery()
+		if err != nil {
+			if !errors.Is(err, authentication.ErrNoDocuments) {
+				log.Printf("WebhookService: Error claiming webhook delivery: %v", err)
+			}
+			return
+		}
+		s.runDelivery(delivery)
+	}
+}
+
+func (s *service) claimDelivery() (Delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	return s.r.ClaimWebhookDelivery(ctx, time.Now(), claimLease)
+}
+
+func (s *service) runDelivery(delivery Delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	webhook, err := s.r.GetWebhook(ctx, delivery.WebhookId)
+	switch {
+	case errors.Is(err, authentication.ErrNoDocuments):
+		delivery.Status = StatusFailed
+		delivery.Error = "webhook was deleted"
+	case err != nil:
+		// The claim lease expires and the delivery is retried without counting this attempt against it
+		log.Printf("WebhookService: Error fetching webhook {%s}: %v", delivery.WebhookId, err)
+		return
+	default:
+		s.attempt(ctx, webhook, &delivery)
+	}
+
+	// The outcome is stored with a deadline of its own, as the delivery may have run out of time
+	updateCtx, cancelUpdate := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancelUpdate()
+	if err := s.r.UpdateWebhookDelivery(updateCtx, delivery); err != nil {
+		log.Printf("WebhookService: Error storing outcome of webhook delivery {%s}: %v", delivery.DeliveryId, err)
+	}
+}
+
+// attempt sends the delivery and records the outcome on it. A failed delivery is scheduled for a retry with
+// exponential backoff, until it runs out of attempts.
+func (s *service) attempt(ctx context.Context, webhook Webhook, delivery *Delivery) {
+	delivery.LastAttemptAt = time.Now()
+	resp, err := s.c.Send(ctx, webhook.URL, webhook.Secret, *delivery)
+	delivery.ResponseStatus = resp.StatusCode
+	delivery.ResponseBody = resp.Body
+	delivery.Error = ""
+
+	switch {
+	case err == nil && resp.IsSuccess():
+		delivery.Status = StatusSucceeded
+		return
+	case err != nil:
+		delivery.Error = err.Error()
+	default:
+		delivery.Error = "webhook responded with status " + strconv.Itoa(resp.StatusCode)
+	}
+
+	if delivery.Attempts >= MaxAttempts {
+		delivery.Status = StatusFailed
+		log.Printf("WebhookService: Delivery {%s} to webhook {%s} failed after %d attempts: %s", delivery.DeliveryId, webhook.WebhookId, delivery.Attempts, delivery.Error)
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(backoff(delivery.Attempts))
+}
+
+// authorize checks the user is an owner of the swear jar, owners manage its webhooks
+func (s *service) authorize(ctx context.Context, swearJarId string, userId string) error {
+	owners, err := s.r.GetSwearJarOwners(ctx, swearJarId)
+	if err != nil {
+		return err
+	}
+	for _, ownerId := range owners {
+		if ownerId == userId {
+			return nil
+		}
+	}
+	return swearJar.ErrNotOwner
+}
+
+// getWebhook returns the webhook if it belongs to the swear jar and the user is an owner of the swear jar
+func (s *service) getWebhook(ctx context.Context, swearJarId string, userId string, webhookId string) (Webhook, error) {
+	if err := s.authorize(ctx, swearJarId, userId); err != nil {
+		return Webhook{}, err
+	}
+
+	webhook, err := s.r.GetWebhook(ctx, webhookId)
+	if err != nil {
+		if errors.Is(err, authentication.ErrNoDocuments) {
+			return Webhook{}, ErrWebhookNotFound
+		}
+		return Webhook{}, err
+	}
+	if webhook.SwearJarId != swearJarId {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+// logEvent records the change to a webhook in the activity of its swear jar
+func (s *service) logEvent(ctx context.Context, userId string, action audit.Action, webhook Webhook, details map[string]string) {
+	s.a.Log(ctx, audit.Event{
+		ActorId:    userId,
+		Action:     action,
+		TargetType: audit.TargetWebhook,
+		TargetId:   webhook.WebhookId,
+		SwearJarId: webhook.SwearJarId,
+		Details:    details,
+	})
+}
@@ -0,0 +1,331 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/audit"
+	"github.com/mikeytheong/swearjar/backend/pkg/authentication"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+// fakeRepository keeps webhooks and deliveries in memory. Claims work like those of the mongo repository: the due
+// delivery is counted as attempted and hidden for the lease.
+type fakeRepository struct {
+	mu         sync.Mutex
+	webhooks   map[string]Webhook
+	deliveries []*Delivery
+	owners     map[string][]string // by swear jar id
+	nextId     int
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{webhooks: map[string]Webhook{}, owners: map[string][]string{}}
+}
+
+func (r *fakeRepository) newId() string {
+	r.nextId++
+	return strconv.Itoa(r.nextId)
+}
+
+func (r *fakeRepository) CreateWebhook(ctx context.Context, w Webhook) (Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w.WebhookId = r.newId()
+	r.webhooks[w.WebhookId] = w
+	return w, nil
+}
+
+func (r *fakeRepository) GetWebhook(ctx context.Context, webhookId string) (Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.webhooks[webhookId]
+	if !ok {
+		return Webhook{}, authentication.ErrNoDocuments
+	}
+	return w, nil
+}
+
+func (r *fakeRepository) GetWebhooksBySwearJarId(ctx context.Context, swearJarId string) ([]Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhooks := []Webhook{}
+	for _, w := range r.webhooks {
+		if w.SwearJarId == swearJarId {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (r *fakeRepository) DeleteWebhook(ctx context.Context, webhookId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.webhooks, webhookId)
+	return nil
+}
+
+func (r *fakeRepository) CreateWebhookDeliveries(ctx context.Context, deliveries []Delivery) ([]Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created := make([]Delivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		d.DeliveryId = r.newId()
+		r.deliveries = append(r.deliveries, &d)
+		created = append(created, d)
+	}
+	return created, nil
+}
+
+func (r *fakeRepository) GetWebhookDelivery(ctx context.Context, deliveryId string) (Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d := r.delivery(deliveryId); d != nil {
+		return *d, nil
+	}
+	return Delivery{}, authentication.ErrNoDocuments
+}
+
+func (r *fakeRepository) GetWebhookDeliveriesByWebhookId(ctx context.Context, webhookId string, limit int) ([]Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deliveries := []Delivery{}
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if r.deliveries[i].WebhookId == webhookId {
+			deliveries = append(deliveries, *r.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *fakeRepository) ClaimWebhookDelivery(ctx context.Context, now time.Time, lease time.Duration) (Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		if d.Status == StatusPending && !d.NextAttemptAt.After(now) {
+			d.NextAttemptAt = now.Add(lease)
+			d.Attempts++
+			return *d, nil
+		}
+	}
+	return Delivery{}, authentication.ErrNoDocuments
+}
+
+func (r *fakeRepository) UpdateWebhookDelivery(ctx context.Context, d Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.delivery(d.DeliveryId)
+	if stored == nil {
+		return authentication.ErrNoDocuments
+	}
+	*stored = d
+	return nil
+}
+
+func (r *fakeRepository) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func (r *fakeRepository) GetSwearJarOwners(ctx context.Context, swearJarId string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.owners[swearJarId], nil
+}
+
+func (r *fakeRepository) delivery(deliveryId string) *Delivery {
+	for _, d := range r.deliveries {
+		if d.DeliveryId == deliveryId {
+			return d
+		}
+	}
+	return nil
+}
+
+// makeDue makes the pending deliveries due, as if their retry delay had passed
+func (r *fakeRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		d.NextAttemptAt = time.Now()
+	}
+}
+
+type fakeAuditLogger struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (a *fakeAuditLogger) Log(ctx context.Context, e audit.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, e)
+}
+
+// newTestService returns a service whose client may send to the receiver, with a webhook of the swear jar "jar"
+// owned by "alex" pointing at it
+func newTestService(t *testing.T, rec *receiver) (*service, *fakeRepository, Webhook) {
+	t.Helper()
+	r := newFakeRepository()
+	r.owners["jar"] = []string{"alex"}
+	s := &service{r, NewClient(5*time.Second, true), &fakeAuditLogger{}, make(chan struct{}, 1)}
+
+	webhook, _, err := s.CreateWebhook(context.Background(), "jar", "alex", rec.URL, nil)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return s, r, webhook
+}
+
+// neverDone runs the worker until no delivery is due
+var neverDone = make(chan struct{})
+
+func TestDeliveryIsSigned(t *testing.T) {
+	rec := newReceiver(t)
+	s, r, webhook := newTestService(t, rec)
+
+	s.HandleEvent(context.Background(), swearJar.Event{Type: swearJar.EventSwearAdded, SwearJarId: "jar", ActorId: "alex"})
+	s.processDeliveries(neverDone)
+
+	requests := rec.received()
+	if len(requests) != 1 {
+		t.Fatalf("%d requests received, want 1", len(requests))
+	}
+	if err := VerifySignature(webhook.Secret, requests[0].header.Get(SignatureHeader), requests[0].body, time.Now(), DefaultSignatureTolerance); err != nil {
+		t.Errorf("VerifySignature = %v, want the delivery signed with the secret of the webhook", err)
+	}
+	if d := r.deliveries[0]; d.Status != StatusSucceeded || d.Attempts != 1 || d.ResponseStatus != http.StatusOK {
+		t.Errorf("delivery = %+v, want it succeeded on the first attempt", d)
+	}
+}
+
+func TestDeliveryIsRetriedOnServerError(t *testing.T) {
+	rec := newReceiver(t)
+	rec.respondWith(http.StatusBadGateway)
+	s, r, _ := newTestService(t, rec)
+
+	s.HandleEvent(context.Background(), swearJar.Event{Type: swearJar.EventSwearAdded, SwearJarId: "jar", ActorId: "alex"})
+
+	// Each retry waits twice as long as the one before, jittered by up to half
+	for attempt := 1; attempt <= 3; attempt++ {
+		before := time.Now()
+		s.processDeliveries(neverDone)
+
+		d := r.deliveries[0]
+		if d.Status != StatusPending || d.Attempts != attempt || d.ResponseStatus != http.StatusBadGateway {
+			t.Fatalf("delivery after attempt %d = %+v, want it pending a retry", attempt, d)
+		}
+		if d.Error != "webhook responded with status 502" {
+			t.Errorf("Error = %q, want the status of the response", d.Error)
+		}
+		delay := backoffBase << (attempt - 1)
+		if d.NextAttemptAt.Before(before.Add(delay/2)) || d.NextAttemptAt.After(time.Now().Add(delay)) {
+			t.Errorf("retry %d scheduled in %v, want between %v and %v", attempt, d.NextAttemptAt.Sub(before), delay/2, delay)
+		}
+		if len(rec.received()) != attempt {
+			t.Fatalf("%d requests received, want %d: the retry was sent before it was due", len(rec.received()), attempt)
+		}
+		r.makeDue()
+	}
+
+	// The receiver recovers
+	rec.respondWith(http.StatusOK)
+	s.processDeliveries(neverDone)
+	if d := r.deliveries[0]; d.Status != StatusSucceeded || d.Attempts != 4 || d.Error != "" {
+		t.Errorf("delivery = %+v, want it succeeded on the fourth attempt", d)
+	}
+}
+
+func TestDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	rec := newReceiver(t)
+	rec.respondWith(http.StatusInternalServerError)
+	s, r, _ := newTestService(t, rec)
+
+	s.HandleEvent(context.Background(), swearJar.Event{Type: swearJar.EventSwearAdded, SwearJarId: "jar", ActorId: "alex"})
+	for i := 0; i < MaxAttempts+2; i++ {
+		s.processDeliveries(neverDone)
+		r.makeDue()
+	}
+
+	if d := r.deliveries[0]; d.Status != StatusFailed || d.Attempts != MaxAttempts {
+		t.Errorf("delivery = %+v, want it failed after %d attempts", d, MaxAttempts)
+	}
+	if len(rec.received()) != MaxAttempts {
+		t.Errorf("%d requests received, want %d", len(rec.received()), MaxAttempts)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	rec := newReceiver(t)
+	rec.respondWith(http.StatusServiceUnavailable)
+	s, r, webhook := newTestService(t, rec)
+	ctx := context.Background()
+
+	s.HandleEvent(ctx, swearJar.Event{Type: swearJar.EventSwearAdded, SwearJarId: "jar", ActorId: "alex"})
+	s.processDeliveries(neverDone)
+	failed := *r.deliveries[0]
+
+	// The receiver is fixed and the owner redelivers the event rather than waiting for the retry
+	rec.respondWith(http.StatusOK)
+	redelivery, err := s.Redeliver(ctx, "jar", "alex", webhook.WebhookId, failed.DeliveryId)
+	if err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if redelivery.DeliveryId == failed.DeliveryId || redelivery.EventId != failed.EventId || redelivery.RedeliveryOf != failed.DeliveryId {
+		t.Errorf("redelivery = %+v, want a new delivery of event %s", redelivery, failed.EventId)
+	}
+	s.processDeliveries(neverDone)
+
+	stored, err := r.GetWebhookDelivery(ctx, redelivery.DeliveryId)
+	if err != nil || stored.Status != StatusSucceeded {
+		t.Errorf("redelivery = %+v, %v, want it succeeded", stored, err)
+	}
+	requests := rec.received()
+	if len(requests) != 2 || string(requests[1].body) != failed.Payload {
+		t.Errorf("received %d requests, want the payload redelivered", len(requests))
+	}
+
+	if _, err := s.Redeliver(ctx, "jar", "sam", webhook.WebhookId, failed.DeliveryId); !errors.Is(err, swearJar.ErrNotOwner) {
+		t.Errorf("Redeliver by a non-owner error = %v, want %v", err, swearJar.ErrNotOwner)
+	}
+	if _, err := s.Redeliver(ctx, "jar", "alex", webhook.WebhookId, "unknown"); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("Redeliver of an unknown delivery error = %v, want %v", err, ErrDeliveryNotFound)
+	}
+}
+
+func TestSendTestEvent(t *testing.T) {
+	rec := newReceiver(t)
+	s, r, webhook := newTestService(t, rec)
+	ctx := context.Background()
+
+	test, err := s.SendTestEvent(ctx, "jar", "alex", webhook.WebhookId)
+	if err != nil {
+		t.Fatalf("SendTestEvent: %v", err)
+	}
+	if test.EventType != EventTest || test.Status != StatusSucceeded || test.Attempts != 1 {
+		t.Errorf("SendTestEvent = %+v, want a succeeded test delivery", test)
+	}
+	requests := rec.received()
+	if len(requests) != 1 || requests[0].header.Get(EventHeader) != string(EventTest) {
+		t.Fatalf("received %v, want the test event", requests)
+	}
+
+	// A failed test is recorded, but not retried by the worker
+	rec.respondWith(http.StatusInternalServerError)
+	test, err = s.SendTestEvent(ctx, "jar", "alex", webhook.WebhookId)
+	if err != nil {
+		t.Fatalf("SendTestEvent: %v", err)
+	}
+	if test.Status != StatusFailed || test.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("SendTestEvent = %+v, want a failed test delivery", test)
+	}
+	r.makeDue()
+	s.processDeliveries(neverDone)
+	if len(rec.received()) != 2 {
+		t.Errorf("%d requests received, want the failed test not retried", len(rec.received()))
+	}
+}
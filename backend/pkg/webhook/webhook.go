@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mikeytheong/swearjar/backend/pkg/apperror"
+	"github.com/mikeytheong/swearjar/backend/pkg/swearJar"
+)
+
+const (
+	MaxWebhooksPerSwearJar = 10
+
+	secretPrefix = "whsec_"
+)
+
+// Webhook receives the events of a swear jar. An empty Events filter subscribes to every event.
+type Webhook struct {
+	WebhookId  string               `bson:"_id,omitempty"`
+	SwearJarId string               `bson:"SwearJarId"`
+	URL        string               `bson:"URL"`
+	Events     []swearJar.EventType `bson:"Events"`
+	Secret     string               `bson:"Secret" json:"-"` // Signs the deliveries, only returned when the webhook is created
+	CreatedAt  time.Time            `bson:"CreatedAt"`
+	CreatedBy  string               `bson:"CreatedBy"`
+}
+
+func (w *Webhook) Validate() error {
+	if w.SwearJarId == "" {
+		return apperror.InvalidField("swearJarId", "swear jar id is required")
+	}
+	if w.URL == "" {
+		return apperror.InvalidField("url", "url is required")
+	}
+	for _, eventType := range w.Events {
+		if !eventType.IsValid() {
+			return apperror.InvalidField("events", fmt.Sprintf("unknown event %q", eventType))
+		}
+	}
+	return nil
+}
+
+// Accepts reports whether the webhook subscribes to the event type
+func (w *Webhook) Accepts(eventType swearJar.EventType) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+func NewWebhook(swearJarId string, url string, events []string, userId string) (*Webhook, error) {
+	eventTypes := make([]swearJar.EventType, 0, len(events))
+	for _, event := range events {
+		if !slices.Contains(eventTypes, swearJar.EventType(event)) {
+			eventTypes = append(eventTypes, swearJar.EventType(event))
+		}
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &Webhook{
+		SwearJarId: swearJarId,
+		URL:        url,
+		Events:     eventTypes,
+		Secret:     secret,
+		CreatedAt:  time.Now(),
+		CreatedBy:  userId,
+	}
+
+	if err := webhook.Validate(); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+// GenerateSecret returns a random secret to sign payloads with
+func GenerateSecret() (string, error) {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(secretBytes), nil
+}
@@ -29,12 +29,16 @@ export async function apiRequest({
     // Create the Cookie header string from the extracted cookies
     const cookieHeader = cookies.map(cookie => `${cookie.name}=${cookie.value}`).join('; ');
 
+    // The backend requires the csrf token bound to the session in a header on state changing requests
+    const csrfToken = cookies.find(cookie => cookie.name === 'csrf_token')?.value;
+
     const config = {
         method: method,
         headers: {
             'Content-Type': 'application/json',
             'Origin': `${process.env.AUTH_URL}`,
             ...(cookieHeader && { 'Cookie': cookieHeader }), // Conditionally add the Cookie header
+            ...(csrfToken && { 'X-CSRF-Token': csrfToken }),
         },
         credentials: 'include',
         ...(body && { body: JSON.stringify(body) }), // Conditionally include the body